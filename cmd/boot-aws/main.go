@@ -15,6 +15,7 @@ import (
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/internal/test"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/cloud/awscloud"
 	"github.com/osbuild/images/pkg/platform"
 )
@@ -99,6 +100,18 @@ func getOptionalStringFlag(flags *pflag.FlagSet, name string) (*string, error) {
 	return &value, nil
 }
 
+// uploadResumable uploads the image with a multipart upload that is
+// recorded in the state file, an interrupted upload is continued when
+// rerun with the same state file
+func uploadResumable(a *awscloud.AWS, filename, bucketName, keyName, stateFile string) (string, error) {
+	journal, err := cloud.OpenUploadJournal(stateFile)
+	if err != nil {
+		return "", err
+	}
+	defer journal.Close()
+	return a.UploadResumable(filename, bucketName, keyName, journal)
+}
+
 func doSetup(a *awscloud.AWS, filename string, flags *pflag.FlagSet, res *resources) error {
 	username, err := flags.GetString("username")
 	if err != nil {
@@ -123,12 +136,26 @@ func doSetup(a *awscloud.AWS, filename string, flags *pflag.FlagSet, res *resour
 		return err
 	}
 
-	uploadOutput, err := a.Upload(filename, bucketName, keyName)
+	stateFile, err := flags.GetString("state-file")
 	if err != nil {
-		return fmt.Errorf("Upload() failed: %s", err.Error())
+		return err
+	}
+
+	var location string
+	if stateFile != "" {
+		location, err = uploadResumable(a, filename, bucketName, keyName, stateFile)
+		if err != nil {
+			return fmt.Errorf("UploadResumable() failed: %s", err.Error())
+		}
+	} else {
+		uploadOutput, err := a.Upload(filename, bucketName, keyName)
+		if err != nil {
+			return fmt.Errorf("Upload() failed: %s", err.Error())
+		}
+		location = uploadOutput.Location
 	}
 
-	fmt.Printf("file uploaded to %s\n", uploadOutput.Location)
+	fmt.Printf("file uploaded to %s\n", location)
 
 	var bootMode *platform.BootMode
 	bootModeFlag, err := flags.GetString("boot-mode")
@@ -443,6 +470,7 @@ func setupCLI() *cobra.Command {
 	rootFlags.String("username", "", "name of the user to create on the system")
 	rootFlags.String("ssh-pubkey", "", "path to user's public ssh key")
 	rootFlags.String("ssh-privkey", "", "path to user's private ssh key")
+	rootFlags.String("state-file", "", "file to record the upload progress in, an interrupted upload is resumed when rerun with the same file")
 
 	exitCheck(rootCmd.MarkPersistentFlagRequired("access-key-id"))
 	exitCheck(rootCmd.MarkPersistentFlagRequired("secret-access-key"))
@@ -12,9 +12,12 @@ import (
 	"github.com/osbuild/images/internal/buildconfig"
 	"github.com/osbuild/images/internal/cmdutil"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/artifact"
+	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distrofactory"
 	"github.com/osbuild/images/pkg/manifestgen"
 	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/packagepolicy"
 	"github.com/osbuild/images/pkg/reporegistry"
 	"github.com/osbuild/images/pkg/rhsm/facts"
 	"github.com/osbuild/images/pkg/rpmmd"
@@ -40,9 +43,15 @@ func run() error {
 	// image selection args
 	var distroName, imgTypeName, configFile string
 	flag.StringVar(&distroName, "distro", "", "distribution (required)")
-	flag.StringVar(&imgTypeName, "type", "", "image type name (required)")
+	flag.StringVar(&imgTypeName, "type", "", "image type name, a comma-separated list of compatible disk image types is built from a single OS tree (required)")
 	flag.StringVar(&configFile, "config", "", "build config file (required)")
 
+	var packagePoliciesFile string
+	flag.StringVar(&packagePoliciesFile, "package-policies", "", "json file with package policies to check the depsolved packages against")
+
+	var diskSpaceCheck string
+	flag.StringVar(&diskSpaceCheck, "disk-space-check", "", "estimate the disk usage before building and \"warn\", \"error\" or \"grow\" the partitions if it does not fit")
+
 	flag.Parse()
 
 	if distroName == "" || imgTypeName == "" || configFile == "" {
@@ -65,6 +74,19 @@ func run() error {
 		return err
 	}
 
+	var packagePolicies []packagepolicy.Policy
+	if packagePoliciesFile != "" {
+		f, err := os.Open(packagePoliciesFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		packagePolicies, err = packagepolicy.Load(f)
+		if err != nil {
+			return err
+		}
+	}
+
 	if err := os.MkdirAll(outputDir, 0777); err != nil {
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
@@ -82,15 +104,20 @@ func run() error {
 		return fmt.Errorf("invalid arch name %q for distro %q: %w", archName, distroName, err)
 	}
 
-	buildName := fmt.Sprintf("%s-%s-%s-%s", u(distroName), u(archName), u(imgTypeName), u(config.Name))
+	imgTypeNames := strings.Split(imgTypeName, ",")
+	buildName := fmt.Sprintf("%s-%s-%s-%s", u(distroName), u(archName), u(strings.Join(imgTypeNames, "+")), u(config.Name))
 	buildDir := filepath.Join(outputDir, buildName)
 	if err := os.MkdirAll(buildDir, 0777); err != nil {
 		return fmt.Errorf("failed to create target directory: %w", err)
 	}
 
-	imgType, err := archi.GetImageType(imgTypeName)
-	if err != nil {
-		return fmt.Errorf("invalid image type %q for distro %q and arch %q: %w", imgTypeName, distroName, archName, err)
+	var imgTypes []distro.ImageType
+	for _, name := range imgTypeNames {
+		imgType, err := archi.GetImageType(name)
+		if err != nil {
+			return fmt.Errorf("invalid image type %q for distro %q and arch %q: %w", name, distroName, archName, err)
+		}
+		imgTypes = append(imgTypes, imgType)
 	}
 
 	// NOTE: we always put the repositories to be used into the allRepos slice, instead of passing the
@@ -110,10 +137,10 @@ func run() error {
 		if err != nil {
 			return fmt.Errorf("failed to load repositories from %q: %w", repositories, err)
 		}
-		allRepos, err = reporeg.ReposByImageTypeName(distribution.Name(), archName, imgTypeName)
+		allRepos, err = reporeg.ReposByImageTypeName(distribution.Name(), archName, imgTypeNames[0])
 		if err != nil {
 			return fmt.Errorf(
-				"failed to get repositories for %s/%s/%s: %w", distribution.Name(), archName, imgTypeName, err)
+				"failed to get repositories for %s/%s/%s: %w", distribution.Name(), archName, imgTypeNames[0], err)
 		}
 	}
 	seedArg, err := cmdutil.SeedArgFor(config, distribution.Name(), archName)
@@ -128,10 +155,12 @@ func run() error {
 
 	fmt.Printf("Generating manifest for %s: ", config.Name)
 	manifestOpts := manifestgen.Options{
-		Cachedir:       filepath.Join(rpmCacheRoot, archName+distribution.Name()),
-		WarningsOutput: os.Stderr,
-		OverrideRepos:  allRepos,
-		CustomSeed:     &seedArg,
+		Cachedir:        filepath.Join(rpmCacheRoot, archName+distribution.Name()),
+		WarningsOutput:  os.Stderr,
+		OverrideRepos:   allRepos,
+		CustomSeed:      &seedArg,
+		PackagePolicies: packagePolicies,
+		DiskSpaceCheck:  manifestgen.DiskSpaceCheckMode(diskSpaceCheck),
 	}
 	if archName != arch.Current().String() {
 		manifestOpts.UseBootstrapContainer = true
@@ -148,7 +177,18 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("[ERROR] manifest generator creation failed: %w", err)
 	}
-	mf, err := mg.Generate(config.Blueprint, imgType, &config.Options)
+	var mf []byte
+	exports := imgTypes[0].Exports()
+	if len(imgTypes) == 1 {
+		mf, err = mg.Generate(config.Blueprint, imgTypes[0], &config.Options)
+	} else {
+		var artifacts []*artifact.Artifact
+		mf, artifacts, err = mg.GenerateMulti(config.Blueprint, imgTypes, &config.Options)
+		exports = nil
+		for _, a := range artifacts {
+			exports = append(exports, a.Export())
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("[ERROR] manifest generation failed: %w", err)
 	}
@@ -166,7 +206,7 @@ func run() error {
 	_, err = osbuild.RunOSBuild(mf, &osbuild.OSBuildOptions{
 		StoreDir:    osbuildStore,
 		OutputDir:   jobOutput,
-		Exports:     imgType.Exports(),
+		Exports:     exports,
 		Checkpoints: checkpoints,
 		JSONOutput:  false,
 	})
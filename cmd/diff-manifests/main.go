@@ -0,0 +1,64 @@
+// Standalone executable that explains the semantic differences between two
+// osbuild manifests, e.g. two versions of a manifest generated by
+// cmd/gen-manifests.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/osbuild/images/pkg/manifestdiff"
+)
+
+func run() (int, error) {
+	var jsonOutput, exitCode bool
+	flag.BoolVar(&jsonOutput, "json", false, "print the differences as json")
+	flag.BoolVar(&exitCode, "exit-code", false, "exit with 1 if there are differences and 0 otherwise")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <old-manifest> <new-manifest>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		return 2, nil
+	}
+
+	oldData, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		return 2, err
+	}
+	newData, err := os.ReadFile(flag.Arg(1))
+	if err != nil {
+		return 2, err
+	}
+
+	diff, err := manifestdiff.CompareBytes(oldData, newData)
+	if err != nil {
+		return 2, err
+	}
+
+	if jsonOutput {
+		err = diff.WriteJSON(os.Stdout)
+	} else {
+		err = diff.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return 2, err
+	}
+
+	if exitCode && !diff.Empty() {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func main() {
+	rc, err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	os.Exit(rc)
+}
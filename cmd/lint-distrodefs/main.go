@@ -0,0 +1,45 @@
+// Standalone executable that checks the distro definitions for semantic
+// problems that are otherwise only found when a specific distro, arch or
+// image type is used, e.g. conditions that never match.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/osbuild/images/pkg/distro/defs"
+)
+
+func run() (int, error) {
+	var strict bool
+	flag.BoolVar(&strict, "strict", false, "exit with 1 on warnings too")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [search-path...]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Lint the built-in distro definitions and the definitions in the given search paths.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	problems, err := defs.NewLoaderWithSearchPaths(flag.Args()).Lint()
+	if err != nil {
+		return 2, err
+	}
+
+	rc := 0
+	for _, p := range problems {
+		fmt.Println(p)
+		if !p.Warning || strict {
+			rc = 1
+		}
+	}
+	return rc, nil
+}
+
+func main() {
+	rc, err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	os.Exit(rc)
+}
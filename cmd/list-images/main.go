@@ -1,5 +1,7 @@
 // Standalone executable that lists all supported combinations of distribution,
 // architecture, and image type. Flags can be specified to filter the list.
+// With -describe the fully resolved configuration of each image type is
+// printed instead.
 package main
 
 import (
@@ -10,6 +12,9 @@ import (
 	"strings"
 
 	"github.com/gobwas/glob"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/osbuild/images/pkg/distro/defs"
 	"github.com/osbuild/images/pkg/distrofactory"
 	testrepos "github.com/osbuild/images/test/data/repositories"
 )
@@ -66,13 +71,35 @@ func jsonPrint(configs []config) {
 	fmt.Println(string(out))
 }
 
+// describer is implemented by image types that are defined in the
+// distro definitions
+type describer interface {
+	Describe() (*defs.ResolvedImageType, error)
+}
+
+func printDescriptions(descriptions []*defs.ResolvedImageType, asJSON bool) error {
+	var out []byte
+	var err error
+	if asJSON {
+		out, err = json.MarshalIndent(descriptions, "", "  ")
+	} else {
+		out, err = yaml.Marshal(descriptions)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal image type descriptions: %w", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
 func main() {
 	var arches, distros, imgTypes multiValue
-	var json bool
+	var json, describe bool
 	flag.Var(&arches, "arches", "comma-separated list of architectures (globs supported)")
 	flag.Var(&distros, "distros", "comma-separated list of distributions (globs supported)")
 	flag.Var(&imgTypes, "types", "comma-separated list of image types (globs supported)")
 	flag.BoolVar(&json, "json", false, "print configs as json")
+	flag.BoolVar(&describe, "describe", false, "print the fully resolved configuration of the image types and where each value is defined")
 	flag.Parse()
 
 	testedRepoRegistry, err := testrepos.New()
@@ -86,6 +113,7 @@ func main() {
 	}
 
 	configs := make([]config, 0)
+	descriptions := make([]*defs.ResolvedImageType, 0)
 	for _, distroName := range distros {
 		distribution := distroFac.GetDistro(distroName)
 		if distribution == nil {
@@ -123,11 +151,29 @@ func main() {
 
 				configs = append(configs, c)
 
+				if describe {
+					d, ok := imgType.(describer)
+					if !ok {
+						fmt.Fprintf(os.Stderr, "WARNING: cannot describe image type %q for distro %q and arch %q\n", imgTypeName, distroName, archName)
+						continue
+					}
+					desc, err := d.Describe()
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "failed to describe image type %q for distro %q and arch %q: %v\n", imgTypeName, distroName, archName, err)
+						os.Exit(1)
+					}
+					descriptions = append(descriptions, desc)
+				}
 			}
 		}
 	}
 
-	if json {
+	if describe {
+		if err := printDescriptions(descriptions, json); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	} else if json {
 		jsonPrint(configs)
 	} else {
 		for _, c := range configs {
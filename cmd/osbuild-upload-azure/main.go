@@ -8,6 +8,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/cloud/azure"
 )
 
@@ -37,18 +38,42 @@ func (t *tags) Set(value string) error {
 	return nil
 }
 
+func uploadResumable(c *azure.StorageClient, blobMetadata azure.BlobMetadata, fileName, stateFile string, threads int) error {
+	imageFile, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("cannot open the image: %w", err)
+	}
+	defer imageFile.Close()
+	stat, err := imageFile.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat the image: %w", err)
+	}
+
+	journal, err := cloud.OpenUploadJournal(stateFile)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	if err := c.UploadPageBlobResumable(blobMetadata, imageFile, uint64(stat.Size()), journal, threads, os.Stdout); err != nil {
+		return err
+	}
+	return journal.Remove()
+}
+
 func main() {
 	var storageAccount string
 	var storageAccessKey string
 	var fileName string
 	var containerName string
 	var threads int
+	var stateFile string
 	tagsArg := tags(make(map[string]string))
 	flag.StringVar(&storageAccount, "storage-account", "", "Azure storage account (mandatory)")
 	flag.StringVar(&storageAccessKey, "storage-access-key", "", "Azure storage access key (mandatory)")
 	flag.StringVar(&fileName, "image", "", "image to upload (mandatory)")
 	flag.StringVar(&containerName, "container", "", "name of storage container (see Azure docs for explanation, mandatory)")
-	flag.IntVar(&threads, "threads", 16, "number of threads for parallel upload")
+	flag.IntVar(&threads, "threads", 0, fmt.Sprintf("number of threads for parallel upload (default %d, %d with --state-file)", azure.DefaultUploadThreads, azure.DefaultResumableUploadThreads))
+	flag.StringVar(&stateFile, "state-file", "", "file to record the upload progress in, an interrupted upload is resumed when rerun with the same file")
 	flag.Var(&tagsArg, "tag", "blob tag formatted as key:value (first colon found is considered to be the delimiter), can be specified multiple times")
 	flag.Parse()
 
@@ -71,11 +96,22 @@ func main() {
 		BlobName:       blobName,
 		ContainerName:  containerName,
 	}
-	err = c.UploadPageBlob(
-		blobMetadata,
-		fileName,
-		threads,
-	)
+	if stateFile != "" {
+		// every thread of a resumable upload buffers a whole part
+		if threads == 0 {
+			threads = azure.DefaultResumableUploadThreads
+		}
+		err = uploadResumable(c, blobMetadata, fileName, stateFile, threads)
+	} else {
+		if threads == 0 {
+			threads = azure.DefaultUploadThreads
+		}
+		err = c.UploadPageBlob(
+			blobMetadata,
+			fileName,
+			threads,
+		)
+	}
 	if err != nil {
 		fmt.Println("Uploading error: ", err)
 		os.Exit(1)
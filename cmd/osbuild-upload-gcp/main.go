@@ -8,6 +8,7 @@ import (
 
 	"cloud.google.com/go/compute/apiv1/computepb"
 
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/cloud/gcp"
 	"github.com/osbuild/images/pkg/olog"
 )
@@ -23,6 +24,28 @@ func (a *strArrayFlag) Set(value string) error {
 	return nil
 }
 
+func uploadResumable(ctx context.Context, g *gcp.GCP, imageFile, bucketName, objectName string, metadata map[string]string, stateFile string) error {
+	f, err := os.Open(imageFile)
+	if err != nil {
+		return fmt.Errorf("cannot open the image: %w", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat the image: %w", err)
+	}
+
+	journal, err := cloud.OpenUploadJournal(stateFile)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	if _, err := g.StorageObjectUploadResumable(ctx, f, uint64(stat.Size()), bucketName, objectName, metadata, journal, cloud.DefaultUploadThreads, os.Stdout); err != nil {
+		return err
+	}
+	return journal.Remove()
+}
+
 func main() {
 
 	var credentialsPath string
@@ -34,6 +57,8 @@ func main() {
 	var imageFile string
 	var shareWith strArrayFlag
 
+	var stateFile string
+
 	var skipUpload bool
 	var skipImport bool
 
@@ -45,6 +70,7 @@ func main() {
 	flag.StringVar(&imageName, "image-name", "", "Image name after import to Compute Engine")
 	flag.StringVar(&imageFile, "image", "", "Image file to upload")
 	flag.Var(&shareWith, "share-with", "Accounts to share the image with. Can be set multiple times. Allowed values are 'user:{emailid}' / 'serviceAccount:{emailid}' / 'group:{emailid}' / 'domain:{domain}'.")
+	flag.StringVar(&stateFile, "state-file", "", "File to record the upload progress in, an interrupted upload is resumed when rerun with the same file")
 	flag.BoolVar(&skipUpload, "skip-upload", false, "Use to skip Image Upload step")
 	flag.BoolVar(&skipImport, "skip-import", false, "Use to skip Image Import step")
 	flag.Parse()
@@ -79,8 +105,13 @@ func main() {
 	// Upload image to the Storage
 	if !skipUpload {
 		olog.Printf("[GCP] 🚀 Uploading image to: %s/%s", bucketName, objectName)
-		_, err := g.StorageObjectUpload(ctx, imageFile, bucketName, objectName,
-			map[string]string{gcp.MetadataKeyImageName: imageName})
+		metadata := map[string]string{gcp.MetadataKeyImageName: imageName}
+		var err error
+		if stateFile != "" {
+			err = uploadResumable(ctx, g, imageFile, bucketName, objectName, metadata, stateFile)
+		} else {
+			_, err = g.StorageObjectUpload(ctx, imageFile, bucketName, objectName, metadata)
+		}
 		if err != nil {
 			olog.Fatalf("[GCP] Uploading image failed: %v", err)
 		}
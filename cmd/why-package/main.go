@@ -0,0 +1,206 @@
+// Standalone executable that explains why a package is part of an image. It
+// depsolves the package sets of an image type and prints the shortest
+// dependency chains from the requested packages of each package set, i.e.
+// the include list of the image type and the blueprint packages, to the
+// given package.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/internal/buildconfig"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/distrofactory"
+	"github.com/osbuild/images/pkg/manifestgen"
+	"github.com/osbuild/images/pkg/reporegistry"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// pipelineChains are the dependency chains of a package in the depsolve
+// result of a pipeline
+type pipelineChains struct {
+	Pipeline string                        `json:"pipeline"`
+	Chains   []depsolvednf.DependencyChain `json:"chains"`
+}
+
+// requests returns the package specs of all package sets of a chain
+func requests(pkgSets []rpmmd.PackageSet) []string {
+	var specs []string
+	for _, pkgSet := range pkgSets {
+		for _, spec := range pkgSet.Include {
+			if !slices.Contains(specs, spec) {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return specs
+}
+
+func formatChain(chain depsolvednf.DependencyChain) string {
+	if len(chain.Dependencies) == 0 {
+		return fmt.Sprintf("%s (requested as %q)", chain.Package, chain.Request)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (requested as %q)", chain.Dependencies[0].From, chain.Request)
+	for _, dep := range chain.Dependencies {
+		fmt.Fprintf(&b, " -> %s (requires %s)", dep.To, dep.Requires)
+	}
+	return b.String()
+}
+
+func printChains(w io.Writer, results []pipelineChains, pkgName string, asJSON bool) error {
+	if asJSON {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal dependency chains: %w", err)
+		}
+		fmt.Fprintln(w, string(out))
+		return nil
+	}
+	for _, res := range results {
+		fmt.Fprintf(w, "%s:\n", res.Pipeline)
+		if len(res.Chains) == 0 {
+			fmt.Fprintf(w, "  %s is not pulled in by a requested package\n", pkgName)
+		}
+		for _, chain := range res.Chains {
+			fmt.Fprintf(w, "  %s\n", formatChain(chain))
+		}
+	}
+	return nil
+}
+
+func run() error {
+	var rpmCacheRoot, repositories, archName, distroName, imgTypeName, configFile, pipeline string
+	var asJSON bool
+	flag.StringVar(&rpmCacheRoot, "rpmmd", "/tmp/rpmmd", "rpm metadata cache directory")
+	flag.StringVar(&repositories, "repositories", "test/data/repositories", "path to repository file or directory")
+	flag.StringVar(&archName, "arch", "", "target architecture")
+	flag.StringVar(&distroName, "distro", "", "distribution (required)")
+	flag.StringVar(&imgTypeName, "type", "", "image type name (required)")
+	flag.StringVar(&configFile, "config", "", "build config file with the blueprint")
+	flag.StringVar(&pipeline, "pipeline", "", "only explain the package in the given pipeline, e.g. \"os\"")
+	flag.BoolVar(&asJSON, "json", false, "print the dependency chains as json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <package name, name.arch or NEVRA>\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if distroName == "" || imgTypeName == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	pkgName := flag.Arg(0)
+
+	config := &buildconfig.BuildConfig{Name: "empty"}
+	if configFile != "" {
+		var err error
+		config, err = buildconfig.New(configFile, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if config.Blueprint == nil {
+		config.Blueprint = &blueprint.Blueprint{}
+	}
+
+	distribution := distrofactory.NewDefault().GetDistro(distroName)
+	if distribution == nil {
+		return fmt.Errorf("invalid or unsupported distribution: %q", distroName)
+	}
+	if archName == "" {
+		archName = arch.Current().String()
+	}
+	archi, err := distribution.GetArch(archName)
+	if err != nil {
+		return fmt.Errorf("invalid arch name %q for distro %q: %w", archName, distroName, err)
+	}
+	imgType, err := archi.GetImageType(imgTypeName)
+	if err != nil {
+		return fmt.Errorf("invalid image type %q for distro %q and arch %q: %w", imgTypeName, distroName, archName, err)
+	}
+
+	var allRepos []rpmmd.RepoConfig
+	if st, err := os.Stat(repositories); err == nil && !st.IsDir() {
+		repoConfig, err := rpmmd.LoadRepositoriesFromFile(repositories)
+		if err != nil {
+			return fmt.Errorf("failed to load repositories from %q: %w", repositories, err)
+		}
+		allRepos = repoConfig[archName]
+	} else {
+		reporeg, err := reporegistry.New([]string{repositories}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to load repositories from %q: %w", repositories, err)
+		}
+		allRepos, err = reporeg.ReposByImageTypeName(distribution.Name(), archName, imgTypeName)
+		if err != nil {
+			return fmt.Errorf("failed to get repositories for %s/%s/%s: %w", distribution.Name(), archName, imgTypeName, err)
+		}
+	}
+	allRepos = append(allRepos, config.CustomRepos...)
+
+	// the package sets and depsolve results are captured while the
+	// manifest is generated, the manifest itself is not needed
+	var pkgSetChains map[string][]rpmmd.PackageSet
+	var results map[string]depsolvednf.DepsolveResult
+	depsolve := func(solver *depsolvednf.Solver, cacheDir string, depsolveWarningsOutput io.Writer, packageSets map[string][]rpmmd.PackageSet, d distro.Distro, a string) (map[string]depsolvednf.DepsolveResult, error) {
+		solver.SetDependencies(true)
+		res, err := manifestgen.DefaultDepsolve(solver, cacheDir, depsolveWarningsOutput, packageSets, d, a)
+		pkgSetChains, results = packageSets, res
+		return res, err
+	}
+	mg, err := manifestgen.New(nil, &manifestgen.Options{
+		Cachedir:       filepath.Join(rpmCacheRoot, archName+distribution.Name()),
+		WarningsOutput: os.Stderr,
+		OverrideRepos:  allRepos,
+		Depsolve:       depsolve,
+	})
+	if err != nil {
+		return fmt.Errorf("manifest generator creation failed: %w", err)
+	}
+	if _, err := mg.Generate(config.Blueprint, imgType, &config.Options); err != nil {
+		return fmt.Errorf("manifest generation failed: %w", err)
+	}
+
+	var pipelines []string
+	for name, res := range results {
+		if pipeline != "" && name != pipeline {
+			continue
+		}
+		if len(res.Transactions.FindPackages(pkgName)) > 0 {
+			pipelines = append(pipelines, name)
+		}
+	}
+	if len(pipelines) == 0 {
+		return fmt.Errorf("package %q is not part of the image type %q", pkgName, imgTypeName)
+	}
+	slices.Sort(pipelines)
+
+	var out []pipelineChains
+	for _, name := range pipelines {
+		res := results[name]
+		chains, err := res.WhyPackage(requests(pkgSetChains[name]), pkgName)
+		if err != nil {
+			return err
+		}
+		out = append(out, pipelineChains{Pipeline: name, Chains: chains})
+	}
+	return printChains(os.Stdout, out, pkgName, asJSON)
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
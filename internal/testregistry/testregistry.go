@@ -381,6 +381,10 @@ func (reg *Registry) Resolve(target string, imgArch arch.Arch) (container.Spec,
 	if !ok {
 		return container.Spec{}, fmt.Errorf("unknown digest")
 	}
+	var size uint64
+	for _, layer := range mf.LayersDescriptors {
+		size += uint64(layer.Size)
+	}
 
 	return container.Spec{
 		Source:     ref.String(),
@@ -390,6 +394,7 @@ func (reg *Registry) Resolve(target string, imgArch arch.Arch) (container.Spec,
 		TLSVerify:  common.ToPtr(false),
 		ListDigest: listDigest,
 		Arch:       imgArch,
+		Size:       size,
 	}, nil
 }
 
@@ -1,9 +1,11 @@
 package awscloud
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,6 +23,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/olog"
 	"github.com/osbuild/images/pkg/platform"
 )
@@ -30,6 +33,8 @@ type AWS struct {
 	s3         s3Client
 	s3uploader s3Uploader
 	s3presign  s3Presign
+
+	s3multipart s3MultipartClient
 }
 
 // Allow to mock the EC2 SnapshotImportedWaiter for testing purposes
@@ -63,6 +68,8 @@ func newAwsFromConfig(cfg aws.Config) *AWS {
 		s3:         s3cli,
 		s3uploader: s3manager.NewUploader(s3cli),
 		s3presign:  s3.NewPresignClient(s3cli),
+
+		s3multipart: s3cli,
 	}
 }
 
@@ -216,6 +223,162 @@ func (a *AWS) UploadFromReader(r io.Reader, bucket, key string) (*s3manager.Uplo
 	)
 }
 
+// UploadResumable uploads the file to the given bucket and key with a S3
+// multipart upload. The progress is recorded in the journal, if the upload
+// is interrupted calling this again with the same journal only uploads the
+// missing parts. Returns the location of the uploaded object.
+func (a *AWS) UploadResumable(filename, bucket, key string, journal *cloud.UploadJournal) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	target := fmt.Sprintf("s3://%s/%s", bucket, key)
+	newKey := func() string { return key }
+	_, location, err := uploadResumable(a, file, uint64(stat.Size()), target, bucket, newKey, journal, olog.Writer())
+	return location, err
+}
+
+// s3MaxParts is the maximum number of parts of a S3 multipart upload
+const s3MaxParts = 10_000
+
+// multipartClient is the part of the AWS client that is needed for
+// resumable uploads
+type multipartClient interface {
+	CreateMultipartUpload(bucket, key string) (string, error)
+	UploadPart(bucket, key, uploadID string, part cloud.UploadedPart, data []byte) (string, error)
+	CompleteMultipartUpload(bucket, key, uploadID string, parts []cloud.UploadedPart) (string, error)
+}
+
+// uploadResumable uploads r with a S3 multipart upload to a new object in
+// the bucket, named by newKey. If the journal records an interrupted upload
+// to the same target it is continued, including its object. Returns the key
+// and the location of the uploaded object.
+func uploadResumable(client multipartClient, r io.ReaderAt, size uint64, target, bucket string, newKey func() string, journal *cloud.UploadJournal, status io.Writer) (string, string, error) {
+	resumed, err := journal.Begin(target, size, cloud.UploadPartSize(size, s3MaxParts))
+	if err != nil {
+		return "", "", err
+	}
+	key, uploadID := journal.Object(), journal.UploadID()
+	if !resumed || uploadID == "" {
+		key = newKey()
+		uploadID, err = client.CreateMultipartUpload(bucket, key)
+		if err != nil {
+			return "", "", err
+		}
+		if err := journal.SetUpload(key, uploadID); err != nil {
+			return "", "", err
+		}
+	}
+	fmt.Fprintf(status, "Uploading to %s:%s\n", bucket, key)
+
+	err = cloud.UploadParts(r, journal, cloud.DefaultUploadThreads, status, func(part cloud.UploadedPart, data []byte) (string, error) {
+		return client.UploadPart(bucket, key, uploadID, part, data)
+	})
+	if err != nil {
+		return "", "", err
+	}
+	location, err := client.CompleteMultipartUpload(bucket, key, uploadID, journal.Parts())
+	if err != nil {
+		return "", "", err
+	}
+	// the multipart upload is gone now, it cannot be resumed anymore
+	if err := journal.Remove(); err != nil {
+		return "", "", err
+	}
+	return key, location, nil
+}
+
+// CreateMultipartUpload starts a multipart upload of the given object
+// and returns its id. The integrity of the parts is verified by S3 using
+// their SHA256.
+func (a *AWS) CreateMultipartUpload(bucket, key string) (string, error) {
+	olog.Printf("[AWS] 🚀 Starting multipart upload to S3: %s/%s", bucket, key)
+	res, err := a.s3multipart.CreateMultipartUpload(
+		context.TODO(),
+		&s3.CreateMultipartUploadInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("cannot create multipart upload: %w", err)
+	}
+	return aws.ToString(res.UploadId), nil
+}
+
+// UploadPart uploads a part of a multipart upload and returns its etag
+func (a *AWS) UploadPart(bucket, key, uploadID string, part cloud.UploadedPart, data []byte) (string, error) {
+	checksum, err := base64SHA256(part.SHA256)
+	if err != nil {
+		return "", err
+	}
+	res, err := a.s3multipart.UploadPart(
+		context.TODO(),
+		&s3.UploadPartInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			UploadId:          aws.String(uploadID),
+			PartNumber:        aws.Int32(int32(part.Number)),
+			Body:              bytes.NewReader(data),
+			ChecksumAlgorithm: s3types.ChecksumAlgorithmSha256,
+			ChecksumSHA256:    aws.String(checksum),
+		},
+	)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(res.ETag), nil
+}
+
+// CompleteMultipartUpload assembles the uploaded parts into the object
+// and returns its location.
+func (a *AWS) CompleteMultipartUpload(bucket, key, uploadID string, parts []cloud.UploadedPart) (string, error) {
+	completed := make([]s3types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		checksum, err := base64SHA256(part.SHA256)
+		if err != nil {
+			return "", err
+		}
+		completed = append(completed, s3types.CompletedPart{
+			ETag:           aws.String(part.ETag),
+			PartNumber:     aws.Int32(int32(part.Number)),
+			ChecksumSHA256: aws.String(checksum),
+		})
+	}
+	res, err := a.s3multipart.CompleteMultipartUpload(
+		context.TODO(),
+		&s3.CompleteMultipartUploadInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{
+				Parts: completed,
+			},
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("cannot complete multipart upload: %w", err)
+	}
+	return aws.ToString(res.Location), nil
+}
+
+// base64SHA256 converts the hex encoded sha256 of an uploaded part to
+// the encoding used by S3
+func base64SHA256(hexSum string) (string, error) {
+	sum, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return "", fmt.Errorf("invalid sha256 of part %q: %w", hexSum, err)
+	}
+	return base64.StdEncoding.EncodeToString(sum), nil
+}
+
 func ec2BootMode(bootMode *platform.BootMode) (ec2types.BootModeValues, error) {
 	if bootMode == nil {
 		return ec2types.BootModeValues(""), nil
@@ -48,13 +48,17 @@ type awsClient interface {
 	UploadFromReader(io.Reader, string, string) (*s3manager.UploadOutput, error)
 	Register(name, bucket, key string, tags []AWSTag, shareWith []string, architecture arch.Arch, bootMode *platform.BootMode, importRole *string) (string, string, error)
 	DeleteObject(string, string) error
+
+	CreateMultipartUpload(bucket, key string) (string, error)
+	UploadPart(bucket, key, uploadID string, part cloud.UploadedPart, data []byte) (string, error)
+	CompleteMultipartUpload(bucket, key, uploadID string, parts []cloud.UploadedPart) (string, error)
 }
 
 var newAwsClient = func(region string, profile string) (awsClient, error) {
 	return NewDefault(region, profile)
 }
 
-func NewUploader(region, bucketName, imageName string, opts *UploaderOptions) (cloud.Uploader, error) {
+func NewUploader(region, bucketName, imageName string, opts *UploaderOptions) (cloud.ResumableUploader, error) {
 	if opts == nil {
 		opts = &UploaderOptions{}
 	}
@@ -76,7 +80,7 @@ func NewUploader(region, bucketName, imageName string, opts *UploaderOptions) (c
 	}, nil
 }
 
-var _ cloud.Uploader = &awsUploader{}
+var _ cloud.ResumableUploader = &awsUploader{}
 
 func (au *awsUploader) Check(status io.Writer) error {
 	fmt.Fprintf(status, "Checking AWS region access...\n")
@@ -110,7 +114,7 @@ func (au *awsUploader) Check(status io.Writer) error {
 	return nil
 }
 
-func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer) (err error) {
+func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer) error {
 	keyName := fmt.Sprintf("%s-%s", uuid.New().String(), au.imageName)
 	fmt.Fprintf(status, "Uploading %s to %s:%s\n", au.imageName, au.bucketName, keyName)
 
@@ -118,6 +122,29 @@ func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer
 	if err != nil {
 		return err
 	}
+	fmt.Fprintf(status, "File uploaded to %s\n", res.Location)
+	return au.register(keyName, status)
+}
+
+// UploadAndRegisterResumable uploads the image with a S3 multipart
+// upload. If the upload is interrupted the multipart upload is kept
+// and continued on the next run with the same journal.
+func (au *awsUploader) UploadAndRegisterResumable(r io.ReaderAt, uploadSize uint64, journal *cloud.UploadJournal, status io.Writer) error {
+	target := fmt.Sprintf("aws:%s:%s:%s", au.region, au.bucketName, au.imageName)
+	newKey := func() string {
+		return fmt.Sprintf("%s-%s", uuid.New().String(), au.imageName)
+	}
+	keyName, location, err := uploadResumable(au.client, r, uploadSize, target, au.bucketName, newKey, journal, status)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "File uploaded to %s\n", location)
+	return au.register(keyName, status)
+}
+
+// register registers the uploaded S3 object as an AMI, the object is
+// deleted afterwards
+func (au *awsUploader) register(keyName string, status io.Writer) (err error) {
 	defer func() {
 		if err != nil {
 			aErr := au.client.DeleteObject(au.bucketName, keyName)
@@ -125,7 +152,6 @@ func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer
 			err = errors.Join(err, aErr)
 		}
 	}()
-	fmt.Fprintf(status, "File uploaded to %s\n", res.Location)
 	if au.targetArch == arch.ARCH_UNSET {
 		au.targetArch = arch.Current()
 	}
@@ -141,9 +167,5 @@ func (au *awsUploader) UploadAndRegister(r io.Reader, _ uint64, status io.Writer
 		return err
 	}
 	fmt.Fprintf(status, "AMI registered: %s\nSnapshot ID: %s\n", ami, snapshot)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"path/filepath"
 	"testing"
 
 	s3manager "github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/cloud/awscloud"
 	"github.com/osbuild/images/pkg/platform"
 )
@@ -43,6 +46,11 @@ type fakeAWSClient struct {
 
 	deleteObjectErr   error
 	deleteObjectCalls int
+
+	createMultipartUploadCalls   int
+	uploadPartErr                error
+	uploadedParts                map[int][]byte
+	completeMultipartUploadParts []cloud.UploadedPart
 }
 
 func (fa *fakeAWSClient) Regions() ([]string, error) {
@@ -76,6 +84,27 @@ func (fa *fakeAWSClient) DeleteObject(string, string) error {
 	return fa.deleteObjectErr
 }
 
+func (fa *fakeAWSClient) CreateMultipartUpload(bucket, key string) (string, error) {
+	fa.createMultipartUploadCalls++
+	return fmt.Sprintf("upload-id-%d", fa.createMultipartUploadCalls), nil
+}
+
+func (fa *fakeAWSClient) UploadPart(bucket, key, uploadID string, part cloud.UploadedPart, data []byte) (string, error) {
+	if fa.uploadPartErr != nil {
+		return "", fa.uploadPartErr
+	}
+	if fa.uploadedParts == nil {
+		fa.uploadedParts = make(map[int][]byte)
+	}
+	fa.uploadedParts[part.Number] = data
+	return fmt.Sprintf("etag-%d", part.Number), nil
+}
+
+func (fa *fakeAWSClient) CompleteMultipartUpload(bucket, key, uploadID string, parts []cloud.UploadedPart) (string, error) {
+	fa.completeMultipartUploadParts = parts
+	return "some-location", nil
+}
+
 func TestUploaderCheckHappy(t *testing.T) {
 	fa := &fakeAWSClient{
 		regions:               []string{"region"},
@@ -227,3 +256,55 @@ func TestUploaderUploadButRegisterErrorAndDeleteError(t *testing.T) {
 	// XXX: this should probably have a context
 	assert.EqualError(t, err, "fake-register-err\nfake-delete-object-err")
 }
+
+func TestUploaderUploadResumable(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+
+	fa := &fakeAWSClient{
+		uploadPartErr:      fmt.Errorf("fake-connection-dropped"),
+		registerImageId:    "image-id",
+		registerSnapshotId: "snapshot-id",
+	}
+	restore := awscloud.MockNewAwsClient(func(string, string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	fakeImage := bytes.NewReader([]byte("fake-aws-image"))
+	journalPath := filepath.Join(t.TempDir(), "upload.journal")
+	uploader, err := awscloud.NewUploader("region", "bucket", "ami", nil)
+	require.NoError(t, err)
+
+	// the first upload is interrupted
+	journal, err := cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegisterResumable(fakeImage, uint64(fakeImage.Size()), journal, &uploadLog)
+	assert.EqualError(t, err, "uploading part 1 failed: fake-connection-dropped")
+	require.NoError(t, journal.Close())
+	assert.Equal(t, 0, fa.registerCalls)
+
+	// and continued with the same multipart upload
+	fa.uploadPartErr = nil
+	journal, err = cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	uploadLog.Reset()
+	err = uploader.UploadAndRegisterResumable(fakeImage, uint64(fakeImage.Size()), journal, &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fa.createMultipartUploadCalls)
+	assert.Equal(t, []byte("fake-aws-image"), fa.uploadedParts[1])
+	require.Len(t, fa.completeMultipartUploadParts, 1)
+	assert.Equal(t, "etag-1", fa.completeMultipartUploadParts[0].ETag)
+	assert.Equal(t, 1, fa.registerCalls)
+	assert.Equal(t, 1, fa.deleteObjectCalls)
+	assert.NoFileExists(t, journalPath)
+	expectedUploadLog := `Uploading to bucket:01010101-0101-4101-8101-010101010101-ami
+Uploaded 1 parts
+File uploaded to some-location
+Registering AMI ami
+Deleted S3 object bucket:01010101-0101-4101-8101-010101010101-ami
+AMI registered: image-id
+Snapshot ID: snapshot-id
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
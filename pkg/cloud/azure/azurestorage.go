@@ -24,6 +24,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/datasizes"
 )
 
@@ -63,6 +64,17 @@ const DefaultUploadThreads = 16
 // See https://learn.microsoft.com/en-us/rest/api/storageservices/put-page
 const PageBlobMaxUploadPagesBytes = 4 * datasizes.MiB
 
+// ResumableUploadPartSize is the size of the parts of the
+// UploadPageBlobResumable method, a multiple of PageBlobMaxUploadPagesBytes.
+// Every thread holds one part in memory, with DefaultResumableUploadThreads
+// this needs about as much memory as UploadPageBlob with
+// DefaultUploadThreads.
+const ResumableUploadPartSize = 4 * PageBlobMaxUploadPagesBytes
+
+// DefaultResumableUploadThreads is the default for the threads parameter
+// of the UploadPageBlobResumable method.
+const DefaultResumableUploadThreads = cloud.DefaultUploadThreads
+
 // UploadPageBlob takes the metadata and credentials required to upload the image specified by `fileName`
 // It can speed up the upload by using goroutines. The number of parallel goroutines is bounded by
 // the `threads` argument.
@@ -189,6 +201,66 @@ func (c StorageClient) UploadPageBlob(metadata BlobMetadata, fileName string, th
 	return nil
 }
 
+// UploadPageBlobResumable uploads the image from r as a page blob like
+// UploadPageBlob but records the uploaded parts in the journal. If the
+// upload is interrupted, calling it again with the same journal only
+// uploads the missing parts. The MD5 of every page range is verified
+// by Azure.
+func (c StorageClient) UploadPageBlobResumable(metadata BlobMetadata, r io.ReaderAt, size uint64, journal *cloud.UploadJournal, threads int, status io.Writer) error {
+	URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", metadata.StorageAccount, metadata.ContainerName, metadata.BlobName))
+	client, err := pageblob.NewClientWithSharedKeyCredential(URL.String(), c.credential, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create a pageblob client: %w", err)
+	}
+	ctx := context.Background()
+
+	if size%512 != 0 {
+		return errors.New("size for azure image must be aligned to 512 bytes")
+	}
+
+	resumed, err := journal.Begin(URL.String(), size, ResumableUploadPartSize)
+	if err != nil {
+		return err
+	}
+	if !resumed || journal.UploadID() == "" {
+		// Create page blob. Page blob is required for VM images
+		if _, err := client.Create(ctx, int64(size), nil); err != nil {
+			return fmt.Errorf("cannot create a new page blob: %w", err)
+		}
+		// page blobs have no upload id, the URL marks that the blob
+		// was created
+		if err := journal.SetUpload(metadata.BlobName, URL.String()); err != nil {
+			return err
+		}
+	}
+
+	zeros := make([]byte, PageBlobMaxUploadPagesBytes)
+	return cloud.UploadParts(r, journal, threads, status, func(part cloud.UploadedPart, data []byte) (string, error) {
+		for offset := 0; offset < len(data); offset += PageBlobMaxUploadPagesBytes {
+			pages := data[offset:min(offset+PageBlobMaxUploadPagesBytes, len(data))]
+			// the blob is zero-initialized, see UploadPageBlob
+			if bytes.Equal(zeros[:len(pages)], pages) {
+				continue
+			}
+
+			// azure uses MD5 hashes
+			/* #nosec G401 */
+			sum := md5.Sum(pages)
+			uploadRange := blob.HTTPRange{
+				Offset: int64(part.Offset) + int64(offset),
+				Count:  int64(len(pages)),
+			}
+			_, err := client.UploadPages(ctx, common.NopSeekCloser(bytes.NewReader(pages)), uploadRange, &pageblob.UploadPagesOptions{
+				TransactionalValidation: blob.TransferValidationTypeMD5(sum[:]),
+			})
+			if err != nil {
+				return "", fmt.Errorf("uploading a page failed: %w", err)
+			}
+		}
+		return "", nil
+	})
+}
+
 // CreateStorageContainerIfNotExist creates an empty storage container inside
 // a storage account. If a container with the same name already exists,
 // this method is no-op.
@@ -0,0 +1,115 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/osbuild/images/pkg/cloud"
+)
+
+var _ = cloud.ResumableUploader(&azureUploader{})
+
+type azureUploader struct {
+	client    *Client
+	imageName string
+	opts      UploaderOptions
+}
+
+type UploaderOptions struct {
+	TenantID       string
+	SubscriptionID string
+	ResourceGroup  string
+	StorageAccount string
+	// StorageContainer is created if it does not exist
+	StorageContainer string
+	// Location of the image, defaults to the location of the resource group
+	Location string
+	// HyperVGeneration of the image, defaults to HyperVGenV1
+	HyperVGeneration HyperVGenerationType
+}
+
+// NewUploader returns an uploader that uploads the image as a page blob
+// to the given storage account and registers it as an image.
+func NewUploader(credentials Credentials, imageName string, opts *UploaderOptions) (cloud.ResumableUploader, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("azure uploader options are required")
+	}
+	client, err := NewClient(credentials, opts.TenantID, opts.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	uploaderOpts := *opts
+	if uploaderOpts.HyperVGeneration == "" {
+		uploaderOpts.HyperVGeneration = HyperVGenV1
+	}
+
+	return &azureUploader{
+		client:    client,
+		imageName: imageName,
+		opts:      uploaderOpts,
+	}, nil
+}
+
+func (au *azureUploader) Check(status io.Writer) error {
+	fmt.Fprintf(status, "Checking Azure resource group...\n")
+	if _, err := au.client.GetResourceGroupLocation(context.Background(), au.opts.ResourceGroup); err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Checking Azure storage account...\n")
+	if _, err := au.client.GetStorageAccountKey(context.Background(), au.opts.ResourceGroup, au.opts.StorageAccount); err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+// UploadAndRegister uploads the image from r, page blobs are uploaded in
+// parallel so r needs to implement io.ReaderAt.
+func (au *azureUploader) UploadAndRegister(r io.Reader, uploadSize uint64, status io.Writer) error {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return errors.New("uploading to azure requires an image that can be read at arbitrary offsets")
+	}
+	return au.UploadAndRegisterResumable(ra, uploadSize, &cloud.UploadJournal{}, status)
+}
+
+func (au *azureUploader) UploadAndRegisterResumable(r io.ReaderAt, uploadSize uint64, journal *cloud.UploadJournal, status io.Writer) error {
+	ctx := context.Background()
+
+	key, err := au.client.GetStorageAccountKey(ctx, au.opts.ResourceGroup, au.opts.StorageAccount)
+	if err != nil {
+		return err
+	}
+	storageClient, err := NewStorageClient(au.opts.StorageAccount, key)
+	if err != nil {
+		return err
+	}
+	if err := storageClient.CreateStorageContainerIfNotExist(ctx, au.opts.StorageAccount, au.opts.StorageContainer); err != nil {
+		return err
+	}
+
+	blobName := EnsureVHDExtension(au.imageName)
+	metadata := BlobMetadata{
+		StorageAccount: au.opts.StorageAccount,
+		ContainerName:  au.opts.StorageContainer,
+		BlobName:       blobName,
+	}
+	fmt.Fprintf(status, "Uploading %s to %s/%s\n", au.imageName, au.opts.StorageContainer, blobName)
+	if err := storageClient.UploadPageBlobResumable(metadata, r, uploadSize, journal, DefaultResumableUploadThreads, status); err != nil {
+		return err
+	}
+	// the blob is complete, a rerun starts a new upload
+	if err := journal.Remove(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(status, "Registering image %s\n", au.imageName)
+	err = au.client.RegisterImage(ctx, au.opts.ResourceGroup, au.opts.StorageAccount, au.opts.StorageContainer, blobName, au.imageName, au.opts.Location, au.opts.HyperVGeneration)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Image registered: %s\n", au.imageName)
+	return nil
+}
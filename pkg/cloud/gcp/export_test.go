@@ -0,0 +1,28 @@
+package gcp
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/osbuild/images/pkg/cloud"
+)
+
+type StorageBucket = storageBucket
+
+func StorageObjectUploadResumableForTest(ctx context.Context, bucketHandle StorageBucket, r io.ReaderAt, size uint64, bucket, object string, metadata map[string]string, journal *cloud.UploadJournal, threads int, status io.Writer) (*storage.ObjectAttrs, error) {
+	return storageObjectUploadResumable(ctx, bucketHandle, r, size, bucket, object, metadata, journal, threads, status)
+}
+
+func MockUploadPartSize(partSize uint64) (restore func()) {
+	saved := uploadPartSize
+	uploadPartSize = func(uint64, int) uint64 {
+		return partSize
+	}
+	return func() {
+		uploadPartSize = saved
+	}
+}
+
+const StorageMaxComposeSources = storageMaxComposeSources
@@ -11,6 +11,8 @@ import (
 
 	"cloud.google.com/go/storage"
 	"google.golang.org/api/option"
+
+	"github.com/osbuild/images/pkg/cloud"
 )
 
 const (
@@ -79,6 +81,124 @@ func (g *GCP) StorageObjectUpload(ctx context.Context, filename, bucket, object
 	return wc.Attrs(), nil
 }
 
+// storageMaxComposeSources is the maximum number of objects that can
+// be composed in a single request
+const storageMaxComposeSources = 32
+
+// storageMaxComponents is the maximum number of components of a
+// composite object
+const storageMaxComponents = 1024
+
+// StorageObjectUploadResumable uploads an OS image from r to the
+// specified Cloud Storage bucket and object. The image is uploaded in
+// parts, each to a temporary object, which are composed into the final
+// object once all parts are uploaded. The parts are recorded in the
+// journal, if the upload is interrupted calling this again with the
+// same journal only uploads the missing parts. The MD5 of every part is
+// verified by Cloud Storage.
+//
+// Uses:
+//   - Storage API
+func (g *GCP) StorageObjectUploadResumable(ctx context.Context, r io.ReaderAt, size uint64, bucket, object string, metadata map[string]string, journal *cloud.UploadJournal, threads int, status io.Writer) (*storage.ObjectAttrs, error) {
+	storageClient, err := storage.NewClient(ctx, option.WithCredentials(g.creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	return storageObjectUploadResumable(ctx, &gcsBucket{storageClient.Bucket(bucket)}, r, size, bucket, object, metadata, journal, threads, status)
+}
+
+// storageBucket is the part of a Cloud Storage bucket that is needed for
+// resumable uploads
+type storageBucket interface {
+	// WriteObject writes data to the object, the upload is rejected if
+	// the data does not match its MD5
+	WriteObject(ctx context.Context, object string, data []byte, md5 []byte) error
+	// ComposeObject concatenates the sources into dst
+	ComposeObject(ctx context.Context, dst string, srcs []string, metadata map[string]string) (*storage.ObjectAttrs, error)
+	DeleteObject(ctx context.Context, object string) error
+}
+
+type gcsBucket struct {
+	handle *storage.BucketHandle
+}
+
+func (b *gcsBucket) WriteObject(ctx context.Context, object string, data []byte, md5 []byte) error {
+	wc := b.handle.Object(object).NewWriter(ctx)
+	// Uploaded data is rejected if its MD5 hash does not match the set value.
+	wc.MD5 = md5
+	if _, err := wc.Write(data); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("Writer.Close: %v", err)
+	}
+	return nil
+}
+
+func (b *gcsBucket) ComposeObject(ctx context.Context, dst string, srcs []string, metadata map[string]string) (*storage.ObjectAttrs, error) {
+	handles := make([]*storage.ObjectHandle, 0, len(srcs))
+	for _, src := range srcs {
+		handles = append(handles, b.handle.Object(src))
+	}
+	composer := b.handle.Object(dst).ComposerFrom(handles...)
+	composer.ObjectAttrs.Metadata = metadata
+	return composer.Run(ctx)
+}
+
+func (b *gcsBucket) DeleteObject(ctx context.Context, object string) error {
+	return b.handle.Object(object).Delete(ctx)
+}
+
+var uploadPartSize = cloud.UploadPartSize
+
+func storageObjectUploadResumable(ctx context.Context, bucketHandle storageBucket, r io.ReaderAt, size uint64, bucket, object string, metadata map[string]string, journal *cloud.UploadJournal, threads int, status io.Writer) (*storage.ObjectAttrs, error) {
+	target := fmt.Sprintf("gs://%s/%s", bucket, object)
+	if _, err := journal.Begin(target, size, uploadPartSize(size, storageMaxComponents)); err != nil {
+		return nil, err
+	}
+	partObject := func(number int) string {
+		return fmt.Sprintf("%s.part-%05d", object, number)
+	}
+
+	err := cloud.UploadParts(r, journal, threads, status, func(part cloud.UploadedPart, data []byte) (string, error) {
+		// gcp uses MD5 hashes
+		/* #nosec G401 */
+		sum := md5.Sum(data)
+		return "", bucketHandle.WriteObject(ctx, partObject(part.Number), data, sum[:])
+	})
+	if err != nil {
+		return nil, fmt.Errorf("uploading the image failed: %v", err)
+	}
+
+	// compose the parts into the object, a single compose request is
+	// limited in the number of sources so compose them incrementally
+	parts := journal.Parts()
+	var attrs *storage.ObjectAttrs
+	for i := 0; i < len(parts); {
+		var srcs []string
+		if i > 0 {
+			srcs = append(srcs, object)
+		}
+		for ; i < len(parts) && len(srcs) < storageMaxComposeSources; i++ {
+			srcs = append(srcs, partObject(parts[i].Number))
+		}
+		attrs, err = bucketHandle.ComposeObject(ctx, object, srcs, metadata)
+		if err != nil {
+			return nil, fmt.Errorf("composing the image failed: %v", err)
+		}
+	}
+
+	for _, part := range parts {
+		if err := bucketHandle.DeleteObject(ctx, partObject(part.Number)); err != nil {
+			fmt.Fprintf(status, "Failed to delete part %d of the image: %v\n", part.Number, err)
+		}
+	}
+	return attrs, nil
+}
+
 // StorageObjectDelete deletes the given object from a bucket.
 //
 // Uses:
@@ -0,0 +1,115 @@
+package gcp_test
+
+import (
+	"bytes"
+	"context"
+	/* #nosec G501 */
+	"crypto/md5"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/cloud/gcp"
+)
+
+type fakeBucket struct {
+	mu sync.Mutex
+
+	objects      map[string][]byte
+	failObject   string
+	writes       []string
+	composeCalls int
+}
+
+func (fb *fakeBucket) WriteObject(ctx context.Context, object string, data []byte, sum []byte) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if object == fb.failObject {
+		return fmt.Errorf("connection reset")
+	}
+	/* #nosec G401 */
+	if expected := md5.Sum(data); !bytes.Equal(expected[:], sum) {
+		return fmt.Errorf("md5 mismatch of %s", object)
+	}
+	fb.writes = append(fb.writes, object)
+	fb.objects[object] = bytes.Clone(data)
+	return nil
+}
+
+func (fb *fakeBucket) ComposeObject(ctx context.Context, dst string, srcs []string, metadata map[string]string) (*storage.ObjectAttrs, error) {
+	if len(srcs) > gcp.StorageMaxComposeSources {
+		return nil, fmt.Errorf("too many sources: %d", len(srcs))
+	}
+	fb.composeCalls++
+	var data []byte
+	for _, src := range srcs {
+		srcData, ok := fb.objects[src]
+		if !ok {
+			return nil, fmt.Errorf("no such object %s", src)
+		}
+		data = append(data, srcData...)
+	}
+	fb.objects[dst] = data
+	return &storage.ObjectAttrs{Name: dst, Metadata: metadata, Size: int64(len(data))}, nil
+}
+
+func (fb *fakeBucket) DeleteObject(ctx context.Context, object string) error {
+	delete(fb.objects, object)
+	return nil
+}
+
+func TestStorageObjectUploadResumable(t *testing.T) {
+	defer gcp.MockUploadPartSize(4)()
+	ctx := context.Background()
+
+	// the last part fails, the ones before are always started
+	fb := &fakeBucket{objects: map[string][]byte{}, failObject: "image.tar.gz.part-00003"}
+	image := bytes.NewReader([]byte("0123456789"))
+	metadata := map[string]string{gcp.MetadataKeyImageName: "image"}
+	journalPath := filepath.Join(t.TempDir(), "state")
+	journal, err := cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+
+	var status bytes.Buffer
+	_, err = gcp.StorageObjectUploadResumableForTest(ctx, fb, image, uint64(image.Size()), "bucket", "image.tar.gz", metadata, journal, 2, &status)
+	assert.ErrorContains(t, err, "uploading part 3 failed: connection reset")
+	assert.Equal(t, 0, fb.composeCalls)
+	require.NoError(t, journal.Close())
+
+	// a rerun with the same state file only uploads the missing part
+	fb.failObject = ""
+	fb.writes = nil
+	journal, err = cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	status.Reset()
+	attrs, err := gcp.StorageObjectUploadResumableForTest(ctx, fb, image, uint64(image.Size()), "bucket", "image.tar.gz", metadata, journal, 2, &status)
+	require.NoError(t, err)
+	assert.Contains(t, status.String(), "Resuming upload, 2 of 3 parts already uploaded")
+	assert.Equal(t, []string{"image.tar.gz.part-00003"}, fb.writes)
+
+	assert.Equal(t, metadata, attrs.Metadata)
+	// the parts are composed into the object and deleted
+	assert.Equal(t, map[string][]byte{"image.tar.gz": []byte("0123456789")}, fb.objects)
+}
+
+func TestStorageObjectUploadResumableManyParts(t *testing.T) {
+	defer gcp.MockUploadPartSize(1)()
+
+	fb := &fakeBucket{objects: map[string][]byte{}}
+	data := []byte(strings.Repeat("abcdefghij", 4))
+	image := bytes.NewReader(data)
+	_, err := gcp.StorageObjectUploadResumableForTest(context.Background(), fb, image, uint64(image.Size()), "bucket", "image.tar.gz", nil, &cloud.UploadJournal{}, 4, &bytes.Buffer{})
+	require.NoError(t, err)
+
+	// 40 parts need two compose requests, the second one appends the
+	// remaining parts to the object composed by the first one
+	assert.Equal(t, 2, fb.composeCalls)
+	assert.Equal(t, map[string][]byte{"image.tar.gz": data}, fb.objects)
+}
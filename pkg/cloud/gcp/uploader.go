@@ -0,0 +1,109 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	"github.com/osbuild/images/pkg/cloud"
+)
+
+var _ = cloud.ResumableUploader(&gcpUploader{})
+
+type gcpUploader struct {
+	gcp       *GCP
+	bucket    string
+	imageName string
+	opts      UploaderOptions
+}
+
+type UploaderOptions struct {
+	// Regions the image is stored in, defaults to the region of the bucket
+	Regions []string
+	// GuestOsFeatures of the image, see GuestOsFeaturesByDistro()
+	GuestOsFeatures []*computepb.GuestOsFeature
+}
+
+// NewUploader returns an uploader that uploads the image archive to the
+// given bucket and imports it into Compute Engine. If credentials are
+// nil the default credentials are used.
+func NewUploader(credentials []byte, bucket, imageName string, opts *UploaderOptions) (cloud.ResumableUploader, error) {
+	if opts == nil {
+		opts = &UploaderOptions{}
+	}
+	g, err := New(credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcpUploader{
+		gcp:       g,
+		bucket:    bucket,
+		imageName: imageName,
+		opts:      *opts,
+	}, nil
+}
+
+func (gu *gcpUploader) Check(status io.Writer) error {
+	ctx := context.Background()
+
+	fmt.Fprintf(status, "Checking GCP bucket...\n")
+	storageClient, err := storage.NewClient(ctx, option.WithCredentials(gu.gcp.creds))
+	if err != nil {
+		return fmt.Errorf("failed to get Storage client: %v", err)
+	}
+	defer storageClient.Close()
+	if _, err := storageClient.Bucket(gu.bucket).Attrs(ctx); err != nil {
+		return fmt.Errorf("cannot access bucket '%s': %w", gu.bucket, err)
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+// UploadAndRegister uploads the image from r, the parts of the image are
+// uploaded in parallel so r needs to implement io.ReaderAt.
+func (gu *gcpUploader) UploadAndRegister(r io.Reader, uploadSize uint64, status io.Writer) error {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return errors.New("uploading to gcp requires an image that can be read at arbitrary offsets")
+	}
+	return gu.UploadAndRegisterResumable(ra, uploadSize, &cloud.UploadJournal{}, status)
+}
+
+func (gu *gcpUploader) UploadAndRegisterResumable(r io.ReaderAt, uploadSize uint64, journal *cloud.UploadJournal, status io.Writer) (err error) {
+	ctx := context.Background()
+
+	// the name of the image is unique in the project, use it for the
+	// object so that an interrupted upload is found again
+	object := gu.imageName + ".tar.gz"
+	fmt.Fprintf(status, "Uploading %s to %s/%s\n", gu.imageName, gu.bucket, object)
+
+	metadata := map[string]string{
+		MetadataKeyImageName: gu.imageName,
+	}
+	if _, err := gu.gcp.StorageObjectUploadResumable(ctx, r, uploadSize, gu.bucket, object, metadata, journal, cloud.DefaultUploadThreads, status); err != nil {
+		return err
+	}
+	// the object is complete, a rerun starts a new upload
+	if err := journal.Remove(); err != nil {
+		return err
+	}
+	defer func() {
+		dErr := gu.gcp.StorageObjectDelete(ctx, gu.bucket, object)
+		fmt.Fprintf(status, "Deleted storage object %s/%s\n", gu.bucket, object)
+		err = errors.Join(err, dErr)
+	}()
+
+	fmt.Fprintf(status, "Importing image %s\n", gu.imageName)
+	image, err := gu.gcp.ComputeImageInsert(ctx, gu.bucket, object, gu.imageName, gu.opts.Regions, gu.opts.GuestOsFeatures)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Image imported: %s\n", image.GetSelfLink())
+	return nil
+}
@@ -0,0 +1,23 @@
+package ibmcloud
+
+type COSClient = cosClient
+
+func MockNewCOSClient(client COSClient) (restore func()) {
+	saved := newCOSClient
+	newCOSClient = func(*ibmcloudUploader) (cosClient, error) {
+		return client, nil
+	}
+	return func() {
+		newCOSClient = saved
+	}
+}
+
+func MockUploadPartSize(partSize uint64) (restore func()) {
+	saved := uploadPartSize
+	uploadPartSize = func(uint64, int) uint64 {
+		return partSize
+	}
+	return func() {
+		uploadPartSize = saved
+	}
+}
@@ -1,6 +1,11 @@
 package ibmcloud
 
 import (
+	"bytes"
+	// IBM Cloud Object Storage uses MD5 hashes
+	/* #nosec G501 */
+	"crypto/md5"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -9,12 +14,35 @@ import (
 	"github.com/IBM/ibm-cos-sdk-go/aws/credentials"
 	"github.com/IBM/ibm-cos-sdk-go/aws/credentials/ibmiam"
 	"github.com/IBM/ibm-cos-sdk-go/aws/session"
+	"github.com/IBM/ibm-cos-sdk-go/service/s3"
 	"github.com/IBM/ibm-cos-sdk-go/service/s3/s3manager"
 
 	"github.com/osbuild/images/pkg/cloud"
 )
 
-var _ = cloud.Uploader(&ibmcloudUploader{})
+var _ = cloud.ResumableUploader(&ibmcloudUploader{})
+
+// cosMaxParts is the maximum number of parts of a multipart upload to
+// the IBM Cloud Object Storage
+const cosMaxParts = 10_000
+
+// cosClient is the part of the object storage client that is needed for
+// multipart uploads
+type cosClient interface {
+	CreateMultipartUpload(*s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(*s3.UploadPartInput) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(*s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+}
+
+var newCOSClient = func(iu *ibmcloudUploader) (cosClient, error) {
+	session, err := iu.newSession()
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(session), nil
+}
+
+var uploadPartSize = cloud.UploadPartSize
 
 type ibmcloudUploader struct {
 	region      string
@@ -40,7 +68,7 @@ type Credentials struct {
 	ServiceInstanceID string
 }
 
-func NewUploader(region string, bucketName string, imageName string, credentials *Credentials) (cloud.Uploader, error) {
+func NewUploader(region string, bucketName string, imageName string, credentials *Credentials) (cloud.ResumableUploader, error) {
 	return &ibmcloudUploader{
 		region:      region,
 		bucketName:  bucketName,
@@ -53,13 +81,11 @@ func (iu *ibmcloudUploader) Check(status io.Writer) error {
 	return nil
 }
 
-func (iu *ibmcloudUploader) UploadAndRegister(r io.Reader, uploadSize uint64, status io.Writer) (err error) {
-	fmt.Fprintf(status, "Uploading to IBM Cloud...\n")
-
+func (iu *ibmcloudUploader) newSession() (*session.Session, error) {
 	endpoint := fmt.Sprintf("s3.%s.cloud-object-storage.appdomain.cloud", iu.region)
 	credentials, err := iu.getCredentials()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	conf := aws.NewConfig().
 		WithRegion(iu.region).
@@ -69,7 +95,17 @@ func (iu *ibmcloudUploader) UploadAndRegister(r io.Reader, uploadSize uint64, st
 
 	session, err := session.NewSession(conf)
 	if err != nil {
-		return fmt.Errorf("Failed to create a session: %w", err)
+		return nil, fmt.Errorf("Failed to create a session: %w", err)
+	}
+	return session, nil
+}
+
+func (iu *ibmcloudUploader) UploadAndRegister(r io.Reader, uploadSize uint64, status io.Writer) (err error) {
+	fmt.Fprintf(status, "Uploading to IBM Cloud...\n")
+
+	session, err := iu.newSession()
+	if err != nil {
+		return err
 	}
 
 	uploader := s3manager.NewUploader(session)
@@ -85,6 +121,78 @@ func (iu *ibmcloudUploader) UploadAndRegister(r io.Reader, uploadSize uint64, st
 	return nil
 }
 
+// UploadAndRegisterResumable uploads the image with a multipart upload.
+// If the upload is interrupted the multipart upload is kept and
+// continued on the next run with the same journal.
+func (iu *ibmcloudUploader) UploadAndRegisterResumable(r io.ReaderAt, uploadSize uint64, journal *cloud.UploadJournal, status io.Writer) error {
+	fmt.Fprintf(status, "Uploading to IBM Cloud...\n")
+
+	client, err := newCOSClient(iu)
+	if err != nil {
+		return err
+	}
+
+	target := fmt.Sprintf("ibmcloud:%s:%s:%s", iu.region, iu.bucketName, iu.imageName)
+	resumed, err := journal.Begin(target, uploadSize, uploadPartSize(uploadSize, cosMaxParts))
+	if err != nil {
+		return err
+	}
+	uploadID := journal.UploadID()
+	if !resumed || uploadID == "" {
+		res, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(iu.bucketName),
+			Key:    aws.String(iu.imageName),
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to create multipart upload: %w", err)
+		}
+		uploadID = aws.StringValue(res.UploadId)
+		if err := journal.SetUpload(iu.imageName, uploadID); err != nil {
+			return err
+		}
+	}
+
+	err = cloud.UploadParts(r, journal, cloud.DefaultUploadThreads, status, func(part cloud.UploadedPart, data []byte) (string, error) {
+		// the object storage verifies the MD5 of the part
+		/* #nosec G401 */
+		sum := md5.Sum(data)
+		res, err := client.UploadPart(&s3.UploadPartInput{
+			Bucket:     aws.String(iu.bucketName),
+			Key:        aws.String(iu.imageName),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int64(int64(part.Number)),
+			Body:       bytes.NewReader(data),
+			ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(res.ETag), nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to upload: %w", err)
+	}
+
+	var completed []*s3.CompletedPart
+	for _, part := range journal.Parts() {
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(int64(part.Number)),
+		})
+	}
+	_, err = client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(iu.bucketName),
+		Key:             aws.String(iu.imageName),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to complete multipart upload: %w", err)
+	}
+
+	return journal.Remove()
+}
+
 func (iu *ibmcloudUploader) getCredentials() (*credentials.Credentials, error) {
 	if iu.credentials.ApiKey != "" && iu.credentials.Crn != "" {
 		return ibmiam.NewStaticCredentials(
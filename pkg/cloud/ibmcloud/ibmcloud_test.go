@@ -0,0 +1,110 @@
+package ibmcloud_test
+
+import (
+	"bytes"
+	/* #nosec G501 */
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/IBM/ibm-cos-sdk-go/aws"
+	"github.com/IBM/ibm-cos-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/cloud/ibmcloud"
+)
+
+type fakeCOSClient struct {
+	mu sync.Mutex
+
+	createCalls int
+	failPart    int64
+	parts       map[int64][]byte
+	completed   *s3.CompleteMultipartUploadInput
+}
+
+func (fc *fakeCOSClient) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.createCalls++
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(fmt.Sprintf("upload-%d", fc.createCalls))}, nil
+}
+
+func (fc *fakeCOSClient) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	number := aws.Int64Value(input.PartNumber)
+	if number == fc.failPart {
+		return nil, fmt.Errorf("connection reset")
+	}
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec G401 */
+	sum := md5.Sum(data)
+	if aws.StringValue(input.ContentMD5) != base64.StdEncoding.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("md5 mismatch of part %d", number)
+	}
+	if fc.parts == nil {
+		fc.parts = make(map[int64][]byte)
+	}
+	fc.parts[number] = data
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", number))}, nil
+}
+
+func (fc *fakeCOSClient) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	fc.completed = input
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func TestUploadAndRegisterResumable(t *testing.T) {
+	// the last part fails, the ones before are always started
+	fc := &fakeCOSClient{failPart: 3}
+	defer ibmcloud.MockNewCOSClient(fc)()
+	defer ibmcloud.MockUploadPartSize(4)()
+
+	image := bytes.NewReader([]byte("0123456789"))
+	journalPath := filepath.Join(t.TempDir(), "state")
+	journal, err := cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+
+	uploader, err := ibmcloud.NewUploader("eu-de", "bucket", "image.qcow2", &ibmcloud.Credentials{})
+	require.NoError(t, err)
+	var status bytes.Buffer
+	err = uploader.UploadAndRegisterResumable(image, uint64(image.Size()), journal, &status)
+	assert.ErrorContains(t, err, "uploading part 3 failed: connection reset")
+	assert.Nil(t, fc.completed)
+	require.NoError(t, journal.Close())
+
+	// a rerun with the same state file continues the multipart upload
+	// and only uploads the missing part
+	fc.failPart = 0
+	fc.parts = nil
+	journal, err = cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	status.Reset()
+	err = uploader.UploadAndRegisterResumable(image, uint64(image.Size()), journal, &status)
+	require.NoError(t, err)
+	assert.Contains(t, status.String(), "Resuming upload, 2 of 3 parts already uploaded")
+
+	assert.Equal(t, 1, fc.createCalls)
+	assert.Equal(t, map[int64][]byte{3: []byte("89")}, fc.parts)
+	require.NotNil(t, fc.completed)
+	assert.Equal(t, "upload-1", aws.StringValue(fc.completed.UploadId))
+	assert.Equal(t, "image.qcow2", aws.StringValue(fc.completed.Key))
+	assert.Equal(t, []*s3.CompletedPart{
+		{ETag: aws.String("etag-1"), PartNumber: aws.Int64(1)},
+		{ETag: aws.String("etag-2"), PartNumber: aws.Int64(2)},
+		{ETag: aws.String("etag-3"), PartNumber: aws.Int64(3)},
+	}, fc.completed.MultipartUpload.Parts)
+
+	// the upload is complete, the state file is removed
+	assert.NoFileExists(t, journalPath)
+}
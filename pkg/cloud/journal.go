@@ -0,0 +1,301 @@
+package cloud
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// UploadedPart is a part of an upload that was successfully uploaded.
+type UploadedPart struct {
+	// Number of the part, starting at 1
+	Number int    `json:"number"`
+	Offset uint64 `json:"offset"`
+	Size   uint64 `json:"size"`
+	// SHA256 is the hex encoded sha256 of the part, it is used to
+	// detect local changes of the image when an upload is resumed
+	SHA256 string `json:"sha256"`
+	// ETag is the provider specific reference to the part that is
+	// needed to complete the upload, e.g. the etag of an S3 part
+	ETag string `json:"etag,omitempty"`
+}
+
+// journalEntry is a single line of the journal file
+type journalEntry struct {
+	Target   string        `json:"target,omitempty"`
+	Size     uint64        `json:"size,omitempty"`
+	PartSize uint64        `json:"part_size,omitempty"`
+	Object   string        `json:"object,omitempty"`
+	UploadID string        `json:"upload_id,omitempty"`
+	Part     *UploadedPart `json:"part,omitempty"`
+}
+
+// UploadJournal records the state of a resumable upload in a local file.
+//
+// The journal is a file with one JSON object per line: the first line
+// describes the upload, every further line records the cloud side upload
+// or a part that was uploaded. Entries are only ever appended so that an
+// interrupted upload loses at most the part that was in flight.
+//
+// The zero value is a journal that is not persisted.
+type UploadJournal struct {
+	path string
+
+	mu    sync.Mutex
+	f     *os.File
+	state journalEntry
+	parts map[int]UploadedPart
+}
+
+// OpenUploadJournal opens the journal at the given path, the file is
+// created on the first write if it does not exist.
+func OpenUploadJournal(path string) (*UploadJournal, error) {
+	j := &UploadJournal{path: path}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open upload journal: %w", err)
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, slices.Clone(scanner.Bytes()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read upload journal %q: %w", path, err)
+	}
+	for i, line := range lines {
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// a truncated last line from an interrupted write, the
+			// journal is rewritten below so it can be ignored
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("cannot parse upload journal %q: %w", path, err)
+		}
+		j.apply(entry)
+	}
+
+	// compact the journal, this also drops an incomplete last line
+	// so that new entries can be appended
+	if err := j.rewrite(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *UploadJournal) apply(entry journalEntry) {
+	switch {
+	case entry.Part != nil:
+		if j.parts == nil {
+			j.parts = make(map[int]UploadedPart)
+		}
+		j.parts[entry.Part.Number] = *entry.Part
+	case entry.Target != "":
+		j.state = entry
+		j.parts = nil
+	default:
+		j.state.Object = entry.Object
+		j.state.UploadID = entry.UploadID
+	}
+}
+
+// rewrite replaces the journal file with a compacted version of the
+// current state.
+func (j *UploadJournal) rewrite() error {
+	if j.path == "" {
+		return nil
+	}
+	if j.f != nil {
+		j.f.Close()
+		j.f = nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot write upload journal: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	entries := []journalEntry{j.state}
+	for _, part := range j.sortedParts() {
+		entries = append(entries, journalEntry{Part: &part})
+	}
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			tmp.Close()
+			return fmt.Errorf("cannot write upload journal: %w", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write upload journal: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("cannot write upload journal: %w", err)
+	}
+	return nil
+}
+
+// append writes the entry to the journal file, the caller needs to hold
+// the lock
+func (j *UploadJournal) append(entry journalEntry) error {
+	j.apply(entry)
+	if j.path == "" {
+		return nil
+	}
+
+	if j.f == nil {
+		f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("cannot open upload journal: %w", err)
+		}
+		j.f = f
+	}
+	if err := json.NewEncoder(j.f).Encode(entry); err != nil {
+		return fmt.Errorf("cannot write upload journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("cannot write upload journal: %w", err)
+	}
+	return nil
+}
+
+// Begin starts the upload of size bytes in parts of partSize to the
+// given target. The target is an arbitrary string that identifies the
+// destination of the upload, e.g. the region, bucket and image name.
+//
+// If the journal records an upload with the same parameters it is
+// resumed and true is returned, otherwise the journal is reset.
+func (j *UploadJournal) Begin(target string, size, partSize uint64) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if partSize == 0 {
+		return false, fmt.Errorf("part size of upload to %q must be greater than zero", target)
+	}
+	if j.state.Target == target && j.state.Size == size && j.state.PartSize == partSize {
+		return true, nil
+	}
+
+	j.state = journalEntry{Target: target, Size: size, PartSize: partSize}
+	j.parts = nil
+	return false, j.rewrite()
+}
+
+// Size returns the size of the upload
+func (j *UploadJournal) Size() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state.Size
+}
+
+// PartSize returns the size of the parts of the upload, the last part
+// may be smaller
+func (j *UploadJournal) PartSize() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state.PartSize
+}
+
+// Object returns the name of the object that is uploaded to as
+// recorded by SetUpload
+func (j *UploadJournal) Object() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state.Object
+}
+
+// UploadID returns the provider specific id of the upload as recorded
+// by SetUpload
+func (j *UploadJournal) UploadID() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state.UploadID
+}
+
+// SetUpload records the object that is uploaded to and the provider
+// specific id of the upload, e.g. the id of an S3 multipart upload.
+func (j *UploadJournal) SetUpload(object, uploadID string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.append(journalEntry{Object: object, UploadID: uploadID})
+}
+
+// Parts returns the uploaded parts ordered by their number
+func (j *UploadJournal) Parts() []UploadedPart {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.sortedParts()
+}
+
+func (j *UploadJournal) sortedParts() []UploadedPart {
+	parts := make([]UploadedPart, 0, len(j.parts))
+	for _, part := range j.parts {
+		parts = append(parts, part)
+	}
+	slices.SortFunc(parts, func(a, b UploadedPart) int {
+		return a.Number - b.Number
+	})
+	return parts
+}
+
+func (j *UploadJournal) part(number int) (UploadedPart, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	part, ok := j.parts[number]
+	return part, ok
+}
+
+func (j *UploadJournal) addPart(part UploadedPart) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.append(journalEntry{Part: &part})
+}
+
+// Remove deletes the journal file, this should be called once the
+// upload is complete.
+func (j *UploadJournal) Remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f != nil {
+		j.f.Close()
+		j.f = nil
+	}
+	j.state = journalEntry{}
+	j.parts = nil
+	if j.path == "" {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot remove upload journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file, the journal is kept so that the upload
+// can be resumed.
+func (j *UploadJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
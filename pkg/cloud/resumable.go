@@ -0,0 +1,140 @@
+package cloud
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// ResumableUploader is implemented by uploaders that can continue an
+// interrupted upload. The image is uploaded in parts, several of them in
+// parallel, and every uploaded part is recorded in the journal. When the
+// upload is rerun with the same journal only the missing parts are
+// uploaded.
+type ResumableUploader interface {
+	Uploader
+
+	// UploadAndRegisterResumable works like UploadAndRegister but
+	// records the progress of the upload in the given journal. The
+	// image needs to be readable at arbitrary offsets, e.g. an *os.File.
+	UploadAndRegisterResumable(r io.ReaderAt, uploadSize uint64, journal *UploadJournal, status io.Writer) error
+}
+
+const (
+	// DefaultUploadPartSize is the default size of the parts of a
+	// resumable upload.
+	DefaultUploadPartSize = 64 * datasizes.MiB
+
+	// DefaultUploadThreads is the default number of parts of a
+	// resumable upload that are uploaded in parallel.
+	DefaultUploadThreads = 4
+)
+
+// UploadPartSize returns the size of the parts for an upload of the
+// given size to a service that supports at most maxParts parts. The
+// size is a multiple of DefaultUploadPartSize.
+func UploadPartSize(size uint64, maxParts int) uint64 {
+	partSize := uint64(DefaultUploadPartSize)
+	for maxParts > 0 && size > partSize*uint64(maxParts) {
+		partSize += DefaultUploadPartSize
+	}
+	return partSize
+}
+
+// UploadPartFunc uploads the data of a single part and returns the
+// provider specific reference to the part, see UploadedPart.ETag. The
+// SHA256 of the part is already set when the function is called.
+type UploadPartFunc func(part UploadedPart, data []byte) (etag string, err error)
+
+// UploadParts uploads all parts of the upload started with
+// journal.Begin() that are not recorded in the journal yet. Up to
+// threads parts are uploaded in parallel. Parts that are recorded in
+// the journal but whose local data changed since are uploaded again.
+func UploadParts(r io.ReaderAt, journal *UploadJournal, threads int, status io.Writer, upload UploadPartFunc) error {
+	size := journal.Size()
+	partSize := journal.PartSize()
+	if partSize == 0 {
+		return fmt.Errorf("cannot upload parts: upload not started")
+	}
+	if threads < 1 {
+		threads = DefaultUploadThreads
+	}
+
+	nParts := int((size + partSize - 1) / partSize)
+	if nDone := len(journal.Parts()); nDone > 0 {
+		fmt.Fprintf(status, "Resuming upload, %d of %d parts already uploaded\n", nDone, nParts)
+	}
+
+	var wg sync.WaitGroup
+	var errsMu sync.Mutex
+	var errs []error
+	failed := func() bool {
+		errsMu.Lock()
+		defer errsMu.Unlock()
+		return len(errs) > 0
+	}
+
+	// bounds the number of parallel uploads and the number of part
+	// buffers in memory
+	semaphore := make(chan struct{}, threads)
+	for i := 0; i < nParts; i++ {
+		semaphore <- struct{}{}
+		// do not start new parts once an upload failed
+		if failed() {
+			<-semaphore
+			break
+		}
+		wg.Add(1)
+		go func(part UploadedPart) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			if err := uploadPart(r, journal, part, upload); err != nil {
+				errsMu.Lock()
+				errs = append(errs, err)
+				errsMu.Unlock()
+			}
+		}(UploadedPart{
+			Number: i + 1,
+			Offset: uint64(i) * partSize,
+			Size:   min(partSize, size-uint64(i)*partSize),
+		})
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Uploaded %d parts\n", nParts)
+	return nil
+}
+
+func uploadPart(r io.ReaderAt, journal *UploadJournal, part UploadedPart, upload UploadPartFunc) error {
+	data := make([]byte, part.Size)
+	// ReadAt may return io.EOF together with the last bytes
+	n, err := r.ReadAt(data, int64(part.Offset))
+	if n < len(data) {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("cannot read part %d of the image: %w", part.Number, err)
+	}
+	sum := sha256.Sum256(data)
+	part.SHA256 = hex.EncodeToString(sum[:])
+
+	if done, ok := journal.part(part.Number); ok && done.SHA256 == part.SHA256 && done.Size == part.Size {
+		return nil
+	}
+
+	etag, err := upload(part, data)
+	if err != nil {
+		return fmt.Errorf("uploading part %d failed: %w", part.Number, err)
+	}
+	part.ETag = etag
+	return journal.addPart(part)
+}
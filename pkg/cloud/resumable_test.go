@@ -0,0 +1,172 @@
+package cloud_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+type fakePartUploader struct {
+	mu       sync.Mutex
+	uploaded map[int]string
+	failPart int
+}
+
+func (fu *fakePartUploader) upload(part cloud.UploadedPart, data []byte) (string, error) {
+	if part.Number == fu.failPart {
+		return "", fmt.Errorf("fake-upload-error")
+	}
+	fu.mu.Lock()
+	defer fu.mu.Unlock()
+	if fu.uploaded == nil {
+		fu.uploaded = make(map[int]string)
+	}
+	fu.uploaded[part.Number] = string(data)
+	return fmt.Sprintf("etag-%d", part.Number), nil
+}
+
+func TestUploadPartsResume(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal")
+	image := bytes.NewReader([]byte("0123456789"))
+
+	journal, err := cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	resumed, err := journal.Begin("target", uint64(image.Size()), 4)
+	require.NoError(t, err)
+	assert.False(t, resumed)
+	require.NoError(t, journal.SetUpload("object", "upload-id"))
+
+	fu := &fakePartUploader{failPart: 2}
+	err = cloud.UploadParts(image, journal, 1, io.Discard, fu.upload)
+	assert.EqualError(t, err, "uploading part 2 failed: fake-upload-error")
+	require.NoError(t, journal.Close())
+
+	// resume the upload, only the missing parts are uploaded
+	journal, err = cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	resumed, err = journal.Begin("target", uint64(image.Size()), 4)
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Equal(t, "object", journal.Object())
+	assert.Equal(t, "upload-id", journal.UploadID())
+
+	fu = &fakePartUploader{}
+	var status bytes.Buffer
+	err = cloud.UploadParts(image, journal, 2, &status, fu.upload)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{2: "4567", 3: "89"}, fu.uploaded)
+	assert.Equal(t, "Resuming upload, 1 of 3 parts already uploaded\nUploaded 3 parts\n", status.String())
+
+	parts := journal.Parts()
+	require.Len(t, parts, 3)
+	for i, part := range parts {
+		assert.Equal(t, i+1, part.Number)
+		assert.Equal(t, uint64(i*4), part.Offset)
+		assert.Equal(t, fmt.Sprintf("etag-%d", i+1), part.ETag)
+	}
+	assert.Equal(t, uint64(2), parts[2].Size)
+
+	require.NoError(t, journal.Remove())
+	assert.NoFileExists(t, journalPath)
+}
+
+func TestUploadPartsReuploadsChangedParts(t *testing.T) {
+	journal := &cloud.UploadJournal{}
+	_, err := journal.Begin("target", 8, 4)
+	require.NoError(t, err)
+
+	fu := &fakePartUploader{}
+	require.NoError(t, cloud.UploadParts(bytes.NewReader([]byte("01234567")), journal, 1, io.Discard, fu.upload))
+
+	fu = &fakePartUploader{}
+	require.NoError(t, cloud.UploadParts(bytes.NewReader([]byte("0123xxxx")), journal, 1, io.Discard, fu.upload))
+	assert.Equal(t, map[int]string{2: "xxxx"}, fu.uploaded)
+}
+
+func TestUploadPartsShortImage(t *testing.T) {
+	journal := &cloud.UploadJournal{}
+	_, err := journal.Begin("target", 8, 4)
+	require.NoError(t, err)
+
+	fu := &fakePartUploader{}
+	err = cloud.UploadParts(bytes.NewReader([]byte("012345")), journal, 1, io.Discard, fu.upload)
+	assert.EqualError(t, err, "cannot read part 2 of the image: unexpected EOF")
+}
+
+func TestUploadJournalBeginOtherUpload(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal")
+	journal, err := cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	_, err = journal.Begin("target", 4, 4)
+	require.NoError(t, err)
+	require.NoError(t, cloud.UploadParts(bytes.NewReader([]byte("0123")), journal, 1, io.Discard, (&fakePartUploader{}).upload))
+	require.NoError(t, journal.Close())
+
+	journal, err = cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	resumed, err := journal.Begin("other-target", 4, 4)
+	require.NoError(t, err)
+	assert.False(t, resumed)
+	assert.Empty(t, journal.Parts())
+}
+
+func TestUploadJournalTruncated(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal")
+	content := `{"target":"target","size":8,"part_size":4}
+{"object":"object","upload_id":"upload-id"}
+{"part":{"number":1,"offset":0,"size":4,"sha256":"abc","etag":"etag-1"}}
+{"part":{"number":2,"off`
+	require.NoError(t, os.WriteFile(journalPath, []byte(content), 0600))
+
+	journal, err := cloud.OpenUploadJournal(journalPath)
+	require.NoError(t, err)
+	resumed, err := journal.Begin("target", 8, 4)
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Equal(t, []cloud.UploadedPart{
+		{Number: 1, Offset: 0, Size: 4, SHA256: "abc", ETag: "etag-1"},
+	}, journal.Parts())
+
+	// the incomplete entry is dropped from the journal
+	compacted, err := os.ReadFile(journalPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(compacted), `"number":2`)
+}
+
+func TestUploadJournalCorrupted(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal")
+	content := `{"target":"target","size":8,"part_size":4}
+garbage
+{"part":{"number":1,"offset":0,"size":4,"sha256":"abc","etag":"etag-1"}}
+`
+	require.NoError(t, os.WriteFile(journalPath, []byte(content), 0600))
+
+	_, err := cloud.OpenUploadJournal(journalPath)
+	assert.ErrorContains(t, err, "cannot parse upload journal")
+}
+
+func TestUploadPartSize(t *testing.T) {
+	for _, tc := range []struct {
+		size     uint64
+		maxParts int
+		expected uint64
+	}{
+		{1 * datasizes.MiB, 10_000, 64 * datasizes.MiB},
+		{20 * datasizes.GiB, 10_000, 64 * datasizes.MiB},
+		{64 * datasizes.GiB, 1024, 64 * datasizes.MiB},
+		{65 * datasizes.GiB, 1024, 128 * datasizes.MiB},
+		{65 * datasizes.GiB, 0, 64 * datasizes.MiB},
+	} {
+		assert.Equal(t, tc.expected, cloud.UploadPartSize(tc.size, tc.maxParts))
+	}
+}
@@ -335,6 +335,53 @@ func (cl *Client) UploadImage(ctx context.Context, from, tag string) (digest.Dig
 	return manifestDigest, nil
 }
 
+// CopyImage copies a single image from one location to another, both
+// are image names with a transport prefix, e.g.
+// "docker://registry.example.com/image@sha256:..." or
+// "oci:/path/to/layout:ref". The Target of the Client is only used for
+// its settings like credentials and TLS verification. Returns the digest
+// of the manifest that was written to the destination.
+func (cl *Client) CopyImage(ctx context.Context, from, to string) (digest.Digest, error) {
+	policyContext, err := signature.NewPolicyContext(cl.policy)
+	if err != nil {
+		return "", err
+	}
+
+	srcRef, err := alltransports.ParseImageName(from)
+	if err != nil {
+		return "", fmt.Errorf("invalid source name '%s': %w", from, err)
+	}
+	destRef, err := alltransports.ParseImageName(to)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination name '%s': %w", to, err)
+	}
+
+	retryOpts := retry.RetryOptions{
+		MaxRetry: cl.MaxRetries,
+	}
+
+	var manifestDigest digest.Digest
+	err = retry.RetryIfNecessary(ctx, func() error {
+		manifestBytes, err := copy.Image(ctx, policyContext, destRef, srcRef, &copy.Options{
+			ReportWriter:       cl.ReportWriter,
+			SourceCtx:          cl.sysCtx,
+			DestinationCtx:     cl.sysCtx,
+			ImageListSelection: copy.CopySystemImage,
+		})
+		if err != nil {
+			return err
+		}
+
+		manifestDigest, err = manifest.Digest(manifestBytes)
+		return err
+	}, &retryOpts)
+	if err != nil {
+		return "", err
+	}
+
+	return manifestDigest, nil
+}
+
 // A RawManifest contains the raw manifest Data and its MimeType
 type RawManifest struct {
 	Data     []byte
@@ -468,6 +515,8 @@ type resolvedIds struct {
 	Manifest     digest.Digest
 	Config       digest.Digest
 	ListManifest digest.Digest
+	// Size is the sum of the compressed layer sizes
+	Size uint64
 }
 
 func (cl *Client) resolveManifestList(ctx context.Context, list manifestList, local bool) (resolvedIds, *arch.Arch, error) {
@@ -492,6 +541,7 @@ func (cl *Client) resolveManifestList(ctx context.Context, list manifestList, lo
 func (cl *Client) resolveRawManifest(ctx context.Context, rm RawManifest, local bool) (resolvedIds, *arch.Arch, error) {
 
 	var imageID digest.Digest
+	var layers []manifest.LayerInfo
 
 	switch rm.MimeType {
 	case manifest.DockerV2ListMediaType:
@@ -530,6 +580,7 @@ func (cl *Client) resolveRawManifest(ctx context.Context, rm RawManifest, local
 			return resolvedIds{}, nil, nil
 		}
 		imageID = m.ConfigInfo().Digest
+		layers = m.LayerInfos()
 
 	case manifest.DockerV2Schema2MediaType:
 		m, err := manifest.Schema2FromManifest(rm.Data)
@@ -537,6 +588,7 @@ func (cl *Client) resolveRawManifest(ctx context.Context, rm RawManifest, local
 			return resolvedIds{}, nil, nil
 		}
 		imageID = m.ConfigInfo().Digest
+		layers = m.LayerInfos()
 
 	default:
 		return resolvedIds{}, nil, fmt.Errorf("unsupported manifest format '%s'", rm.MimeType)
@@ -547,9 +599,17 @@ func (cl *Client) resolveRawManifest(ctx context.Context, rm RawManifest, local
 		return resolvedIds{}, nil, err
 	}
 
+	var size uint64
+	for _, layer := range layers {
+		if layer.Size > 0 {
+			size += uint64(layer.Size)
+		}
+	}
+
 	return resolvedIds{
 		Manifest: dg,
 		Config:   imageID,
+		Size:     size,
 	}, nil, nil
 }
 
@@ -578,6 +638,7 @@ func (cl *Client) Resolve(ctx context.Context, name string, local bool) (Spec, e
 		name,
 		local,
 	)
+	spec.Size = ids.Size
 
 	if imageArch != nil {
 		spec.Arch = *imageArch
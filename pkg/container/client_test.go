@@ -48,6 +48,7 @@ func TestClientResolve(t *testing.T) {
 		LocalName:  client.Target.String(),
 		ListDigest: listDigest,
 		Arch:       arch.ARCH_X86_64,
+		Size:       228,
 	}, spec)
 
 	client.SetArchitectureChoice("ppc64le")
@@ -62,6 +63,7 @@ func TestClientResolve(t *testing.T) {
 		LocalName:  client.Target.String(),
 		ListDigest: listDigest,
 		Arch:       arch.ARCH_PPC64LE,
+		Size:       228,
 	}, spec)
 
 	// don't have that architecture
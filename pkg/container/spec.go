@@ -22,6 +22,10 @@ type Spec struct {
 	LocalStorage bool
 
 	Arch arch.Arch // the architecture of the image
+
+	// Size is the compressed size of the layers of the image, it is
+	// 0 if unknown
+	Size uint64
 }
 
 // NewSpec creates a new Spec from the essential information.
@@ -0,0 +1,61 @@
+package mok
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+)
+
+const (
+	// CertificatePath is the path in the image where the certificate is
+	// stored until it is enrolled as a machine owner key.
+	CertificatePath = "/etc/pki/secureboot/mok.der"
+)
+
+// SBATPolicies are the SBAT revocation policies that shim can be asked to
+// apply, see mokutil(1) --set-sbat-policy.
+var SBATPolicies = []string{"latest", "automatic", "delete"}
+
+// The ImageOptions configure shim on the first boot of an image: the
+// enrollment of a custom certificate as a machine owner key (MOK) through
+// shim's MokManager and the SBAT revocation policy of shim.
+//
+// Nothing is signed. The binaries of the boot chain are installed from the
+// distribution packages and keep the signatures of the distribution keys.
+type ImageOptions struct {
+	// Path to the DER encoded certificate on the host that runs osbuild.
+	// The certificate is included in the image like a blueprint file with
+	// a "file:" URI.
+	CertPath string `json:"cert_path,omitempty"`
+
+	// EnrollMOK requests the enrollment of the certificate as a machine
+	// owner key through shim's MokManager on the first boot of the image.
+	// The enrollment needs to be confirmed on the console with the root
+	// password of the image.
+	EnrollMOK bool `json:"enroll_mok,omitempty"`
+
+	// SBATPolicy is the SBAT revocation policy that shim applies on the
+	// next boot, one of SBATPolicies.
+	SBATPolicy string `json:"sbat_policy,omitempty"`
+}
+
+func (o ImageOptions) Validate() error {
+	if !o.EnrollMOK && o.SBATPolicy == "" {
+		return fmt.Errorf("mok options require a machine owner key enrollment or an sbat policy")
+	}
+	if o.EnrollMOK && o.CertPath == "" {
+		return fmt.Errorf("machine owner key enrollment requires a certificate path")
+	}
+	if o.CertPath != "" {
+		if !o.EnrollMOK {
+			return fmt.Errorf("mok certificate path %q is only used for a machine owner key enrollment", o.CertPath)
+		}
+		if !filepath.IsAbs(o.CertPath) {
+			return fmt.Errorf("mok certificate path must be absolute, got %q", o.CertPath)
+		}
+	}
+	if o.SBATPolicy != "" && !slices.Contains(SBATPolicies, o.SBATPolicy) {
+		return fmt.Errorf("unknown sbat policy %q, must be one of %v", o.SBATPolicy, SBATPolicies)
+	}
+	return nil
+}
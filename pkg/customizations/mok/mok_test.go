@@ -0,0 +1,30 @@
+package mok_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/customizations/mok"
+)
+
+func TestImageOptionsValidate(t *testing.T) {
+	assert.NoError(t, mok.ImageOptions{EnrollMOK: true, CertPath: "/keys/db.der"}.Validate())
+	assert.NoError(t, mok.ImageOptions{SBATPolicy: "latest"}.Validate())
+	assert.NoError(t, mok.ImageOptions{EnrollMOK: true, CertPath: "/keys/db.der", SBATPolicy: "delete"}.Validate())
+
+	err := mok.ImageOptions{}.Validate()
+	assert.EqualError(t, err, "mok options require a machine owner key enrollment or an sbat policy")
+
+	err = mok.ImageOptions{EnrollMOK: true}.Validate()
+	assert.EqualError(t, err, "machine owner key enrollment requires a certificate path")
+
+	err = mok.ImageOptions{CertPath: "/keys/db.der", SBATPolicy: "latest"}.Validate()
+	assert.EqualError(t, err, `mok certificate path "/keys/db.der" is only used for a machine owner key enrollment`)
+
+	err = mok.ImageOptions{EnrollMOK: true, CertPath: "db.der"}.Validate()
+	assert.EqualError(t, err, `mok certificate path must be absolute, got "db.der"`)
+
+	err = mok.ImageOptions{SBATPolicy: "previous"}.Validate()
+	assert.EqualError(t, err, `unknown sbat policy "previous", must be one of [latest automatic delete]`)
+}
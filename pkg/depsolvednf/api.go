@@ -19,6 +19,7 @@ type depsolveResultRaw struct {
 	Repos        []rpmmd.RepoConfig
 	Solver       string
 	SBOMRaw      json.RawMessage
+	Dependencies []Dependency
 }
 
 // apiHandler defines the interface for API version implementations.
@@ -55,6 +56,7 @@ type solverConfig struct {
 	rootDir          string
 	proxy            string
 	subscriptions    *rhsm.Subscriptions
+	dependencies     bool
 }
 
 // activeHandler is the currently active API handler implementation.
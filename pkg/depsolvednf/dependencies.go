@@ -0,0 +1,172 @@
+package depsolvednf
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// Dependency is an edge of the dependency graph of a depsolve result: the
+// package From requires the capability Requires, which is provided by the
+// package To. Packages are referenced by their full NEVRA (see
+// rpmmd.Package.FullNEVRA) so that packages of the same name, e.g. the
+// multilib packages of different architectures, are kept apart.
+type Dependency struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Requires string `json:"requires"`
+}
+
+// DependencyChain explains why a package is part of a depsolve result. The
+// package spec Request of a package set pulled in the package with the full
+// NEVRA Package through the edges of Dependencies, which are empty if the
+// package was requested directly.
+type DependencyChain struct {
+	Request      string       `json:"request"`
+	Package      string       `json:"package"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// resolveDependencies computes the dependency edges of the transactions from
+// the requires and provides of the packages. It is used for depsolvers that
+// do not return the edges they resolved. The packages of a transaction can
+// only require packages of the same or of an earlier transaction. The
+// versions of the requires are not compared, the depsolver already made sure
+// that the versions of the installed packages match.
+func resolveDependencies(transactions TransactionList) []Dependency {
+	providers := make(map[string][]string)
+	deps := []Dependency{}
+	for _, transaction := range transactions {
+		for _, pkg := range transaction {
+			nevra := pkg.FullNEVRA()
+			for _, provide := range pkg.Provides {
+				providers[provide.Name] = append(providers[provide.Name], nevra)
+			}
+			for _, file := range pkg.Files {
+				providers[file] = append(providers[file], nevra)
+			}
+		}
+		for _, pkg := range transaction {
+			nevra := pkg.FullNEVRA()
+			seen := make(map[string]bool)
+			for _, req := range pkg.Requires {
+				// rpmlib() requires are provided by rpm itself
+				if strings.HasPrefix(req.Name, "rpmlib(") {
+					continue
+				}
+				for _, provider := range providers[req.Name] {
+					if provider == nevra || seen[provider] {
+						continue
+					}
+					seen[provider] = true
+					deps = append(deps, Dependency{From: nevra, To: provider, Requires: formatRelDep(req)})
+				}
+			}
+		}
+	}
+	return deps
+}
+
+func formatRelDep(dep rpmmd.RelDep) string {
+	if dep.Relationship == "" {
+		return dep.Name
+	}
+	return fmt.Sprintf("%s %s %s", dep.Name, dep.Relationship, dep.Version)
+}
+
+// requestedPackages returns the full NEVRAs of the packages that satisfy the
+// package spec, i.e. the packages with that name, name.arch or NEVRA or, if
+// there are none, the ones that provide it as a capability or file. Groups,
+// modules and globs are not resolved.
+func requestedPackages(pkgs rpmmd.PackageList, spec string) []string {
+	var nevras []string
+	for _, pkg := range matchingPackages(pkgs, spec) {
+		nevras = append(nevras, pkg.FullNEVRA())
+	}
+	if len(nevras) > 0 {
+		return nevras
+	}
+	for _, pkg := range pkgs {
+		if slices.ContainsFunc(pkg.Provides, func(dep rpmmd.RelDep) bool { return dep.Name == spec }) || slices.Contains(pkg.Files, spec) {
+			nevras = append(nevras, pkg.FullNEVRA())
+		}
+	}
+	return nevras
+}
+
+// WhyPackage returns the shortest dependency chain from each of the requested
+// package specs to the package pkg, e.g. from the include lists of the
+// package sets that were depsolved. The package is given by name, name.arch
+// or NEVRA, a name matches the packages of all architectures. Requests that
+// do not pull in the package are omitted, the chains are sorted by length.
+// The result must have been depsolved with [Solver.SetDependencies] enabled.
+func (r *DepsolveResult) WhyPackage(requests []string, pkg string) ([]DependencyChain, error) {
+	targets := make(map[string]bool)
+	for _, match := range r.Transactions.FindPackages(pkg) {
+		targets[match.FullNEVRA()] = true
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("package %q not found in transactions", pkg)
+	}
+	if r.Dependencies == nil {
+		return nil, fmt.Errorf("depsolve result has no dependencies, the depsolve must be run with dependencies enabled")
+	}
+
+	edges := make(map[string][]Dependency)
+	for _, dep := range r.Dependencies {
+		edges[dep.From] = append(edges[dep.From], dep)
+	}
+
+	pkgs := r.Transactions.AllPackages()
+	var chains []DependencyChain
+	for _, request := range requests {
+		var shortest *DependencyChain
+		for _, root := range requestedPackages(pkgs, request) {
+			target, path, ok := shortestPath(edges, root, targets)
+			if ok && (shortest == nil || len(path) < len(shortest.Dependencies)) {
+				shortest = &DependencyChain{Request: request, Package: target, Dependencies: path}
+			}
+		}
+		if shortest != nil {
+			chains = append(chains, *shortest)
+		}
+	}
+	slices.SortStableFunc(chains, func(a, b DependencyChain) int {
+		return cmp.Compare(len(a.Dependencies), len(b.Dependencies))
+	})
+	return chains, nil
+}
+
+// shortestPath searches the edges breadth-first from the package "from" to
+// the closest of the target packages and returns it with the path to it
+func shortestPath(edges map[string][]Dependency, from string, targets map[string]bool) (string, []Dependency, bool) {
+	if targets[from] {
+		return from, []Dependency{}, true
+	}
+	// the edge through which each package was first reached
+	via := map[string]Dependency{from: {}}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range edges[current] {
+			if _, ok := via[dep.To]; ok {
+				continue
+			}
+			via[dep.To] = dep
+			if targets[dep.To] {
+				var path []Dependency
+				for pkg := dep.To; pkg != from; pkg = via[pkg].From {
+					path = append(path, via[pkg])
+				}
+				slices.Reverse(path)
+				return dep.To, path, true
+			}
+			queue = append(queue, dep.To)
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,207 @@
+package depsolvednf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+var testDependencyTransactions = TransactionList{
+	{
+		{
+			Name:     "glibc",
+			Version:  "2.40",
+			Release:  "1",
+			Arch:     "x86_64",
+			Provides: rpmmd.RelDepList{{Name: "glibc"}, {Name: "libc.so.6()(64bit)"}},
+		},
+		{
+			Name:     "glibc",
+			Version:  "2.40",
+			Release:  "1",
+			Arch:     "i686",
+			Provides: rpmmd.RelDepList{{Name: "glibc"}, {Name: "libc.so.6"}},
+		},
+		{
+			Name:     "bash",
+			Version:  "5.2",
+			Release:  "1",
+			Arch:     "x86_64",
+			Provides: rpmmd.RelDepList{{Name: "bash"}, {Name: "/bin/sh"}},
+			Requires: rpmmd.RelDepList{{Name: "libc.so.6()(64bit)"}, {Name: "rpmlib(PayloadIsZstd)", Relationship: "<=", Version: "5.4.18-1"}},
+		},
+	},
+	{
+		{
+			Name:     "openssl-libs",
+			Epoch:    1,
+			Version:  "3.2",
+			Release:  "1",
+			Arch:     "x86_64",
+			Provides: rpmmd.RelDepList{{Name: "openssl-libs"}, {Name: "libssl.so.3()(64bit)"}},
+			Requires: rpmmd.RelDepList{{Name: "libc.so.6()(64bit)"}},
+		},
+		{
+			Name:     "curl",
+			Version:  "8.9",
+			Release:  "1",
+			Arch:     "x86_64",
+			Provides: rpmmd.RelDepList{{Name: "curl"}},
+			Requires: rpmmd.RelDepList{{Name: "libcurl", Relationship: ">=", Version: "8.0"}, {Name: "libc.so.6()(64bit)"}},
+		},
+		{
+			Name:     "libcurl",
+			Version:  "8.9",
+			Release:  "1",
+			Arch:     "x86_64",
+			Provides: rpmmd.RelDepList{{Name: "libcurl"}},
+			Requires: rpmmd.RelDepList{{Name: "libssl.so.3()(64bit)"}, {Name: "/bin/sh"}},
+			Files:    []string{"/usr/lib64/libcurl.so.4"},
+		},
+		{
+			Name:     "wine-core",
+			Version:  "9.0",
+			Release:  "1",
+			Arch:     "i686",
+			Provides: rpmmd.RelDepList{{Name: "wine-core"}},
+			Requires: rpmmd.RelDepList{{Name: "libc.so.6"}},
+		},
+	},
+}
+
+const (
+	glibcNEVRA     = "glibc-0:2.40-1.x86_64"
+	glibcI686NEVRA = "glibc-0:2.40-1.i686"
+	bashNEVRA      = "bash-0:5.2-1.x86_64"
+	opensslNEVRA   = "openssl-libs-1:3.2-1.x86_64"
+	curlNEVRA      = "curl-0:8.9-1.x86_64"
+	libcurlNEVRA   = "libcurl-0:8.9-1.x86_64"
+	wineNEVRA      = "wine-core-0:9.0-1.i686"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	deps := resolveDependencies(testDependencyTransactions)
+	assert.Equal(t, []Dependency{
+		{From: bashNEVRA, To: glibcNEVRA, Requires: "libc.so.6()(64bit)"},
+		{From: opensslNEVRA, To: glibcNEVRA, Requires: "libc.so.6()(64bit)"},
+		{From: curlNEVRA, To: libcurlNEVRA, Requires: "libcurl >= 8.0"},
+		{From: curlNEVRA, To: glibcNEVRA, Requires: "libc.so.6()(64bit)"},
+		{From: libcurlNEVRA, To: opensslNEVRA, Requires: "libssl.so.3()(64bit)"},
+		{From: libcurlNEVRA, To: bashNEVRA, Requires: "/bin/sh"},
+		{From: wineNEVRA, To: glibcI686NEVRA, Requires: "libc.so.6"},
+	}, deps)
+
+	assert.Equal(t, []Dependency{}, resolveDependencies(nil))
+}
+
+func TestFindPackages(t *testing.T) {
+	nevras := func(pkgs rpmmd.PackageList) []string {
+		var res []string
+		for _, pkg := range pkgs {
+			res = append(res, pkg.FullNEVRA())
+		}
+		return res
+	}
+	assert.Equal(t, []string{glibcI686NEVRA, glibcNEVRA}, nevras(testDependencyTransactions.FindPackages("glibc")))
+	assert.Equal(t, []string{glibcI686NEVRA}, nevras(testDependencyTransactions.FindPackages("glibc.i686")))
+	assert.Equal(t, []string{glibcNEVRA}, nevras(testDependencyTransactions.FindPackages("glibc-2.40-1.x86_64")))
+	assert.Equal(t, []string{opensslNEVRA}, nevras(testDependencyTransactions.FindPackages("openssl-libs-1:3.2-1.x86_64")))
+	assert.Empty(t, testDependencyTransactions.FindPackages("vim"))
+}
+
+func TestWhyPackage(t *testing.T) {
+	result := DepsolveResult{
+		Transactions: testDependencyTransactions,
+		Dependencies: resolveDependencies(testDependencyTransactions),
+	}
+
+	testCases := []struct {
+		name     string
+		requests []string
+		pkg      string
+		expected []DependencyChain
+	}{
+		{
+			name:     "requested",
+			requests: []string{"curl", "glibc.x86_64"},
+			pkg:      "glibc.x86_64",
+			expected: []DependencyChain{
+				{Request: "glibc.x86_64", Package: glibcNEVRA, Dependencies: []Dependency{}},
+				{Request: "curl", Package: glibcNEVRA, Dependencies: []Dependency{
+					{From: curlNEVRA, To: glibcNEVRA, Requires: "libc.so.6()(64bit)"},
+				}},
+			},
+		},
+		{
+			name:     "shortest chain",
+			requests: []string{"curl"},
+			pkg:      "bash",
+			expected: []DependencyChain{
+				{Request: "curl", Package: bashNEVRA, Dependencies: []Dependency{
+					{From: curlNEVRA, To: libcurlNEVRA, Requires: "libcurl >= 8.0"},
+					{From: libcurlNEVRA, To: bashNEVRA, Requires: "/bin/sh"},
+				}},
+			},
+		},
+		{
+			name:     "requested by provide and file",
+			requests: []string{"/bin/sh", "/usr/lib64/libcurl.so.4", "@core"},
+			pkg:      "openssl-libs",
+			expected: []DependencyChain{
+				{Request: "/usr/lib64/libcurl.so.4", Package: opensslNEVRA, Dependencies: []Dependency{
+					{From: libcurlNEVRA, To: opensslNEVRA, Requires: "libssl.so.3()(64bit)"},
+				}},
+			},
+		},
+		{
+			name:     "multilib",
+			requests: []string{"curl", "wine-core"},
+			pkg:      "glibc.i686",
+			expected: []DependencyChain{
+				{Request: "wine-core", Package: glibcI686NEVRA, Dependencies: []Dependency{
+					{From: wineNEVRA, To: glibcI686NEVRA, Requires: "libc.so.6"},
+				}},
+			},
+		},
+		{
+			name:     "multilib by name",
+			requests: []string{"wine-core", "bash"},
+			pkg:      "glibc",
+			expected: []DependencyChain{
+				{Request: "wine-core", Package: glibcI686NEVRA, Dependencies: []Dependency{
+					{From: wineNEVRA, To: glibcI686NEVRA, Requires: "libc.so.6"},
+				}},
+				{Request: "bash", Package: glibcNEVRA, Dependencies: []Dependency{
+					{From: bashNEVRA, To: glibcNEVRA, Requires: "libc.so.6()(64bit)"},
+				}},
+			},
+		},
+		{
+			name:     "not pulled in",
+			requests: []string{"bash"},
+			pkg:      "curl",
+			expected: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			chains, err := result.WhyPackage(tc.requests, tc.pkg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, chains)
+		})
+	}
+}
+
+func TestWhyPackageErrors(t *testing.T) {
+	result := DepsolveResult{Transactions: testDependencyTransactions}
+
+	_, err := result.WhyPackage([]string{"curl"}, "glibc")
+	assert.EqualError(t, err, "depsolve result has no dependencies, the depsolve must be run with dependencies enabled")
+
+	_, err = result.WhyPackage([]string{"curl"}, "vim")
+	assert.EqualError(t, err, `package "vim" not found in transactions`)
+}
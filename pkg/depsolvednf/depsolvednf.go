@@ -158,6 +158,8 @@ type Solver struct {
 
 	sbomType sbom.StandardType
 
+	dependencies bool
+
 	// Stderr is the stderr output from osbuild-depsolve-dnf, if unset os.Stderr
 	// will be used.
 	//
@@ -179,6 +181,10 @@ type DepsolveResult struct {
 	Repos        []rpmmd.RepoConfig
 	SBOM         *sbom.Document
 	Solver       string
+	// Dependencies are the requires edges between the packages of the
+	// transactions, only set if the solver was asked for them with
+	// [Solver.SetDependencies].
+	Dependencies []Dependency
 }
 
 // DumpResult contains the results of a dump operation.
@@ -239,6 +245,7 @@ func (s *Solver) solverCfg() *solverConfig {
 		rootDir:          s.rootDir,
 		proxy:            s.proxy,
 		subscriptions:    s.subscriptions,
+		dependencies:     s.dependencies,
 	}
 }
 
@@ -269,6 +276,12 @@ func (s *Solver) SetSBOMType(sbomType sbom.StandardType) {
 	s.sbomType = sbomType
 }
 
+// SetDependencies enables returning the dependency edges between the
+// depsolved packages, see [DepsolveResult.WhyPackage].
+func (s *Solver) SetDependencies(enabled bool) {
+	s.dependencies = enabled
+}
+
 // Depsolve the list of required package sets with explicit excludes using
 // their associated repositories.  Each package set is depsolved as a separate
 // transactions in a chain.  It returns a list of all packages (with solved
@@ -283,8 +296,15 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 		return nil, err
 	}
 
+	// The depsolver can only generate SPDX documents, other standard
+	// types are converted from the SPDX document afterwards.
+	requestSBOMType := sbomType
+	if requestSBOMType != sbom.StandardTypeNone {
+		requestSBOMType = sbom.StandardTypeSpdx
+	}
+
 	cfg := s.solverCfg()
-	reqData, err := activeHandler.makeDepsolveRequest(cfg, pkgSets, sbomType)
+	reqData, err := activeHandler.makeDepsolveRequest(cfg, pkgSets, requestSBOMType)
 	if err != nil {
 		return nil, fmt.Errorf("makeDepsolveRequest failed: %w", err)
 	}
@@ -321,10 +341,20 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 
 	var sbomDoc *sbom.Document
 	if sbomType != sbom.StandardTypeNone {
-		sbomDoc, err = sbom.NewDocument(sbomType, resultRaw.SBOMRaw)
+		sbomDoc, err = sbom.NewDocument(requestSBOMType, resultRaw.SBOMRaw)
 		if err != nil {
 			return nil, fmt.Errorf("creating SBOM document failed: %w", err)
 		}
+		sbomDoc, err = sbomDoc.Convert(sbomType)
+		if err != nil {
+			return nil, fmt.Errorf("converting SBOM document failed: %w", err)
+		}
+	}
+
+	dependencies := resultRaw.Dependencies
+	if s.dependencies && dependencies == nil {
+		// older depsolvers do not return the edges
+		dependencies = resolveDependencies(resultRaw.Transactions)
 	}
 
 	return &DepsolveResult{
@@ -333,6 +363,7 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 		Repos:        resultRaw.Repos,
 		SBOM:         sbomDoc,
 		Solver:       resultRaw.Solver,
+		Dependencies: dependencies,
 	}, nil
 }
 
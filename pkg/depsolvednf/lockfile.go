@@ -0,0 +1,399 @@
+package depsolvednf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// LockfileVersion is the version of the lockfile format written by
+// Lockfile.Write. Lockfiles of other versions are rejected by
+// ReadLockfile.
+const LockfileVersion = 1
+
+// LockedGPGKeyDir is the directory of the GPG keys that are imported
+// from the tree. Recording all files of all packages would bloat the
+// lockfile, only the files in this directory are recorded.
+const LockedGPGKeyDir = "/etc/pki/rpm-gpg/"
+
+// Lockfile records the results of depsolving the package sets of all
+// pipelines of a manifest so that the manifest can be regenerated later
+// with exactly the same packages and without running the depsolver.
+type Lockfile struct {
+	Version   int                       `json:"version"`
+	Pipelines map[string]LockedPipeline `json:"pipelines"`
+}
+
+// LockedPipeline is the depsolve result of a single pipeline
+type LockedPipeline struct {
+	Solver string `json:"solver"`
+	// Repos are the repositories the packages were resolved from, their
+	// IDs are the hashes of the configured repositories, see
+	// rpmmd.RepoConfig.Hash()
+	Repos   []rpmmd.RepoConfig `json:"repos"`
+	Modules []LockedModule     `json:"modules,omitempty"`
+	// Transactions are the packages of each depsolve transaction, see
+	// DepsolveResult.Transactions
+	Transactions [][]LockedPackage `json:"transactions"`
+}
+
+// LockedPackage is a single package of a depsolve transaction
+type LockedPackage struct {
+	Name    string `json:"name"`
+	Epoch   uint   `json:"epoch"`
+	Version string `json:"version"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+	// Checksum in the form "<type>:<value>"
+	Checksum        string   `json:"checksum"`
+	Location        string   `json:"location"`
+	RemoteLocations []string `json:"remote_locations,omitempty"`
+	RepoID          string   `json:"repo_id"`
+
+	License      string `json:"license,omitempty"`
+	Vendor       string `json:"vendor,omitempty"`
+	DownloadSize uint64 `json:"download_size,omitempty"`
+	InstallSize  uint64 `json:"install_size,omitempty"`
+
+	Secrets   string `json:"secrets,omitempty"`
+	CheckGPG  bool   `json:"check_gpg,omitempty"`
+	IgnoreSSL bool   `json:"ignore_ssl,omitempty"`
+
+	// Files of the package that can be imported as GPG keys from the
+	// tree, see LockedGPGKeyDir
+	Files []string `json:"files,omitempty"`
+}
+
+// LockedModule is a module that was enabled when depsolving a pipeline
+type LockedModule struct {
+	Name         string   `json:"name"`
+	Stream       string   `json:"stream"`
+	Profiles     []string `json:"profiles,omitempty"`
+	State        string   `json:"state,omitempty"`
+	ConfigPath   string   `json:"config_path"`
+	FailsafePath string   `json:"failsafe_path"`
+	FailsafeData string   `json:"failsafe_data"`
+}
+
+// NewLockfile returns the lockfile for the given depsolve results, they
+// are usually the results of Solver.DepsolveAll(). SBOMs are not
+// recorded.
+func NewLockfile(results map[string]DepsolveResult) *Lockfile {
+	lf := &Lockfile{
+		Version:   LockfileVersion,
+		Pipelines: make(map[string]LockedPipeline, len(results)),
+	}
+	for name, res := range results {
+		pipeline := LockedPipeline{
+			Solver:       res.Solver,
+			Repos:        slices.Clone(res.Repos),
+			Transactions: make([][]LockedPackage, 0, len(res.Transactions)),
+		}
+		for _, mod := range res.Modules {
+			pipeline.Modules = append(pipeline.Modules, LockedModule{
+				Name:         mod.ModuleConfigFile.Data.Name,
+				Stream:       mod.ModuleConfigFile.Data.Stream,
+				Profiles:     slices.Clone(mod.ModuleConfigFile.Data.Profiles),
+				State:        mod.ModuleConfigFile.Data.State,
+				ConfigPath:   mod.ModuleConfigFile.Path,
+				FailsafePath: mod.FailsafeFile.Path,
+				FailsafeData: mod.FailsafeFile.Data,
+			})
+		}
+		for _, trans := range res.Transactions {
+			pkgs := make([]LockedPackage, 0, len(trans))
+			for _, pkg := range trans {
+				pkgs = append(pkgs, LockedPackage{
+					Name:            pkg.Name,
+					Epoch:           pkg.Epoch,
+					Version:         pkg.Version,
+					Release:         pkg.Release,
+					Arch:            pkg.Arch,
+					Checksum:        pkg.Checksum.String(),
+					Location:        pkg.Location,
+					RemoteLocations: slices.Clone(pkg.RemoteLocations),
+					RepoID:          pkg.RepoID,
+					License:         pkg.License,
+					Vendor:          pkg.Vendor,
+					DownloadSize:    pkg.DownloadSize,
+					InstallSize:     pkg.InstallSize,
+					Secrets:         pkg.Secrets,
+					CheckGPG:        pkg.CheckGPG,
+					IgnoreSSL:       pkg.IgnoreSSL,
+					Files:           gpgKeyFiles(pkg.Files),
+				})
+			}
+			pipeline.Transactions = append(pipeline.Transactions, pkgs)
+		}
+		lf.Pipelines[name] = pipeline
+	}
+	return lf
+}
+
+func gpgKeyFiles(files []string) []string {
+	var keys []string
+	for _, f := range files {
+		if strings.HasPrefix(f, LockedGPGKeyDir) {
+			keys = append(keys, f)
+		}
+	}
+	return keys
+}
+
+// ReadLockfile reads a lockfile written by Lockfile.Write
+func ReadLockfile(r io.Reader) (*Lockfile, error) {
+	var lf Lockfile
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&lf); err != nil {
+		return nil, fmt.Errorf("cannot parse lockfile: %w", err)
+	}
+	if lf.Version != LockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d, expected %d", lf.Version, LockfileVersion)
+	}
+	return &lf, nil
+}
+
+// Write writes the lockfile as indented JSON
+func (lf *Lockfile) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(lf)
+}
+
+// DepsolveResults returns the depsolve results recorded in the lockfile,
+// they can be passed to manifest.Manifest.Serialize(). The results have
+// no SBOM.
+func (lf *Lockfile) DepsolveResults() (map[string]DepsolveResult, error) {
+	results := make(map[string]DepsolveResult, len(lf.Pipelines))
+	for name, pipeline := range lf.Pipelines {
+		res := DepsolveResult{
+			Repos:  slices.Clone(pipeline.Repos),
+			Solver: pipeline.Solver,
+		}
+		repoMap := make(map[string]*rpmmd.RepoConfig, len(res.Repos))
+		for i := range res.Repos {
+			repoMap[res.Repos[i].Id] = &res.Repos[i]
+		}
+
+		for _, mod := range pipeline.Modules {
+			res.Modules = append(res.Modules, rpmmd.ModuleSpec{
+				ModuleConfigFile: rpmmd.ModuleConfigFile{
+					Path: mod.ConfigPath,
+					Data: rpmmd.ModuleConfigData{
+						Name:     mod.Name,
+						Stream:   mod.Stream,
+						Profiles: slices.Clone(mod.Profiles),
+						State:    mod.State,
+					},
+				},
+				FailsafeFile: rpmmd.ModuleFailsafeFile{
+					Path: mod.FailsafePath,
+					Data: mod.FailsafeData,
+				},
+			})
+		}
+
+		for _, lockedTrans := range pipeline.Transactions {
+			trans := make(rpmmd.PackageList, 0, len(lockedTrans))
+			for _, lp := range lockedTrans {
+				repo, ok := repoMap[lp.RepoID]
+				if !ok {
+					return nil, fmt.Errorf("package %s of pipeline %q is from repository %q that is not in the lockfile", lp.Name, name, lp.RepoID)
+				}
+				checksumType, checksumValue, ok := strings.Cut(lp.Checksum, ":")
+				if !ok || checksumType == "" || checksumValue == "" {
+					return nil, fmt.Errorf("package %s of pipeline %q has an invalid checksum %q", lp.Name, name, lp.Checksum)
+				}
+				trans = append(trans, rpmmd.Package{
+					Name:    lp.Name,
+					Epoch:   lp.Epoch,
+					Version: lp.Version,
+					Release: lp.Release,
+					Arch:    lp.Arch,
+					Checksum: rpmmd.Checksum{
+						Type:  checksumType,
+						Value: checksumValue,
+					},
+					Location:        lp.Location,
+					RemoteLocations: slices.Clone(lp.RemoteLocations),
+					RepoID:          lp.RepoID,
+					Repo:            repo,
+					License:         lp.License,
+					Vendor:          lp.Vendor,
+					DownloadSize:    lp.DownloadSize,
+					InstallSize:     lp.InstallSize,
+					Secrets:         lp.Secrets,
+					CheckGPG:        lp.CheckGPG,
+					IgnoreSSL:       lp.IgnoreSSL,
+					Files:           slices.Clone(lp.Files),
+				})
+			}
+			res.Transactions = append(res.Transactions, trans)
+		}
+		results[name] = res
+	}
+	return results, nil
+}
+
+// PipelineDrift describes why the locked packages of a pipeline no longer
+// satisfy its package sets
+type PipelineDrift struct {
+	Pipeline string
+	Reasons  []string
+}
+
+// LockfileDriftError is returned by Lockfile.Check when the lockfile does
+// not match the package sets it is checked against
+type LockfileDriftError struct {
+	// Drift of every pipeline that drifted, sorted by pipeline name
+	Drift []PipelineDrift
+}
+
+// Pipelines returns the names of the pipelines that drifted
+func (e *LockfileDriftError) Pipelines() []string {
+	names := make([]string, 0, len(e.Drift))
+	for _, d := range e.Drift {
+		names = append(names, d.Pipeline)
+	}
+	return names
+}
+
+func (e *LockfileDriftError) Error() string {
+	var lines []string
+	for _, d := range e.Drift {
+		lines = append(lines, fmt.Sprintf("pipeline %q: %s", d.Pipeline, strings.Join(d.Reasons, ", ")))
+	}
+	return fmt.Sprintf("lockfile does not match the package sets:\n%s", strings.Join(lines, "\n"))
+}
+
+// Check returns a *LockfileDriftError if the locked packages no longer
+// satisfy the given package set chains, i.e. if pipelines were added or
+// removed, if packages that are included are not locked or packages that
+// are excluded are, if enabled modules are not locked or if locked
+// packages come from repositories that are no longer configured.
+//
+// Only includes and excludes that are plain package names are checked,
+// groups, file paths, globs and other provides cannot be matched
+// without the depsolver.
+func (lf *Lockfile) Check(pkgSetChains map[string][]rpmmd.PackageSet) error {
+	names := make([]string, 0, len(pkgSetChains)+len(lf.Pipelines))
+	for name := range pkgSetChains {
+		names = append(names, name)
+	}
+	for name := range lf.Pipelines {
+		if _, ok := pkgSetChains[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var drift []PipelineDrift
+	for _, name := range names {
+		chain, inChains := pkgSetChains[name]
+		pipeline, locked := lf.Pipelines[name]
+		var reasons []string
+		switch {
+		case !locked:
+			reasons = []string{"not in the lockfile"}
+		case !inChains:
+			reasons = []string{"has no package sets"}
+		default:
+			reasons = pipeline.check(chain)
+		}
+		if len(reasons) > 0 {
+			drift = append(drift, PipelineDrift{Pipeline: name, Reasons: reasons})
+		}
+	}
+	if len(drift) > 0 {
+		return &LockfileDriftError{Drift: drift}
+	}
+	return nil
+}
+
+func (p *LockedPipeline) check(chain []rpmmd.PackageSet) []string {
+	lockedPkgs := make(map[string]bool)
+	lockedRepos := make(map[string]bool)
+	for _, trans := range p.Transactions {
+		for _, pkg := range trans {
+			lockedPkgs[pkg.Name] = true
+			lockedRepos[pkg.RepoID] = true
+		}
+	}
+	lockedModules := make(map[string]bool)
+	for _, mod := range p.Modules {
+		lockedModules[mod.Name+":"+mod.Stream] = true
+	}
+
+	var missing, excluded, modules []string
+	configuredRepos := make(map[string]bool)
+	for _, ps := range chain {
+		for _, include := range ps.Include {
+			if isPackageName(include) && !lockedPkgs[include] && !slices.Contains(missing, include) {
+				missing = append(missing, include)
+			}
+		}
+		for _, exclude := range ps.Exclude {
+			if isPackageName(exclude) && lockedPkgs[exclude] && !slices.Contains(excluded, exclude) {
+				excluded = append(excluded, exclude)
+			}
+		}
+		for _, mod := range ps.EnabledModules {
+			// modules are enabled as "name:stream" or
+			// "name:stream/profile"
+			nameStream, _, _ := strings.Cut(mod, "/")
+			if !lockedModules[nameStream] && !slices.Contains(modules, mod) {
+				modules = append(modules, mod)
+			}
+		}
+		for _, repo := range ps.Repositories {
+			// the depsolver identifies repositories by their
+			// hash, custom depsolvers may keep the configured ID
+			configuredRepos[repo.Hash()] = true
+			if repo.Id != "" {
+				configuredRepos[repo.Id] = true
+			}
+		}
+	}
+	var repos []string
+	for _, repo := range p.Repos {
+		if lockedRepos[repo.Id] && !configuredRepos[repo.Id] {
+			repos = append(repos, repoName(repo))
+		}
+	}
+
+	var reasons []string
+	if len(missing) > 0 {
+		reasons = append(reasons, fmt.Sprintf("packages not locked: %s", strings.Join(missing, ", ")))
+	}
+	if len(excluded) > 0 {
+		reasons = append(reasons, fmt.Sprintf("excluded packages locked: %s", strings.Join(excluded, ", ")))
+	}
+	if len(modules) > 0 {
+		reasons = append(reasons, fmt.Sprintf("modules not locked: %s", strings.Join(modules, ", ")))
+	}
+	if len(repos) > 0 {
+		reasons = append(reasons, fmt.Sprintf("repositories no longer configured: %s", strings.Join(repos, ", ")))
+	}
+	return reasons
+}
+
+func repoName(repo rpmmd.RepoConfig) string {
+	if repo.Name != "" {
+		return repo.Name
+	}
+	return repo.Id
+}
+
+// isPackageName returns true if s can only be matched by the name of a
+// package and not by a group, a file, a glob or another provide
+func isPackageName(s string) bool {
+	if s == "" || strings.HasPrefix(s, "@") || strings.HasPrefix(s, "/") {
+		return false
+	}
+	return !strings.ContainsAny(s, "*?[]()<>= ")
+}
@@ -0,0 +1,189 @@
+package depsolvednf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/sbom"
+)
+
+func lockfileTestResults(t *testing.T) (map[string]DepsolveResult, rpmmd.RepoConfig) {
+	configured := rpmmd.RepoConfig{
+		Name:     "baseos",
+		BaseURLs: []string{"https://example.com/baseos"},
+		GPGKeys:  []string{"-----BEGIN PGP PUBLIC KEY BLOCK-----"},
+		CheckGPG: common.ToPtr(true),
+	}
+	repo := configured
+	repo.Id = configured.Hash()
+	repo.IgnoreSSL = common.ToPtr(false)
+
+	sbomDoc, err := sbom.NewDocument(sbom.StandardTypeSpdx, []byte(`{}`))
+	require.NoError(t, err)
+
+	results := map[string]DepsolveResult{
+		"build": {
+			Transactions: TransactionList{
+				{
+					{
+						Name:            "bash",
+						Version:         "5.2",
+						Release:         "1.fc43",
+						Arch:            "x86_64",
+						Checksum:        rpmmd.Checksum{Type: "sha256", Value: "abc"},
+						Location:        "Packages/b/bash-5.2-1.fc43.x86_64.rpm",
+						RemoteLocations: []string{"https://example.com/baseos/Packages/b/bash-5.2-1.fc43.x86_64.rpm"},
+						RepoID:          repo.Id,
+						Repo:            &repo,
+						License:         "GPL-3.0-or-later",
+						Vendor:          "Fedora Project",
+						InstallSize:     8 * 1024 * 1024,
+						CheckGPG:        true,
+						Files:           []string{"/usr/bin/bash", "/etc/pki/rpm-gpg/RPM-GPG-KEY-test"},
+						Summary:         "not locked",
+					},
+				},
+			},
+			Modules: []rpmmd.ModuleSpec{
+				{
+					ModuleConfigFile: rpmmd.ModuleConfigFile{
+						Path: "/etc/dnf/modules.d/nodejs.module",
+						Data: rpmmd.ModuleConfigData{Name: "nodejs", Stream: "22", Profiles: []string{"common"}, State: "enabled"},
+					},
+					FailsafeFile: rpmmd.ModuleFailsafeFile{Path: "/var/lib/dnf/modulefailsafe/nodejs:22", Data: "failsafe"},
+				},
+			},
+			Repos:  []rpmmd.RepoConfig{repo},
+			SBOM:   sbomDoc,
+			Solver: "dnf5",
+		},
+	}
+	return results, configured
+}
+
+func TestLockfileRoundtrip(t *testing.T) {
+	results, _ := lockfileTestResults(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, NewLockfile(results).Write(&buf))
+	lf, err := ReadLockfile(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, LockfileVersion, lf.Version)
+
+	locked, err := lf.DepsolveResults()
+	require.NoError(t, err)
+	require.Contains(t, locked, "build")
+	res := locked["build"]
+	assert.Nil(t, res.SBOM)
+	assert.Equal(t, "dnf5", res.Solver)
+	assert.Equal(t, results["build"].Repos, res.Repos)
+	assert.Equal(t, results["build"].Modules, res.Modules)
+
+	require.Len(t, res.Transactions, 1)
+	require.Len(t, res.Transactions[0], 1)
+	pkg := res.Transactions[0][0]
+	expected := results["build"].Transactions[0][0]
+	expected.Files = []string{"/etc/pki/rpm-gpg/RPM-GPG-KEY-test"}
+	expected.Summary = ""
+	expected.Repo = &res.Repos[0]
+	assert.Equal(t, expected, pkg)
+	// the package points to the repository of the result
+	assert.Same(t, &res.Repos[0], pkg.Repo)
+}
+
+func TestReadLockfileErrors(t *testing.T) {
+	_, err := ReadLockfile(strings.NewReader(`{"version": 2, "pipelines": {}}`))
+	assert.EqualError(t, err, "unsupported lockfile version 2, expected 1")
+
+	_, err = ReadLockfile(strings.NewReader(`{"version": 1, "pipelines": {}, "unknown": 1}`))
+	assert.ErrorContains(t, err, "cannot parse lockfile")
+}
+
+func TestLockfileDepsolveResultsErrors(t *testing.T) {
+	lf := &Lockfile{
+		Version: LockfileVersion,
+		Pipelines: map[string]LockedPipeline{
+			"os": {Transactions: [][]LockedPackage{{{Name: "bash", Checksum: "sha256:abc", RepoID: "missing"}}}},
+		},
+	}
+	_, err := lf.DepsolveResults()
+	assert.EqualError(t, err, `package bash of pipeline "os" is from repository "missing" that is not in the lockfile`)
+
+	lf.Pipelines["os"] = LockedPipeline{
+		Repos:        []rpmmd.RepoConfig{{Id: "repo"}},
+		Transactions: [][]LockedPackage{{{Name: "bash", Checksum: "abc", RepoID: "repo"}}},
+	}
+	_, err = lf.DepsolveResults()
+	assert.EqualError(t, err, `package bash of pipeline "os" has an invalid checksum "abc"`)
+}
+
+func TestLockfileCheck(t *testing.T) {
+	results, configured := lockfileTestResults(t)
+	lf := NewLockfile(results)
+
+	otherRepo := rpmmd.RepoConfig{Name: "other", BaseURLs: []string{"https://example.com/other"}}
+
+	for _, tc := range []struct {
+		name      string
+		chains    map[string][]rpmmd.PackageSet
+		pipelines []string
+		expected  string
+	}{
+		{
+			name: "satisfied",
+			chains: map[string][]rpmmd.PackageSet{
+				"build": {{
+					Include:        []string{"bash", "@core", "/usr/bin/sh", "python3-*", "pkgconfig(glib-2.0)"},
+					Exclude:        []string{"dracut"},
+					EnabledModules: []string{"nodejs:22/common"},
+					Repositories:   []rpmmd.RepoConfig{configured},
+				}},
+			},
+		},
+		{
+			name: "drift",
+			chains: map[string][]rpmmd.PackageSet{
+				"build": {
+					{
+						Include:        []string{"bash", "dnf"},
+						Exclude:        []string{"bash"},
+						EnabledModules: []string{"nodejs:24"},
+						Repositories:   []rpmmd.RepoConfig{otherRepo},
+					},
+					{Include: []string{"dnf", "kernel"}},
+				},
+				"os": {{Include: []string{"bash"}}},
+			},
+			pipelines: []string{"build", "os"},
+			expected: `lockfile does not match the package sets:
+pipeline "build": packages not locked: dnf, kernel, excluded packages locked: bash, modules not locked: nodejs:24, repositories no longer configured: baseos
+pipeline "os": not in the lockfile`,
+		},
+		{
+			name:      "pipeline removed",
+			chains:    map[string][]rpmmd.PackageSet{},
+			pipelines: []string{"build"},
+			expected: `lockfile does not match the package sets:
+pipeline "build": has no package sets`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := lf.Check(tc.chains)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expected)
+			var driftErr *LockfileDriftError
+			require.True(t, errors.As(err, &driftErr))
+			assert.Equal(t, tc.pipelines, driftErr.Pipelines())
+		})
+	}
+}
@@ -38,6 +38,25 @@ func (t TransactionList) FindPackage(name string) (*rpmmd.Package, error) {
 	return nil, fmt.Errorf("package %q not found in transactions", name)
 }
 
+// FindPackages returns the packages of all transactions with the given name,
+// name.arch or NEVRA, sorted by full NEVRA. A name matches the packages of
+// all architectures, e.g. both multilib packages.
+func (t TransactionList) FindPackages(spec string) rpmmd.PackageList {
+	return matchingPackages(t.AllPackages(), spec)
+}
+
+// matchingPackages returns the packages with the given name, name.arch or
+// NEVRA, the epoch of the NEVRA may be omitted if it is zero
+func matchingPackages(pkgs rpmmd.PackageList, spec string) rpmmd.PackageList {
+	var matches rpmmd.PackageList
+	for _, pkg := range pkgs {
+		if pkg.Name == spec || pkg.Name+"."+pkg.Arch == spec || pkg.FullNEVRA() == spec || pkg.Name+"-"+pkg.EVRA() == spec {
+			matches = append(matches, pkg)
+		}
+	}
+	return matches
+}
+
 // TransactionFileInfo contains information about a file provided by a package
 // within a transaction list.
 type TransactionFileInfo struct {
@@ -164,6 +164,9 @@ type v2Arguments struct {
 
 	// Optionally request an SBOM from depsolving
 	Sbom *v2SbomRequest `json:"sbom,omitempty"`
+
+	// Optionally request the dependency edges resolved while depsolving
+	Dependencies bool `json:"dependencies,omitempty"`
 }
 
 // v2TransactionArgs contains arguments for a single depsolve transaction.
@@ -206,6 +209,15 @@ type v2DepsolveResult struct {
 	Repos        map[string]v2Repository `json:"repos"`
 	Modules      map[string]v2ModuleSpec `json:"modules"`
 	SBOM         json.RawMessage         `json:"sbom,omitempty"`
+	Dependencies []v2DependencyEdge      `json:"dependencies,omitempty"`
+}
+
+// v2DependencyEdge represents a resolved requires of a depsolved package,
+// packages are referenced by their NEVRA.
+type v2DependencyEdge struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Requires v2Dependency `json:"requires"`
 }
 
 // v2PackageListResult is the common response structure for dump and search.
@@ -269,6 +281,7 @@ func (h *v2Handler) makeDepsolveRequest(cfg *solverConfig, pkgSets []rpmmd.Packa
 	if sbomType != sbom.StandardTypeNone {
 		req.Arguments.Sbom = &v2SbomRequest{Type: sbomType.String()}
 	}
+	req.Arguments.Dependencies = cfg.dependencies
 
 	return json.Marshal(req)
 }
@@ -347,6 +360,11 @@ func (h *v2Handler) parseDepsolveResult(output []byte) (*depsolveResultRaw, erro
 		transactions[transIdx] = transPkgs
 	}
 
+	dependencies, err := h.toDependencies(result.Dependencies, transactions)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert modules
 	modules := make([]rpmmd.ModuleSpec, 0, len(result.Modules))
 	for _, mod := range result.Modules {
@@ -359,9 +377,45 @@ func (h *v2Handler) parseDepsolveResult(output []byte) (*depsolveResultRaw, erro
 		Repos:        repos,
 		Solver:       result.Solver,
 		SBOMRaw:      result.SBOM,
+		Dependencies: dependencies,
 	}, nil
 }
 
+// toDependencies converts the dependency edges of the response to edges
+// between full NEVRAs, the depsolver may reference packages with or without
+// their zero epoch.
+func (h *v2Handler) toDependencies(edges []v2DependencyEdge, transactions TransactionList) ([]Dependency, error) {
+	if edges == nil {
+		return nil, nil
+	}
+	nevras := make(map[string]string)
+	for _, pkg := range transactions.AllPackages() {
+		nevras[pkg.FullNEVRA()] = pkg.FullNEVRA()
+		nevras[pkg.Name+"-"+pkg.EVRA()] = pkg.FullNEVRA()
+	}
+	deps := make([]Dependency, 0, len(edges))
+	for _, edge := range edges {
+		from, ok := nevras[edge.From]
+		if !ok {
+			return nil, fmt.Errorf("dependency of unknown package: %s", edge.From)
+		}
+		to, ok := nevras[edge.To]
+		if !ok {
+			return nil, fmt.Errorf("dependency on unknown package: %s", edge.To)
+		}
+		deps = append(deps, Dependency{
+			From: from,
+			To:   to,
+			Requires: formatRelDep(rpmmd.RelDep{
+				Name:         edge.Requires.Name,
+				Relationship: edge.Requires.Relation,
+				Version:      edge.Requires.Version,
+			}),
+		})
+	}
+	return deps, nil
+}
+
 func (h *v2Handler) parseDumpResult(output []byte) (*DumpResult, error) {
 	pkgs, repos, solver, err := h.parsePackageListResult(output, "dump")
 	if err != nil {
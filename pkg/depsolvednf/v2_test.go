@@ -232,10 +232,11 @@ func TestV2HandlerMakeDepsolveRequest(t *testing.T) {
 	}
 
 	testCases := []struct {
-		name        string
-		packageSets []rpmmd.PackageSet
-		withSbom    bool
-		wantJSON    string
+		name             string
+		packageSets      []rpmmd.PackageSet
+		withSbom         bool
+		withDependencies bool
+		wantJSON         string
 	}{
 		{
 			name: "single transaction",
@@ -519,19 +520,49 @@ func TestV2HandlerMakeDepsolveRequest(t *testing.T) {
 				}
 			}`, baseOS.Hash(), appstream.Hash()),
 		},
+		{
+			name: "withDependencies flag",
+			packageSets: []rpmmd.PackageSet{
+				{
+					Include:      []string{"pkg1"},
+					Repositories: []rpmmd.RepoConfig{baseOS},
+				},
+			},
+			withDependencies: true,
+			wantJSON: fmt.Sprintf(`{
+				"api_version": 2,
+				"command": "depsolve",
+				"module_platform_id": "platform:el8",
+				"releasever": "8",
+				"arch": "x86_64",
+				"cachedir": "/cache",
+				"arguments": {
+					"repos": [
+						{"id": %[1]q, "name": "baseos", "baseurl": ["https://example.org/baseos"]}
+					],
+					"transactions": [
+						{"package-specs": ["pkg1"], "repo-ids": [%[1]q], "install_weak_deps": false}
+					],
+					"root_dir": "/root",
+					"optional-metadata": ["filelists"],
+					"dependencies": true
+				}
+			}`, baseOS.Hash()),
+		},
 	}
 
-	cfg := &solverConfig{
-		modulePlatformID: "platform:el8",
-		arch:             "x86_64",
-		releaseVer:       "8",
-		cacheDir:         "/cache",
-		rootDir:          "/root",
-	}
 	v2Handler := newV2Handler()
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
+			cfg := &solverConfig{
+				modulePlatformID: "platform:el8",
+				arch:             "x86_64",
+				releaseVer:       "8",
+				cacheDir:         "/cache",
+				rootDir:          "/root",
+				dependencies:     tt.withDependencies,
+			}
 			var sbomType sbom.StandardType
 			if tt.withSbom {
 				sbomType = sbom.StandardTypeSpdx
@@ -1498,6 +1529,47 @@ func TestV2HandlerParseDepsolveResultWithModules(t *testing.T) {
 	assert.Equal(t, "failsafe data", mod.FailsafeFile.Data)
 }
 
+func TestV2HandlerParseDepsolveResultWithDependencies(t *testing.T) {
+	v2Handler := newV2Handler()
+
+	input := `{
+		"solver": "dnf5",
+		"transactions": [
+			[
+				{"name": "glibc", "epoch": 0, "version": "2.34", "release": "1", "arch": "x86_64", "repo_id": "baseos", "checksum": {"algorithm": "sha256", "value": "abc"}},
+				{"name": "bash", "epoch": 1, "version": "5.1", "release": "1", "arch": "x86_64", "repo_id": "baseos", "checksum": {"algorithm": "sha256", "value": "def"}}
+			]
+		],
+		"repos": {"baseos": {"id": "baseos", "name": "BaseOS"}},
+		"modules": {},
+		"dependencies": [
+			{"from": "bash-1:5.1-1.x86_64", "to": "glibc-2.34-1.x86_64", "requires": {"name": "glibc", "relation": ">=", "version": "2.34"}},
+			{"from": "bash-1:5.1-1.x86_64", "to": "glibc-0:2.34-1.x86_64", "requires": {"name": "libc.so.6()(64bit)"}}
+		]
+	}`
+
+	result, err := v2Handler.parseDepsolveResult([]byte(input))
+	require.NoError(t, err)
+	assert.Equal(t, []Dependency{
+		{From: "bash-1:5.1-1.x86_64", To: "glibc-0:2.34-1.x86_64", Requires: "glibc >= 2.34"},
+		{From: "bash-1:5.1-1.x86_64", To: "glibc-0:2.34-1.x86_64", Requires: "libc.so.6()(64bit)"},
+	}, result.Dependencies)
+
+	// older depsolvers do not return dependencies
+	result, err = v2Handler.parseDepsolveResult([]byte(`{"solver": "dnf5", "transactions": [], "repos": {}, "modules": {}}`))
+	require.NoError(t, err)
+	assert.Nil(t, result.Dependencies)
+
+	_, err = v2Handler.parseDepsolveResult([]byte(`{
+		"solver": "dnf5",
+		"transactions": [],
+		"repos": {},
+		"modules": {},
+		"dependencies": [{"from": "bash-1:5.1-1.x86_64", "to": "glibc-2.34-1.x86_64", "requires": {"name": "glibc"}}]
+	}`))
+	assert.EqualError(t, err, "dependency of unknown package: bash-1:5.1-1.x86_64")
+}
+
 // TestV2HandlerParseDepsolveResultDetails verifies that parseDepsolveResult
 // correctly parses all package and repository fields into rpmmd types.
 func TestV2HandlerParseDepsolveResultDetails(t *testing.T) {
@@ -0,0 +1,118 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// formatSize formats a size with the largest binary unit that divides it
+func formatSize(size datasizes.Size) string {
+	switch {
+	case size == 0:
+		return "0 B"
+	case size%datasizes.GiB == 0:
+		return fmt.Sprintf("%d GiB", size/datasizes.GiB)
+	case size%datasizes.MiB == 0:
+		return fmt.Sprintf("%d MiB", size/datasizes.MiB)
+	case size%datasizes.KiB == 0:
+		return fmt.Sprintf("%d KiB", size/datasizes.KiB)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+// describeEntity returns the line of an entity in the diagram
+func describeEntity(ent Entity) string {
+	switch e := ent.(type) {
+	case *Filesystem:
+		desc := e.Type
+		if e.Mountpoint != "" {
+			desc += " " + e.Mountpoint
+		}
+		if e.Label != "" {
+			desc += fmt.Sprintf(" (label %q)", e.Label)
+		}
+		return desc
+	case *Swap:
+		return "swap"
+	case *Btrfs:
+		return "btrfs"
+	case *BtrfsSubvolume:
+		desc := "subvolume " + e.Name
+		if e.Mountpoint != "" {
+			desc += " " + e.Mountpoint
+		}
+		return desc
+	case *LUKSContainer:
+		desc := "luks"
+		if e.Clevis != nil && e.Clevis.Pin != "" {
+			desc += fmt.Sprintf(" (clevis %s)", e.Clevis.Pin)
+		}
+		return desc
+	case *LVMVolumeGroup:
+		return "lvm volume group " + e.Name
+	case *LVMLogicalVolume:
+		return fmt.Sprintf("logical volume %s, %s", e.Name, formatSize(e.Size))
+	case *Raw:
+		return "raw from " + e.SourcePath
+	case *VerityHash:
+		return "verity hash of " + e.Target
+	default:
+		return fmt.Sprintf("%T", ent)
+	}
+}
+
+func writeDiagramChildren(b *strings.Builder, ent Entity, indent string) {
+	container, ok := ent.(Container)
+	if !ok {
+		return
+	}
+	count := container.GetItemCount()
+	for idx := uint(0); idx < count; idx++ {
+		child := container.GetChild(idx)
+		branch, next := "├── ", "│   "
+		if idx == count-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(b, "%s%s%s\n", indent, branch, describeEntity(child))
+		writeDiagramChildren(b, child, indent+next)
+	}
+}
+
+// Diagram returns an ASCII diagram of the partition table with the
+// partitions and the entities they contain, e.g.
+//
+//	gpt, 10 GiB
+//	├── 1: 1 MiB at 1 MiB, bios
+//	└── 2: 9 GiB at 2 MiB, root-x86-64
+//	    └── xfs /
+func (pt *PartitionTable) Diagram() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %s\n", pt.Type, formatSize(pt.Size))
+	for idx := range pt.Partitions {
+		p := &pt.Partitions[idx]
+		branch, next := "├── ", "│   "
+		if idx == len(pt.Partitions)-1 {
+			branch, next = "└── ", "    "
+		}
+		partType := p.Type
+		if pt.Type == PT_GPT {
+			partType = repartType(p)
+			if name, ok := repartFilenames[strings.ToUpper(p.Type)]; ok && partType == strings.ToLower(p.Type) {
+				partType = name
+			}
+		}
+		desc := fmt.Sprintf("%d: %s at %s, %s", idx+1, formatSize(p.Size), formatSize(datasizes.Size(p.Start)), partType)
+		if p.Label != "" {
+			desc += fmt.Sprintf(" (name %q)", p.Label)
+		}
+		if p.Bootable {
+			desc += ", bootable"
+		}
+		fmt.Fprintf(&b, "%s%s\n", branch, desc)
+		writeDiagramChildren(&b, p, next)
+	}
+	return b.String()
+}
@@ -0,0 +1,37 @@
+package disk_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/internal/testdisk"
+)
+
+func TestPartitionTableDiagram(t *testing.T) {
+	assert.Equal(t, `gpt, 10 GiB
+├── 1: 1 MiB at 1 MiB, bios, bootable
+├── 2: 200 MiB at 2 MiB, esp (name "ESP")
+│   └── vfat /boot/efi
+├── 3: 1 GiB at 202 MiB, xbootldr
+│   └── xfs /boot
+└── 4: 8966 MiB at 1226 MiB, linux-generic
+    └── luks (clevis tpm2)
+        └── lvm volume group rootvg
+            ├── logical volume rootlv, 5 GiB
+            │   └── xfs /
+            └── logical volume swaplv, 1 GiB
+                └── swap
+`, exportTestPartitionTable().Diagram())
+}
+
+func TestPartitionTableDiagramBtrfs(t *testing.T) {
+	pt := testdisk.MakeFakeBtrfsPartitionTable("/", "/home")
+
+	assert.Equal(t, `gpt, 9 GiB
+└── 1: 9 GiB at 0 B, linux-generic
+    └── btrfs
+        ├── subvolume root /
+        └── subvolume /home /home
+`, pt.Diagram())
+}
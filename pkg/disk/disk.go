@@ -38,6 +38,14 @@ const (
 	// Default sector size in bytes
 	DefaultSectorSize = 512
 
+	// Sector size in bytes of 4K native (4Kn) disks
+	NativeSectorSize4K = 4096
+
+	// Minimum size of an EFI system partition on 4Kn disks. UEFI requires
+	// FAT32 for the ESP and FAT32 needs at least 65525 clusters, with 4096
+	// byte sectors this is about 260 MiB including the FATs.
+	MinESPSize4K = datasizes.Size(260 * datasizes.MiB)
+
 	// Default grain size in bytes. The grain controls how sizes of certain
 	// entities are rounded. For example, by default, partition sizes are
 	// rounded to the next MiB.
@@ -67,6 +75,28 @@ const (
 	UsrPartitionPpc64leGUID = "15BB03AF-77E7-4D4A-B12B-C0D084F7491C" // SD_GPT_USR_PPC64_LE
 	UsrPartitionS390xGUID   = "8A4F5770-50AA-4ED3-874A-99B710DB6FEA" // SD_GPT_USR_S390X
 
+	// dm-verity hash tree partitions for the root and usr partitions
+	RootVerityPartitionX86_64GUID  = "2C7357ED-EBD2-46D9-AEC1-23D437EC2BF5" // SD_GPT_ROOT_X86_64_VERITY
+	RootVerityPartitionAarch64GUID = "DF3300CE-D69F-4C92-978C-9BFB0F38D820" // SD_GPT_ROOT_ARM64_VERITY
+	RootVerityPartitionPpc64leGUID = "906BD944-4589-4AAE-A4E4-DD983917446A" // SD_GPT_ROOT_PPC64_LE_VERITY
+	RootVerityPartitionS390xGUID   = "B325BFBE-C7BE-4AB8-8357-139E652D2F6B" // SD_GPT_ROOT_S390X_VERITY
+
+	UsrVerityPartitionX86_64GUID  = "77FF5F63-E7B6-4633-ACF4-1565B864C0E6" // SD_GPT_USR_X86_64_VERITY
+	UsrVerityPartitionAarch64GUID = "6E11A4E7-FBCA-4DED-B9E9-E1A512BB664E" // SD_GPT_USR_ARM64_VERITY
+	UsrVerityPartitionPpc64leGUID = "EE2B9983-21E8-4153-86D9-B6901A54D1CE" // SD_GPT_USR_PPC64_LE_VERITY
+	UsrVerityPartitionS390xGUID   = "31741CC4-1A2A-4111-A581-E00B447D2D06" // SD_GPT_USR_S390X_VERITY
+
+	// dm-verity signature partitions for the root and usr partitions
+	RootVeritySigPartitionX86_64GUID  = "41092B05-9FC8-4523-994F-2DEF0408B176" // SD_GPT_ROOT_X86_64_VERITY_SIG
+	RootVeritySigPartitionAarch64GUID = "6DB69DE6-29F4-4758-A7A5-962190F00CE3" // SD_GPT_ROOT_ARM64_VERITY_SIG
+	RootVeritySigPartitionPpc64leGUID = "D4A236E7-E873-4C07-BF1D-BF6CF7F1C3C6" // SD_GPT_ROOT_PPC64_LE_VERITY_SIG
+	RootVeritySigPartitionS390xGUID   = "C80187A5-73A3-491A-901A-017C3FA953E9" // SD_GPT_ROOT_S390X_VERITY_SIG
+
+	UsrVeritySigPartitionX86_64GUID  = "E7BB33FB-06CF-4E81-8273-E543B413E2E2" // SD_GPT_USR_X86_64_VERITY_SIG
+	UsrVeritySigPartitionAarch64GUID = "C23CE4FF-44BD-4B00-B2D4-B41B3419E02A" // SD_GPT_USR_ARM64_VERITY_SIG
+	UsrVeritySigPartitionPpc64leGUID = "C8BFBD1E-268E-4521-8BBA-BF314C399557" // SD_GPT_USR_PPC64_LE_VERITY_SIG
+	UsrVeritySigPartitionS390xGUID   = "3F324816-667B-46AE-86EE-9B0C0C6C11B4" // SD_GPT_USR_S390X_VERITY_SIG
+
 	// Partition type IDs for DOS disks
 
 	// Partition type ID for BIOS boot partition on dos.
@@ -112,6 +142,47 @@ const (
 	ESPFstabOptions = "defaults,uid=0,gid=0,umask=077,shortname=winnt"
 )
 
+// archPartitionGUIDs maps the names of architecture specific partition types
+// to their GUIDs on each supported architecture.
+var archPartitionGUIDs = map[string]map[arch.Arch]string{
+	"root": {
+		arch.ARCH_X86_64:  RootPartitionX86_64GUID,
+		arch.ARCH_AARCH64: RootPartitionAarch64GUID,
+		arch.ARCH_PPC64LE: RootPartitionPpc64leGUID,
+		arch.ARCH_S390X:   RootPartitionS390xGUID,
+	},
+	"usr": {
+		arch.ARCH_X86_64:  UsrPartitionX86_64GUID,
+		arch.ARCH_AARCH64: UsrPartitionAarch64GUID,
+		arch.ARCH_PPC64LE: UsrPartitionPpc64leGUID,
+		arch.ARCH_S390X:   UsrPartitionS390xGUID,
+	},
+	"root-verity": {
+		arch.ARCH_X86_64:  RootVerityPartitionX86_64GUID,
+		arch.ARCH_AARCH64: RootVerityPartitionAarch64GUID,
+		arch.ARCH_PPC64LE: RootVerityPartitionPpc64leGUID,
+		arch.ARCH_S390X:   RootVerityPartitionS390xGUID,
+	},
+	"usr-verity": {
+		arch.ARCH_X86_64:  UsrVerityPartitionX86_64GUID,
+		arch.ARCH_AARCH64: UsrVerityPartitionAarch64GUID,
+		arch.ARCH_PPC64LE: UsrVerityPartitionPpc64leGUID,
+		arch.ARCH_S390X:   UsrVerityPartitionS390xGUID,
+	},
+	"root-verity-sig": {
+		arch.ARCH_X86_64:  RootVeritySigPartitionX86_64GUID,
+		arch.ARCH_AARCH64: RootVeritySigPartitionAarch64GUID,
+		arch.ARCH_PPC64LE: RootVeritySigPartitionPpc64leGUID,
+		arch.ARCH_S390X:   RootVeritySigPartitionS390xGUID,
+	},
+	"usr-verity-sig": {
+		arch.ARCH_X86_64:  UsrVeritySigPartitionX86_64GUID,
+		arch.ARCH_AARCH64: UsrVeritySigPartitionAarch64GUID,
+		arch.ARCH_PPC64LE: UsrVeritySigPartitionPpc64leGUID,
+		arch.ARCH_S390X:   UsrVeritySigPartitionS390xGUID,
+	},
+}
+
 func getPartitionTypeIDfor(ptType PartitionTableType, partTypeName string, architecture arch.Arch) (string, error) {
 	switch ptType {
 	case PT_DOS:
@@ -147,36 +218,15 @@ func getPartitionTypeIDfor(ptType PartitionTableType, partTypeName string, archi
 			return PRePartitionGUID, nil
 		case "swap":
 			return SwapPartitionGUID, nil
-		case "root":
-			switch architecture {
-			case arch.ARCH_X86_64:
-				return RootPartitionX86_64GUID, nil
-			case arch.ARCH_AARCH64:
-				return RootPartitionAarch64GUID, nil
-			case arch.ARCH_PPC64LE:
-				return RootPartitionPpc64leGUID, nil
-			case arch.ARCH_S390X:
-				return RootPartitionS390xGUID, nil
-			case arch.ARCH_UNSET:
+		case "root", "usr", "root-verity", "usr-verity", "root-verity-sig", "usr-verity-sig":
+			if architecture == arch.ARCH_UNSET {
 				return "", fmt.Errorf("architecture must be specified for selecting GUID for %q partition", partTypeName)
-			default:
-				return "", fmt.Errorf("unknown or unsupported architecture enum value: %d", architecture)
 			}
-		case "usr":
-			switch architecture {
-			case arch.ARCH_X86_64:
-				return UsrPartitionX86_64GUID, nil
-			case arch.ARCH_AARCH64:
-				return UsrPartitionAarch64GUID, nil
-			case arch.ARCH_PPC64LE:
-				return UsrPartitionPpc64leGUID, nil
-			case arch.ARCH_S390X:
-				return UsrPartitionS390xGUID, nil
-			case arch.ARCH_UNSET:
-				return "", fmt.Errorf("architecture must be specified for selecting GUID for %q partition", partTypeName)
-			default:
+			guid, ok := archPartitionGUIDs[partTypeName][architecture]
+			if !ok {
 				return "", fmt.Errorf("unknown or unsupported architecture enum value: %d", architecture)
 			}
+			return guid, nil
 		default:
 			return "", fmt.Errorf("unknown or unsupported partition type name: %s", partTypeName)
 		}
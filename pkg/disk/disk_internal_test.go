@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/arch"
 )
 
 func TestGenUniqueString(t *testing.T) {
@@ -106,3 +108,19 @@ func TestGenUniqueStringManyCollisions(t *testing.T) {
 		})
 	}
 }
+
+func TestGetPartitionTypeIDforVerity(t *testing.T) {
+	guid, err := getPartitionTypeIDfor(PT_GPT, "root-verity", arch.ARCH_X86_64)
+	assert.NoError(t, err)
+	assert.Equal(t, RootVerityPartitionX86_64GUID, guid)
+
+	guid, err = getPartitionTypeIDfor(PT_GPT, "usr-verity-sig", arch.ARCH_AARCH64)
+	assert.NoError(t, err)
+	assert.Equal(t, UsrVeritySigPartitionAarch64GUID, guid)
+
+	_, err = getPartitionTypeIDfor(PT_GPT, "root-verity", arch.ARCH_UNSET)
+	assert.EqualError(t, err, `architecture must be specified for selecting GUID for "root-verity" partition`)
+
+	_, err = getPartitionTypeIDfor(PT_DOS, "root-verity", arch.ARCH_X86_64)
+	assert.EqualError(t, err, "unknown or unsupported partition type name: root-verity")
+}
@@ -0,0 +1,278 @@
+package disk
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// Disk is an additional disk of an image with multiple disks. The boot disk
+// of the image holds the root filesystem and is described by its
+// PartitionTable, additional disks hold other mountpoints, e.g.
+// /var/lib/data.
+//
+// A volume group can span disks: osbuild creates every volume group on a
+// single device, so the volume group is created on one disk and extended
+// onto the physical volume of another disk when the image boots for the
+// first time, see VolumeGroup. This only adds free extents to the volume
+// group, all logical volumes stay on the disk that the volume group was
+// created on.
+type Disk struct {
+	// Name of the disk, it is part of the filename of the disk image
+	Name           string          `json:"name" yaml:"name"`
+	PartitionTable *PartitionTable `json:"partition_table" yaml:"partition_table"`
+
+	// VolumeGroup is the name of a volume group on another disk that is
+	// extended onto the last partition of this disk, see PhysicalVolume
+	VolumeGroup string `json:"volume_group,omitempty" yaml:"volume_group,omitempty"`
+}
+
+// PhysicalVolume returns the partition of the disk that extends its
+// VolumeGroup or nil if the disk does not extend a volume group
+func (d Disk) PhysicalVolume() *Partition {
+	if d.VolumeGroup == "" || d.PartitionTable == nil || len(d.PartitionTable.Partitions) == 0 {
+		return nil
+	}
+	return &d.PartitionTable.Partitions[len(d.PartitionTable.Partitions)-1]
+}
+
+// physicalVolumeMinSize is the size of the physical volume that extends a
+// volume group when the disk has no room left for it, see
+// NewDataPartitionTable
+const physicalVolumeMinSize = 1 * datasizes.GiB
+
+var diskNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ValidateDisks checks that the additional disks can be used together with
+// the boot disk: disk names need to be unique, the root filesystem needs
+// to be on the boot disk, mountpoints and volume group names cannot be
+// used on more than one disk and the volume groups that are extended onto
+// a disk need to be on another disk.
+func ValidateDisks(boot *PartitionTable, disks []Disk) error {
+	mountpoints := make(map[string]string)
+	vgnames := make(map[string]string)
+	collect := func(diskName string, pt *PartitionTable) error {
+		return pt.ForEachEntity(func(e Entity, path []Entity) error {
+			switch ent := e.(type) {
+			case Mountable:
+				if other, ok := mountpoints[ent.GetMountpoint()]; ok {
+					return fmt.Errorf("mountpoint %q is on disk %q and disk %q", ent.GetMountpoint(), other, diskName)
+				}
+				mountpoints[ent.GetMountpoint()] = diskName
+			case *LVMVolumeGroup:
+				if other, ok := vgnames[ent.Name]; ok {
+					return fmt.Errorf("volume group %q is on disk %q and disk %q, a volume group is created on one disk and extended onto the others", ent.Name, other, diskName)
+				}
+				vgnames[ent.Name] = diskName
+			}
+			return nil
+		})
+	}
+
+	if boot != nil {
+		if err := collect("boot", boot); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool)
+	for _, d := range disks {
+		if !diskNameRegex.MatchString(d.Name) {
+			return fmt.Errorf("invalid disk name %q, only lowercase letters, digits, \"-\" and \"_\" are allowed", d.Name)
+		}
+		if d.Name == "boot" || names[d.Name] {
+			return fmt.Errorf("duplicate disk name %q", d.Name)
+		}
+		names[d.Name] = true
+		if d.PartitionTable == nil {
+			return fmt.Errorf("disk %q has no partition table", d.Name)
+		}
+		if d.PartitionTable.ContainsMountpoint("/") {
+			return fmt.Errorf("disk %q cannot hold the root filesystem, it must be on the boot disk", d.Name)
+		}
+		if err := collect(d.Name, d.PartitionTable); err != nil {
+			return err
+		}
+	}
+	for _, d := range disks {
+		if d.VolumeGroup == "" {
+			continue
+		}
+		vgDisk, ok := vgnames[d.VolumeGroup]
+		if !ok {
+			return fmt.Errorf("disk %q extends volume group %q that is not on any disk", d.Name, d.VolumeGroup)
+		}
+		if vgDisk == d.Name {
+			return fmt.Errorf("disk %q extends volume group %q that is already on the disk", d.Name, d.VolumeGroup)
+		}
+		if pv := d.PhysicalVolume(); pv == nil || pv.Payload != nil || pv.UUID == "" {
+			return fmt.Errorf("disk %q has no physical volume to extend volume group %q", d.Name, d.VolumeGroup)
+		}
+	}
+	return nil
+}
+
+// SplitDiskCustomization moves partitions of the disk customization of a
+// blueprint to additional disks. The selectors map the name of each disk to
+// the partitions it holds: a partition is selected by its mountpoint, the
+// mountpoint of one of its logical volumes or subvolumes or the name of its
+// volume group. The partitions that are not selected stay on the boot disk,
+// the root filesystem cannot be moved. The disk customization is not
+// modified.
+func SplitDiskCustomization(customizations *blueprint.DiskCustomization, selectors map[string][]string) (*blueprint.DiskCustomization, map[string][]blueprint.PartitionCustomization, error) {
+	selected := 0
+	for _, sel := range selectors {
+		selected += len(sel)
+	}
+	if selected == 0 {
+		return customizations, nil, nil
+	}
+	if customizations == nil {
+		return nil, nil, fmt.Errorf("partitions can only be moved to additional disks with a disk customization")
+	}
+
+	names := make([]string, 0, len(selectors))
+	for name := range selectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// disk name for each partition index of the customization
+	owners := make(map[int]string)
+	for _, name := range names {
+		for _, sel := range selectors[name] {
+			idx := slices.IndexFunc(customizations.Partitions, func(part blueprint.PartitionCustomization) bool {
+				return slices.Contains(partitionSelectors(part), sel)
+			})
+			if idx < 0 {
+				return nil, nil, fmt.Errorf("disk %q: no partition with mountpoint or volume group %q in the disk customization", name, sel)
+			}
+			if slices.Contains(partitionSelectors(customizations.Partitions[idx]), "/") {
+				return nil, nil, fmt.Errorf("disk %q: partition %q holds the root filesystem, it must be on the boot disk", name, sel)
+			}
+			if owner, ok := owners[idx]; ok && owner != name {
+				return nil, nil, fmt.Errorf("partition %q is moved to disk %q and disk %q", sel, owner, name)
+			}
+			owners[idx] = name
+		}
+	}
+
+	boot := *customizations
+	boot.Partitions = nil
+	disks := make(map[string][]blueprint.PartitionCustomization)
+	for idx, part := range customizations.Partitions {
+		if owner, ok := owners[idx]; ok {
+			disks[owner] = append(disks[owner], part)
+		} else {
+			boot.Partitions = append(boot.Partitions, part)
+		}
+	}
+	return &boot, disks, nil
+}
+
+// partitionSelectors returns the mountpoints and volume group name that
+// select a partition customization, see SplitDiskCustomization
+func partitionSelectors(part blueprint.PartitionCustomization) []string {
+	var selectors []string
+	if part.Mountpoint != "" {
+		selectors = append(selectors, part.Mountpoint)
+	}
+	if part.Name != "" {
+		selectors = append(selectors, part.Name)
+	}
+	for _, lv := range part.LogicalVolumes {
+		if lv.Mountpoint != "" {
+			selectors = append(selectors, lv.Mountpoint)
+		}
+	}
+	for _, subvol := range part.Subvolumes {
+		if subvol.Mountpoint != "" {
+			selectors = append(selectors, subvol.Mountpoint)
+		}
+	}
+	return selectors
+}
+
+// NewDataPartitionTable creates the partition table of an additional disk
+// from the disk customizations of a blueprint. Unlike NewCustomPartitionTable
+// no partitions for booting and no root filesystem are added, the last
+// partition takes the remaining space of the disk.
+//
+// If volumeGroup is set, the last partition is an empty LVM physical volume
+// that extends the volume group of another disk, see Disk.VolumeGroup.
+func NewDataPartitionTable(customizations *blueprint.DiskCustomization, volumeGroup string, options *CustomPartitionTableOptions, rng *rand.Rand) (*PartitionTable, error) {
+	if options == nil {
+		options = &CustomPartitionTableOptions{}
+	}
+	if customizations == nil {
+		customizations = &blueprint.DiskCustomization{}
+	}
+
+	errPrefix := "error generating data partition table:"
+	if len(customizations.Partitions) == 0 && volumeGroup == "" {
+		return nil, fmt.Errorf("%s no partitions", errPrefix)
+	}
+
+	if err := customizations.Validate(); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
+	}
+	for _, part := range customizations.Partitions {
+		mountpoints := []string{part.Mountpoint}
+		for _, lv := range part.LogicalVolumes {
+			mountpoints = append(mountpoints, lv.Mountpoint)
+		}
+		for _, subvol := range part.Subvolumes {
+			mountpoints = append(mountpoints, subvol.Mountpoint)
+		}
+		if slices.Contains(mountpoints, "/") {
+			return nil, fmt.Errorf("%s the root filesystem must be on the boot disk", errPrefix)
+		}
+	}
+
+	if err := ValidateSectorSize(options.SectorSize); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
+	}
+	pt := &PartitionTable{
+		SectorSize: options.SectorSize,
+	}
+	switch customizations.Type {
+	case "dos":
+		pt.Type = PT_DOS
+	case "gpt", "":
+		pt.Type = PT_GPT
+	default:
+		return nil, fmt.Errorf("%s invalid partition table type: %s", errPrefix, customizations.Type)
+	}
+
+	if err := addCustomPartitions(pt, customizations, options); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
+	}
+	if volumeGroup != "" {
+		// the physical volume is found by its partition UUID on first boot
+		if pt.Type != PT_GPT {
+			return nil, fmt.Errorf("%s extending volume group %q requires a %q partition table", errPrefix, volumeGroup, PT_GPT)
+		}
+		pt.Partitions = append(pt.Partitions, Partition{
+			Type: LVMPartitionGUID,
+			Size: physicalVolumeMinSize,
+		})
+	}
+
+	if customizations.StartOffset > 0 {
+		pt.StartOffset = Offset(customizations.StartOffset)
+	}
+	pt.relayout(datasizes.Size(customizations.MinSize))
+	if err := pt.CheckSectorSize(); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
+	}
+	pt.GenerateUUIDs(rng)
+
+	if pt.Type == PT_DOS && len(pt.Partitions) > 4 {
+		return nil, fmt.Errorf("%s invalid partition table: \"dos\" partition table type only supports up to 4 partitions: got %d", errPrefix, len(pt.Partitions))
+	}
+	return pt, nil
+}
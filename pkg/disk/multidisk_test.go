@@ -0,0 +1,343 @@
+package disk_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func dataDiskCustomization() *blueprint.DiskCustomization {
+	return &blueprint.DiskCustomization{
+		MinSize: 10 * datasizes.GiB,
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				MinSize: 1 * datasizes.GiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/var/lib/data",
+					FSType:     "xfs",
+				},
+			},
+			{
+				Type: "lvm",
+				VGCustomization: blueprint.VGCustomization{
+					Name: "datavg",
+					LogicalVolumes: []blueprint.LVCustomization{
+						{
+							Name:    "backuplv",
+							MinSize: 2 * datasizes.GiB,
+							FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+								Mountpoint: "/var/lib/backup",
+								FSType:     "ext4",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestNewDataPartitionTable(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	pt, err := disk.NewDataPartitionTable(dataDiskCustomization(), "", &disk.CustomPartitionTableOptions{DefaultFSType: disk.FS_XFS}, rng)
+	require.NoError(t, err)
+
+	assert.Equal(t, disk.PT_GPT, pt.Type)
+	assert.Equal(t, datasizes.Size(10*datasizes.GiB), pt.Size)
+	require.Len(t, pt.Partitions, 2)
+	assert.True(t, pt.ContainsMountpoint("/var/lib/data"))
+	assert.True(t, pt.ContainsMountpoint("/var/lib/backup"))
+	assert.False(t, pt.ContainsMountpoint("/"))
+	assert.False(t, pt.ContainsMountpoint("/boot/efi"))
+
+	// the last partition takes the remaining space of the disk
+	data := pt.Partitions[0]
+	lvm := pt.Partitions[1]
+	assert.Equal(t, datasizes.Size(1*datasizes.MiB), datasizes.Size(data.Start))
+	assert.Equal(t, datasizes.Size(1*datasizes.GiB), data.Size)
+	assert.Equal(t, data.Start+data.Size.Uint64(), lvm.Start)
+	assert.Equal(t, pt.Size, datasizes.Size(lvm.Start)+lvm.Size+pt.HeaderSize())
+	assert.IsType(t, &disk.LVMVolumeGroup{}, lvm.Payload)
+}
+
+func TestNewDataPartitionTableVolumeGroup(t *testing.T) {
+	rng := rand.New(rand.NewSource(0))
+	pt, err := disk.NewDataPartitionTable(nil, "datavg", &disk.CustomPartitionTableOptions{DefaultFSType: disk.FS_XFS}, rng)
+	require.NoError(t, err)
+
+	require.Len(t, pt.Partitions, 1)
+	pv := pt.Partitions[0]
+	assert.Equal(t, disk.LVMPartitionGUID, pv.Type)
+	assert.Nil(t, pv.Payload)
+	assert.NotEmpty(t, pv.UUID)
+	assert.GreaterOrEqual(t, pv.Size, datasizes.Size(1*datasizes.GiB))
+
+	// the physical volume is the last partition and takes the remaining space
+	pt, err = disk.NewDataPartitionTable(dataDiskCustomization(), "rootvg", &disk.CustomPartitionTableOptions{DefaultFSType: disk.FS_XFS}, rng)
+	require.NoError(t, err)
+	require.Len(t, pt.Partitions, 3)
+	pv = pt.Partitions[2]
+	assert.Equal(t, disk.LVMPartitionGUID, pv.Type)
+	assert.Nil(t, pv.Payload)
+	assert.Equal(t, pt.Size, datasizes.Size(pv.Start)+pv.Size+pt.HeaderSize())
+
+	d := disk.Disk{Name: "data", PartitionTable: pt, VolumeGroup: "rootvg"}
+	assert.Equal(t, &pt.Partitions[2], d.PhysicalVolume())
+	d.VolumeGroup = ""
+	assert.Nil(t, d.PhysicalVolume())
+
+	_, err = disk.NewDataPartitionTable(&blueprint.DiskCustomization{Type: "dos"}, "rootvg", nil, rng)
+	assert.EqualError(t, err, `error generating data partition table: extending volume group "rootvg" requires a "gpt" partition table`)
+}
+
+func TestNewDataPartitionTableErrors(t *testing.T) {
+	options := &disk.CustomPartitionTableOptions{DefaultFSType: disk.FS_XFS}
+	testCases := map[string]struct {
+		customizations *blueprint.DiskCustomization
+		errmsg         string
+	}{
+		"no-partitions": {
+			customizations: &blueprint.DiskCustomization{},
+			errmsg:         "error generating data partition table: no partitions",
+		},
+		"root": {
+			customizations: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						MinSize: 1 * datasizes.GiB,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "xfs",
+						},
+					},
+				},
+			},
+			errmsg: "error generating data partition table: the root filesystem must be on the boot disk",
+		},
+		"bad-pt-type": {
+			customizations: &blueprint.DiskCustomization{
+				Type: "toucan",
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						MinSize: 1 * datasizes.GiB,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/data",
+							FSType:     "xfs",
+						},
+					},
+				},
+			},
+			errmsg: "error generating data partition table: unknown partition table type: toucan (valid: gpt, dos)",
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			_, err := disk.NewDataPartitionTable(tc.customizations, "", options, rand.New(rand.NewSource(0)))
+			assert.EqualError(t, err, tc.errmsg)
+		})
+	}
+}
+
+func TestValidateDisks(t *testing.T) {
+	boot := testdisk.MakeFakePartitionTable("/", "/boot")
+	newDataPT := func() *disk.PartitionTable {
+		pt, err := disk.NewDataPartitionTable(dataDiskCustomization(), "", &disk.CustomPartitionTableOptions{DefaultFSType: disk.FS_XFS}, rand.New(rand.NewSource(0)))
+		require.NoError(t, err)
+		return pt
+	}
+	newPVPT := func(vg string) *disk.PartitionTable {
+		pt, err := disk.NewDataPartitionTable(nil, vg, nil, rand.New(rand.NewSource(0)))
+		require.NoError(t, err)
+		return pt
+	}
+
+	testCases := map[string]struct {
+		disks  []disk.Disk
+		errmsg string
+	}{
+		"happy": {
+			disks: []disk.Disk{{Name: "data", PartitionTable: newDataPT()}},
+		},
+		"bad-name": {
+			disks:  []disk.Disk{{Name: "../data", PartitionTable: newDataPT()}},
+			errmsg: `invalid disk name "../data", only lowercase letters, digits, "-" and "_" are allowed`,
+		},
+		"duplicate-name": {
+			disks: []disk.Disk{
+				{Name: "data", PartitionTable: newDataPT()},
+				{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/srv")},
+			},
+			errmsg: `duplicate disk name "data"`,
+		},
+		"no-pt": {
+			disks:  []disk.Disk{{Name: "data"}},
+			errmsg: `disk "data" has no partition table`,
+		},
+		"root": {
+			disks:  []disk.Disk{{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/")}},
+			errmsg: `disk "data" cannot hold the root filesystem, it must be on the boot disk`,
+		},
+		"duplicate-mountpoint": {
+			disks:  []disk.Disk{{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/boot")}},
+			errmsg: `mountpoint "/boot" is on disk "boot" and disk "data"`,
+		},
+		"spanning-vg": {
+			disks: []disk.Disk{
+				{Name: "data", PartitionTable: newDataPT()},
+				{Name: "data2", PartitionTable: func() *disk.PartitionTable {
+					customizations := dataDiskCustomization()
+					customizations.Partitions = customizations.Partitions[1:]
+					customizations.Partitions[0].LogicalVolumes[0].Mountpoint = "/var/lib/other"
+					pt, err := disk.NewDataPartitionTable(customizations, "", nil, rand.New(rand.NewSource(0)))
+					require.NoError(t, err)
+					return pt
+				}()},
+			},
+			errmsg: `volume group "datavg" is on disk "data" and disk "data2", a volume group is created on one disk and extended onto the others`,
+		},
+		"extend-vg": {
+			disks: []disk.Disk{
+				{Name: "data", PartitionTable: newDataPT()},
+				{Name: "data2", PartitionTable: newPVPT("datavg"), VolumeGroup: "datavg"},
+			},
+		},
+		"extend-unknown-vg": {
+			disks:  []disk.Disk{{Name: "data", PartitionTable: newPVPT("toucanvg"), VolumeGroup: "toucanvg"}},
+			errmsg: `disk "data" extends volume group "toucanvg" that is not on any disk`,
+		},
+		"extend-own-vg": {
+			disks: []disk.Disk{
+				{Name: "data", PartitionTable: func() *disk.PartitionTable {
+					pt, err := disk.NewDataPartitionTable(dataDiskCustomization(), "datavg", nil, rand.New(rand.NewSource(0)))
+					require.NoError(t, err)
+					return pt
+				}(), VolumeGroup: "datavg"},
+			},
+			errmsg: `disk "data" extends volume group "datavg" that is already on the disk`,
+		},
+		"extend-no-pv": {
+			disks: []disk.Disk{
+				{Name: "data", PartitionTable: newDataPT()},
+				{Name: "data2", PartitionTable: testdisk.MakeFakePartitionTable("/srv"), VolumeGroup: "datavg"},
+			},
+			errmsg: `disk "data2" has no physical volume to extend volume group "datavg"`,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			err := disk.ValidateDisks(boot, tc.disks)
+			if tc.errmsg == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.errmsg)
+			}
+		})
+	}
+}
+
+func TestSplitDiskCustomization(t *testing.T) {
+	dc := &blueprint.DiskCustomization{
+		MinSize: 20 * datasizes.GiB,
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/", FSType: "xfs"},
+			},
+		},
+	}
+	dc.Partitions = append(dc.Partitions, dataDiskCustomization().Partitions...)
+	dc.Partitions = append(dc.Partitions, blueprint.PartitionCustomization{
+		FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/srv", FSType: "ext4"},
+	})
+
+	boot, disks, err := disk.SplitDiskCustomization(dc, map[string][]string{
+		"data":   {"/var/lib/data", "/var/lib/backup"},
+		"backup": nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20*datasizes.GiB), boot.MinSize)
+	assert.Equal(t, []blueprint.PartitionCustomization{dc.Partitions[0], dc.Partitions[3]}, boot.Partitions)
+	assert.Equal(t, map[string][]blueprint.PartitionCustomization{
+		"data": {dc.Partitions[1], dc.Partitions[2]},
+	}, disks)
+	// the input is not modified
+	assert.Len(t, dc.Partitions, 4)
+
+	// volume groups select their partition
+	_, disks, err = disk.SplitDiskCustomization(dc, map[string][]string{"data": {"datavg"}, "srv": {"/srv"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]blueprint.PartitionCustomization{
+		"data": {dc.Partitions[2]},
+		"srv":  {dc.Partitions[3]},
+	}, disks)
+
+	// nothing to move
+	boot, disks, err = disk.SplitDiskCustomization(dc, map[string][]string{"data": nil})
+	require.NoError(t, err)
+	assert.Same(t, dc, boot)
+	assert.Nil(t, disks)
+}
+
+func TestSplitDiskCustomizationErrors(t *testing.T) {
+	dc := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				Type: "lvm",
+				VGCustomization: blueprint.VGCustomization{
+					Name: "rootvg",
+					LogicalVolumes: []blueprint.LVCustomization{
+						{
+							Name:                         "rootlv",
+							FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/", FSType: "xfs"},
+						},
+					},
+				},
+			},
+		},
+	}
+	dc.Partitions = append(dc.Partitions, dataDiskCustomization().Partitions...)
+
+	testCases := map[string]struct {
+		customizations *blueprint.DiskCustomization
+		selectors      map[string][]string
+		errmsg         string
+	}{
+		"no-customization": {
+			selectors: map[string][]string{"data": {"/var/lib/data"}},
+			errmsg:    "partitions can only be moved to additional disks with a disk customization",
+		},
+		"unknown": {
+			customizations: dc,
+			selectors:      map[string][]string{"data": {"/toucan"}},
+			errmsg:         `disk "data": no partition with mountpoint or volume group "/toucan" in the disk customization`,
+		},
+		"root": {
+			customizations: dc,
+			selectors:      map[string][]string{"data": {"rootvg"}},
+			errmsg:         `disk "data": partition "rootvg" holds the root filesystem, it must be on the boot disk`,
+		},
+		"twice": {
+			customizations: dc,
+			selectors:      map[string][]string{"data": {"datavg"}, "other": {"/var/lib/backup"}},
+			errmsg:         `partition "/var/lib/backup" is moved to disk "data" and disk "other"`,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			_, _, err := disk.SplitDiskCustomization(tc.customizations, tc.selectors)
+			assert.EqualError(t, err, tc.errmsg)
+		})
+	}
+}
@@ -104,6 +104,21 @@ func (p *Partition) IsBIOSBoot() bool {
 	return p.Type == BIOSBootPartitionGUID || p.Type == BIOSBootPartitionDOSID
 }
 
+// IsESP returns true if the partition is an EFI system partition, either by
+// its type or, for dos partition tables that use a FAT type ID, by holding
+// the /boot/efi filesystem.
+func (p *Partition) IsESP() bool {
+	if p == nil {
+		return false
+	}
+
+	if p.Type == EFISystemPartitionGUID || p.Type == EFISystemPartitionDOSID {
+		return true
+	}
+	fs, ok := p.Payload.(*Filesystem)
+	return ok && fs.Mountpoint == "/boot/efi"
+}
+
 func (p *Partition) IsPReP() bool {
 	if p == nil {
 		return false
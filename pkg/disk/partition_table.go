@@ -159,9 +159,13 @@ func NewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.Filesyste
 	if len(requiredSizes) != 0 {
 		newPT.EnsureDirectorySizes(requiredSizes)
 	}
+	newPT.ensureESPSize()
 
 	// Calculate partition table offsets and sizes
 	newPT.relayout(imageSize)
+	if err := newPT.CheckSectorSize(); err != nil {
+		return nil, err
+	}
 
 	// Generate new UUIDs for filesystems and partitions
 	newPT.GenerateUUIDs(rng)
@@ -227,22 +231,85 @@ func (pt *PartitionTable) AlignUp(size datasizes.Size) datasizes.Size {
 	return ((size + grain) / grain) * grain
 }
 
+// GetSectorSize returns the (logical) sector size of the disk in bytes,
+// taking the default into account.
+func (pt *PartitionTable) GetSectorSize() uint64 {
+	if pt.SectorSize == 0 {
+		return DefaultSectorSize
+	}
+	return pt.SectorSize
+}
+
 // Convert the given bytes to the number of sectors.
 func (pt *PartitionTable) BytesToSectors(size uint64) uint64 {
-	sectorSize := pt.SectorSize
-	if sectorSize == 0 {
-		sectorSize = DefaultSectorSize
-	}
-	return size / sectorSize
+	return size / pt.GetSectorSize()
 }
 
 // Convert the given number of sectors to bytes.
 func (pt *PartitionTable) SectorsToBytes(size uint64) uint64 {
-	sectorSize := pt.SectorSize
-	if sectorSize == 0 {
-		sectorSize = DefaultSectorSize
+	return size * pt.GetSectorSize()
+}
+
+// ValidateSectorSize returns an error if the given sector size is not
+// supported. Zero selects the default sector size.
+func ValidateSectorSize(sectorSize uint64) error {
+	switch sectorSize {
+	case 0, DefaultSectorSize, NativeSectorSize4K:
+		return nil
+	default:
+		return fmt.Errorf("unsupported sector size %d, must be %d or %d", sectorSize, DefaultSectorSize, NativeSectorSize4K)
+	}
+}
+
+// CheckSectorSize returns an error if the layout of the partition table is
+// not valid for its sector size: the offset of the first partition, the start
+// and the size of all partitions must be multiples of the sector size and,
+// on 4Kn disks, EFI system partitions must be large enough for FAT32.
+func (pt *PartitionTable) CheckSectorSize() error {
+	if err := ValidateSectorSize(pt.SectorSize); err != nil {
+		return err
+	}
+	sectorSize := pt.GetSectorSize()
+
+	if pt.StartOffset.Uint64()%sectorSize != 0 {
+		return fmt.Errorf("start offset %d is not aligned to the sector size %d", pt.StartOffset, sectorSize)
 	}
-	return size * sectorSize
+	for idx, part := range pt.Partitions {
+		if part.Start%sectorSize != 0 {
+			return fmt.Errorf("start %d of partition %d is not aligned to the sector size %d", part.Start, idx+1, sectorSize)
+		}
+		if part.Size.Uint64()%sectorSize != 0 {
+			return fmt.Errorf("size %d of partition %d is not aligned to the sector size %d", part.Size, idx+1, sectorSize)
+		}
+		if sectorSize == NativeSectorSize4K && part.IsESP() && part.Size < MinESPSize4K {
+			return fmt.Errorf("EFI system partition %d is too small for a disk with %d byte sectors: %d bytes, need at least %d bytes", idx+1, sectorSize, part.Size, MinESPSize4K)
+		}
+	}
+	return nil
+}
+
+// ensureESPSize grows the EFI system partitions to the minimum size for the
+// sector size of the partition table. The sizes of the ESPs of base partition
+// tables are chosen for 512 byte sectors.
+func (pt *PartitionTable) ensureESPSize() {
+	if pt.GetSectorSize() != NativeSectorSize4K {
+		return
+	}
+	for idx := range pt.Partitions {
+		part := &pt.Partitions[idx]
+		if part.IsESP() && part.Size < MinESPSize4K {
+			part.Size = MinESPSize4K
+		}
+	}
+}
+
+// defaultESPSize returns the size of automatically created EFI system
+// partitions for the sector size of the partition table.
+func (pt *PartitionTable) defaultESPSize() datasizes.Size {
+	if pt.GetSectorSize() == NativeSectorSize4K {
+		return MinESPSize4K
+	}
+	return 200 * datasizes.MiB
 }
 
 // Returns if the partition table contains a filesystem with the given
@@ -471,7 +538,8 @@ func (pt *PartitionTable) applyCustomization(mountpoints []blueprint.FilesystemC
 // Dynamically calculate and update the start point for each of the existing
 // partitions. Adjusts the overall size of image to either the supplied value
 // in `size` or to the sum of all partitions if that is larger. Will grow the
-// root partition if there is any empty space. Returns the updated start point.
+// root partition, or the last partition if there is no root filesystem, if
+// there is any empty space. Returns the updated start point.
 func (pt *PartitionTable) relayout(size datasizes.Size) uint64 {
 	header := pt.HeaderSize()
 	footer := datasizes.Size(0)
@@ -486,12 +554,23 @@ func (pt *PartitionTable) relayout(size datasizes.Size) uint64 {
 	size = pt.AlignUp(size)
 
 	var rootIdx = -1
+	for idx := range pt.Partitions {
+		if len(entityPath(&pt.Partitions[idx], "/")) != 0 {
+			rootIdx = idx
+			break
+		}
+	}
+	// partition tables of additional disks have no root filesystem, grow
+	// the last partition instead
+	if rootIdx < 0 {
+		rootIdx = len(pt.Partitions) - 1
+	}
+
 	for idx := range pt.Partitions {
 		partition := &pt.Partitions[idx]
-		if len(entityPath(partition, "/")) != 0 {
+		if idx == rootIdx {
 			// keep the root partition index to handle after all the other
 			// partitions have been moved and resized
-			rootIdx = idx
 			continue
 		}
 		partition.Start = start
@@ -501,7 +580,7 @@ func (pt *PartitionTable) relayout(size datasizes.Size) uint64 {
 	}
 
 	if rootIdx < 0 {
-		panic("no root filesystem found; this is a programming error")
+		panic("no partitions found; this is a programming error")
 	}
 
 	root := &pt.Partitions[rootIdx]
@@ -879,14 +958,15 @@ func (pt *PartitionTable) ensureBtrfs(defaultFS string, architecture arch.Arch)
 }
 
 type partitionTableFeatures struct {
-	LVM   bool
-	Btrfs bool
-	XFS   bool
-	FAT   bool
-	EXT4  bool
-	LUKS  bool
-	Swap  bool
-	Raw   bool
+	LVM    bool
+	Btrfs  bool
+	XFS    bool
+	FAT    bool
+	EXT4   bool
+	LUKS   bool
+	Swap   bool
+	Raw    bool
+	Verity bool
 }
 
 // features examines all of the PartitionTable entities and returns a struct
@@ -919,6 +999,8 @@ func (pt *PartitionTable) features() partitionTableFeatures {
 			ptFeatures.Raw = true
 		case *Swap:
 			ptFeatures.Swap = true
+		case *VerityHash:
+			ptFeatures.Verity = true
 		case *LUKSContainer:
 			ptFeatures.LUKS = true
 		case *PartitionTable, *Partition:
@@ -961,6 +1043,10 @@ func (pt *PartitionTable) GetBuildPackages() []string {
 			"cryptsetup",
 		)
 	}
+	if features.Verity && !features.LUKS {
+		// veritysetup is part of cryptsetup
+		packages = append(packages, "cryptsetup")
+	}
 
 	return packages
 }
@@ -1164,7 +1250,7 @@ func addPartitionsForBootMode(pt *PartitionTable, disk *blueprint.DiskCustomizat
 	case arch.ARCH_AARCH64, arch.ARCH_RISCV64:
 		// (our) aarch64/riscv64 only supports UEFI right now
 		if !hasESP(disk) {
-			part, err := mkESP(200*datasizes.MiB, pt.Type)
+			part, err := mkESP(pt.defaultESPSize(), pt.Type)
 			if err != nil {
 				return err
 			}
@@ -1184,7 +1270,7 @@ func addPartitionsForBootMode(pt *PartitionTable, disk *blueprint.DiskCustomizat
 		case platform.BOOT_UEFI:
 			// add ESP if needed
 			if !hasESP(disk) {
-				part, err := mkESP(200*datasizes.MiB, pt.Type)
+				part, err := mkESP(pt.defaultESPSize(), pt.Type)
 				if err != nil {
 					return err
 				}
@@ -1199,7 +1285,7 @@ func addPartitionsForBootMode(pt *PartitionTable, disk *blueprint.DiskCustomizat
 			}
 			pt.Partitions = append(pt.Partitions, bios)
 			if !hasESP(disk) {
-				esp, err := mkESP(200*datasizes.MiB, pt.Type)
+				esp, err := mkESP(pt.defaultESPSize(), pt.Type)
 				if err != nil {
 					return err
 				}
@@ -1292,6 +1378,11 @@ type CustomPartitionTableOptions struct {
 	// enable automatic discovery. It has no effect and is not required when
 	// the PartitionTableType is PT_DOS.
 	Architecture arch.Arch
+
+	// SectorSize is the logical sector size of the disk in bytes, either
+	// 512 or 4096 for 4K native disks. Defaults to 512. Automatically
+	// created EFI system partitions are sized for the sector size.
+	SectorSize uint64
 }
 
 // Returns the default filesystem type if the fstype is empty. If both are
@@ -1346,7 +1437,12 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
 
-	pt := &PartitionTable{}
+	if err := ValidateSectorSize(options.SectorSize); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
+	}
+	pt := &PartitionTable{
+		SectorSize: options.SectorSize,
+	}
 
 	switch customizations.Type {
 	case "dos":
@@ -1379,36 +1475,8 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
 	// add user customized partitions
-	for _, part := range customizations.Partitions {
-		if part.PartType != "" {
-			// check the partition details now that we also know the partition table type
-			if err := part.ValidatePartitionTypeID(pt.Type.String()); err != nil {
-				return nil, fmt.Errorf("%s error validating partition type ID for %q: %w", errPrefix, part.Mountpoint, err)
-			}
-			if err := part.ValidatePartitionID(pt.Type.String()); err != nil {
-				return nil, fmt.Errorf("%s error validating partition ID for %q: %w", errPrefix, part.Mountpoint, err)
-			}
-			if err := part.ValidatePartitionLabel(pt.Type.String()); err != nil {
-				return nil, fmt.Errorf("%s error validating partition label for %q: %w", errPrefix, part.Mountpoint, err)
-			}
-		}
-
-		switch part.Type {
-		case "plain", "":
-			if err := addPlainPartition(pt, part, options); err != nil {
-				return nil, fmt.Errorf("%s %w", errPrefix, err)
-			}
-		case "lvm":
-			if err := addLVMPartition(pt, part, options); err != nil {
-				return nil, fmt.Errorf("%s %w", errPrefix, err)
-			}
-		case "btrfs":
-			if err := addBtrfsPartition(pt, part); err != nil {
-				return nil, fmt.Errorf("%s %w", errPrefix, err)
-			}
-		default:
-			return nil, fmt.Errorf("%s invalid partition type: %s", errPrefix, part.Type)
-		}
+	if err := addCustomPartitions(pt, customizations, options); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
 
 	if err := EnsureRootFilesystem(pt, options.DefaultFSType, options.Architecture); err != nil {
@@ -1425,6 +1493,9 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 
 	// TODO: make blueprint MinSize of type datatypes.Size too
 	pt.relayout(datasizes.Size(customizations.MinSize))
+	if err := pt.CheckSectorSize(); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
+	}
 	pt.GenerateUUIDs(rng)
 
 	// One thing not caught by the customization validation is if a final "dos"
@@ -1440,6 +1511,43 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 	return pt, nil
 }
 
+// addCustomPartitions adds the partitions of the disk customizations to the
+// partition table
+func addCustomPartitions(pt *PartitionTable, customizations *blueprint.DiskCustomization, options *CustomPartitionTableOptions) error {
+	for _, part := range customizations.Partitions {
+		if part.PartType != "" {
+			// check the partition details now that we also know the partition table type
+			if err := part.ValidatePartitionTypeID(pt.Type.String()); err != nil {
+				return fmt.Errorf("error validating partition type ID for %q: %w", part.Mountpoint, err)
+			}
+			if err := part.ValidatePartitionID(pt.Type.String()); err != nil {
+				return fmt.Errorf("error validating partition ID for %q: %w", part.Mountpoint, err)
+			}
+			if err := part.ValidatePartitionLabel(pt.Type.String()); err != nil {
+				return fmt.Errorf("error validating partition label for %q: %w", part.Mountpoint, err)
+			}
+		}
+
+		switch part.Type {
+		case "plain", "":
+			if err := addPlainPartition(pt, part, options); err != nil {
+				return err
+			}
+		case "lvm":
+			if err := addLVMPartition(pt, part, options); err != nil {
+				return err
+			}
+		case "btrfs":
+			if err := addBtrfsPartition(pt, part); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid partition type: %s", part.Type)
+		}
+	}
+	return nil
+}
+
 // sortPartitions reorders the partitions in the table based on their start
 // sector.
 func (pt *PartitionTable) sortPartitions() {
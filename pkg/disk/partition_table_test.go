@@ -3339,3 +3339,124 @@ func TestUnmarshalSizeUnitStringPartitionTable(t *testing.T) {
 		})
 	}
 }
+
+func TestNewCustomPartitionTable4K(t *testing.T) {
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_XFS,
+		BootMode:      platform.BOOT_HYBRID,
+		Architecture:  arch.ARCH_X86_64,
+		SectorSize:    disk.NativeSectorSize4K,
+	}
+	pt, err := disk.NewCustomPartitionTable(&blueprint.DiskCustomization{}, options, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(disk.NativeSectorSize4K), pt.SectorSize)
+	assert.NoError(t, pt.CheckSectorSize())
+
+	// the automatically created ESP is large enough for FAT32
+	require.True(t, pt.Partitions[1].IsESP())
+	assert.Equal(t, disk.MinESPSize4K, pt.Partitions[1].Size)
+
+	// the GPT footer takes one sector for the header and 128 entries
+	root := pt.Partitions[len(pt.Partitions)-1]
+	assert.Equal(t, uint64(disk.NativeSectorSize4K+128*128), pt.Size.Uint64()-root.Start-root.Size.Uint64())
+	assert.Equal(t, root.Start/disk.NativeSectorSize4K, pt.BytesToSectors(root.Start))
+}
+
+func TestNewPartitionTable4KGrowsESP(t *testing.T) {
+	basePT := testdisk.TestPartitionTables()["plain"]
+	basePT.SectorSize = disk.NativeSectorSize4K
+
+	pt, err := disk.NewPartitionTable(&basePT, nil, 0, "", arch.ARCH_X86_64, nil, "", rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+
+	for _, part := range pt.Partitions {
+		if part.IsESP() {
+			assert.Equal(t, disk.MinESPSize4K, part.Size)
+		}
+	}
+	assert.NoError(t, pt.CheckSectorSize())
+}
+
+func TestCheckSectorSizeErrors(t *testing.T) {
+	testCases := map[string]struct {
+		pt     disk.PartitionTable
+		errmsg string
+	}{
+		"unsupported": {
+			pt:     disk.PartitionTable{SectorSize: 1024},
+			errmsg: "unsupported sector size 1024, must be 512 or 4096",
+		},
+		"unaligned-offset": {
+			pt: disk.PartitionTable{
+				SectorSize:  disk.NativeSectorSize4K,
+				StartOffset: 512,
+			},
+			errmsg: "start offset 512 is not aligned to the sector size 4096",
+		},
+		"unaligned-start": {
+			pt: disk.PartitionTable{
+				SectorSize: disk.NativeSectorSize4K,
+				Partitions: []disk.Partition{
+					{Start: 1*datasizes.MiB + 512, Size: 1 * datasizes.GiB},
+				},
+			},
+			errmsg: "start 1049088 of partition 1 is not aligned to the sector size 4096",
+		},
+		"unaligned-size": {
+			pt: disk.PartitionTable{
+				Partitions: []disk.Partition{
+					{Start: 1 * datasizes.MiB, Size: 1*datasizes.GiB + 1},
+				},
+			},
+			errmsg: "size 1073741825 of partition 1 is not aligned to the sector size 512",
+		},
+		"small-esp": {
+			pt: disk.PartitionTable{
+				SectorSize: disk.NativeSectorSize4K,
+				Partitions: []disk.Partition{
+					{Start: 1 * datasizes.MiB, Size: 200 * datasizes.MiB, Type: disk.EFISystemPartitionGUID},
+				},
+			},
+			errmsg: "EFI system partition 1 is too small for a disk with 4096 byte sectors: 209715200 bytes, need at least 272629760 bytes",
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			assert.EqualError(t, tc.pt.CheckSectorSize(), tc.errmsg)
+		})
+	}
+
+	// a 200 MiB ESP is fine with 512 byte sectors
+	pt := testCases["small-esp"].pt
+	pt.SectorSize = 0
+	assert.NoError(t, pt.CheckSectorSize())
+}
+
+func TestNewCustomPartitionTable4KSmallESP(t *testing.T) {
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				MinSize: 100 * datasizes.MiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/boot/efi",
+					FSType:     "vfat",
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_XFS,
+		BootMode:      platform.BOOT_UEFI,
+		Architecture:  arch.ARCH_X86_64,
+		SectorSize:    disk.NativeSectorSize4K,
+	}
+	_, err := disk.NewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(0)))
+	assert.EqualError(t, err, "error generating partition table: EFI system partition 1 is too small for a disk with 4096 byte sectors: 104857600 bytes, need at least 272629760 bytes")
+
+	options.SectorSize = 2048
+	_, err = disk.NewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(0)))
+	assert.EqualError(t, err, "error generating partition table: unsupported sector size 2048, must be 512 or 4096")
+}
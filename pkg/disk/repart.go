@@ -0,0 +1,234 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osbuild/images/pkg/arch"
+)
+
+// repartArchNames are the architecture suffixes of the partition type
+// identifiers of systemd-repart, e.g. "root-x86-64"
+var repartArchNames = map[arch.Arch]string{
+	arch.ARCH_X86_64:  "x86-64",
+	arch.ARCH_AARCH64: "arm64",
+	arch.ARCH_PPC64LE: "ppc64-le",
+	arch.ARCH_S390X:   "s390x",
+}
+
+// repartTypeNames maps partition type GUIDs to the identifiers that
+// systemd-repart uses for them
+var repartTypeNames = map[string]string{
+	EFISystemPartitionGUID: "esp",
+	XBootLDRPartitionGUID:  "xbootldr",
+	SwapPartitionGUID:      "swap",
+	FilesystemDataGUID:     "linux-generic",
+	LVMPartitionGUID:       "linux-lvm",
+}
+
+// repartFilenames are the names of definition files of partitions without a
+// payload whose type has no systemd-repart identifier
+var repartFilenames = map[string]string{
+	BIOSBootPartitionGUID: "bios",
+	PRePartitionGUID:      "prep",
+}
+
+func init() {
+	for name, guids := range archPartitionGUIDs {
+		for a, guid := range guids {
+			repartTypeNames[guid] = fmt.Sprintf("%s-%s", name, repartArchNames[a])
+			repartFilenames[guid] = name
+		}
+	}
+}
+
+// RepartDefinition is a partition definition for systemd-repart, see
+// repart.d(5). The definitions of a partition table recreate its layout, the
+// root partition has no maximum size so that it grows to the size of the
+// disk.
+type RepartDefinition struct {
+	// Filename of the definition in a repart.d directory. The names are
+	// ordered like the partitions, e.g. "01-esp.conf"
+	Filename string
+
+	Type   string
+	Label  string
+	UUID   string
+	Format string
+	// Encrypt is the LUKS key setup, e.g. "key-file" or "tpm2"
+	Encrypt string
+	// Verity is the dm-verity role of the partition: "data" or "hash"
+	Verity         string
+	VerityMatchKey string
+	// CopyBlocks is the path of an image that is copied to the partition
+	CopyBlocks string
+	// Subvolumes are the paths of the btrfs subvolumes to create
+	Subvolumes []string
+
+	SizeMinBytes uint64
+	// SizeMaxBytes is 0 if the partition can grow
+	SizeMaxBytes uint64
+
+	// Comments describe the parts of the layout that systemd-repart cannot
+	// create, e.g. LVM logical volumes
+	Comments []string
+}
+
+// String renders the definition as a repart.d(5) file
+func (d RepartDefinition) String() string {
+	var b strings.Builder
+	for _, comment := range d.Comments {
+		fmt.Fprintf(&b, "# %s\n", comment)
+	}
+	b.WriteString("[Partition]\n")
+	fmt.Fprintf(&b, "Type=%s\n", d.Type)
+	settings := []struct{ key, value string }{
+		{"Label", d.Label},
+		{"UUID", d.UUID},
+		{"Format", d.Format},
+		{"Encrypt", d.Encrypt},
+		{"Verity", d.Verity},
+		{"VerityMatchKey", d.VerityMatchKey},
+		{"CopyBlocks", d.CopyBlocks},
+		{"MakeDirectories", strings.Join(d.Subvolumes, " ")},
+		{"Subvolumes", strings.Join(d.Subvolumes, " ")},
+	}
+	for _, s := range settings {
+		if s.value != "" {
+			fmt.Fprintf(&b, "%s=%s\n", s.key, s.value)
+		}
+	}
+	if d.SizeMinBytes > 0 {
+		fmt.Fprintf(&b, "SizeMinBytes=%d\n", d.SizeMinBytes)
+	}
+	if d.SizeMaxBytes > 0 {
+		fmt.Fprintf(&b, "SizeMaxBytes=%d\n", d.SizeMaxBytes)
+	}
+	return b.String()
+}
+
+// mountpointName returns a name for a mountpoint that can be used in file
+// names and keys, e.g. "root" for "/" and "boot-efi" for "/boot/efi"
+func mountpointName(mountpoint string) string {
+	if mountpoint == "/" {
+		return "root"
+	}
+	return strings.ReplaceAll(strings.Trim(mountpoint, "/"), "/", "-")
+}
+
+// repartType returns the systemd-repart type identifier of a partition, the
+// GUID is used if systemd-repart has no name for the type
+func repartType(p *Partition) string {
+	if p.Type == "" {
+		return repartTypeNames[FilesystemDataGUID]
+	}
+	if name, ok := repartTypeNames[strings.ToUpper(p.Type)]; ok {
+		return name
+	}
+	return strings.ToLower(p.Type)
+}
+
+// addRepartPayload adds the settings for the payload of a partition to the
+// definition and returns the name of the payload for the file name
+func addRepartPayload(def *RepartDefinition, payload Entity, verityTargets map[string]bool) (string, error) {
+	switch ent := payload.(type) {
+	case nil:
+		return "", nil
+	case *Filesystem:
+		def.Format = ent.Type
+		if verityTargets[ent.Mountpoint] {
+			def.Verity = "data"
+			def.VerityMatchKey = mountpointName(ent.Mountpoint)
+		}
+		return mountpointName(ent.Mountpoint), nil
+	case *Swap:
+		def.Format = "swap"
+		return "swap", nil
+	case *Btrfs:
+		def.Format = "btrfs"
+		name := ""
+		for _, sv := range ent.Subvolumes {
+			def.Subvolumes = append(def.Subvolumes, "/"+strings.TrimPrefix(sv.Name, "/"))
+			if sv.Mountpoint == "/" {
+				name = "root"
+			}
+		}
+		if name == "" {
+			name = "btrfs"
+		}
+		return name, nil
+	case *LUKSContainer:
+		def.Encrypt = "key-file"
+		if ent.Clevis != nil && ent.Clevis.Pin == "tpm2" {
+			def.Encrypt = "tpm2"
+		}
+		return addRepartPayload(def, ent.Payload, verityTargets)
+	case *LVMVolumeGroup:
+		def.Comments = append(def.Comments, fmt.Sprintf("systemd-repart does not create the LVM volume group %q with the logical volumes:", ent.Name))
+		name := "lvm"
+		for _, lv := range ent.LogicalVolumes {
+			desc := fmt.Sprintf("  %s: %d bytes", lv.Name, lv.Size)
+			if mnt, ok := lv.Payload.(Mountable); ok {
+				desc += fmt.Sprintf(", %s on %s", mnt.GetFSType(), mnt.GetMountpoint())
+				if mnt.GetMountpoint() == "/" {
+					name = "root"
+				}
+			}
+			def.Comments = append(def.Comments, desc)
+		}
+		return name, nil
+	case *Raw:
+		def.CopyBlocks = ent.SourcePath
+		return "raw", nil
+	case *VerityHash:
+		def.Verity = "hash"
+		def.VerityMatchKey = mountpointName(ent.Target)
+		return mountpointName(ent.Target) + "-verity", nil
+	default:
+		return "", fmt.Errorf("unsupported payload %T for systemd-repart", payload)
+	}
+}
+
+// RepartDefinitions returns the systemd-repart definitions of the partitions
+// of the table, e.g. to grow or recreate the root partition on first boot.
+// Only GPT partition tables are supported by systemd-repart.
+func (pt *PartitionTable) RepartDefinitions() ([]RepartDefinition, error) {
+	if pt.Type != PT_GPT {
+		return nil, fmt.Errorf("systemd-repart only supports gpt partition tables, got %q", pt.Type)
+	}
+
+	verityTargets := make(map[string]bool)
+	for _, p := range pt.Partitions {
+		if vh, ok := p.Payload.(*VerityHash); ok {
+			verityTargets[vh.Target] = true
+		}
+	}
+
+	defs := make([]RepartDefinition, 0, len(pt.Partitions))
+	for idx := range pt.Partitions {
+		p := &pt.Partitions[idx]
+		def := RepartDefinition{
+			Type:         repartType(p),
+			Label:        p.Label,
+			UUID:         strings.ToLower(p.UUID),
+			SizeMinBytes: p.Size.Uint64(),
+		}
+		// the root partition takes the remaining space of the disk
+		if len(entityPath(p, "/")) == 0 {
+			def.SizeMaxBytes = p.Size.Uint64()
+		}
+		name, err := addRepartPayload(&def, p.Payload, verityTargets)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", idx+1, err)
+		}
+		if name == "" {
+			name = repartFilenames[strings.ToUpper(p.Type)]
+		}
+		if name == "" {
+			name = "partition"
+		}
+		def.Filename = fmt.Sprintf("%02d-%s.conf", idx+1, name)
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
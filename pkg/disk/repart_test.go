@@ -0,0 +1,181 @@
+package disk_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// exportTestPartitionTable is a layout with all entities the exporters
+// render: a bios boot partition, an ESP, a /boot partition and an encrypted
+// LVM volume group with the root
+func exportTestPartitionTable() *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		UUID: "D209C89E-EA5E-4FBD-B161-B461CCE297E0",
+		Size: 10 * datasizes.GiB,
+		Partitions: []disk.Partition{
+			{
+				Start:    1 * datasizes.MiB,
+				Size:     1 * datasizes.MiB,
+				Type:     disk.BIOSBootPartitionGUID,
+				Bootable: true,
+				UUID:     disk.BIOSBootPartitionUUID,
+			},
+			{
+				Start: 2 * datasizes.MiB,
+				Size:  200 * datasizes.MiB,
+				Type:  disk.EFISystemPartitionGUID,
+				UUID:  disk.EFISystemPartitionUUID,
+				Label: "ESP",
+				Payload: &disk.Filesystem{
+					Type:       "vfat",
+					UUID:       disk.EFIFilesystemUUID,
+					Mountpoint: "/boot/efi",
+				},
+			},
+			{
+				Start: 202 * datasizes.MiB,
+				Size:  1 * datasizes.GiB,
+				Type:  disk.XBootLDRPartitionGUID,
+				Attrs: []uint{59},
+				Payload: &disk.Filesystem{
+					Type:       "xfs",
+					Mountpoint: "/boot",
+				},
+			},
+			{
+				Start: 1226 * datasizes.MiB,
+				Size:  8966 * datasizes.MiB,
+				Type:  disk.FilesystemDataGUID,
+				UUID:  disk.RootPartitionUUID,
+				Payload: &disk.LUKSContainer{
+					Clevis: &disk.ClevisBind{Pin: "tpm2"},
+					Payload: &disk.LVMVolumeGroup{
+						Name: "rootvg",
+						LogicalVolumes: []disk.LVMLogicalVolume{
+							{
+								Name: "rootlv",
+								Size: 5 * datasizes.GiB,
+								Payload: &disk.Filesystem{
+									Type:       "xfs",
+									Mountpoint: "/",
+								},
+							},
+							{
+								Name:    "swaplv",
+								Size:    1 * datasizes.GiB,
+								Payload: &disk.Swap{},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestRepartDefinitions(t *testing.T) {
+	defs, err := exportTestPartitionTable().RepartDefinitions()
+	require.NoError(t, err)
+	require.Len(t, defs, 4)
+
+	assert.Equal(t, "01-bios.conf", defs[0].Filename)
+	assert.Equal(t, `[Partition]
+Type=21686148-6449-6e6f-744e-656564454649
+UUID=fac7f1fb-3e8d-4137-a512-961de09a5549
+SizeMinBytes=1048576
+SizeMaxBytes=1048576
+`, defs[0].String())
+
+	assert.Equal(t, "02-boot-efi.conf", defs[1].Filename)
+	assert.Equal(t, `[Partition]
+Type=esp
+Label=ESP
+UUID=68b2905b-df3e-4fb3-80fa-49d1e773aa33
+Format=vfat
+SizeMinBytes=209715200
+SizeMaxBytes=209715200
+`, defs[1].String())
+
+	assert.Equal(t, "03-boot.conf", defs[2].Filename)
+	assert.Equal(t, "xbootldr", defs[2].Type)
+
+	// the root grows, the logical volumes are only described
+	assert.Equal(t, "04-root.conf", defs[3].Filename)
+	assert.Equal(t, `# systemd-repart does not create the LVM volume group "rootvg" with the logical volumes:
+#   rootlv: 5368709120 bytes, xfs on /
+#   swaplv: 1073741824 bytes
+[Partition]
+Type=linux-generic
+UUID=6264d520-3fb9-423f-8ab8-7a0a8e3d3562
+Encrypt=tpm2
+SizeMinBytes=9401532416
+`, defs[3].String())
+}
+
+func TestRepartDefinitionsBtrfs(t *testing.T) {
+	pt := testdisk.MakeFakeBtrfsPartitionTable("/", "/home", "/boot")
+
+	defs, err := pt.RepartDefinitions()
+	require.NoError(t, err)
+	require.Len(t, defs, 2)
+	assert.Equal(t, "01-boot.conf", defs[0].Filename)
+	assert.Equal(t, "02-root.conf", defs[1].Filename)
+	assert.Equal(t, `[Partition]
+Type=linux-generic
+Format=btrfs
+MakeDirectories=/root /home
+Subvolumes=/root /home
+SizeMinBytes=9663676416
+`, defs[1].String())
+}
+
+func TestRepartDefinitionsVerity(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Size:    1 * datasizes.GiB,
+				Type:    disk.UsrPartitionX86_64GUID,
+				Payload: &disk.Filesystem{Type: "erofs", Mountpoint: "/usr"},
+			},
+			{
+				Size:    100 * datasizes.MiB,
+				Type:    disk.UsrVerityPartitionX86_64GUID,
+				Payload: &disk.VerityHash{Target: "/usr"},
+			},
+			{
+				Size:    2 * datasizes.GiB,
+				Type:    disk.RootPartitionX86_64GUID,
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"},
+			},
+		},
+	}
+
+	defs, err := pt.RepartDefinitions()
+	require.NoError(t, err)
+	require.Len(t, defs, 3)
+	assert.Equal(t, "usr-x86-64", defs[0].Type)
+	assert.Equal(t, "data", defs[0].Verity)
+	assert.Equal(t, "usr", defs[0].VerityMatchKey)
+	assert.Equal(t, "02-usr-verity.conf", defs[1].Filename)
+	assert.Equal(t, "usr-verity-x86-64", defs[1].Type)
+	assert.Equal(t, "hash", defs[1].Verity)
+	assert.Equal(t, "usr", defs[1].VerityMatchKey)
+	assert.Equal(t, "root-x86-64", defs[2].Type)
+	assert.Equal(t, uint64(0), defs[2].SizeMaxBytes)
+}
+
+func TestRepartDefinitionsDOS(t *testing.T) {
+	pt := testdisk.MakeFakePartitionTable("/")
+	pt.Type = disk.PT_DOS
+
+	_, err := pt.RepartDefinitions()
+	assert.EqualError(t, err, `systemd-repart only supports gpt partition tables, got "dos"`)
+}
@@ -0,0 +1,81 @@
+package disk
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// sfdiskAttrNames are the names of the GPT partition attribute bits that
+// sfdisk knows, the other bits are written as "GUID:<bit>"
+var sfdiskAttrNames = map[uint]string{
+	0: "RequiredPartition",
+	1: "NoBlockIOProtocol",
+	2: "LegacyBIOSBootable",
+}
+
+// partitionDevice returns the device node of the partition with the given
+// number on the device, e.g. /dev/sda1 or /dev/nvme0n1p1
+func partitionDevice(device string, num int) string {
+	if device != "" && unicode.IsDigit(rune(device[len(device)-1])) {
+		return fmt.Sprintf("%sp%d", device, num)
+	}
+	return fmt.Sprintf("%s%d", device, num)
+}
+
+// SfdiskScript returns the partition table as a script in the format of
+// "sfdisk --dump" for the given device, e.g. "/dev/vda". The script can be
+// passed to sfdisk to recreate the partition table.
+func (pt *PartitionTable) SfdiskScript(device string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "label: %s\n", pt.Type)
+	if pt.UUID != "" {
+		fmt.Fprintf(&b, "label-id: %s\n", pt.UUID)
+	}
+	if device != "" {
+		fmt.Fprintf(&b, "device: %s\n", device)
+	}
+	b.WriteString("unit: sectors\n")
+	fmt.Fprintf(&b, "sector-size: %d\n", pt.GetSectorSize())
+	b.WriteString("\n")
+
+	for idx, p := range pt.Partitions {
+		fields := []string{
+			fmt.Sprintf("start=%12d", pt.BytesToSectors(p.Start)),
+			fmt.Sprintf("size=%12d", pt.BytesToSectors(p.Size.Uint64())),
+		}
+		if p.Type != "" {
+			fields = append(fields, fmt.Sprintf("type=%s", p.Type))
+		}
+		if p.UUID != "" && pt.Type == PT_GPT {
+			fields = append(fields, fmt.Sprintf("uuid=%s", p.UUID))
+		}
+		if p.Label != "" && pt.Type == PT_GPT {
+			fields = append(fields, fmt.Sprintf("name=%q", p.Label))
+		}
+		if pt.Type == PT_DOS && p.Bootable {
+			fields = append(fields, "bootable")
+		}
+		if pt.Type == PT_GPT {
+			var attrs []string
+			if p.Bootable {
+				attrs = append(attrs, sfdiskAttrNames[2])
+			}
+			for _, bit := range p.Attrs {
+				if p.Bootable && bit == 2 {
+					continue
+				}
+				if name, ok := sfdiskAttrNames[bit]; ok {
+					attrs = append(attrs, name)
+				} else {
+					attrs = append(attrs, fmt.Sprintf("GUID:%d", bit))
+				}
+			}
+			if len(attrs) > 0 {
+				fields = append(fields, fmt.Sprintf("attrs=%q", strings.Join(attrs, " ")))
+			}
+		}
+		fmt.Fprintf(&b, "%s : %s\n", partitionDevice(device, idx+1), strings.Join(fields, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package disk_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func TestSfdiskScript(t *testing.T) {
+	pt := exportTestPartitionTable()
+
+	assert.Equal(t, `label: gpt
+label-id: D209C89E-EA5E-4FBD-B161-B461CCE297E0
+device: /dev/vda
+unit: sectors
+sector-size: 512
+
+/dev/vda1 : start=        2048, size=        2048, type=21686148-6449-6E6F-744E-656564454649, uuid=FAC7F1FB-3E8D-4137-A512-961DE09A5549, attrs="LegacyBIOSBootable"
+/dev/vda2 : start=        4096, size=      409600, type=C12A7328-F81F-11D2-BA4B-00A0C93EC93B, uuid=68B2905B-DF3E-4FB3-80FA-49D1E773AA33, name="ESP"
+/dev/vda3 : start=      413696, size=     2097152, type=BC13C2FF-59E6-4262-A352-B275FD6F7172, attrs="GUID:59"
+/dev/vda4 : start=     2510848, size=    18362368, type=0FC63DAF-8483-4772-8E79-3D69D8477DE4, uuid=6264D520-3FB9-423F-8AB8-7A0A8E3D3562
+`, pt.SfdiskScript("/dev/vda"))
+
+	// partitions of devices that end with a digit have a "p" separator
+	assert.Contains(t, pt.SfdiskScript("/dev/nvme0n1"), "/dev/nvme0n1p4 : ")
+}
+
+func TestSfdiskScriptDOS(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type:       disk.PT_DOS,
+		UUID:       "0x14fc63d2",
+		SectorSize: 4096,
+		Partitions: []disk.Partition{
+			{
+				Start:    1 * datasizes.MiB,
+				Size:     1 * datasizes.GiB,
+				Type:     disk.FilesystemLinuxDOSID,
+				Bootable: true,
+				Label:    "ignored",
+			},
+		},
+	}
+
+	assert.Equal(t, `label: dos
+label-id: 0x14fc63d2
+device: /dev/sda
+unit: sectors
+sector-size: 4096
+
+/dev/sda1 : start=         256, size=      262144, type=83, bootable
+`, pt.SfdiskScript("/dev/sda"))
+}
@@ -0,0 +1,143 @@
+package disk
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// SpaceUsage is the estimated usage of the space of an entity of the
+// partition table, e.g. a partition or a logical volume. Btrfs subvolumes
+// share the space of their volume, the usage of all their mountpoints is
+// summed up.
+type SpaceUsage struct {
+	// Mountpoints on the entity
+	Mountpoints []string
+	// Usage is the estimated usage of the mountpoints
+	Usage datasizes.Size
+	// Size of the entity
+	Size datasizes.Size
+}
+
+// Exceeded returns true if the estimated usage does not fit into the entity
+func (u SpaceUsage) Exceeded() bool {
+	return u.Usage > u.Size
+}
+
+func (u SpaceUsage) String() string {
+	return fmt.Sprintf("%s: %d bytes estimated, %d bytes available", strings.Join(u.Mountpoints, ", "), u.Usage, u.Size)
+}
+
+// spaceEntity returns the entity that holds the space of the mountable at
+// the start of the entity path
+func spaceEntity(path []Entity) Sizeable {
+	for _, ent := range path {
+		if _, ok := ent.(*BtrfsSubvolume); ok {
+			continue
+		}
+		if sizeable, ok := ent.(Sizeable); ok {
+			return sizeable
+		}
+	}
+	return nil
+}
+
+// SpaceUsage sums up the usage of the given directories for each entity of
+// the partition table that holds the space of a mountpoint. The usage of a
+// directory is accounted to the mountpoint it is on. The result is sorted by
+// the first mountpoint of each entity.
+func (pt *PartitionTable) SpaceUsage(dirUsage map[string]datasizes.Size) ([]SpaceUsage, error) {
+	var usages []SpaceUsage
+	index := make(map[Sizeable]int)
+	for dir, usage := range dirUsage {
+		entPath := pt.findDirectoryEntityPath(dir)
+		if entPath == nil {
+			return nil, fmt.Errorf("cannot find the mountpoint of %q", dir)
+		}
+		mountpoint := entPath[0].(Mountable).GetMountpoint()
+		ent := spaceEntity(entPath)
+		if ent == nil {
+			return nil, fmt.Errorf("mountpoint %q has no sized entity", mountpoint)
+		}
+		idx, ok := index[ent]
+		if !ok {
+			idx = len(usages)
+			index[ent] = idx
+			usages = append(usages, SpaceUsage{Size: ent.GetSize()})
+		}
+		if !slices.Contains(usages[idx].Mountpoints, mountpoint) {
+			usages[idx].Mountpoints = append(usages[idx].Mountpoints, mountpoint)
+		}
+		usages[idx].Usage += usage
+	}
+	for i := range usages {
+		slices.Sort(usages[i].Mountpoints)
+	}
+	slices.SortFunc(usages, func(a, b SpaceUsage) int {
+		return strings.Compare(a.Mountpoints[0], b.Mountpoints[0])
+	})
+	return usages, nil
+}
+
+// SplitDirectoryUsage splits the usage of the given directories between
+// the partition tables of the disks of an image. The usage of a directory
+// is accounted to the partition table with the deepest mountpoint that the
+// directory is on, directories that are on no mountpoint stay with the
+// first partition table. The result has one map for each partition table
+// in the given order.
+func SplitDirectoryUsage(pts []*PartitionTable, dirUsage map[string]datasizes.Size) []map[string]datasizes.Size {
+	res := make([]map[string]datasizes.Size, len(pts))
+	for i := range res {
+		res[i] = make(map[string]datasizes.Size)
+	}
+	if len(pts) == 0 {
+		return res
+	}
+	for dir, usage := range dirUsage {
+		owner, depth := 0, -1
+		for i, pt := range pts {
+			entPath := pt.findDirectoryEntityPath(dir)
+			if entPath == nil {
+				continue
+			}
+			if mountpoint := entPath[0].(Mountable).GetMountpoint(); len(mountpoint) > depth {
+				owner, depth = i, len(mountpoint)
+			}
+		}
+		res[owner][dir] += usage
+	}
+	return res
+}
+
+// GrowDirectorySizes grows the entities of the given directories like
+// EnsureDirectorySizes. If any entity was grown the partitions are laid out
+// again and the partition table grows if they do not fit anymore. It returns
+// true if any entity was grown.
+func (pt *PartitionTable) GrowDirectorySizes(dirSizeMap map[string]datasizes.Size) bool {
+	before := pt.Clone().(*PartitionTable)
+	pt.EnsureDirectorySizes(dirSizeMap)
+	if equalEntitySizes(before, pt) {
+		return false
+	}
+	pt.relayout(pt.Size)
+	return true
+}
+
+// equalEntitySizes compares the sizes of all sizeable entities of two
+// partition tables with the same structure
+func equalEntitySizes(a, b *PartitionTable) bool {
+	var sizes []datasizes.Size
+	collect := func(ent Entity, path []Entity) error {
+		if sizeable, ok := ent.(Sizeable); ok {
+			sizes = append(sizes, sizeable.GetSize())
+		}
+		return nil
+	}
+	_ = a.ForEachEntity(collect)
+	sizesA := sizes
+	sizes = nil
+	_ = b.ForEachEntity(collect)
+	return slices.Equal(sizesA, sizes)
+}
@@ -0,0 +1,98 @@
+package disk_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func TestPartitionTableSpaceUsage(t *testing.T) {
+	pt := testdisk.MakeFakePartitionTable("/", "/boot", "/var")
+
+	usages, err := pt.SpaceUsage(map[string]datasizes.Size{
+		"/usr/bin":  100 * datasizes.MiB,
+		"/etc":      10 * datasizes.MiB,
+		"/boot":     900 * datasizes.MiB,
+		"/var/lib":  1 * datasizes.MiB,
+		"/var/log2": 2 * datasizes.MiB,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []disk.SpaceUsage{
+		{Mountpoints: []string{"/"}, Usage: 110 * datasizes.MiB, Size: testdisk.FakePartitionSize},
+		{Mountpoints: []string{"/boot"}, Usage: 900 * datasizes.MiB, Size: testdisk.FakePartitionSize},
+		{Mountpoints: []string{"/var"}, Usage: 3 * datasizes.MiB, Size: testdisk.FakePartitionSize},
+	}, usages)
+	assert.False(t, usages[0].Exceeded())
+	assert.True(t, usages[1].Exceeded())
+	assert.Equal(t, "/boot: 943718400 bytes estimated, 827326464 bytes available", usages[1].String())
+}
+
+func TestPartitionTableSpaceUsageBtrfs(t *testing.T) {
+	pt := testdisk.MakeFakeBtrfsPartitionTable("/", "/home", "/boot")
+
+	usages, err := pt.SpaceUsage(map[string]datasizes.Size{
+		"/usr":       1 * datasizes.GiB,
+		"/home/user": 2 * datasizes.GiB,
+		"/boot":      10 * datasizes.MiB,
+	})
+	require.NoError(t, err)
+	// the subvolumes share the space of the btrfs volume
+	assert.Equal(t, []disk.SpaceUsage{
+		{Mountpoints: []string{"/", "/home"}, Usage: 3 * datasizes.GiB, Size: 9 * datasizes.GiB},
+		{Mountpoints: []string{"/boot"}, Usage: 10 * datasizes.MiB, Size: 1 * datasizes.GiB},
+	}, usages)
+}
+
+func TestPartitionTableSpaceUsageNoRoot(t *testing.T) {
+	pt := testdisk.MakeFakePartitionTable("/boot")
+
+	_, err := pt.SpaceUsage(map[string]datasizes.Size{"/usr": 1})
+	assert.EqualError(t, err, `cannot find the mountpoint of "/usr"`)
+}
+
+func TestPartitionTableGrowDirectorySizes(t *testing.T) {
+	pt := testdisk.MakeFakeBtrfsPartitionTable("/", "/boot")
+
+	assert.False(t, pt.GrowDirectorySizes(map[string]datasizes.Size{"/boot": 10 * datasizes.MiB}))
+
+	assert.True(t, pt.GrowDirectorySizes(map[string]datasizes.Size{"/boot": 2 * datasizes.GiB}))
+	size, err := pt.GetMountpointSize("/boot")
+	require.NoError(t, err)
+	assert.Equal(t, datasizes.Size(2*datasizes.GiB), size)
+
+	usages, err := pt.SpaceUsage(map[string]datasizes.Size{"/boot": 2 * datasizes.GiB})
+	require.NoError(t, err)
+	assert.False(t, usages[0].Exceeded())
+	// the partitions are laid out again and the image grows
+	assert.Greater(t, pt.Size, datasizes.Size(10*datasizes.GiB))
+}
+
+func TestSplitDirectoryUsage(t *testing.T) {
+	boot := testdisk.MakeFakePartitionTable("/", "/boot", "/var")
+	data := testdisk.MakeFakePartitionTable("/var/lib/data", "/srv")
+
+	split := disk.SplitDirectoryUsage([]*disk.PartitionTable{boot, data}, map[string]datasizes.Size{
+		"/usr":                1 * datasizes.GiB,
+		"/var/log":            10 * datasizes.MiB,
+		"/var/lib/data":       2 * datasizes.GiB,
+		"/var/lib/data/cache": 1 * datasizes.MiB,
+		"/srv/www":            3 * datasizes.MiB,
+	})
+	assert.Equal(t, []map[string]datasizes.Size{
+		{"/usr": 1 * datasizes.GiB, "/var/log": 10 * datasizes.MiB},
+		{"/var/lib/data": 2 * datasizes.GiB, "/var/lib/data/cache": 1 * datasizes.MiB, "/srv/www": 3 * datasizes.MiB},
+	}, split)
+
+	// the usage of the data disk is accounted to its own mountpoints
+	usages, err := data.SpaceUsage(split[1])
+	require.NoError(t, err)
+	assert.Equal(t, []disk.SpaceUsage{
+		{Mountpoints: []string{"/srv"}, Usage: 3 * datasizes.MiB, Size: testdisk.FakePartitionSize},
+		{Mountpoints: []string{"/var/lib/data"}, Usage: 2*datasizes.GiB + 1*datasizes.MiB, Size: testdisk.FakePartitionSize},
+	}, usages)
+}
@@ -0,0 +1,196 @@
+package disk
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+const (
+	// verityBlockSize is the size of the data and hash blocks of the
+	// dm-verity devices. The org.osbuild.dmverity stage formats the hash
+	// devices with the defaults of veritysetup(8), i.e. 4096 byte blocks
+	// and sha256 hashes.
+	verityBlockSize = 4096
+
+	// verityDigestSize is the size of a sha256 digest in bytes
+	verityDigestSize = 32
+)
+
+// VerityHash defines the payload of a partition that holds the dm-verity hash
+// tree for a read-only filesystem on another partition, the data partition.
+// The data partition is identified by the mountpoint of its filesystem.
+//
+// The hash tree is computed after the filesystem has been populated, which
+// means that the filesystem cannot be modified afterwards and must be mounted
+// read-only. The root hash is only known at that point, it is written next
+// to the image file (see osbuild.VerityRootHashFilename) and needs to be
+// passed to the booted system by the deployment, e.g. with the roothash= or
+// usrhash= kernel command line option.
+//
+// The root hash is not added to the kernel command line or a UKI of the
+// image: the stages that write them get their options from the manifest
+// and osbuild cannot pass them a value that an earlier stage computed
+// during the build. There is no verity signature partition either, no
+// osbuild stage signs the root hash. Both are out of scope until osbuild
+// supports them.
+type VerityHash struct {
+	// Mountpoint of the filesystem whose partition is protected by this
+	// hash tree.
+	Target string `json:"target" yaml:"target"`
+}
+
+func init() {
+	payloadEntityMap["verity_hash"] = reflect.TypeOf(VerityHash{})
+}
+
+func (v *VerityHash) EntityName() string {
+	return "verity_hash"
+}
+
+func (v *VerityHash) Clone() Entity {
+	if v == nil {
+		return nil
+	}
+
+	return &VerityHash{
+		Target: v.Target,
+	}
+}
+
+// HashTreeSize returns the size required for the hash tree (including the
+// verity superblock) of a data device with the given size.
+func (v *VerityHash) HashTreeSize(dataSize datasizes.Size) datasizes.Size {
+	hashesPerBlock := uint64(verityBlockSize / verityDigestSize)
+
+	// the superblock takes one hash block
+	size := uint64(verityBlockSize)
+	blocks := (dataSize.Uint64() + verityBlockSize - 1) / verityBlockSize
+	for blocks > 1 {
+		blocks = (blocks + hashesPerBlock - 1) / hashesPerBlock
+		size += blocks * verityBlockSize
+	}
+	return datasizes.Size(size)
+}
+
+// VerityPartitions groups the partitions that make up a dm-verity protected
+// filesystem. The values are indexes into PartitionTable.Partitions.
+type VerityPartitions struct {
+	// Target is the mountpoint of the protected filesystem.
+	Target string
+
+	Data int
+	Hash int
+}
+
+// VerityPartitions returns the dm-verity partition groups of the partition
+// table ordered by the position of their hash partition. It returns an error
+// if the definition is inconsistent, e.g. if the target filesystem does not
+// exist, is not on a plain partition, is not mounted read-only or if the hash
+// partition is too small.
+func (pt *PartitionTable) VerityPartitions() ([]VerityPartitions, error) {
+	var res []VerityPartitions
+
+	for idx, part := range pt.Partitions {
+		if payload, ok := part.Payload.(*VerityHash); ok {
+			res = append(res, VerityPartitions{Target: payload.Target, Data: -1, Hash: idx})
+		}
+	}
+
+	// a target can only be protected by one hash tree
+	seen := map[string]bool{}
+	for _, vp := range res {
+		if seen[vp.Target] {
+			return nil, fmt.Errorf("multiple verity hash partitions for %q", vp.Target)
+		}
+		seen[vp.Target] = true
+	}
+
+	for vpIdx := range res {
+		vp := &res[vpIdx]
+		for idx, part := range pt.Partitions {
+			mnt, ok := part.Payload.(Mountable)
+			if !ok || mnt.GetMountpoint() != vp.Target {
+				continue
+			}
+			vp.Data = idx
+
+			opts, err := mnt.GetFSTabOptions()
+			if err != nil {
+				return nil, err
+			}
+			if !opts.ReadOnly() {
+				return nil, fmt.Errorf("verity protected filesystem %q must be mounted read-only", vp.Target)
+			}
+		}
+		if vp.Data == -1 {
+			return nil, fmt.Errorf("cannot find a filesystem on a plain partition for the verity target %q", vp.Target)
+		}
+
+		hash := pt.Partitions[vp.Hash].Payload.(*VerityHash)
+		required := hash.HashTreeSize(pt.Partitions[vp.Data].Size)
+		if pt.Partitions[vp.Hash].Size < required {
+			return nil, fmt.Errorf("verity hash partition for %q is too small: %d < %d bytes", vp.Target, pt.Partitions[vp.Hash].Size, required)
+		}
+	}
+
+	return res, nil
+}
+
+// NewVerityImagePartitionTable returns the GPT partition table of a
+// discoverable disk image, like the ones used for system extensions, that
+// consists of a root partition, which is written from the filesystem image
+// at sourcePath, and the dm-verity hash partition that protects it. The
+// partitions have no size yet, see SetVerityImageDataSize.
+func NewVerityImagePartitionTable(sourcePath string, architecture arch.Arch, rng *rand.Rand) (*PartitionTable, error) {
+	dataType, err := getPartitionTypeIDfor(PT_GPT, "root", architecture)
+	if err != nil {
+		return nil, err
+	}
+	hashType, err := getPartitionTypeIDfor(PT_GPT, "root-verity", architecture)
+	if err != nil {
+		return nil, err
+	}
+
+	pt := &PartitionTable{
+		Type: PT_GPT,
+		Partitions: []Partition{
+			{
+				Type:    dataType,
+				Payload: &Raw{SourcePath: sourcePath},
+			},
+			{
+				Type:    hashType,
+				Payload: &VerityHash{Target: "/"},
+			},
+		},
+	}
+	pt.GenerateUUIDs(rng)
+	return pt, nil
+}
+
+// SetVerityImageDataSize lays out a partition table created with
+// NewVerityImagePartitionTable for a data partition of at least dataSize
+// bytes. The hash partition is sized to hold the hash tree of the whole data
+// partition.
+func (pt *PartitionTable) SetVerityImageDataSize(dataSize datasizes.Size) error {
+	if len(pt.Partitions) != 2 {
+		return fmt.Errorf("verity image partition table must have 2 partitions, got %d", len(pt.Partitions))
+	}
+	if _, ok := pt.Partitions[0].Payload.(*Raw); !ok {
+		return fmt.Errorf("unexpected payload of verity image data partition: %T", pt.Partitions[0].Payload)
+	}
+	hash, ok := pt.Partitions[1].Payload.(*VerityHash)
+	if !ok {
+		return fmt.Errorf("unexpected payload of verity image hash partition: %T", pt.Partitions[1].Payload)
+	}
+
+	pt.Partitions[0].Size = pt.AlignUp(dataSize)
+	pt.Partitions[1].Size = hash.HashTreeSize(pt.Partitions[0].Size)
+	pt.Size = 0
+	pt.relayout(0)
+	return nil
+}
@@ -0,0 +1,158 @@
+package disk_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func TestImplementsInterfacesCompileTimeCheckVerity(t *testing.T) {
+	var _ = disk.PayloadEntity(&disk.VerityHash{})
+}
+
+func TestVerityHashTreeSize(t *testing.T) {
+	testCases := map[string]struct {
+		dataSize datasizes.Size
+		expected datasizes.Size
+	}{
+		"single-block": {
+			dataSize: 4096,
+			expected: 4096,
+		},
+		"1GiB": {
+			dataSize: 1 * datasizes.GiB,
+			// superblock + 2048 + 16 + 1 hash blocks
+			expected: 2066 * 4096,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			hash := disk.VerityHash{Target: "/"}
+			assert.Equal(t, tc.expected, hash.HashTreeSize(tc.dataSize))
+		})
+	}
+}
+
+func verityTestPartitionTable(rootOptions string, hashSize datasizes.Size) *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Start: 1 * datasizes.MiB,
+				Size:  1 * datasizes.GiB,
+				Payload: &disk.Filesystem{
+					Type:         "ext4",
+					Mountpoint:   "/",
+					FSTabOptions: rootOptions,
+				},
+			},
+			{
+				Start:   1*datasizes.GiB + 1*datasizes.MiB,
+				Size:    hashSize,
+				Payload: &disk.VerityHash{Target: "/"},
+			},
+		},
+	}
+}
+
+func TestVerityPartitions(t *testing.T) {
+	pt := verityTestPartitionTable("ro", 64*datasizes.MiB)
+
+	vps, err := pt.VerityPartitions()
+	require.NoError(t, err)
+	assert.Equal(t, []disk.VerityPartitions{
+		{Target: "/", Data: 0, Hash: 1},
+	}, vps)
+
+	features := disk.GetPartitionTableFeatures(*pt)
+	assert.True(t, features.Verity)
+	assert.Contains(t, pt.GetBuildPackages(), "cryptsetup")
+}
+
+func TestVerityPartitionsErrors(t *testing.T) {
+	pt := verityTestPartitionTable("defaults", 64*datasizes.MiB)
+	_, err := pt.VerityPartitions()
+	assert.EqualError(t, err, `verity protected filesystem "/" must be mounted read-only`)
+
+	pt = verityTestPartitionTable("ro", 4*datasizes.MiB)
+	_, err = pt.VerityPartitions()
+	assert.EqualError(t, err, `verity hash partition for "/" is too small: 4194304 < 8462336 bytes`)
+
+	pt = verityTestPartitionTable("ro", 64*datasizes.MiB)
+	pt.Partitions[0].Payload.(*disk.Filesystem).Mountpoint = "/sysroot"
+	_, err = pt.VerityPartitions()
+	assert.EqualError(t, err, `cannot find a filesystem on a plain partition for the verity target "/"`)
+
+	pt = verityTestPartitionTable("ro", 64*datasizes.MiB)
+	pt.Partitions = append(pt.Partitions, disk.Partition{Payload: &disk.VerityHash{Target: "/"}})
+	_, err = pt.VerityPartitions()
+	assert.EqualError(t, err, `multiple verity hash partitions for "/"`)
+}
+
+func TestVerityPartitionTableUnmarshalYAML(t *testing.T) {
+	inputYAML := `
+type: "gpt"
+partitions:
+  - size: "1 GiB"
+    payload_type: "filesystem"
+    payload:
+      type: ext4
+      mountpoint: "/"
+      fstab_options: "ro"
+  - size: "64 MiB"
+    payload_type: "verity_hash"
+    payload:
+      target: "/"
+`
+	var pt disk.PartitionTable
+	err := yaml.Unmarshal([]byte(inputYAML), &pt)
+	require.NoError(t, err)
+	assert.Equal(t, &disk.VerityHash{Target: "/"}, pt.Partitions[1].Payload)
+}
+
+func TestVerityImagePartitionTable(t *testing.T) {
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+	pt, err := disk.NewVerityImagePartitionTable("extension.img", arch.ARCH_X86_64, rng)
+	require.NoError(t, err)
+	require.Len(t, pt.Partitions, 2)
+	assert.Equal(t, disk.RootPartitionX86_64GUID, pt.Partitions[0].Type)
+	assert.Equal(t, &disk.Raw{SourcePath: "extension.img"}, pt.Partitions[0].Payload)
+	assert.Equal(t, disk.RootVerityPartitionX86_64GUID, pt.Partitions[1].Type)
+	hash := pt.Partitions[1].Payload.(*disk.VerityHash)
+	assert.Equal(t, "/", hash.Target)
+
+	require.NoError(t, pt.SetVerityImageDataSize(100*datasizes.MiB))
+	assert.Equal(t, uint64(1*datasizes.MiB), pt.Partitions[0].Start)
+	assert.Equal(t, datasizes.Size(100*datasizes.MiB), pt.Partitions[0].Size)
+	assert.Equal(t, uint64(101*datasizes.MiB), pt.Partitions[1].Start)
+	// the last partition leaves room for the secondary GPT header
+	assert.Equal(t, datasizes.Size(1*datasizes.MiB)-pt.HeaderSize(), pt.Partitions[1].Size)
+	assert.Equal(t, datasizes.Size(102*datasizes.MiB), pt.Size)
+
+	// the table can be laid out again for a different size
+	require.NoError(t, pt.SetVerityImageDataSize(10*datasizes.MiB+1))
+	assert.Equal(t, datasizes.Size(11*datasizes.MiB), pt.Partitions[0].Size)
+	assert.Equal(t, uint64(12*datasizes.MiB), pt.Partitions[1].Start)
+}
+
+func TestVerityImagePartitionTableErrors(t *testing.T) {
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+	_, err := disk.NewVerityImagePartitionTable("extension.img", arch.ARCH_UNSET, rng)
+	assert.EqualError(t, err, `architecture must be specified for selecting GUID for "root" partition`)
+
+	pt := verityTestPartitionTable("ro", 64*datasizes.MiB)
+	assert.EqualError(t, pt.SetVerityImageDataSize(datasizes.MiB), "unexpected payload of verity image data partition: *disk.Filesystem")
+
+	pt.Partitions = pt.Partitions[:1]
+	assert.EqualError(t, pt.SetVerityImageDataSize(datasizes.MiB), "verity image partition table must have 2 partitions, got 1")
+}
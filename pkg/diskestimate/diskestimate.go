@@ -0,0 +1,147 @@
+// Package diskestimate predicts how much space the content of an image
+// tree needs in each of its directories, so that the mountpoints of the
+// partition table can be checked before osbuild runs.
+//
+// The estimate is based on the installed sizes of the depsolved packages,
+// the kernels that are installed and the containers that are embedded. The
+// installed size of a package is split evenly across its files, as the rpm
+// metadata has no sizes of single files. Packages without a file list are
+// accounted to /usr.
+package diskestimate
+
+import (
+	"path"
+	"strings"
+
+	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+const (
+	// DefaultKernelBootSize is the space each installed kernel needs in
+	// /boot: the kernel image and the initramfs that is generated at
+	// install time and their rescue variants
+	DefaultKernelBootSize = 200 * datasizes.MiB
+
+	// DefaultContainerExpansion is the factor from the compressed size of
+	// the layers of a container to its size in the containers-storage
+	DefaultContainerExpansion = 3
+
+	// DefaultOverheadPercent is added to the estimated usage for the
+	// filesystem metadata and files created at build or first boot
+	DefaultOverheadPercent = 20
+
+	// DefaultContainersStorage is where containers are stored if no
+	// custom location is configured
+	DefaultContainersStorage = "/var/lib/containers/storage"
+)
+
+// kernelPackages provide the kernel image of a kernel flavor
+var kernelPackages = []string{
+	"kernel",
+	"kernel-core",
+	"kernel-rt-core",
+	"kernel-64k-core",
+	"kernel-debug-core",
+	"kernel-uki-virt",
+	"kernel-default",
+}
+
+// Options tunes the estimate, unset values use the defaults
+type Options struct {
+	KernelBootSize     datasizes.Size
+	ContainerExpansion uint64
+	OverheadPercent    uint64
+}
+
+func (o *Options) withDefaults() Options {
+	var opts Options
+	if o != nil {
+		opts = *o
+	}
+	if opts.KernelBootSize == 0 {
+		opts.KernelBootSize = DefaultKernelBootSize
+	}
+	if opts.ContainerExpansion == 0 {
+		opts.ContainerExpansion = DefaultContainerExpansion
+	}
+	if opts.OverheadPercent == 0 {
+		opts.OverheadPercent = DefaultOverheadPercent
+	}
+	return opts
+}
+
+// Content is the content of an image tree
+type Content struct {
+	Packages   rpmmd.PackageList
+	Containers []container.Spec
+	// ContainersStorage is the location of the containers-storage,
+	// DefaultContainersStorage if empty
+	ContainersStorage string
+}
+
+// Kernels returns the number of kernels that are installed by the packages.
+// The packages of the same kernel, e.g. "kernel" and "kernel-core", have the
+// same version.
+func Kernels(pkgs rpmmd.PackageList) int {
+	versions := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, name := range kernelPackages {
+			if pkg.Name == name {
+				versions[pkg.EVRA()] = true
+			}
+		}
+	}
+	return len(versions)
+}
+
+// Estimate returns the estimated usage of each directory of a tree with the
+// given content, including the overhead. The directories are the parent
+// directories of the files of the packages and the directories of /boot and
+// of the containers-storage.
+func Estimate(content Content, opts *Options) map[string]datasizes.Size {
+	o := opts.withDefaults()
+	usage := make(map[string]datasizes.Size)
+
+	for _, pkg := range content.Packages {
+		if len(pkg.Files) == 0 {
+			usage["/usr"] += datasizes.Size(pkg.InstallSize)
+			continue
+		}
+		share := pkg.InstallSize / uint64(len(pkg.Files))
+		// the remainder of the split goes to the first file
+		remainder := pkg.InstallSize % uint64(len(pkg.Files))
+		for i, file := range pkg.Files {
+			if !strings.HasPrefix(file, "/") {
+				continue
+			}
+			size := share
+			if i == 0 {
+				size += remainder
+			}
+			usage[path.Dir(file)] += datasizes.Size(size)
+		}
+	}
+
+	if kernels := Kernels(content.Packages); kernels > 0 {
+		usage["/boot"] += datasizes.Size(kernels) * o.KernelBootSize
+	}
+
+	storage := content.ContainersStorage
+	if storage == "" {
+		storage = DefaultContainersStorage
+	}
+	for _, spec := range content.Containers {
+		usage[storage] += datasizes.Size(spec.Size * o.ContainerExpansion)
+	}
+
+	for dir, size := range usage {
+		if size == 0 {
+			delete(usage, dir)
+			continue
+		}
+		usage[dir] = size + size*datasizes.Size(o.OverheadPercent)/100
+	}
+	return usage
+}
@@ -0,0 +1,85 @@
+package diskestimate_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/diskestimate"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+func TestKernels(t *testing.T) {
+	pkgs := rpmmd.PackageList{
+		{Name: "kernel", Version: "5.14.0", Release: "1.el9", Arch: "x86_64"},
+		{Name: "kernel-core", Version: "5.14.0", Release: "1.el9", Arch: "x86_64"},
+		{Name: "kernel-core", Version: "5.14.0", Release: "2.el9", Arch: "x86_64"},
+		{Name: "kernel-modules", Version: "5.14.0", Release: "3.el9", Arch: "x86_64"},
+		{Name: "bash", Version: "5.1.8", Release: "1.el9", Arch: "x86_64"},
+	}
+	assert.Equal(t, 2, diskestimate.Kernels(pkgs))
+	assert.Equal(t, 0, diskestimate.Kernels(pkgs[3:]))
+}
+
+func TestEstimate(t *testing.T) {
+	content := diskestimate.Content{
+		Packages: rpmmd.PackageList{
+			{
+				Name:        "bash",
+				InstallSize: 1001,
+				Files:       []string{"/usr/bin/bash", "/usr/bin/sh", "/etc/skel/.bashrc"},
+			},
+			{
+				Name:        "filesystem",
+				InstallSize: 100,
+			},
+			{
+				Name:        "kernel-core",
+				Version:     "5.14.0",
+				Release:     "1.el9",
+				Arch:        "x86_64",
+				InstallSize: 200,
+				Files:       []string{"/usr/lib/modules/5.14.0/vmlinuz"},
+			},
+			{
+				Name: "empty",
+			},
+		},
+		Containers: []container.Spec{
+			{Source: "registry.example.org/app", Size: 1000},
+			{Source: "registry.example.org/unknown"},
+		},
+	}
+
+	usage := diskestimate.Estimate(content, &diskestimate.Options{
+		KernelBootSize:  1000,
+		OverheadPercent: 10,
+	})
+	assert.Equal(t, map[string]datasizes.Size{
+		// 333 + 2 remainder + 333 and 10% overhead
+		"/usr/bin":                    734,
+		"/etc/skel":                   366,
+		"/usr":                        110,
+		"/usr/lib/modules/5.14.0":     220,
+		"/boot":                       1100,
+		"/var/lib/containers/storage": 3300,
+	}, usage)
+}
+
+func TestEstimateDefaults(t *testing.T) {
+	content := diskestimate.Content{
+		Packages: rpmmd.PackageList{
+			{Name: "kernel", Version: "6.1", Release: "1", Arch: "aarch64"},
+		},
+		Containers:        []container.Spec{{Size: 100}},
+		ContainersStorage: "/usr/lib/containers/storage",
+	}
+
+	usage := diskestimate.Estimate(content, nil)
+	assert.Equal(t, map[string]datasizes.Size{
+		"/boot":                       diskestimate.DefaultKernelBootSize * 120 / 100,
+		"/usr/lib/containers/storage": 360,
+	}, usage)
+}
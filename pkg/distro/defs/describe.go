@@ -0,0 +1,127 @@
+package defs
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ResolvedValue is a value of the resolved configuration of an image
+// type together with the location in the distro definitions it comes
+// from, e.g. `image_types.qcow2.image_config.conditions["rhel-10"]`.
+type ResolvedValue struct {
+	Value      any    `json:"value" yaml:"value"`
+	Provenance string `json:"provenance" yaml:"provenance"`
+}
+
+// ResolvedPackageSet is a package set where every package carries the
+// location it is defined in.
+type ResolvedPackageSet struct {
+	Include []ResolvedValue `json:"include,omitempty" yaml:"include,omitempty"`
+	Exclude []ResolvedValue `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+// ResolvedImageType is the fully resolved configuration of an image
+// type for a concrete distro and architecture, i.e. with all conditions
+// evaluated and all inherited values merged. The configs are indexed by
+// the YAML name of their fields, unset fields are omitted.
+type ResolvedImageType struct {
+	Distro    string `json:"distro" yaml:"distro"`
+	Arch      string `json:"arch" yaml:"arch"`
+	ImageType string `json:"image_type" yaml:"image_type"`
+
+	PackageSets     map[string]ResolvedPackageSet `json:"package_sets,omitempty" yaml:"package_sets,omitempty"`
+	ImageConfig     map[string]ResolvedValue      `json:"image_config,omitempty" yaml:"image_config,omitempty"`
+	InstallerConfig map[string]ResolvedValue      `json:"installer_config,omitempty" yaml:"installer_config,omitempty"`
+	ISOConfig       map[string]ResolvedValue      `json:"iso_config,omitempty" yaml:"iso_config,omitempty"`
+	DiskConfig      map[string]ResolvedValue      `json:"disk_config,omitempty" yaml:"disk_config,omitempty"`
+	Platform        *ResolvedValue                `json:"platform,omitempty" yaml:"platform,omitempty"`
+	PartitionTable  *ResolvedValue                `json:"partition_table,omitempty" yaml:"partition_table,omitempty"`
+}
+
+// Resolve returns the configuration of the image type for the given
+// distro and architecture. The image config of the distro is merged
+// into the image config of the image type in the same way as it is
+// when building an image.
+func (it *ImageTypeYAML) Resolve(d *DistroYAML, archName string) (*ResolvedImageType, error) {
+	platforms, platformsProvenance, err := it.platformsFor(d.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ResolvedImageType{
+		Distro:    d.Name,
+		Arch:      archName,
+		ImageType: it.Name(),
+
+		PackageSets:     it.packageSets(d.ID, archName),
+		ImageConfig:     resolveConfigSources(append(d.imageConfigYAML.sources(d.ID), it.imageConfigSources(d.ID, archName)...)),
+		InstallerConfig: resolveConfigSources(it.installerConfigSources(d.ID, archName)),
+		ISOConfig:       resolveConfigSources(it.isoConfigSources(d.ID, archName)),
+		DiskConfig:      resolveConfigSources(it.diskConfigSources(d.ID, archName)),
+	}
+	for _, pl := range platforms {
+		if pl.Arch.String() == archName {
+			res.Platform = &ResolvedValue{pl, platformsProvenance}
+			break
+		}
+	}
+
+	pt, ptProvenance, err := it.partitionTable(d.ID, archName)
+	switch {
+	case errors.Is(err, ErrNoPartitionTableForImgType):
+		// image types without a partition table are fine
+	case err != nil:
+		return nil, err
+	default:
+		res.PartitionTable = &ResolvedValue{pt, ptProvenance}
+	}
+
+	return res, nil
+}
+
+// resolveConfigSources returns all set fields of the given configs
+// together with the provenance of the config they are set in. Like
+// with InheritFrom the last config that sets a field wins.
+func resolveConfigSources[T any](sources []configSource[T]) map[string]ResolvedValue {
+	res := make(map[string]ResolvedValue)
+	for _, src := range sources {
+		if src.config == nil {
+			continue
+		}
+		val := reflect.ValueOf(src.config).Elem()
+		for i := 0; i < val.NumField(); i++ {
+			// all config fields are pointers, slices or maps, see
+			// distro.shallowMerge()
+			if val.Field(i).IsNil() {
+				continue
+			}
+			res[yamlFieldName(val.Type().Field(i))] = ResolvedValue{
+				Value:      val.Field(i).Interface(),
+				Provenance: src.provenance,
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// yamlFieldName returns the name of the field in the YAML definitions
+func yamlFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		// the default of go-yaml
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// sortResolvedValues sorts resolved package names
+func sortResolvedValues(values []ResolvedValue) {
+	slices.SortStableFunc(values, func(a, b ResolvedValue) int {
+		return strings.Compare(a.Value.(string), b.Value.(string))
+	})
+}
@@ -0,0 +1,131 @@
+package defs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/distro/defs"
+)
+
+func TestImageTypeResolve(t *testing.T) {
+	fakeDistroYaml := `
+image_config:
+  default:
+    locale: "C.UTF-8"
+    timezone: "DefaultTZ"
+  conditions:
+    "distro tz":
+      when:
+        distro_name: "test-distro"
+      shallow_merge:
+        timezone: "DistroTZ"
+
+image_types:
+  test_type:
+    filename: foo
+    platforms:
+      - arch: x86_64
+        bios_platform: i386-pc
+    package_sets:
+      os:
+        - include: [pkg1, pkg3]
+          exclude: [exclude1]
+          conditions:
+            "on x86_64":
+              when:
+                arch: x86_64
+              append:
+                include: [pkg2]
+            "never":
+              when:
+                distro_name: "other-distro"
+              append:
+                include: [pkg-never]
+    image_config:
+      hostname: "foo"
+      conditions:
+        "version lt":
+          when:
+            version_less_than: "2"
+          shallow_merge:
+            timezone: "ImageTypeTZ"
+    partition_table:
+      x86_64: &pt
+        partitions:
+          - size: 1_048_576
+      aarch64: *pt
+`
+	makeTestImageType(t, fakeDistroYaml)
+	d, err := defs.NewDistroYAML("test-distro-1")
+	require.NoError(t, err)
+	it := d.ImageTypes()["test_type"]
+
+	res, err := it.Resolve(d, "x86_64")
+	require.NoError(t, err)
+
+	assert.Equal(t, "test-distro-1", res.Distro)
+	assert.Equal(t, "x86_64", res.Arch)
+	assert.Equal(t, "test_type", res.ImageType)
+	assert.Equal(t, map[string]defs.ResolvedPackageSet{
+		"os": {
+			Include: []defs.ResolvedValue{
+				{"pkg1", "image_types.test_type.package_sets.os[0]"},
+				{"pkg2", `image_types.test_type.package_sets.os[0].conditions["on x86_64"]`},
+				{"pkg3", "image_types.test_type.package_sets.os[0]"},
+			},
+			Exclude: []defs.ResolvedValue{
+				{"exclude1", "image_types.test_type.package_sets.os[0]"},
+			},
+		},
+	}, res.PackageSets)
+	assert.Equal(t, map[string]defs.ResolvedValue{
+		"hostname": {common.ToPtr("foo"), "image_types.test_type.image_config"},
+		"locale":   {common.ToPtr("C.UTF-8"), "image_config.default"},
+		"timezone": {common.ToPtr("ImageTypeTZ"), `image_types.test_type.image_config.conditions["version lt"]`},
+	}, res.ImageConfig)
+	assert.Nil(t, res.InstallerConfig)
+	assert.Nil(t, res.ISOConfig)
+	assert.Nil(t, res.DiskConfig)
+
+	require.NotNil(t, res.Platform)
+	assert.Equal(t, "image_types.test_type.platforms", res.Platform.Provenance)
+	require.NotNil(t, res.PartitionTable)
+	assert.Equal(t, "image_types.test_type.partition_table.x86_64", res.PartitionTable.Provenance)
+
+	// the image type config is resolved for the given arch
+	res, err = it.Resolve(d, arch.ARCH_AARCH64.String())
+	require.NoError(t, err)
+	assert.Nil(t, res.Platform)
+	assert.Equal(t, []defs.ResolvedValue{
+		{"pkg1", "image_types.test_type.package_sets.os[0]"},
+		{"pkg3", "image_types.test_type.package_sets.os[0]"},
+	}, res.PackageSets["os"].Include)
+}
+
+func TestImageTypeResolveNoPartitionTable(t *testing.T) {
+	fakeDistroYaml := `
+image_types:
+  test_type:
+    filename: foo
+    partition_tables_override:
+      conditions:
+        "distro name":
+          when:
+            distro_name: "test-distro"
+          override:
+            x86_64:
+              partitions:
+                - size: 2_097_152
+`
+	it := makeTestImageType(t, fakeDistroYaml)
+	d, err := defs.NewDistroYAML("test-distro-1")
+	require.NoError(t, err)
+
+	res, err := it.Resolve(d, "x86_64")
+	require.NoError(t, err)
+	assert.Nil(t, res.PartitionTable)
+}
@@ -62,7 +62,13 @@ func matchAndNormalize(reStr, nameVer string) (string, error) {
 //
 // If no match is found it will "nil" and no error (
 func ParseID(nameVer string) (*distro.ID, error) {
-	distros, err := loadDistros()
+	return defaultLoader().ParseID(nameVer)
+}
+
+// ParseID parse the given nameVer into a distro.ID using the distro
+// definitions of the loader, see ParseID.
+func (l *Loader) ParseID(nameVer string) (*distro.ID, error) {
+	distros, err := l.loadDistros()
 	if err != nil {
 		return nil, err
 	}
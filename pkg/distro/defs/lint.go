@@ -0,0 +1,660 @@
+package defs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/distro"
+)
+
+// LintProblem is a semantic problem in the distro definitions. Unlike
+// syntax errors these problems are otherwise only found when a specific
+// distro, architecture or image type is instantiated (or never).
+type LintProblem struct {
+	Filename string
+	Line     int
+	Column   int
+	Message  string
+
+	// Warning is set for problems that do not change the resulting
+	// images, e.g. unused anchors
+	Warning bool
+}
+
+func (p LintProblem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("%s:%d:%d: warning: %s", p.Filename, p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.Filename, p.Line, p.Column, p.Message)
+}
+
+// Lint checks the built-in distro definitions for semantic problems.
+func Lint() ([]LintProblem, error) {
+	return defaultLoader().Lint()
+}
+
+// Lint checks all distro definitions of the loader for semantic problems.
+// The `when` conditions are evaluated for all versions of a distro that
+// can make a difference for the versions used in the conditions and for
+// all architectures of an image type.
+//
+// The returned error is only set if the definitions cannot be loaded at
+// all, e.g. because of syntax errors.
+func (l *Loader) Lint() ([]LintProblem, error) {
+	distros, err := l.loadDistros()
+	if err != nil {
+		return nil, err
+	}
+
+	lt := &linter{}
+	// the node of the definition of each distro, later
+	// definitions replace earlier ones just like in loadDistros()
+	distroNodes := make(map[string]lintNode)
+	for fsIdx, dataFS := range l.fses {
+		dents, err := fs.Glob(dataFS, "*.yaml")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range dents {
+			root, err := decodeNode(dataFS, name)
+			if err != nil {
+				return nil, err
+			}
+			fileDistros, err := decodeDistros(dataFS, name)
+			if err != nil {
+				return nil, err
+			}
+			for idx, d := range fileDistros.Distros {
+				distroNodes[d.key()] = lintNode{
+					filename: l.filename(fsIdx, name),
+					node:     nodeFor(root, "distros", idx),
+				}
+			}
+		}
+	}
+
+	byDefsPath := make(map[string][]DistroYAML)
+	for _, d := range distros.Distros {
+		byDefsPath[d.DefsPath] = append(byDefsPath[d.DefsPath], d)
+	}
+	for _, defsPath := range slices.Sorted(maps.Keys(byDefsPath)) {
+		if err := l.lintDefsPath(lt, defsPath, byDefsPath[defsPath], distroNodes); err != nil {
+			return nil, err
+		}
+	}
+
+	return lt.problems, nil
+}
+
+func (l *Loader) lintDefsPath(lt *linter, defsPath string, distros []DistroYAML, distroNodes map[string]lintNode) error {
+	imgTypes, err := l.loadImageTypes(defsPath)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(defsPath, "imagetypes.yaml")
+
+	type imgTypesFile struct {
+		filename string
+		root     *yaml.Node
+		content  *imageTypesYAML
+	}
+	var files []imgTypesFile
+	for fsIdx, dataFS := range l.fses {
+		content, err := decodeImageTypes(dataFS, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot decode %s: %w", name, err)
+		}
+		root, err := decodeNode(dataFS, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, imgTypesFile{l.filename(fsIdx, name), root, content})
+	}
+
+	// collect all conditions first, the versions they use define
+	// the distro versions that the conditions are evaluated for
+	var conds []lintCondition
+	for idx := range distros {
+		d := &distros[idx]
+		for _, condName := range slices.Sorted(maps.Keys(d.Conditions)) {
+			cond := d.Conditions[condName]
+			if cond.When == nil {
+				continue
+			}
+			conds = append(conds, lintCondition{
+				lintNode:  distroNodes[d.key()].at("conditions", condName, "when"),
+				when:      cond.When,
+				allowArch: true,
+				distro:    d,
+			})
+		}
+	}
+	for _, f := range files {
+		conds = append(conds, imageTypesConditions(f.filename, f.root, f.content)...)
+	}
+
+	var versions []string
+	for _, cond := range conds {
+		versions = append(versions, cond.when.VersionLessThan, cond.when.VersionGreaterOrEqual, cond.when.VersionEqual)
+	}
+	var distroVersions []DistroYAML
+	names := make(map[string]bool)
+	for _, d := range distros {
+		for _, id := range lintDistroIDs(&d, versions) {
+			dv := d
+			dv.ID = id
+			distroVersions = append(distroVersions, dv)
+		}
+		names[lintDistroName(&d)] = true
+	}
+
+	// the targets of all image types, problems with the platforms
+	// are reported here once per image type
+	targets := make(map[*ImageTypeYAML][]lintTarget)
+	var allArches []string
+	for _, f := range files {
+		for _, itName := range slices.Sorted(maps.Keys(f.content.ImageTypes)) {
+			it := f.content.ImageTypes[itName]
+			it.name = itName
+			itNode := lintNode{f.filename, nodeFor(f.root, "image_types", itName)}
+			for _, t := range imageTypeTargets(lt, itNode, &it, distroVersions) {
+				if !slices.Contains(allArches, t.arch) {
+					allArches = append(allArches, t.arch)
+				}
+			}
+		}
+	}
+
+	// conditions can be shared between image types via anchors, they
+	// are reported once and only if none of their uses ever matches
+	checked := make(map[*yaml.Node]bool)
+	matched := make(map[*yaml.Node]bool)
+	for _, cond := range conds {
+		if !checked[cond.node] {
+			checked[cond.node] = true
+			if !lt.checkCondition(cond, names) {
+				// already reported
+				matched[cond.node] = true
+			}
+		}
+		if matched[cond.node] {
+			continue
+		}
+
+		var condTargets []lintTarget
+		switch {
+		case cond.imgType != nil:
+			if _, ok := targets[cond.imgType]; !ok {
+				targets[cond.imgType] = imageTypeTargets(nil, lintNode{}, cond.imgType, distroVersions)
+			}
+			condTargets = targets[cond.imgType]
+		default:
+			for _, dv := range distroVersions {
+				if cond.distro != nil && dv.key() != cond.distro.key() {
+					continue
+				}
+				condTargets = append(condTargets, lintTarget{dv.ID, ""})
+				for _, a := range allArches {
+					condTargets = append(condTargets, lintTarget{dv.ID, a})
+				}
+			}
+		}
+		// without any known distro versions the condition cannot
+		// be evaluated
+		if len(condTargets) == 0 {
+			matched[cond.node] = true
+			continue
+		}
+		matched[cond.node] = cond.matches(condTargets)
+	}
+	for _, cond := range conds {
+		if !matched[cond.node] {
+			lt.report(cond.lintNode, "condition never matches any distro version or architecture")
+			matched[cond.node] = true
+		}
+	}
+
+	for _, d := range distros {
+		for _, condName := range slices.Sorted(maps.Keys(d.Conditions)) {
+			for idx, itName := range d.Conditions[condName].IgnoreImageTypes {
+				if _, ok := imgTypes.ImageTypes[itName]; !ok {
+					lt.report(distroNodes[d.key()].at("conditions", condName, "ignore_image_types", idx), "unknown image type %q in %s", itName, name)
+				}
+			}
+		}
+	}
+
+	for _, f := range files {
+		for _, itName := range slices.Sorted(maps.Keys(f.content.ImageTypes)) {
+			it := f.content.ImageTypes[itName]
+			it.name = itName
+			itNode := lintNode{f.filename, nodeFor(f.root, "image_types", itName)}
+			lt.checkImageType(itNode, &it, imageTypeTargets(nil, itNode, &it, distroVersions))
+		}
+		lt.checkCommonAnchors(f.filename, f.root)
+	}
+
+	return nil
+}
+
+// lintTarget is a distro version and an architecture that an image
+// type is built for
+type lintTarget struct {
+	id   distro.ID
+	arch string
+}
+
+// imageTypeTargets returns the targets of the image type for all given
+// distro versions. Problems with the platforms are reported if lt is set.
+func imageTypeTargets(lt *linter, itNode lintNode, it *ImageTypeYAML, distroVersions []DistroYAML) []lintTarget {
+	var targets []lintTarget
+	for _, dv := range distroVersions {
+		platforms, err := it.PlatformsFor(dv.ID)
+		if err != nil {
+			if lt != nil {
+				lt.report(itNode.at("platforms_override"), "%v for %s", err, dv.ID)
+			}
+			continue
+		}
+		for _, pl := range platforms {
+			t := lintTarget{dv.ID, pl.Arch.String()}
+			if dv.SkipImageType(it.Name(), t.arch) || slices.Contains(targets, t) {
+				continue
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+type linter struct {
+	problems []LintProblem
+}
+
+func (lt *linter) report(ln lintNode, format string, args ...any) {
+	lt.add(ln, false, fmt.Sprintf(format, args...))
+}
+
+func (lt *linter) warn(ln lintNode, format string, args ...any) {
+	lt.add(ln, true, fmt.Sprintf(format, args...))
+}
+
+func (lt *linter) add(ln lintNode, warning bool, msg string) {
+	p := LintProblem{
+		Filename: ln.filename,
+		Message:  msg,
+		Warning:  warning,
+	}
+	if ln.node != nil {
+		p.Line = ln.node.Line
+		p.Column = ln.node.Column
+	}
+	lt.problems = append(lt.problems, p)
+}
+
+// lintNode is a YAML node with the file it is defined in
+type lintNode struct {
+	filename string
+	node     *yaml.Node
+}
+
+// at returns the node at the given path below the node, see nodeFor()
+func (ln lintNode) at(path ...any) lintNode {
+	return lintNode{ln.filename, nodeFor(ln.node, path...)}
+}
+
+// lintCondition is a `when` condition and where it is used
+type lintCondition struct {
+	lintNode
+	when *whenCondition
+	// allowArch is set if the condition is evaluated with the
+	// architecture of the image
+	allowArch bool
+	// imgType is the image type the condition is part of, if any
+	imgType *ImageTypeYAML
+	// distro is the distro the condition is part of, if any
+	distro *DistroYAML
+}
+
+func imageTypesConditions(filename string, root *yaml.Node, content *imageTypesYAML) []lintCondition {
+	var conds []lintCondition
+
+	file := lintNode{filename, root}
+	for _, condName := range slices.Sorted(maps.Keys(content.ImageConfig.Conditions)) {
+		conds = append(conds, lintCondition{
+			lintNode: file.at("image_config", "conditions", condName, "when"),
+			when:     &content.ImageConfig.Conditions[condName].When,
+		})
+	}
+
+	for _, itName := range slices.Sorted(maps.Keys(content.ImageTypes)) {
+		it := content.ImageTypes[itName]
+		it.name = itName
+		itNode := file.at("image_types", itName)
+		add := func(when *whenCondition, allowArch bool, path ...any) {
+			conds = append(conds, lintCondition{
+				lintNode:  itNode.at(append(path, "when")...),
+				when:      when,
+				allowArch: allowArch,
+				imgType:   &it,
+			})
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(it.PackageSetsYAML)) {
+			for idx, pkgSet := range it.PackageSetsYAML[key] {
+				for _, condName := range slices.Sorted(maps.Keys(pkgSet.Conditions)) {
+					add(&pkgSet.Conditions[condName].When, true, "package_sets", key, idx, "conditions", condName)
+				}
+			}
+		}
+		if it.PartitionTablesOverrides != nil {
+			for _, condName := range slices.Sorted(maps.Keys(it.PartitionTablesOverrides.Conditions)) {
+				add(&it.PartitionTablesOverrides.Conditions[condName].When, true, "partition_tables_override", "conditions", condName)
+			}
+		}
+		if it.PlatformsOverride != nil {
+			for _, condName := range slices.Sorted(maps.Keys(it.PlatformsOverride.Conditions)) {
+				add(&it.PlatformsOverride.Conditions[condName].When, false, "platforms_override", "conditions", condName)
+			}
+		}
+		for _, condName := range slices.Sorted(maps.Keys(it.ImageConfigYAML.Conditions)) {
+			add(&it.ImageConfigYAML.Conditions[condName].When, true, "image_config", "conditions", condName)
+		}
+		for _, condName := range slices.Sorted(maps.Keys(it.InstallerConfigYAML.Conditions)) {
+			add(&it.InstallerConfigYAML.Conditions[condName].When, true, "installer_config", "conditions", condName)
+		}
+		for _, condName := range slices.Sorted(maps.Keys(it.ISOConfigYAML.Conditions)) {
+			add(&it.ISOConfigYAML.Conditions[condName].When, true, "iso_config", "conditions", condName)
+		}
+		for _, condName := range slices.Sorted(maps.Keys(it.DiskConfigYAML.Conditions)) {
+			add(&it.DiskConfigYAML.Conditions[condName].When, true, "disk_config", "conditions", condName)
+		}
+	}
+
+	return conds
+}
+
+// checkCondition reports invalid values in the condition and returns false
+// if there are any.
+func (lt *linter) checkCondition(cond lintCondition, names map[string]bool) bool {
+	when := cond.when
+	if when.Architecture != "" {
+		if _, err := arch.FromString(when.Architecture); err != nil {
+			lt.report(cond.at("arch"), "unknown arch %q in condition", when.Architecture)
+			return false
+		}
+		if !cond.allowArch {
+			lt.report(cond.at("arch"), "arch conditions are not supported here, the condition never matches")
+			return false
+		}
+	}
+	for _, name := range []string{when.DistroName, when.NotDistroName} {
+		if name != "" && !names[name] {
+			lt.report(cond.lintNode, "unknown distro name %q in condition", name)
+			return false
+		}
+	}
+	for _, ver := range []string{when.VersionLessThan, when.VersionGreaterOrEqual, when.VersionEqual} {
+		if ver == "" {
+			continue
+		}
+		if _, err := distro.ParseID("lint-" + ver); err != nil {
+			lt.report(cond.lintNode, "invalid version %q in condition", ver)
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns true if the condition matches any of the given targets.
+func (cond lintCondition) matches(targets []lintTarget) bool {
+	for _, t := range targets {
+		a := t.arch
+		if !cond.allowArch {
+			a = ""
+		}
+		if cond.when.Eval(t.id, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (lt *linter) checkImageType(itNode lintNode, it *ImageTypeYAML, targets []lintTarget) {
+	if len(it.PartitionTables) > 0 {
+		var missing []string
+		for _, t := range targets {
+			if it.PartitionTables[t.arch] == nil && !slices.Contains(missing, t.arch) {
+				missing = append(missing, t.arch)
+				lt.report(itNode.at("partition_table"), "no partition table for arch %q of the image type platforms", t.arch)
+			}
+		}
+		for _, a := range slices.Sorted(maps.Keys(it.PartitionTables)) {
+			if _, err := arch.FromString(a); err != nil {
+				lt.report(itNode.at("partition_table", a), "unknown arch %q in partition tables", a)
+			}
+		}
+	}
+
+	// a matching override without a partition table for the arch
+	// removes the partition table
+	if it.PartitionTablesOverrides != nil {
+		for _, condName := range slices.Sorted(maps.Keys(it.PartitionTablesOverrides.Conditions)) {
+			cond := it.PartitionTablesOverrides.Conditions[condName]
+			for _, t := range targets {
+				if it.PartitionTables[t.arch] == nil || cond.Override[t.arch] != nil {
+					continue
+				}
+				if cond.When.Eval(t.id, t.arch) {
+					lt.report(itNode.at("partition_tables_override", "conditions", condName), "partition table override for %s has no partition table for arch %q", t.id, t.arch)
+					break
+				}
+			}
+		}
+	}
+
+	for _, key := range []string{"supported_options", "required_options"} {
+		options := it.Blueprint.SupportedOptions
+		if key == "required_options" {
+			options = it.Blueprint.RequiredOptions
+		}
+		for idx, option := range options {
+			if err := distro.ValidateBlueprintOption(option); err != nil {
+				lt.report(itNode.at("blueprint", key, idx), "invalid blueprint option: %v", err)
+			}
+		}
+	}
+}
+
+// checkCommonAnchors reports anchors in the ".common" section that are not
+// used anywhere. Anchors that are nested in a used anchor are considered
+// used.
+func (lt *linter) checkCommonAnchors(filename string, root *yaml.Node) {
+	common := nodeFor(root, ".common")
+	if common == nil || common.Kind != yaml.MappingNode {
+		return
+	}
+
+	used := make(map[*yaml.Node]bool)
+	var findAliases func(n *yaml.Node)
+	findAliases = func(n *yaml.Node) {
+		if n.Kind == yaml.AliasNode {
+			used[n.Alias] = true
+			return
+		}
+		for _, c := range n.Content {
+			findAliases(c)
+		}
+	}
+	findAliases(root)
+
+	var checkAnchors func(n *yaml.Node, parentUsed bool)
+	checkAnchors = func(n *yaml.Node, parentUsed bool) {
+		isUsed := parentUsed || used[n]
+		if n.Anchor != "" && !isUsed {
+			lt.warn(lintNode{filename, n}, "anchor %q in .common is never used", n.Anchor)
+		}
+		for _, c := range n.Content {
+			checkAnchors(c, isUsed)
+		}
+	}
+	checkAnchors(common, false)
+}
+
+// lintDistroName returns the name of the distro without the version
+func lintDistroName(d *DistroYAML) string {
+	name, _, found := strings.Cut(d.Name, "-{{")
+	if found {
+		return name
+	}
+	if id, err := distro.ParseID(d.Name); err == nil {
+		return id.Name
+	}
+	return d.Name
+}
+
+// lintDistroIDs returns the distro IDs of the given distro that the
+// conditions are evaluated for. Distros that match a range of versions
+// are expanded to the versions around the given versions that are used
+// by the conditions.
+func lintDistroIDs(d *DistroYAML, versions []string) []distro.ID {
+	// distros are also found by their name, so a name without
+	// templates is a single version even if there is a match
+	if d.Match == "" || !strings.Contains(d.Name, "{{") {
+		if id, err := distro.ParseID(d.Name); err == nil {
+			return []distro.ID{*id}
+		}
+		return nil
+	}
+
+	name := lintDistroName(d)
+	var candidates []string
+	for _, ver := range versions {
+		if ver == "" {
+			continue
+		}
+		id, err := distro.ParseID("lint-" + ver)
+		if err != nil {
+			continue
+		}
+		for _, major := range []int{id.MajorVersion - 1, id.MajorVersion, id.MajorVersion + 1} {
+			candidates = append(candidates, fmt.Sprintf("%s-%d", name, major))
+		}
+		minor := max(id.MinorVersion, 0)
+		for _, m := range []int{minor - 1, minor, minor + 1} {
+			if m >= 0 {
+				candidates = append(candidates, fmt.Sprintf("%s-%d.%d", name, id.MajorVersion, m))
+			}
+		}
+	}
+
+	var ids []distro.ID
+	for _, candidate := range candidates {
+		found, err := matchAndNormalize(d.Match, candidate)
+		if err != nil || found == "" {
+			continue
+		}
+		id, err := distro.ParseID(found)
+		if err != nil || slices.Contains(ids, *id) {
+			continue
+		}
+		ids = append(ids, *id)
+	}
+	return ids
+}
+
+func decodeNode(dataFS fs.FS, name string) (*yaml.Node, error) {
+	f, err := dataFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var root yaml.Node
+	if err := yaml.NewDecoder(f).Decode(&root); err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", name, err)
+	}
+	return &root, nil
+}
+
+// nodeFor returns the node at the given path of mapping keys (string) and
+// sequence indexes (int) below the given node. Aliases and merge keys are
+// followed, so the returned node is where the value is actually defined.
+// If the path does not exist the deepest existing node is returned.
+func nodeFor(node *yaml.Node, path ...any) *yaml.Node {
+	node = resolveNode(node)
+	for _, elem := range path {
+		var next *yaml.Node
+		switch key := elem.(type) {
+		case string:
+			next = mappingValue(node, key)
+		case int:
+			if node != nil && node.Kind == yaml.SequenceNode && key < len(node.Content) {
+				next = resolveNode(node.Content[key])
+			}
+		}
+		if next == nil {
+			return node
+		}
+		node = next
+	}
+	return node
+}
+
+func resolveNode(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			if len(node.Content) == 0 {
+				return nil
+			}
+			node = node.Content[0]
+		case yaml.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var merges []*yaml.Node
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		k, v := node.Content[idx], node.Content[idx+1]
+		if k.Tag == "!!merge" {
+			merges = append(merges, v)
+			continue
+		}
+		if k.Value == key {
+			return resolveNode(v)
+		}
+	}
+	for _, merge := range merges {
+		merge = resolveNode(merge)
+		sources := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			sources = merge.Content
+		}
+		for _, src := range sources {
+			if v := mappingValue(resolveNode(src), key); v != nil {
+				return v
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package defs_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/distro/defs"
+)
+
+func TestLintBuiltinDistroDefs(t *testing.T) {
+	problems, err := defs.Lint()
+	require.NoError(t, err)
+	for _, p := range problems {
+		assert.True(t, p.Warning, "unexpected problem in the distro definitions: %s", p)
+	}
+}
+
+func TestLint(t *testing.T) {
+	fakeDistrosYAML := `
+distros:
+ - name: test-distro-1
+   vendor: test-vendor
+   defs_path: test-distro-1/
+   conditions:
+     "ignore unknown":
+       when:
+         distro_name: test-distro
+       ignore_image_types:
+         - unknown_type
+`
+	fakeImageTypesYAML := `
+.common:
+  used: &used_pkgset
+    include: ["a"]
+  unused: &unused_pkgset
+    include: ["b"]
+
+image_types:
+  test_type:
+    filename: "disk.img"
+    platforms:
+      - arch: "x86_64"
+      - arch: "aarch64"
+    package_sets:
+      os:
+        - *used_pkgset
+        - include: ["c"]
+          conditions:
+            "never":
+              when:
+                version_less_than: "1"
+            "bad arch":
+              when:
+                arch: "sparc"
+            "other distro":
+              when:
+                distro_name: "other-distro"
+            "aarch64 only":
+              when:
+                arch: "aarch64"
+    platforms_override:
+      conditions:
+        "arch is not supported":
+          when:
+            arch: "x86_64"
+          override:
+            - arch: "x86_64"
+    partition_table:
+      x86_64:
+        partitions:
+          - payload_type: filesystem
+            payload:
+              type: ext4
+              mountpoint: "/"
+    blueprint:
+      supported_options:
+        - "customizations.kernel"
+        - "customizations.nope"
+`
+	baseDir := makeFakeDistrosYAML(t, fakeDistrosYAML, fakeImageTypesYAML)
+	problems, err := defs.NewLoader(os.DirFS(baseDir)).Lint()
+	require.NoError(t, err)
+
+	var res []string
+	for _, p := range problems {
+		res = append(res, p.String())
+	}
+	assert.Equal(t, []string{
+		`test-distro-1/imagetypes.yaml:25:23: unknown arch "sparc" in condition`,
+		`test-distro-1/imagetypes.yaml:28:17: unknown distro name "other-distro" in condition`,
+		`test-distro-1/imagetypes.yaml:36:19: arch conditions are not supported here, the condition never matches`,
+		`test-distro-1/imagetypes.yaml:22:17: condition never matches any distro version or architecture`,
+		`distros.yaml:11:12: unknown image type "unknown_type" in test-distro-1/imagetypes.yaml`,
+		`test-distro-1/imagetypes.yaml:40:7: no partition table for arch "aarch64" of the image type platforms`,
+		`test-distro-1/imagetypes.yaml:49:11: invalid blueprint option: customizations.nope: no such blueprint option`,
+		`test-distro-1/imagetypes.yaml:6:11: warning: anchor "unused_pkgset" in .common is never used`,
+	}, res)
+}
+
+func TestLintPartitionTablesOverride(t *testing.T) {
+	fakeImageTypesYAML := `
+image_types:
+  test_type:
+    filename: "disk.img"
+    platforms:
+      - arch: "x86_64"
+    partition_table:
+      x86_64: &pt
+        partitions:
+          - payload_type: filesystem
+            payload:
+              type: ext4
+              mountpoint: "/"
+    partition_tables_override:
+      conditions:
+        "override without x86_64":
+          when:
+            version_greater_or_equal: "1"
+          override:
+            aarch64: *pt
+`
+	baseDir := makeFakeDistrosYAML(t, "", fakeImageTypesYAML)
+	problems, err := defs.NewLoader(os.DirFS(baseDir)).Lint()
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, `test-distro-1/imagetypes.yaml:18:11: partition table override for test-distro-1 has no partition table for arch "x86_64"`, problems[0].String())
+}
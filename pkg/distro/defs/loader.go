@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
@@ -25,6 +26,7 @@ import (
 	"github.com/osbuild/images/pkg/experimentalflags"
 	"github.com/osbuild/images/pkg/manifest"
 	"github.com/osbuild/images/pkg/olog"
+	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/platform"
 	"github.com/osbuild/images/pkg/rpmmd"
 	"github.com/osbuild/images/pkg/runner"
@@ -40,8 +42,6 @@ var (
 var defaultDataFS fs.FS = distrodefs.Data
 
 func dataFS() fs.FS {
-	// XXX: this is a short term measure, pass a set of
-	// searchPaths down the stack instead
 	dataFS := defaultDataFS
 	if overrideDir := experimentalflags.String("yamldir"); overrideDir != "" {
 		olog.Printf("WARNING: using experimental override dir %q", overrideDir)
@@ -50,6 +50,57 @@ func dataFS() fs.FS {
 	return dataFS
 }
 
+// Loader loads the distro definitions from an ordered list of
+// filesystems. The `distros` entries of all filesystems are merged,
+// a distro with the same name and match in a later filesystem replaces
+// the one from an earlier filesystem. The "<defs_path>/imagetypes.yaml" files
+// of a distro are merged in the same order: image types and image
+// config conditions of later files replace the ones with the same
+// name, the default image config of a later file is merged on top of
+// the earlier one.
+//
+// Each file is read separately, so anchors and other references
+// can only be done within the same file.
+type Loader struct {
+	fses []fs.FS
+	// names of the filesystems for error messages, optional
+	names []string
+}
+
+// NewLoader returns a Loader for the given filesystems, later
+// filesystems take precedence over earlier ones.
+func NewLoader(fses ...fs.FS) *Loader {
+	return &Loader{fses: fses}
+}
+
+// NewLoaderWithSearchPaths returns a Loader that reads the distro
+// definitions that are built into the library first and then the
+// definitions in the given search paths, e.g.
+// "/usr/share/osbuild/distrodefs" and "/etc/osbuild/distrodefs".
+// Search paths that do not exist are ignored.
+func NewLoaderWithSearchPaths(searchPaths []string) *Loader {
+	loader := NewLoader(dataFS())
+	loader.names = []string{""}
+	for _, searchPath := range searchPaths {
+		loader.fses = append(loader.fses, os.DirFS(searchPath))
+		loader.names = append(loader.names, searchPath)
+	}
+	return loader
+}
+
+// filename returns the name of the given file in the filesystem with the
+// given index for error messages.
+func (l *Loader) filename(fsIdx int, name string) string {
+	if fsIdx < len(l.names) && l.names[fsIdx] != "" {
+		return filepath.Join(l.names[fsIdx], name)
+	}
+	return name
+}
+
+func defaultLoader() *Loader {
+	return NewLoader(dataFS())
+}
+
 // distrosYAML defines all supported YAML based distributions, since this can
 // come from multiple sources we should make sure that we only have things in
 // here that are easily merged
@@ -95,6 +146,8 @@ type DistroYAML struct {
 	imageTypes map[string]ImageTypeYAML
 	// distro wide default image config
 	imageConfig *distro.ImageConfig `yaml:"default"`
+	// the distro wide image config with all conditions
+	imageConfigYAML distroImageConfig
 
 	// ignore the given image types & override tweaks
 	Conditions map[string]distroConditions `yaml:"conditions"`
@@ -169,38 +222,66 @@ func (d *DistroYAML) GetTweaks() *distro.Tweaks {
 	return tweaks
 }
 
-// Load all YAML files directly in the root of the definitions filesystem. Each
-// file is read in sorted order and the entries found under the `distros` key
-// are appended together.
+// Load all YAML files directly in the root of the definitions filesystems.
+// Each file is read in sorted order and the entries found under the `distros`
+// key are appended together. A distro with the same name and match as a
+// distro from an earlier filesystem replaces it.
 // Note that files are read separately from each other, so anchors and other
 // references can only be done within the same file.
-func loadDistros() (*distrosYAML, error) {
-	dents, err := fs.Glob(dataFS(), "*.yaml")
-	if err != nil {
-		return nil, err
-	}
-
+func (l *Loader) loadDistros() (*distrosYAML, error) {
 	var allDistros distrosYAML
 
-	for _, name := range dents {
-		f, err := dataFS().Open(name)
+	for _, dataFS := range l.fses {
+		// the distros that were defined in earlier filesystems,
+		// distros in the same filesystem are never replaced
+		seen := make(map[string]int, len(allDistros.Distros))
+		for idx, d := range allDistros.Distros {
+			seen[d.key()] = idx
+		}
+
+		dents, err := fs.Glob(dataFS, "*.yaml")
 		if err != nil {
 			return nil, err
 		}
-		defer f.Close()
+		for _, name := range dents {
+			distros, err := decodeDistros(dataFS, name)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range distros.Distros {
+				if idx, ok := seen[d.key()]; ok {
+					allDistros.Distros[idx] = d
+					continue
+				}
+				allDistros.Distros = append(allDistros.Distros, d)
+			}
+		}
+	}
 
-		decoder := yaml.NewDecoder(f)
-		decoder.KnownFields(true)
+	return &allDistros, nil
+}
 
-		var distros distrosYAML
-		if err := decoder.Decode(&distros); err != nil {
-			return nil, err
-		}
+// key identifies a distro definition, the name alone is not unique as
+// it may be a template, e.g. "rhel-{{.MajorVersion}}.{{.MinorVersion}}"
+func (d *DistroYAML) key() string {
+	return d.Name + "\x00" + d.Match
+}
 
-		allDistros.Distros = append(allDistros.Distros, distros.Distros...)
+func decodeDistros(dataFS fs.FS, name string) (*distrosYAML, error) {
+	f, err := dataFS.Open(name)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	return &allDistros, nil
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	var distros distrosYAML
+	if err := decoder.Decode(&distros); err != nil {
+		return nil, err
+	}
+	return &distros, nil
 }
 
 // NewDistroYAML return the given distro or nil if the distro is not
@@ -211,7 +292,13 @@ func loadDistros() (*distrosYAML, error) {
 // with the way distrofactory/reporegistry work which is by defining
 // distros via repository files.
 func NewDistroYAML(nameVer string) (*DistroYAML, error) {
-	foundDistro, err := LoadDistroWithoutImageTypes(nameVer)
+	return defaultLoader().NewDistroYAML(nameVer)
+}
+
+// NewDistroYAML return the given distro from the definitions of the
+// loader or nil if the distro is not found.
+func (l *Loader) NewDistroYAML(nameVer string) (*DistroYAML, error) {
+	foundDistro, err := l.LoadDistroWithoutImageTypes(nameVer)
 	if err != nil {
 		return nil, err
 	}
@@ -219,14 +306,18 @@ func NewDistroYAML(nameVer string) (*DistroYAML, error) {
 		return nil, nil
 	}
 
-	if err := foundDistro.LoadImageTypes(); err != nil {
+	if err := l.LoadImageTypes(foundDistro); err != nil {
 		return nil, err
 	}
 	return foundDistro, nil
 }
 
 func LoadDistroWithoutImageTypes(nameVer string) (*DistroYAML, error) {
-	distros, err := loadDistros()
+	return defaultLoader().LoadDistroWithoutImageTypes(nameVer)
+}
+
+func (l *Loader) LoadDistroWithoutImageTypes(nameVer string) (*DistroYAML, error) {
+	distros, err := l.loadDistros()
 	if err != nil {
 		return nil, err
 	}
@@ -267,16 +358,14 @@ func LoadDistroWithoutImageTypes(nameVer string) (*DistroYAML, error) {
 }
 
 func (d *DistroYAML) LoadImageTypes() error {
-	f, err := dataFS().Open(filepath.Join(d.DefsPath, "imagetypes.yaml"))
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+	return defaultLoader().LoadImageTypes(d)
+}
 
-	var toplevel imageTypesYAML
-	decoder := yaml.NewDecoder(f)
-	decoder.KnownFields(true)
-	if err := decoder.Decode(&toplevel); err != nil {
+// LoadImageTypes loads the image types of the given distro from all
+// "<defs_path>/imagetypes.yaml" files of the loader.
+func (l *Loader) LoadImageTypes(d *DistroYAML) error {
+	toplevel, err := l.loadImageTypes(d.DefsPath)
+	if err != nil {
 		return err
 	}
 	if len(toplevel.ImageTypes) > 0 {
@@ -293,11 +382,71 @@ func (d *DistroYAML) LoadImageTypes() error {
 
 			d.imageTypes[name] = v
 		}
+		if err := d.resolveBaseImageTypes(); err != nil {
+			return err
+		}
 	}
 	d.imageConfig = toplevel.ImageConfig.For(d.ID)
+	d.imageConfigYAML = toplevel.ImageConfig
+	return nil
+}
+
+// resolveBaseImageTypes sets the "base" package set of the extension image
+// types to the "os" package set of the image type they are made for.
+func (d *DistroYAML) resolveBaseImageTypes() error {
+	for name, imgType := range d.imageTypes {
+		baseName := imgType.Extension.BaseImageType
+		if baseName == "" {
+			continue
+		}
+		if _, ok := imgType.PackageSetsYAML["base"]; ok {
+			return fmt.Errorf("image type %q sets both a base image type and a base package set", name)
+		}
+		base, ok := d.imageTypes[baseName]
+		if !ok {
+			return fmt.Errorf("image type %q has an unknown base image type %q", name, baseName)
+		}
+		basePkgSet, ok := base.PackageSetsYAML["os"]
+		if !ok {
+			return fmt.Errorf("base image type %q of image type %q has no os package set", baseName, name)
+		}
+		// anchored image types can share the map, do not modify it
+		pkgSets := maps.Clone(imgType.PackageSetsYAML)
+		if pkgSets == nil {
+			pkgSets = make(map[string][]packageSet, 1)
+		}
+		pkgSets["base"] = basePkgSet
+		imgType.PackageSetsYAML = pkgSets
+		d.imageTypes[name] = imgType
+	}
 	return nil
 }
 
+func (l *Loader) loadImageTypes(defsPath string) (*imageTypesYAML, error) {
+	name := filepath.Join(defsPath, "imagetypes.yaml")
+
+	var merged *imageTypesYAML
+	for _, dataFS := range l.fses {
+		toplevel, err := decodeImageTypes(dataFS, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = toplevel
+			continue
+		}
+		merged.merge(toplevel)
+	}
+	if merged == nil {
+		return nil, fmt.Errorf("cannot find %s in any distro definitions path: %w", name, fs.ErrNotExist)
+	}
+
+	return merged, nil
+}
+
 // imageTypesYAML describes the image types for a given distribution
 // family. Note that multiple distros may use the same image types,
 // e.g. centos/rhel
@@ -307,6 +456,43 @@ type imageTypesYAML struct {
 	Common      map[string]any           `yaml:".common,omitempty"`
 }
 
+func decodeImageTypes(dataFS fs.FS, name string) (*imageTypesYAML, error) {
+	f, err := dataFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var toplevel imageTypesYAML
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&toplevel); err != nil {
+		return nil, err
+	}
+	return &toplevel, nil
+}
+
+// merge merges the image types and image config of other on top
+// of it.
+func (it *imageTypesYAML) merge(other *imageTypesYAML) {
+	if it.ImageTypes == nil {
+		it.ImageTypes = make(map[string]ImageTypeYAML, len(other.ImageTypes))
+	}
+	for name, imgType := range other.ImageTypes {
+		it.ImageTypes[name] = imgType
+	}
+
+	if other.ImageConfig.Default != nil {
+		it.ImageConfig.Default = other.ImageConfig.Default.InheritFrom(it.ImageConfig.Default)
+	}
+	if it.ImageConfig.Conditions == nil {
+		it.ImageConfig.Conditions = make(map[string]*distroImageConfigConditions, len(other.ImageConfig.Conditions))
+	}
+	for name, cond := range other.ImageConfig.Conditions {
+		it.ImageConfig.Conditions[name] = cond
+	}
+}
+
 type distroImageConfig struct {
 	Default    *distro.ImageConfig                     `yaml:"default"`
 	Conditions map[string]*distroImageConfigConditions `yaml:"conditions,omitempty"`
@@ -348,20 +534,46 @@ func (wc *whenCondition) Eval(id distro.ID, archStr string) bool {
 }
 
 func (di *distroImageConfig) For(id distro.ID) *distro.ImageConfig {
-	imgConfig := di.Default
+	return mergeConfigSources(di.sources(id))
+}
 
-	if di.Conditions != nil {
-		for _, cond := range di.Conditions {
-			// distro image config cannot have architecure
-			// specific conditions
-			arch := ""
-			if cond.When.Eval(id, arch) {
-				imgConfig = cond.ShallowMerge.InheritFrom(imgConfig)
-			}
+func (di *distroImageConfig) sources(id distro.ID) []configSource[distro.ImageConfig] {
+	sources := []configSource[distro.ImageConfig]{
+		{"image_config.default", di.Default},
+	}
+	for _, name := range slices.Sorted(maps.Keys(di.Conditions)) {
+		cond := di.Conditions[name]
+		// distro image config cannot have architecure
+		// specific conditions
+		arch := ""
+		if cond.When.Eval(id, arch) {
+			sources = append(sources, configSource[distro.ImageConfig]{
+				fmt.Sprintf("image_config.conditions[%q]", name), cond.ShallowMerge,
+			})
 		}
 	}
+	return sources
+}
+
+// configSource is a (partial) config and where it is defined
+type configSource[T any] struct {
+	provenance string
+	config     *T
+}
 
-	return imgConfig
+type inheritingConfig[T any] interface {
+	*T
+	InheritFrom(*T) *T
+}
+
+// mergeConfigSources merges the given configs, the values of later
+// configs take precedence.
+func mergeConfigSources[T any, PT inheritingConfig[T]](sources []configSource[T]) *T {
+	config := sources[0].config
+	for _, src := range sources[1:] {
+		config = PT(src.config).InheritFrom(config)
+	}
+	return config
 }
 
 type distroImageConfigConditions struct {
@@ -421,6 +633,20 @@ type ImageTypeYAML struct {
 	// XXX: rhel-8 uses this
 	UseOstreeRemotes bool `yaml:"use_ostree_remotes"`
 
+	// Extension configures the images of the "extension" image func,
+	// the "base" package set holds the packages of the base image
+	Extension struct {
+		Type manifest.ExtensionType `yaml:"type"`
+		// BaseImageType names the image type the extension is made
+		// for, its "os" package set becomes the "base" package set
+		BaseImageType string `yaml:"base_image_type"`
+		// RootfsType is either squashfs or erofs (the default)
+		RootfsType        *manifest.ISORootfsType    `yaml:"rootfs_type"`
+		RootfsCompression string                     `yaml:"rootfs_compression"`
+		ErofsOptions      *osbuild.ErofsStageOptions `yaml:"erofs_options"`
+		Verity            bool                       `yaml:"verity"`
+	} `yaml:"extension"`
+
 	DefaultSize datasizes.Size `yaml:"default_size"`
 	// the image func name: disk,container,live-installer,...
 	Image                  string                    `yaml:"image_func"`
@@ -452,22 +678,36 @@ func (it *ImageTypeYAML) Name() string {
 }
 
 func (it *ImageTypeYAML) PlatformsFor(id distro.ID) ([]platform.Data, error) {
+	pl, _, err := it.platformsFor(id)
+	return pl, err
+}
+
+// platformsFor returns the platforms for the given distro and where
+// they are defined.
+func (it *ImageTypeYAML) platformsFor(id distro.ID) ([]platform.Data, string, error) {
 	pl := it.InternalPlatforms
+	provenance := it.provenance("platforms")
 	if it.PlatformsOverride != nil {
 		var nMatches int
-		for _, cond := range it.PlatformsOverride.Conditions {
+		for name, cond := range it.PlatformsOverride.Conditions {
 			// arch does not make sense for platform overrides
 			arch := ""
 			if cond.When.Eval(id, arch) {
 				pl = cond.Override
+				provenance = it.provenance("platforms_override.conditions[%q]", name)
 				nMatches++
 			}
 		}
 		if nMatches > 1 {
-			return nil, fmt.Errorf("platform conditionals for image type %q should match only once but matched %v times", it.Name(), nMatches)
+			return nil, "", fmt.Errorf("platform conditionals for image type %q should match only once but matched %v times", it.Name(), nMatches)
 		}
 	}
-	return pl, nil
+	return pl, provenance, nil
+}
+
+// provenance returns the location of the given field of the image type
+func (it *ImageTypeYAML) provenance(format string, args ...any) string {
+	return fmt.Sprintf("image_types.%s.", it.Name()) + fmt.Sprintf(format, args...)
 }
 
 func (it *ImageTypeYAML) runTemplates(distro *DistroYAML) error {
@@ -653,29 +893,48 @@ func versionStringForVerCmp(u distro.ID) string {
 // discovered via the imagetype.
 func (imgType *ImageTypeYAML) PackageSets(id distro.ID, archName string) map[string]rpmmd.PackageSet {
 	res := make(map[string]rpmmd.PackageSet)
-	for key, pkgSets := range imgType.PackageSetsYAML {
+	for key, pkgSet := range imgType.packageSets(id, archName) {
 		var rpmmdPkgSet rpmmd.PackageSet
-		for _, pkgSet := range pkgSets {
-			rpmmdPkgSet = rpmmdPkgSet.Append(rpmmd.PackageSet{
-				Include: pkgSet.Include,
-				Exclude: pkgSet.Exclude,
-			})
+		for _, pkg := range pkgSet.Include {
+			rpmmdPkgSet.Include = append(rpmmdPkgSet.Include, pkg.Value.(string))
+		}
+		for _, pkg := range pkgSet.Exclude {
+			rpmmdPkgSet.Exclude = append(rpmmdPkgSet.Exclude, pkg.Value.(string))
+		}
+		res[key] = rpmmdPkgSet
+	}
 
-			if pkgSet.Conditions != nil {
-				for _, cond := range pkgSet.Conditions {
-					if cond.When.Eval(id, archName) {
-						rpmmdPkgSet = rpmmdPkgSet.Append(rpmmd.PackageSet{
-							Include: cond.Append.Include,
-							Exclude: cond.Append.Exclude,
-						})
-					}
+	return res
+}
+
+// packageSets returns the package sets with the location each
+// package is defined in.
+func (imgType *ImageTypeYAML) packageSets(id distro.ID, archName string) map[string]ResolvedPackageSet {
+	res := make(map[string]ResolvedPackageSet)
+	for key, pkgSets := range imgType.PackageSetsYAML {
+		var resolved ResolvedPackageSet
+		add := func(include, exclude []string, provenance string) {
+			for _, pkg := range include {
+				resolved.Include = append(resolved.Include, ResolvedValue{pkg, provenance})
+			}
+			for _, pkg := range exclude {
+				resolved.Exclude = append(resolved.Exclude, ResolvedValue{pkg, provenance})
+			}
+		}
+		for idx, pkgSet := range pkgSets {
+			add(pkgSet.Include, pkgSet.Exclude, imgType.provenance("package_sets.%s[%d]", key, idx))
+
+			for _, name := range slices.Sorted(maps.Keys(pkgSet.Conditions)) {
+				cond := pkgSet.Conditions[name]
+				if cond.When.Eval(id, archName) {
+					add(cond.Append.Include, cond.Append.Exclude, imgType.provenance("package_sets.%s[%d].conditions[%q]", key, idx, name))
 				}
 			}
 		}
 		// mostly for tests
-		slices.Sort(rpmmdPkgSet.Include)
-		slices.Sort(rpmmdPkgSet.Exclude)
-		res[key] = rpmmdPkgSet
+		sortResolvedValues(resolved.Include)
+		sortResolvedValues(resolved.Exclude)
+		res[key] = resolved
 	}
 
 	return res
@@ -683,76 +942,117 @@ func (imgType *ImageTypeYAML) PackageSets(id distro.ID, archName string) map[str
 
 // PartitionTable returns the partionTable for the given distro/imgType.
 func (imgType *ImageTypeYAML) PartitionTable(id distro.ID, archName string) (*disk.PartitionTable, error) {
+	pt, _, err := imgType.partitionTable(id, archName)
+	return pt, err
+}
+
+// partitionTable returns the partition table for the given distro/imgType
+// and where it is defined.
+func (imgType *ImageTypeYAML) partitionTable(id distro.ID, archName string) (*disk.PartitionTable, string, error) {
 	if imgType.PartitionTables == nil {
-		return nil, fmt.Errorf("%w: %q", ErrNoPartitionTableForImgType, id)
+		return nil, "", fmt.Errorf("%w: %q", ErrNoPartitionTableForImgType, id)
 	}
 	pt, ok := imgType.PartitionTables[archName]
 	if !ok {
-		return nil, fmt.Errorf("%w (%q): %q", ErrNoPartitionTableForArch, id, archName)
+		return nil, "", fmt.Errorf("%w (%q): %q", ErrNoPartitionTableForArch, id, archName)
 	}
+	provenance := imgType.provenance("partition_table.%s", archName)
 
 	if imgType.PartitionTablesOverrides != nil {
-		for _, cond := range imgType.PartitionTablesOverrides.Conditions {
+		for _, name := range slices.Sorted(maps.Keys(imgType.PartitionTablesOverrides.Conditions)) {
+			cond := imgType.PartitionTablesOverrides.Conditions[name]
 			if cond.When.Eval(id, archName) {
 				pt = cond.Override[archName]
+				provenance = imgType.provenance("partition_tables_override.conditions[%q].override.%s", name, archName)
 			}
 		}
 	}
 
-	return pt, nil
+	return pt, provenance, nil
 }
 
 // ImageConfig returns the image type specific ImageConfig
 func (imgType *ImageTypeYAML) ImageConfig(id distro.ID, archName string) *distro.ImageConfig {
-	imgConfig := imgType.ImageConfigYAML.ImageConfig
-	for _, cond := range imgType.ImageConfigYAML.Conditions {
-		if cond.When.Eval(id, archName) {
-			imgConfig = cond.ShallowMerge.InheritFrom(imgConfig)
+	return mergeConfigSources(imgType.imageConfigSources(id, archName))
+}
 
+func (imgType *ImageTypeYAML) imageConfigSources(id distro.ID, archName string) []configSource[distro.ImageConfig] {
+	sources := []configSource[distro.ImageConfig]{
+		{imgType.provenance("image_config"), imgType.ImageConfigYAML.ImageConfig},
+	}
+	for _, name := range slices.Sorted(maps.Keys(imgType.ImageConfigYAML.Conditions)) {
+		cond := imgType.ImageConfigYAML.Conditions[name]
+		if cond.When.Eval(id, archName) {
+			sources = append(sources, configSource[distro.ImageConfig]{
+				imgType.provenance("image_config.conditions[%q]", name), cond.ShallowMerge,
+			})
 		}
 	}
-
-	return imgConfig
+	return sources
 }
 
 // InstallerConfig returns the InstallerConfig for the given imgType
 // Note that on conditions the InstallerConfig is fully replaced, do
 // any merging in YAML
 func (imgType *ImageTypeYAML) InstallerConfig(id distro.ID, archName string) *distro.InstallerConfig {
-	installerConfig := imgType.InstallerConfigYAML.InstallerConfig
-	for _, cond := range imgType.InstallerConfigYAML.Conditions {
+	return mergeConfigSources(imgType.installerConfigSources(id, archName))
+}
+
+func (imgType *ImageTypeYAML) installerConfigSources(id distro.ID, archName string) []configSource[distro.InstallerConfig] {
+	sources := []configSource[distro.InstallerConfig]{
+		{imgType.provenance("installer_config"), imgType.InstallerConfigYAML.InstallerConfig},
+	}
+	for _, name := range slices.Sorted(maps.Keys(imgType.InstallerConfigYAML.Conditions)) {
+		cond := imgType.InstallerConfigYAML.Conditions[name]
 		if cond.When.Eval(id, archName) {
-			installerConfig = cond.ShallowMerge.InheritFrom(installerConfig)
+			sources = append(sources, configSource[distro.InstallerConfig]{
+				imgType.provenance("installer_config.conditions[%q]", name), cond.ShallowMerge,
+			})
 		}
 	}
-
-	return installerConfig
+	return sources
 }
 
 // ISOConfig returns the ISOConfig for the given imgType
 // Note that on conditions the ISOConfig is fully replaced, do
 // any merging in YAML
 func (imgType *ImageTypeYAML) ISOConfig(id distro.ID, archName string) *distro.ISOConfig {
-	isoConfig := imgType.ISOConfigYAML.ISOConfig
-	for _, cond := range imgType.ISOConfigYAML.Conditions {
+	return mergeConfigSources(imgType.isoConfigSources(id, archName))
+}
+
+func (imgType *ImageTypeYAML) isoConfigSources(id distro.ID, archName string) []configSource[distro.ISOConfig] {
+	sources := []configSource[distro.ISOConfig]{
+		{imgType.provenance("iso_config"), imgType.ISOConfigYAML.ISOConfig},
+	}
+	for _, name := range slices.Sorted(maps.Keys(imgType.ISOConfigYAML.Conditions)) {
+		cond := imgType.ISOConfigYAML.Conditions[name]
 		if cond.When.Eval(id, archName) {
-			isoConfig = cond.ShallowMerge.InheritFrom(isoConfig)
+			sources = append(sources, configSource[distro.ISOConfig]{
+				imgType.provenance("iso_config.conditions[%q]", name), cond.ShallowMerge,
+			})
 		}
 	}
-
-	return isoConfig
+	return sources
 }
 
 // DiskConfig returns the DiskConfig for the given imgType
 // Note that on conditions the DiskConfig is fully replaced, do
 // any merging in YAML
 func (imgType *ImageTypeYAML) DiskConfig(id distro.ID, archName string) *distro.DiskConfig {
-	diskConfig := imgType.DiskConfigYAML.DiskConfig
-	for _, cond := range imgType.DiskConfigYAML.Conditions {
+	return mergeConfigSources(imgType.diskConfigSources(id, archName))
+}
+
+func (imgType *ImageTypeYAML) diskConfigSources(id distro.ID, archName string) []configSource[distro.DiskConfig] {
+	sources := []configSource[distro.DiskConfig]{
+		{imgType.provenance("disk_config"), imgType.DiskConfigYAML.DiskConfig},
+	}
+	for _, name := range slices.Sorted(maps.Keys(imgType.DiskConfigYAML.Conditions)) {
+		cond := imgType.DiskConfigYAML.Conditions[name]
 		if cond.When.Eval(id, archName) {
-			diskConfig = cond.ShallowMerge.InheritFrom(diskConfig)
+			sources = append(sources, configSource[distro.DiskConfig]{
+				imgType.provenance("disk_config.conditions[%q]", name), cond.ShallowMerge,
+			})
 		}
 	}
-
-	return diskConfig
+	return sources
 }
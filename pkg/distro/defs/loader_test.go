@@ -3,6 +3,7 @@ package defs_test
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -808,6 +809,84 @@ image_types:
 	require.ErrorContains(t, err, `cannot execute template for "vendor" field (is it set?)`)
 }
 
+func TestImageTypeExtensionBaseImageType(t *testing.T) {
+	fakeDistroYaml := `
+image_types:
+  base_type:
+    package_sets:
+      os:
+        - include: [kernel]
+          conditions:
+            "some-arch":
+              when:
+                arch: "aarch64"
+              append:
+                include: [grub2-efi-aa64]
+  test_type:
+    extension:
+      type: "sysext"
+      base_image_type: "base_type"
+`
+	it := makeTestImageType(t, fakeDistroYaml)
+
+	assert.Equal(t, "base_type", it.Extension.BaseImageType)
+	pkgSet := it.PackageSets(distro.ID{Name: "test-distro", MajorVersion: 1}, "aarch64")
+	assert.Equal(t, map[string]rpmmd.PackageSet{
+		"base": {Include: []string{"grub2-efi-aa64", "kernel"}},
+	}, pkgSet)
+}
+
+func TestImageTypeExtensionBaseImageTypeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		imgTypesYaml string
+		expectedErr  string
+	}{
+		{
+			imgTypesYaml: `
+image_types:
+  test_type:
+    extension:
+      base_image_type: "missing"
+`,
+			expectedErr: `image type "test_type" has an unknown base image type "missing"`,
+		},
+		{
+			imgTypesYaml: `
+image_types:
+  base_type:
+    filename: "disk.qcow2"
+  test_type:
+    extension:
+      base_image_type: "base_type"
+`,
+			expectedErr: `base image type "base_type" of image type "test_type" has no os package set`,
+		},
+		{
+			imgTypesYaml: `
+image_types:
+  base_type:
+    package_sets:
+      os:
+        - include: [kernel]
+  test_type:
+    extension:
+      base_image_type: "base_type"
+    package_sets:
+      base:
+        - include: [kernel]
+`,
+			expectedErr: `image type "test_type" sets both a base image type and a base package set`,
+		},
+	} {
+		baseDir := makeFakeDistrosYAML(t, "", tc.imgTypesYaml)
+		restore := defs.MockDataFS(baseDir)
+		defer restore()
+
+		_, err := defs.NewDistroYAML("test-distro-1")
+		assert.EqualError(t, err, tc.expectedErr)
+	}
+}
+
 var fakeDistroYamlISOConf = `
 image_types:
   test_type:
@@ -1313,3 +1392,126 @@ distros:
 		})
 	}
 }
+
+func TestLoaderSearchPaths(t *testing.T) {
+	baseDir := makeFakeDistrosYAML(t, "", `
+image_config:
+  default:
+    hostname: "base-host"
+    locale: "C.UTF-8"
+image_types:
+  test_type:
+    filename: "base.img"
+  other_type:
+    filename: "other.img"
+`)
+	overrideDir := makeFakeDistrosYAML(t, `
+distros:
+ - name: test-distro-1
+   vendor: override-vendor
+   defs_path: test-distro-1/
+ - name: downstream-distro-1
+   vendor: downstream-vendor
+   defs_path: downstream-distro-1/
+`, `
+image_config:
+  default:
+    hostname: "override-host"
+image_types:
+  test_type:
+    filename: "override.img"
+`)
+	loader := defs.NewLoader(os.DirFS(baseDir), os.DirFS(overrideDir), os.DirFS(filepath.Join(t.TempDir(), "missing")))
+
+	// later distro entries replace earlier ones with the same name
+	dist, err := loader.NewDistroYAML("test-distro-1")
+	require.NoError(t, err)
+	assert.Equal(t, "override-vendor", dist.Vendor)
+	// image types are merged by name
+	assert.Equal(t, "override.img", dist.ImageTypes()["test_type"].Filename)
+	assert.Equal(t, "other.img", dist.ImageTypes()["other_type"].Filename)
+	// the default image config is merged on top of the earlier one
+	assert.Equal(t, common.ToPtr("override-host"), dist.ImageConfig().Hostname)
+	assert.Equal(t, common.ToPtr("C.UTF-8"), dist.ImageConfig().Locale)
+
+	// distros are added from later search paths
+	dist, err = loader.NewDistroYAML("downstream-distro-1")
+	require.NoError(t, err)
+	assert.Equal(t, "downstream-vendor", dist.Vendor)
+	assert.Equal(t, "override.img", dist.ImageTypes()["test_type"].Filename)
+
+	dist, err = loader.NewDistroYAML("unknown-distro-1")
+	require.NoError(t, err)
+	assert.Nil(t, dist)
+
+	// the built-in loader does not know about the search paths
+	restore := defs.MockDataFS(baseDir)
+	defer restore()
+	dist, err = defs.NewDistroYAML("downstream-distro-1")
+	require.NoError(t, err)
+	assert.Nil(t, dist)
+}
+
+func TestLoaderSearchPathsTemplatedNames(t *testing.T) {
+	baseDir := makeFakeDistrosYAML(t, `
+distros:
+  - name: "rhel-{{.MajorVersion}}.{{.MinorVersion}}"
+    match: '(?P<name>rhel)-(?P<major>8)\.?(?P<minor>[0-9]+)'
+    vendor: base-vendor-8
+    defs_path: rhel-8/
+  - name: "rhel-{{.MajorVersion}}.{{.MinorVersion}}"
+    match: '(?P<name>rhel)-(?P<major>9)\.?(?P<minor>[0-9]+)'
+    vendor: base-vendor-9
+    defs_path: rhel-9/
+`, "")
+	overrideDir := makeFakeDistrosYAML(t, `
+distros:
+  - name: "rhel-{{.MajorVersion}}.{{.MinorVersion}}"
+    match: '(?P<name>rhel)-(?P<major>8)\.?(?P<minor>[0-9]+)'
+    vendor: override-vendor-8
+    defs_path: rhel-8/
+`, "")
+	loader := defs.NewLoader(os.DirFS(baseDir), os.DirFS(overrideDir))
+
+	// distros with the same templated name but a different match are
+	// not replaced
+	dist, err := loader.LoadDistroWithoutImageTypes("rhel-8.10")
+	require.NoError(t, err)
+	require.NotNil(t, dist)
+	assert.Equal(t, "override-vendor-8", dist.Vendor)
+
+	dist, err = loader.LoadDistroWithoutImageTypes("rhel-9.6")
+	require.NoError(t, err)
+	require.NotNil(t, dist)
+	assert.Equal(t, "base-vendor-9", dist.Vendor)
+}
+
+func TestLoaderSearchPathsMissingImageTypes(t *testing.T) {
+	baseDir := makeFakeDistrosYAML(t, "", "")
+	require.NoError(t, os.RemoveAll(filepath.Join(baseDir, "test-distro-1")))
+
+	_, err := defs.NewLoader(os.DirFS(baseDir)).NewDistroYAML("test-distro-1")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorContains(t, err, "cannot find test-distro-1/imagetypes.yaml in any distro definitions path")
+}
+
+func TestNewLoaderWithSearchPaths(t *testing.T) {
+	overrideDir := makeFakeDistrosYAML(t, `
+distros:
+ - name: downstream-distro-1
+   vendor: downstream-vendor
+   defs_path: downstream-distro-1/
+`, "")
+	loader := defs.NewLoaderWithSearchPaths([]string{filepath.Join(t.TempDir(), "missing"), overrideDir})
+
+	// built-in distros are still available
+	dist, err := loader.LoadDistroWithoutImageTypes("fedora-42")
+	require.NoError(t, err)
+	require.NotNil(t, dist)
+	assert.Equal(t, "fedora-42", dist.Name)
+
+	dist, err = loader.NewDistroYAML("downstream-distro-1")
+	require.NoError(t, err)
+	require.NotNil(t, dist)
+	assert.Equal(t, "downstream-vendor", dist.Vendor)
+}
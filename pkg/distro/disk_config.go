@@ -14,6 +14,10 @@ type DiskConfig struct {
 
 	// Mostly for RHEL7 compat though might be purposed in the future
 	PartitioningTool *osbuild.PartTool `yaml:"partitioning_tool,omitempty"`
+
+	// SectorSize is the default logical sector size of the disks in bytes,
+	// e.g. 4096 for image types of 4Kn only targets. Defaults to 512.
+	SectorSize *uint64 `yaml:"sector_size,omitempty"`
 }
 
 // InheritFrom inherits unset values from the provided parent configuration and
@@ -5,6 +5,8 @@ import (
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/artifact"
+	"github.com/osbuild/images/pkg/customizations/mok"
 	"github.com/osbuild/images/pkg/customizations/subscription"
 	"github.com/osbuild/images/pkg/depsolvednf"
 	"github.com/osbuild/images/pkg/disk"
@@ -160,6 +162,21 @@ type ImageType interface {
 	Manifest(bp *blueprint.Blueprint, options ImageOptions, repos []rpmmd.RepoConfig, seed *int64) (*manifest.Manifest, []string, error)
 }
 
+// MultiManifestImageType is implemented by image types that can be built
+// together with other image types from a single OS tree.
+type MultiManifestImageType interface {
+	ImageType
+
+	// MultiManifest returns a single osbuild manifest that builds this
+	// image type and all others from the same OS tree and disk image. The
+	// image types need to be compatible, i.e. they may only differ in the
+	// format of the exported image. The artifacts of this image type and
+	// the others are returned in order, together with any warnings. The
+	// artifacts of the additional disks (see ImageOptions.AdditionalDisks)
+	// follow in the same order.
+	MultiManifest(bp *blueprint.Blueprint, options ImageOptions, repos []rpmmd.RepoConfig, seed *int64, others []ImageType) (*manifest.Manifest, []*artifact.Artifact, []string, error)
+}
+
 type BootcImageOptions struct {
 	InstallerPayloadRef string `json:"installer_payload_ref,omitempty"`
 
@@ -180,6 +197,7 @@ type ImageOptions struct {
 	Subscription     *subscription.ImageOptions `json:"subscription,omitempty"`
 	Facts            *facts.ImageOptions        `json:"facts,omitempty"`
 	PartitioningMode partition.PartitioningMode `json:"partitioning-mode,omitempty"`
+	MOK              *mok.ImageOptions          `json:"mok,omitempty"`
 
 	UseBootstrapContainer bool `json:"use_bootstrap_container,omitempty"`
 
@@ -187,6 +205,49 @@ type ImageOptions struct {
 	// empty (nil) the default from the distro is used. When set it overrides
 	// the default.
 	Preview *bool `json:"preview,omitempty"`
+
+	// SourceDateEpoch makes the build reproducible when set: the timestamps
+	// in the image and its artifacts are clamped to this UNIX timestamp and,
+	// unless a seed is passed explicitly, the seed for the random number
+	// generator is derived from it. Two builds with the same blueprint,
+	// options and depsolve result then produce the same manifest.
+	SourceDateEpoch *int64 `json:"source_date_epoch,omitempty"`
+
+	// AdditionalDisks are created next to the boot disk of disk images,
+	// e.g. to put /var/lib/data on a second disk. The partitions of the
+	// disk customization of the blueprint are moved to the additional disks
+	// by their mountpoints or volume group names, the root filesystem is
+	// always on the boot disk.
+	AdditionalDisks []AdditionalDisk `json:"additional_disks,omitempty"`
+
+	// SectorSize is the logical sector size of the disks of disk images in
+	// bytes, either 512 or 4096 for 4K native (4Kn) devices. When left
+	// empty (0) the default from the disk config of the image type is used.
+	SectorSize uint64 `json:"sector_size,omitempty"`
+}
+
+// AdditionalDisk is a named disk of an image with multiple disks. It holds
+// the partitions of the disk customization of the blueprint that are
+// selected by Partitions and can extend a volume group of another disk.
+type AdditionalDisk struct {
+	Name string `json:"name"`
+	// Type of the partition table of the disk, "gpt" (default) or "dos"
+	Type string `json:"type,omitempty"`
+	// MinSize of the disk in bytes, the last partition takes the remaining
+	// space
+	MinSize uint64 `json:"minsize,omitempty"`
+	// Partitions select the partitions of the disk customization of the
+	// blueprint that are moved to this disk by the mountpoint of the
+	// partition, of one of its logical volumes or subvolumes or by the
+	// name of its volume group
+	Partitions []string `json:"partitions,omitempty"`
+	// VolumeGroup is the name of a volume group on another disk that is
+	// extended onto this disk. osbuild creates each volume group on a
+	// single device, so a physical volume is added as the last partition
+	// of this disk and the volume group is extended onto it when the image
+	// boots for the first time. This only adds free extents, the logical
+	// volumes of the blueprint are all created on the other disk.
+	VolumeGroup string `json:"volume_group,omitempty"`
 }
 
 type BasePartitionTableMap map[string]disk.PartitionTable
@@ -206,6 +267,17 @@ func PayloadPackageSets() []string {
 	return []string{}
 }
 
+// SeedFromOptions returns the seed for an image build. An explicit seed takes
+// precedence, otherwise reproducible builds (see
+// ImageOptions.SourceDateEpoch) are seeded with the epoch and all other builds
+// get a random seed.
+func SeedFromOptions(p *int64, options ImageOptions) int64 {
+	if p == nil && options.SourceDateEpoch != nil {
+		return *options.SourceDateEpoch
+	}
+	return SeedFrom(p)
+}
+
 func SeedFrom(p *int64) int64 {
 	if p == nil {
 		// #nosec G404
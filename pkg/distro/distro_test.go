@@ -81,6 +81,9 @@ func TestImageTypePipelineNames(t *testing.T) {
 					bp := blueprint.Blueprint{
 						Customizations: customizations,
 					}
+					if slices.Contains(imageType.RequiredBlueprintOptions(), "packages") {
+						bp.Packages = []blueprint.Package{{Name: "strace"}}
+					}
 					options := distro.ImageOptions{}
 					// This base repo's GPG keys should get included in the
 					// OS pipeline's RPM stage since packages are resolved
@@ -305,6 +308,12 @@ func TestPipelineRepositories(t *testing.T) {
 					newStringSet([]string{"os-1", "os-2"}),
 					newStringSet([]string{"os-1", "os-2", "payload"}),
 				},
+				"extension-tree": {
+					// extensions depsolve the blueprint packages in the
+					// second set, on top of the base image packages
+					newStringSet(nil),
+					newStringSet([]string{"payload"}),
+				},
 			},
 		},
 		"noglobal": { // no global repositories; only pipeline restricted ones (unrealistic but technically valid)
@@ -729,3 +738,52 @@ func TestGetImageTypes(t *testing.T) {
 		}
 	}
 }
+
+func TestSeedFromOptions(t *testing.T) {
+	epoch := int64(1700000000)
+	explicit := int64(42)
+
+	assert.Equal(t, epoch, distro.SeedFromOptions(nil, distro.ImageOptions{SourceDateEpoch: &epoch}))
+	assert.Equal(t, explicit, distro.SeedFromOptions(&explicit, distro.ImageOptions{SourceDateEpoch: &epoch}))
+	assert.Equal(t, explicit, distro.SeedFromOptions(&explicit, distro.ImageOptions{}))
+}
+
+func TestManifestSourceDateEpoch(t *testing.T) {
+	d := distrofactory.NewDefault().GetDistro("fedora-42")
+	require.NotNil(t, d)
+	arch, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	imgType, err := arch.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	repos := []rpmmd.RepoConfig{{Name: "baseos", BaseURLs: []string{"http://baseos.example.com"}}}
+	epoch := int64(1700000000)
+	opts := distro.ImageOptions{SourceDateEpoch: &epoch}
+	mf1, _, err := imgType.Manifest(&blueprint.Blueprint{}, opts, repos, nil)
+	require.NoError(t, err)
+
+	// the seed is pinned, so the partition table UUIDs are the same
+	mf2, _, err := imgType.Manifest(&blueprint.Blueprint{}, opts, repos, nil)
+	require.NoError(t, err)
+	assert.Equal(t, mf1, mf2)
+
+	packageSets, err := mf1.GetPackageSetChains()
+	require.NoError(t, err)
+	depsolvedSets, err := manifestmock.Depsolve(packageSets, arch.Name(), nil, false)
+	require.NoError(t, err)
+	serialized, err := mf1.Serialize(depsolvedSets, nil, nil, nil)
+	require.NoError(t, err)
+
+	// every pipeline is built with the epoch, not only the os tree
+	var pm struct {
+		Pipelines []struct {
+			Name        string `json:"name"`
+			SourceEpoch *int64 `json:"source-epoch"`
+		} `json:"pipelines"`
+	}
+	require.NoError(t, json.Unmarshal(serialized, &pm))
+	require.NotEmpty(t, pm.Pipelines)
+	for _, pipeline := range pm.Pipelines {
+		assert.Equal(t, &epoch, pipeline.SourceEpoch, pipeline.Name)
+	}
+}
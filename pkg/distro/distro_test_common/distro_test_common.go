@@ -104,6 +104,12 @@ func TestDistro_KernelOption(t *testing.T, d distro.Distro) {
 		"container":         true,
 		"generic-container": true,
 
+		// extensions only contain the packages that are not part of the
+		// base image
+		"generic-sysext":        true,
+		"generic-sysext-verity": true,
+		"generic-confext":       true,
+
 		// image installer on Fedora doesn't support kernel customizations
 		// on RHEL we support kernel name
 		// TODO: Remove when we unify the allowed options
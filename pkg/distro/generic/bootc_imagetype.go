@@ -124,9 +124,9 @@ func (t *bootcImageType) RequiredBlueprintOptions() []string {
 }
 
 // keep in sync with "generic/imagetype.go:checkOptions()"
-func (t *bootcImageType) checkOptions(bp *blueprint.Blueprint) []string {
+func (t *bootcImageType) checkOptions(bp *blueprint.Blueprint) ([]string, distro.BlueprintErrors) {
 	if bp == nil {
-		return nil
+		return nil, nil
 	}
 
 	if err := distro.ValidateConfig(t, *bp); err != nil {
@@ -134,13 +134,18 @@ func (t *bootcImageType) checkOptions(bp *blueprint.Blueprint) []string {
 		// NOTE (validation-warnings): appending to warnings now, because this
 		// is breaking a lot of things the service
 		errAsWarning := fmt.Errorf("%s: %w", errPrefix, err)
-		return []string{errAsWarning.Error()}
+		var violations distro.BlueprintErrors
+		errors.As(err, &violations)
+		return []string{errAsWarning.Error()}, violations
 	}
-	return nil
+	return nil, nil
 }
 
 func (t *bootcImageType) Manifest(bp *blueprint.Blueprint, options distro.ImageOptions, repos []rpmmd.RepoConfig, seedp *int64) (*manifest.Manifest, []string, error) {
-	validationWarnings := t.checkOptions(bp)
+	validationWarnings, _ := t.checkOptions(bp)
+	if options.SourceDateEpoch != nil {
+		validationWarnings = append(validationWarnings, fmt.Sprintf("source_date_epoch is not supported for bootc image type %q and is ignored", t.Name()))
+	}
 
 	mani, manifestWarnings, err := t.manifestWithoutValidation(bp, options)
 	return mani, append(validationWarnings, manifestWarnings...), err
@@ -832,6 +837,7 @@ func (t *bootcImageType) genPartitionTableDiskCust(basept *disk.PartitionTable,
 		DefaultFSType:    defaultFSType,
 		RequiredMinSizes: requiredMinSizes,
 		Architecture:     t.arch.arch,
+		SectorSize:       basept.SectorSize,
 	}
 	return disk.NewCustomPartitionTable(diskCust, partOptions, rng)
 }
@@ -31,6 +31,10 @@ const (
 
 	// blueprint package set name
 	blueprintPkgsKey = "blueprint"
+
+	// base image package set name, extension images are depsolved
+	// against it
+	basePkgsKey = "base"
 )
 
 var (
@@ -47,7 +51,20 @@ type distribution struct {
 }
 
 func New(nameVer string) (distro.Distro, error) {
-	distroYAML, err := defs.NewDistroYAML(nameVer)
+	return NewWithLoader(nameVer, nil)
+}
+
+// NewWithLoader returns the distro with the given name from the
+// distro definitions of the given loader. If loader is nil the
+// built-in distro definitions are used.
+func NewWithLoader(nameVer string, loader *defs.Loader) (distro.Distro, error) {
+	var distroYAML *defs.DistroYAML
+	var err error
+	if loader != nil {
+		distroYAML, err = loader.NewDistroYAML(nameVer)
+	} else {
+		distroYAML, err = defs.NewDistroYAML(nameVer)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -253,7 +270,19 @@ func (a *architecture) Distro() distro.Distro {
 }
 
 func DistroFactory(idStr string) distro.Distro {
-	distro, err := New(idStr)
+	return distroFactory(idStr, nil)
+}
+
+// NewDistroFactory returns a distro factory for the distro definitions
+// of the given loader.
+func NewDistroFactory(loader *defs.Loader) func(idStr string) distro.Distro {
+	return func(idStr string) distro.Distro {
+		return distroFactory(idStr, loader)
+	}
+}
+
+func distroFactory(idStr string, loader *defs.Loader) distro.Distro {
+	distro, err := NewWithLoader(idStr, loader)
 	if errors.Is(err, ErrDistroNotFound) {
 		return nil
 	}
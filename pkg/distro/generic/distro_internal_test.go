@@ -26,3 +26,25 @@ func TestISOLabel(t *testing.T) {
 	isoLabelFunc := d.getISOLabelFunc("iso-label")
 	assert.Equal(t, "name:rhel,major:9,minor:1,product:some-product,arch:s390x,iso-label:iso-label", isoLabelFunc(imgType))
 }
+
+func TestImageTypeDescribe(t *testing.T) {
+	d, err := New("rhel-10.0")
+	assert.NoError(t, err)
+	ar, err := d.GetArch("x86_64")
+	assert.NoError(t, err)
+	it, err := ar.GetImageType("qcow2")
+	assert.NoError(t, err)
+
+	res, err := it.(*imageType).Describe()
+	assert.NoError(t, err)
+	assert.Equal(t, "rhel-10.0", res.Distro)
+	assert.Equal(t, "x86_64", res.Arch)
+	assert.Equal(t, "qcow2", res.ImageType)
+	assert.Contains(t, res.PackageSets["os"].Include, defs.ResolvedValue{
+		Value:      "insights-client",
+		Provenance: `image_types.qcow2.package_sets.os[0].conditions["add insights pkgs on rhel"]`,
+	})
+	assert.Equal(t, "image_config.default", res.ImageConfig["locale"].Provenance)
+	assert.Equal(t, "image_types.qcow2.partition_table.x86_64", res.PartitionTable.Provenance)
+	assert.NotNil(t, res.Platform)
+}
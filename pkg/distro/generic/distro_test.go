@@ -6,6 +6,7 @@ import (
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/datasizes"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distro/generic"
 	testrepos "github.com/osbuild/images/test/data/repositories"
@@ -102,6 +103,111 @@ func TestManifestError(t *testing.T) {
 				},
 				expErr: fmt.Sprintf("blueprint validation failed for image type %q: Repository ID is required", ami.Name()),
 			},
+			"additional-disk": {
+				options: distro.ImageOptions{
+					AdditionalDisks: []distro.AdditionalDisk{{Name: "data", Partitions: []string{"/var/lib/data"}}},
+				},
+				bp: blueprint.Blueprint{
+					Customizations: &blueprint.Customizations{
+						Disk: &blueprint.DiskCustomization{
+							Partitions: []blueprint.PartitionCustomization{
+								{
+									MinSize: 1 * datasizes.GiB,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/var/lib/data",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"additional-disk-spanning-vg": {
+				// the volume group of the boot disk is extended onto the
+				// physical volume of the additional disk
+				options: distro.ImageOptions{
+					AdditionalDisks: []distro.AdditionalDisk{{Name: "data", MinSize: 10 * datasizes.GiB, VolumeGroup: "rootvg"}},
+				},
+				bp: blueprint.Blueprint{
+					Customizations: &blueprint.Customizations{
+						Disk: &blueprint.DiskCustomization{
+							Partitions: []blueprint.PartitionCustomization{
+								{
+									Type: "lvm",
+									VGCustomization: blueprint.VGCustomization{
+										Name: "rootvg",
+										LogicalVolumes: []blueprint.LVCustomization{
+											{
+												Name:    "rootlv",
+												MinSize: 5 * datasizes.GiB,
+												FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+													Mountpoint: "/",
+													FSType:     "xfs",
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"sector-size-4k": {
+				options: distro.ImageOptions{
+					SectorSize: 4096,
+				},
+			},
+			"sector-size-4k-disk-customization": {
+				options: distro.ImageOptions{
+					SectorSize: 4096,
+				},
+				bp: blueprint.Blueprint{
+					Customizations: &blueprint.Customizations{
+						Disk: &blueprint.DiskCustomization{
+							Partitions: []blueprint.PartitionCustomization{
+								{
+									Type: "plain",
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/data",
+										FSType:     "ext4",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"bad-additional-disk-partition": {
+				// the partitions of additional disks are moved from the
+				// disk customization
+				options: distro.ImageOptions{
+					AdditionalDisks: []distro.AdditionalDisk{{Name: "data", Partitions: []string{"/var/lib/data"}}},
+				},
+				bp: blueprint.Blueprint{
+					Customizations: &blueprint.Customizations{
+						Disk: &blueprint.DiskCustomization{
+							Partitions: []blueprint.PartitionCustomization{
+								{
+									MinSize: 1 * datasizes.GiB,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/srv",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+				expErr: `disk "data": no partition with mountpoint or volume group "/var/lib/data" in the disk customization`,
+			},
+			"bad-additional-disk-vg": {
+				options: distro.ImageOptions{
+					AdditionalDisks: []distro.AdditionalDisk{{Name: "data", VolumeGroup: "toucanvg"}},
+				},
+				expErr: `disk "data" extends volume group "toucanvg" that is not on any disk`,
+			},
 			"warnings": {
 				// make sure warnings are properly returned
 				bp: blueprint.Blueprint{
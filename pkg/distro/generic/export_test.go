@@ -26,5 +26,10 @@ func (t *imageType) GetDefaultImageConfig() *distro.ImageConfig {
 }
 
 func ImageTypeCheckOptions(it *imageType, bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, error) {
+	warnings, _, err := it.checkOptions(bp, options)
+	return warnings, err
+}
+
+func ImageTypeCheckOptionsViolations(it *imageType, bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, distro.BlueprintErrors, error) {
 	return it.checkOptions(bp, options)
 }
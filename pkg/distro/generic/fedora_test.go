@@ -84,6 +84,14 @@ func TestFedoraFilenameFromType(t *testing.T) {
 				mimeType: "application/x-vhd",
 			},
 		},
+		{
+			name: "generic-vhdx",
+			args: args{"generic-vhdx"},
+			want: wantResult{
+				filename: "disk.vhdx",
+				mimeType: "application/x-vhdx",
+			},
+		},
 		{
 			name: "generic-vmdk",
 			args: args{"generic-vmdk"},
@@ -108,6 +116,14 @@ func TestFedoraFilenameFromType(t *testing.T) {
 				mimeType: "application/x-tar",
 			},
 		},
+		{
+			name: "generic-sysext",
+			args: args{"generic-sysext"},
+			want: wantResult{
+				filename: "extension.raw",
+				mimeType: "application/octet-stream",
+			},
+		},
 		{
 			name: "generic-wsl",
 			args: args{"generic-wsl"},
@@ -345,6 +361,7 @@ func TestFedoraImageType_Name(t *testing.T) {
 				"generic-ova",
 				"generic-qcow2",
 				"generic-vhd",
+				"generic-vhdx",
 				"generic-vmdk",
 				"generic-vagrant-libvirt",
 				"generic-vagrant-virtualbox",
@@ -384,6 +401,7 @@ func TestFedoraImageType_Name(t *testing.T) {
 				"generic-oci",
 				"generic-openstack",
 				"generic-qcow2",
+				"generic-vhdx",
 				"generic-vagrant-libvirt",
 				"server-qcow2",
 				"kinoite-installer",
@@ -509,7 +527,10 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 			arch: "x86_64",
 			imgNames: []string{
 				"generic-ami",
+				"generic-confext",
 				"generic-container",
+				"generic-sysext",
+				"generic-sysext-verity",
 				"minimal-installer",
 				"iot-commit",
 				"iot-container",
@@ -524,6 +545,7 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 				"generic-ova",
 				"generic-qcow2",
 				"generic-vhd",
+				"generic-vhdx",
 				"generic-vmdk",
 				"generic-vagrant-libvirt",
 				"generic-vagrant-virtualbox",
@@ -551,7 +573,10 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 			arch: "aarch64",
 			imgNames: []string{
 				"generic-ami",
+				"generic-confext",
 				"generic-container",
+				"generic-sysext",
+				"generic-sysext-verity",
 				"minimal-installer",
 				"iot-commit",
 				"iot-container",
@@ -564,6 +589,7 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 				"generic-oci",
 				"generic-openstack",
 				"generic-qcow2",
+				"generic-vhdx",
 				"generic-vagrant-libvirt",
 				"server-qcow2",
 				"cloud-azure",
@@ -587,7 +613,10 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 		{
 			arch: "ppc64le",
 			imgNames: []string{
+				"generic-confext",
 				"generic-container",
+				"generic-sysext",
+				"generic-sysext-verity",
 				"generic-qcow2",
 				"server-qcow2",
 				"cloud-qcow2",
@@ -597,7 +626,10 @@ func TestFedoraArchitecture_ListImageTypes(t *testing.T) {
 		{
 			arch: "s390x",
 			imgNames: []string{
+				"generic-confext",
 				"generic-container",
+				"generic-sysext",
+				"generic-sysext-verity",
 				"generic-qcow2",
 				"server-qcow2",
 				"cloud-qcow2",
@@ -763,3 +795,40 @@ func TestFedoraDistroBootstrapRef(t *testing.T) {
 		}
 	}
 }
+
+func TestFedoraExtensionImageTypes(t *testing.T) {
+	for _, tc := range []struct {
+		imgTypeName       string
+		expectedPipelines []string
+	}{
+		{"generic-sysext", []string{"extension-tree", "extension"}},
+		{"generic-sysext-verity", []string{"extension-tree", "extension", "extension-verity"}},
+		{"generic-confext", []string{"extension-tree", "extension"}},
+	} {
+		t.Run(tc.imgTypeName, func(t *testing.T) {
+			distroArch, err := generic.DistroFactory("fedora-42").GetArch("x86_64")
+			require.NoError(t, err)
+			imgType, err := distroArch.GetImageType(tc.imgTypeName)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPipelines[len(tc.expectedPipelines)-1:], imgType.Exports())
+			assert.Equal(t, []string{"packages"}, imgType.RequiredBlueprintOptions())
+
+			bp := blueprint.Blueprint{
+				Packages: []blueprint.Package{{Name: "strace"}},
+			}
+			m, _, err := imgType.Manifest(&bp, distro.ImageOptions{}, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedPipelines, m.PayloadPipelines())
+
+			// the extension packages are depsolved on top of the
+			// packages of the base image type
+			chains, err := m.GetPackageSetChains()
+			require.NoError(t, err)
+			chain := chains["extension-tree"]
+			require.Len(t, chain, 2)
+			assert.Contains(t, chain[0].Include, "@Fedora Cloud Server")
+			assert.Contains(t, chain[0].Include, "qemu-guest-agent")
+			assert.Equal(t, []string{"strace"}, chain[1].Include)
+		})
+	}
+}
@@ -320,6 +320,8 @@ func osCustomizations(t *imageType, osPackageSet rpmmd.PackageSet, options distr
 	osc.AuthConfig = imageConfig.Authconfig
 	osc.PwQuality = imageConfig.PwQuality
 	osc.Subscription = options.Subscription
+	osc.MOK = options.MOK
+	osc.SourceDateEpoch = options.SourceDateEpoch
 	osc.WAAgentConfig = imageConfig.WAAgentConfig
 	osc.UdevRules = imageConfig.UdevRules
 	osc.GCPGuestAgentConfig = imageConfig.GCPGuestAgentConfig
@@ -337,6 +339,10 @@ func osCustomizations(t *imageType, osPackageSet rpmmd.PackageSet, options distr
 		osc.NoBLS = *imageConfig.NoBLS
 	}
 
+	if imageConfig.RepartDefinitionsDir != nil {
+		osc.RepartDefinitionsDir = *imageConfig.RepartDefinitionsDir
+	}
+
 	ca, err := c.GetCACerts()
 	if err != nil {
 		panic(fmt.Sprintf("unexpected error checking CA certs: %v", err))
@@ -667,6 +673,11 @@ func diskImage(t *imageType,
 	}
 	img.PartitionTable = pt
 
+	img.AdditionalDisks, err = t.getAdditionalDisks(pt, bp.Customizations, options, rng)
+	if err != nil {
+		return nil, err
+	}
+
 	img.VPCForceSize = t.ImageTypeYAML.DiskImageVPCForceSize
 
 	if img.OSCustomizations.NoBLS {
@@ -731,6 +742,44 @@ func containerImage(t *imageType,
 	return img, nil
 }
 
+func extensionImage(t *imageType,
+	bp *blueprint.Blueprint,
+	options distro.ImageOptions,
+	packageSets map[string]rpmmd.PackageSet,
+	payloadRepos []rpmmd.RepoConfig,
+	containers []container.SourceSpec,
+	rng *rand.Rand) (image.ImageKind, error) {
+	img := image.NewExtension(t.platform, t.Filename())
+	if opts := buildOptions(t); opts != nil {
+		img.BuildOptions = opts
+	}
+
+	extConfig := t.ImageTypeYAML.Extension
+	img.ExtensionType = extConfig.Type
+	if extConfig.RootfsType != nil {
+		img.RootfsType = *extConfig.RootfsType
+	}
+	img.RootfsCompression = extConfig.RootfsCompression
+	img.ErofsOptions = extConfig.ErofsOptions
+	img.Verity = extConfig.Verity
+
+	d := t.arch.distro
+	img.OSReleaseID = d.ID().Name
+	img.OSReleaseVersionID = d.ID().VersionString()
+
+	img.BasePackages = packageSets[basePkgsKey]
+	img.Packages = packageSets[osPkgsKey]
+	img.Packages.Include = append(img.Packages.Include, bp.GetPackagesEx(false)...)
+	img.PayloadRepos = payloadRepos
+
+	imgConfig := t.getDefaultImageConfig()
+	if imgConfig.InstallWeakDeps != nil {
+		img.InstallWeakDeps = *imgConfig.InstallWeakDeps
+	}
+
+	return img, nil
+}
+
 func liveInstallerImage(t *imageType,
 	bp *blueprint.Blueprint,
 	options distro.ImageOptions,
@@ -9,6 +9,7 @@ import (
 	"text/template"
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
+	"github.com/osbuild/images/pkg/artifact"
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/datasizes"
 	"github.com/osbuild/images/pkg/disk"
@@ -26,6 +27,7 @@ type isoLabelFunc func(t *imageType) string
 
 // imageType implements the distro.ImageType interface
 var _ = distro.ImageType(&imageType{})
+var _ = distro.MultiManifestImageType(&imageType{})
 
 type imageType struct {
 	defs.ImageTypeYAML
@@ -72,6 +74,8 @@ func newImageTypeFrom(d *distribution, ar *architecture, imgYAML defs.ImageTypeY
 		it.image = networkInstallerImage
 	case "pxe_tar":
 		it.image = pxeTarImage
+	case "extension":
+		it.image = extensionImage
 	default:
 		return imageType{}, fmt.Errorf("unknown image func: %v for %v", imgYAML.Image, imgYAML.Name())
 	}
@@ -164,14 +168,33 @@ func (t *imageType) BasePartitionTable() (*disk.PartitionTable, error) {
 	return t.ImageTypeYAML.PartitionTable(d.ID(), t.arch.arch.String())
 }
 
+// Describe returns the fully resolved configuration of the image type
+// for its distro and architecture, see defs.ImageTypeYAML.Resolve()
+func (t *imageType) Describe() (*defs.ResolvedImageType, error) {
+	d, ok := t.arch.distro.(*distribution)
+	if !ok {
+		return nil, fmt.Errorf("cannot describe image type %q: unexpected distro type %T", t.Name(), t.arch.distro)
+	}
+	return t.ImageTypeYAML.Resolve(&d.DistroYAML, t.arch.arch.String())
+}
+
 func (t *imageType) getPartitionTable(customizations *blueprint.Customizations, options distro.ImageOptions, rng *rand.Rand) (*disk.PartitionTable, error) {
 	basePartitionTable, err := t.BasePartitionTable()
 	if err != nil {
 		return nil, err
 	}
+	sectorSize, err := t.sectorSize(options)
+	if err != nil {
+		return nil, err
+	}
+	// the base partition table is shared by all manifests of the image type
+	basePartitionTable = basePartitionTable.Clone().(*disk.PartitionTable)
+	if sectorSize != 0 {
+		basePartitionTable.SectorSize = sectorSize
+	}
 
 	imageSize := t.Size(options.Size)
-	partitioning, err := customizations.GetPartitioning()
+	partitioning, _, err := splitPartitioning(customizations, options)
 	if err != nil {
 		return nil, err
 	}
@@ -196,6 +219,7 @@ func (t *imageType) getPartitionTable(customizations *blueprint.Customizations,
 			DefaultFSType:      defaultFsType,
 			RequiredMinSizes:   t.ImageTypeYAML.RequiredPartitionSizes,
 			Architecture:       t.platform.GetArch(),
+			SectorSize:         basePartitionTable.SectorSize,
 		}
 		return disk.NewCustomPartitionTable(partitioning, partOptions, rng)
 	}
@@ -204,6 +228,65 @@ func (t *imageType) getPartitionTable(customizations *blueprint.Customizations,
 	return disk.NewPartitionTable(basePartitionTable, mountpoints, datasizes.Size(imageSize), options.PartitioningMode, t.platform.GetArch(), t.ImageTypeYAML.RequiredPartitionSizes, defaultFsType.String(), rng)
 }
 
+// splitPartitioning splits the disk customization of the blueprint into the
+// one of the boot disk and the partitions of the additional disks of the
+// image options, see disk.SplitDiskCustomization
+func splitPartitioning(customizations *blueprint.Customizations, options distro.ImageOptions) (*blueprint.DiskCustomization, map[string][]blueprint.PartitionCustomization, error) {
+	partitioning, err := customizations.GetPartitioning()
+	if err != nil {
+		return nil, nil, err
+	}
+	selectors := make(map[string][]string, len(options.AdditionalDisks))
+	for _, ad := range options.AdditionalDisks {
+		selectors[ad.Name] = append(selectors[ad.Name], ad.Partitions...)
+	}
+	return disk.SplitDiskCustomization(partitioning, selectors)
+}
+
+// getAdditionalDisks creates the partition tables of the additional disks
+// of the image options from the partitions of the disk customization that
+// are moved to them and checks that they can be used together with the
+// partition table of the boot disk
+func (t *imageType) getAdditionalDisks(pt *disk.PartitionTable, customizations *blueprint.Customizations, options distro.ImageOptions, rng *rand.Rand) ([]disk.Disk, error) {
+	if len(options.AdditionalDisks) == 0 {
+		return nil, nil
+	}
+
+	_, partitions, err := splitPartitioning(customizations, options)
+	if err != nil {
+		return nil, err
+	}
+
+	d, convOk := t.arch.distro.(*distribution)
+	if !convOk {
+		return nil, fmt.Errorf("failed to cast image type distribution %T to *distribution: this is a programming error", t.arch.distro)
+	}
+	partOptions := &disk.CustomPartitionTableOptions{
+		DefaultFSType: d.DefaultFSType,
+		Architecture:  t.platform.GetArch(),
+		// all disks of an image are attached to the same kind of device
+		SectorSize: pt.SectorSize,
+	}
+
+	disks := make([]disk.Disk, 0, len(options.AdditionalDisks))
+	for _, ad := range options.AdditionalDisks {
+		dc := &blueprint.DiskCustomization{
+			Type:       ad.Type,
+			MinSize:    ad.MinSize,
+			Partitions: partitions[ad.Name],
+		}
+		dataPT, err := disk.NewDataPartitionTable(dc, ad.VolumeGroup, partOptions, rng)
+		if err != nil {
+			return nil, fmt.Errorf("additional disk %q: %w", ad.Name, err)
+		}
+		disks = append(disks, disk.Disk{Name: ad.Name, PartitionTable: dataPT, VolumeGroup: ad.VolumeGroup})
+	}
+	if err := disk.ValidateDisks(pt, disks); err != nil {
+		return nil, err
+	}
+	return disks, nil
+}
+
 func (t *imageType) getDefaultImageConfig() *distro.ImageConfig {
 	d := t.Arch().Distro()
 	imageConfig := t.ImageConfig(d.ID(), t.arch.arch.String())
@@ -231,6 +314,23 @@ func (t *imageType) getDefaultDiskConfig() (*distro.DiskConfig, error) {
 	return t.DiskConfig(d.ID(), t.arch.arch.String()), nil
 }
 
+// sectorSize returns the sector size of the disks of the image: the sector
+// size of the image options or the default of the disk config. Zero selects
+// the default sector size of the partition table.
+func (t *imageType) sectorSize(options distro.ImageOptions) (uint64, error) {
+	if options.SectorSize != 0 {
+		return options.SectorSize, nil
+	}
+	diskConfig, err := t.getDefaultDiskConfig()
+	if err != nil {
+		return 0, err
+	}
+	if diskConfig != nil && diskConfig.SectorSize != nil {
+		return *diskConfig.SectorSize, nil
+	}
+	return 0, nil
+}
+
 func (t *imageType) PartitionType() disk.PartitionTableType {
 	basePartitionTable, err := t.BasePartitionTable()
 	if errors.Is(err, defs.ErrNoPartitionTableForImgType) {
@@ -247,13 +347,89 @@ func (t *imageType) Manifest(bp *blueprint.Blueprint,
 	options distro.ImageOptions,
 	repos []rpmmd.RepoConfig,
 	seedp *int64) (*manifest.Manifest, []string, error) {
-	seed := distro.SeedFrom(seedp)
+	seed := distro.SeedFromOptions(seedp, options)
 
-	warnings, err := t.checkOptions(bp, options)
+	img, rng, warnings, err := t.imageKind(bp, options, repos, seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	mf, err := t.newManifest(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	runner := t.arch.distro.Runner()
+	_, err = img.InstantiateManifest(mf, repos, &runner, rng)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	return mf, warnings, err
+}
+
+// MultiManifest implements distro.MultiManifestImageType, only disk
+// images of the same architecture can be combined.
+func (t *imageType) MultiManifest(bp *blueprint.Blueprint,
+	options distro.ImageOptions,
+	repos []rpmmd.RepoConfig,
+	seedp *int64,
+	others []distro.ImageType) (*manifest.Manifest, []*artifact.Artifact, []string, error) {
+	seed := distro.SeedFromOptions(seedp, options)
+
+	img, rng, warnings, err := t.imageKind(bp, options, repos, seed)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	diskImg, ok := img.(*image.DiskImage)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("image type %q is not a disk image and cannot be combined with other image types", t.Name())
+	}
+	for _, other := range others {
+		otherType, ok := other.(*imageType)
+		if !ok || otherType.arch.Name() != t.arch.Name() || otherType.arch.distro.Name() != t.arch.distro.Name() {
+			return nil, nil, nil, fmt.Errorf("image type %q cannot be combined with %q: different distribution or architecture", other.Name(), t.Name())
+		}
+		// every image type gets its own rng from the same seed so that
+		// e.g. the partition table UUIDs are the same for all of them
+		otherImg, _, otherWarnings, err := otherType.imageKind(bp, options, repos, seed)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		warnings = append(warnings, otherWarnings...)
+		otherDiskImg, ok := otherImg.(*image.DiskImage)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("image type %q is not a disk image and cannot be combined with other image types", other.Name())
+		}
+		if err := diskImg.AddFormat(otherDiskImg); err != nil {
+			return nil, nil, nil, fmt.Errorf("image type %q cannot be combined with %q: %w", other.Name(), t.Name(), err)
+		}
+	}
+
+	mf, err := t.newManifest(options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	runner := t.arch.distro.Runner()
+	artifacts, err := diskImg.InstantiateManifestMulti(mf, repos, &runner, rng)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return mf, artifacts, warnings, nil
+}
+
+// imageKind returns the image of the image type for the given blueprint
+// and options together with the rng that needs to be used to instantiate
+// its manifest.
+func (t *imageType) imageKind(bp *blueprint.Blueprint,
+	options distro.ImageOptions,
+	repos []rpmmd.RepoConfig,
+	seed int64) (image.ImageKind, *rand.Rand, []string, error) {
+
+	warnings, _, err := t.checkOptions(bp, options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
 	// merge package sets that appear in the image type with the package sets
 	// of the same name from the distro and arch
 	staticPackageSets := make(map[string]rpmmd.PackageSet)
@@ -282,7 +458,7 @@ func (t *imageType) Manifest(bp *blueprint.Blueprint,
 
 	customRepos, err := bp.Customizations.GetRepositories()
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	installFromRepos := blueprint.RepoCustomizationsInstallFromOnly(customRepos)
 	payloadRepos = append(payloadRepos, installFromRepos...)
@@ -304,58 +480,69 @@ func (t *imageType) Manifest(bp *blueprint.Blueprint,
 
 	img, err := t.image(t, bp, options, staticPackageSets, payloadRepos, containerSources, rng)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
+	return img, rng, warnings, nil
+}
+
+func (t *imageType) newManifest(options distro.ImageOptions) (*manifest.Manifest, error) {
+	d := t.Arch().Distro()
 	mf := manifest.New()
 	// TODO: remove the need for this entirely, the manifest has a
 	// bunch of code that checks the distro currently, ideally all
 	// would just be encoded in the YAML
 	mf.Distro = d.IDLike()
 	if mf.Distro == manifest.DISTRO_NULL {
-		return nil, nil, fmt.Errorf("no distro_like set in yaml for %q", d.Name())
+		return nil, fmt.Errorf("no distro_like set in yaml for %q", d.Name())
 	}
 	if options.UseBootstrapContainer {
-		bootstrapContainerRef, err := t.Arch().Distro().BootstrapContainer(t.arch.Name())
+		bootstrapContainerRef, err := d.BootstrapContainer(t.arch.Name())
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 		mf.DistroBootstrapRef = bootstrapContainerRef
 	}
-	runner := d.Runner()
-	_, err = img.InstantiateManifest(&mf, repos, &runner, rng)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return &mf, warnings, err
+	return &mf, nil
 }
 
 // checkOptions checks the validity and compatibility of options and customizations for the image type.
-// Returns ([]string, error) where []string, if non-nil, will hold any generated warnings (e.g. deprecation notices).
-func (t *imageType) checkOptions(bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, error) {
-
-	warnings, err := checkOptionsCommon(t, bp, options)
-	if err != nil {
-		return warnings, err
+// Returns ([]string, distro.BlueprintErrors, error) where []string, if non-nil, will hold any generated warnings (e.g. deprecation notices)
+// and distro.BlueprintErrors holds the unsupported and missing options of the blueprint, which are reported as warnings too.
+func (t *imageType) checkOptions(bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, distro.BlueprintErrors, error) {
+
+	// NOTE (validation-warnings): the unsupported and missing options are
+	// appended to the warnings, because failing on them is breaking a lot
+	// of things in the service. The violations are also returned as a
+	// typed list.
+	var warnings []string
+	var violations distro.BlueprintErrors
+	if err := distro.ValidateConfig(t, *bp); err != nil {
+		errAsWarning := fmt.Errorf("blueprint validation failed for image type %q: %w", t.Name(), err)
+		warnings = append(warnings, errAsWarning.Error())
+		errors.As(err, &violations)
 	}
 
+	commonWarnings, errs, bpErrs := checkOptionsCommon(t, bp, options)
+	warnings = append(warnings, commonWarnings...)
+
 	d := t.Arch().Distro()
 	switch idLike := d.IDLike(); idLike {
 	case manifest.DISTRO_FEDORA, manifest.DISTRO_EL7, manifest.DISTRO_EL10:
 		// no specific options checkers
 	case manifest.DISTRO_EL8:
-		if err := checkOptionsRhel8(t, bp); err != nil {
-			return warnings, err
-		}
+		bpErrs = append(bpErrs, checkOptionsRhel8(t, bp)...)
 	case manifest.DISTRO_EL9:
-		if err := checkOptionsRhel9(t, bp); err != nil {
-			return warnings, err
-		}
+		bpErrs = append(bpErrs, checkOptionsRhel9(t, bp)...)
 	default:
-		return nil, fmt.Errorf("checkOptions called with unknown distro-like %v", idLike)
+		return nil, nil, fmt.Errorf("checkOptions called with unknown distro-like %v", idLike)
 	}
 
-	return warnings, nil
+	// all violations of the blueprint are returned as one list so that they
+	// can all be fixed at once
+	if len(bpErrs) > 0 {
+		errs = append(errs, fmt.Errorf("blueprint validation failed for image type %q: %w", t.Name(), bpErrs))
+	}
+	return warnings, violations, errors.Join(errs...)
 }
 
 func (t *imageType) RequiredBlueprintOptions() []string {
@@ -2,41 +2,64 @@ package generic
 
 import (
 	"fmt"
+	"reflect"
 	"slices"
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/customizations/oscap"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/policies"
 )
 
-func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, error) {
+// checkOptionsCommon checks the options and customizations that are common
+// to all distros. All problems are collected: the errors of the image
+// options are returned next to the violations of the blueprint. The
+// unsupported and missing options of the image type are checked by
+// checkOptions().
+func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, []error, distro.BlueprintErrors) {
+	var errs []error
 	if !t.RPMOSTree && options.OSTree != nil {
-		return nil, fmt.Errorf("OSTree is not supported for %q", t.Name())
+		errs = append(errs, fmt.Errorf("OSTree is not supported for %q", t.Name()))
 	}
 
 	if len(t.ImageTypeYAML.SupportedPartitioningModes) > 0 && !slices.Contains(t.ImageTypeYAML.SupportedPartitioningModes, options.PartitioningMode) {
-		return nil, fmt.Errorf("partitioning mode %s not supported for %q", options.PartitioningMode, t.Name())
+		errs = append(errs, fmt.Errorf("partitioning mode %s not supported for %q", options.PartitioningMode, t.Name()))
 	}
 
 	customizations := bp.Customizations
 
 	var warnings []string
 
-	errPrefix := fmt.Sprintf("blueprint validation failed for image type %q", t.Name())
+	if options.OSTree != nil {
+		if err := options.OSTree.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-	if err := distro.ValidateConfig(t, *bp); err != nil {
-		// NOTE (validation-warnings): appending to warnings now, because this
-		// is breaking a lot of things the service
-		errAsWarning := fmt.Errorf("%s: %w", errPrefix, err)
-		warnings = append(warnings, errAsWarning.Error())
+	if options.SourceDateEpoch != nil && *options.SourceDateEpoch < 0 {
+		errs = append(errs, fmt.Errorf("source_date_epoch must not be negative, got %d", *options.SourceDateEpoch))
 	}
 
-	if options.OSTree != nil {
-		if err := options.OSTree.Validate(); err != nil {
-			return warnings, err
+	if len(options.AdditionalDisks) > 0 && t.ImageTypeYAML.Image != "disk" {
+		errs = append(errs, fmt.Errorf("additional disks are not supported for %q", t.Name()))
+	}
+
+	if options.SectorSize != 0 {
+		if t.PartitionType() == disk.PT_NONE {
+			errs = append(errs, fmt.Errorf("sector size is not supported for %q", t.Name()))
+		} else if err := disk.ValidateSectorSize(options.SectorSize); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if options.MOK != nil {
+		if !t.Bootable || t.RPMOSTree || t.platform.GetUEFIVendor() == "" {
+			errs = append(errs, fmt.Errorf("mok options are not supported for %q", t.Name()))
+		} else if err := options.MOK.Validate(); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
@@ -44,14 +67,21 @@ func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.Im
 		// ostree-based ISOs require a URL from which to pull a payload commit, this can either be a default URL or one
 		// supplied through options
 		if t.OSTreeURL() == "" && (options.OSTree == nil || options.OSTree.URL == "") {
-			return warnings, fmt.Errorf("options validation failed for image type %q: ostree.url: required, there is no default available", t.Name())
+			errs = append(errs, fmt.Errorf("options validation failed for image type %q: ostree.url: required, there is no default available", t.Name()))
 		}
 	}
 
+	// the violations of the blueprint are collected so that they can all be
+	// fixed at once
+	var bpErrs distro.BlueprintErrors
+	addError := func(path string, code distro.ValidationErrorCode, msg string) {
+		bpErrs = append(bpErrs, distro.BlueprintError{Path: path, Code: code, Message: msg})
+	}
+
 	// FDO is optional, but when specified has some restrictions
 	if customizations.GetFDO() != nil {
 		if customizations.GetFDO().ManufacturingServerURL == "" {
-			return warnings, fmt.Errorf("%s: customizations.fdo.manufacturing_server_url: required when using fdo", errPrefix)
+			addError("/customizations/fdo/manufacturing_server_url", distro.ValidationErrorRequired, "customizations.fdo.manufacturing_server_url: required when using fdo")
 		}
 		var diunSet int
 		if customizations.GetFDO().DiunPubKeyHash != "" {
@@ -64,50 +94,90 @@ func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.Im
 			diunSet++
 		}
 		if diunSet != 1 {
-			return warnings, fmt.Errorf("%s: exactly one of customizations.fdo.diun_pub_key_hash, customizations.fdo.diun_pub_key_insecure, customizations.fdo.diun_pub_key_root_certs: required when using fdo", errPrefix)
+			bpErrs = append(bpErrs, distro.BlueprintError{
+				Path:    "/customizations/fdo",
+				Code:    distro.ValidationErrorConflict,
+				Message: "exactly one of customizations.fdo.diun_pub_key_hash, customizations.fdo.diun_pub_key_insecure, customizations.fdo.diun_pub_key_root_certs: required when using fdo",
+				Allowed: []string{"customizations.fdo.diun_pub_key_hash", "customizations.fdo.diun_pub_key_insecure", "customizations.fdo.diun_pub_key_root_certs"},
+			})
 		}
 	}
 
 	ignitionCustomization, err := customizations.GetIgnition()
 	if err != nil {
-		return warnings, err
+		addError("/customizations/ignition/firstboot", distro.ValidationErrorConflict, err.Error())
 	}
 	if ignitionCustomization != nil {
 		if ignitionCustomization.Embedded != nil && ignitionCustomization.FirstBoot != nil {
-			return warnings, fmt.Errorf("%s: customizations.ignition.embedded cannot be used with customizations.ignition.firstboot", errPrefix)
+			addError("/customizations/ignition/embedded", distro.ValidationErrorConflict, "customizations.ignition.embedded cannot be used with customizations.ignition.firstboot")
 		}
 		if ignitionCustomization.FirstBoot != nil && ignitionCustomization.FirstBoot.ProvisioningURL == "" {
-			return warnings, fmt.Errorf("%s: customizations.ignition.firstboot requires customizations.ignition.firstboot.provisioning_url", errPrefix)
+			addError("/customizations/ignition/firstboot/provisioning_url", distro.ValidationErrorRequired, "customizations.ignition.firstboot requires customizations.ignition.firstboot.provisioning_url")
 		}
 	}
 
 	mountpoints := customizations.GetFilesystems()
-	partitioning, err := customizations.GetPartitioning()
-	if err != nil {
-		return warnings, err
+	partitioning, partitioningErr := customizations.GetPartitioning()
+	if partitioningErr != nil {
+		addError("/customizations/disk", distro.ValidationErrorInvalid, partitioningErr.Error())
 	}
 	if len(mountpoints) > 0 && partitioning != nil {
-		return warnings, fmt.Errorf("%s: customizations.disk cannot be used with customizations.filesystem", errPrefix)
+		addError("/customizations/disk", distro.ValidationErrorConflict, "customizations.disk cannot be used with customizations.filesystem")
 	}
 
-	if err := blueprint.CheckMountpointsPolicy(mountpoints, policies.MountpointPolicies); err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+	for idx, mountpoint := range mountpoints {
+		if err := blueprint.CheckMountpointsPolicy([]blueprint.FilesystemCustomization{mountpoint}, policies.MountpointPolicies); err != nil {
+			addError(fmt.Sprintf("/customizations/filesystem/%d/mountpoint", idx), distro.ValidationErrorPolicy, err.Error())
+		}
 	}
-	if err := blueprint.CheckDiskMountpointsPolicy(partitioning, policies.MountpointPolicies); err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+	for _, mp := range diskMountpoints(partitioning) {
+		single := &blueprint.DiskCustomization{
+			Partitions: []blueprint.PartitionCustomization{
+				{FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: mp.mountpoint}},
+			},
+		}
+		if err := blueprint.CheckDiskMountpointsPolicy(single, policies.MountpointPolicies); err != nil {
+			addError(mp.path, distro.ValidationErrorPolicy, err.Error())
+		}
 	}
-	if err := partitioning.ValidateLayoutConstraints(); err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+	if partitioningErr == nil {
+		bootPartitioning, diskPartitions, err := splitPartitioning(customizations, options)
+		if err != nil {
+			errs = append(errs, err)
+		} else if partitioning != nil {
+			// the layout constraints apply to each disk of the image on its own
+			disks := [][]blueprint.PartitionCustomization{bootPartitioning.Partitions}
+			for _, ad := range options.AdditionalDisks {
+				disks = append(disks, diskPartitions[ad.Name])
+			}
+			for _, partitions := range disks {
+				if idx, err := layoutConstraintViolation(partitions); err != nil {
+					// point at the partition in the disk customization
+					bpIdx := slices.IndexFunc(partitioning.Partitions, func(part blueprint.PartitionCustomization) bool {
+						return reflect.DeepEqual(part, partitions[idx])
+					})
+					addError(fmt.Sprintf("/customizations/disk/partitions/%d", bpIdx), distro.ValidationErrorConflict, err.Error())
+				}
+			}
+		}
 	}
 
 	if osc := customizations.GetOpenSCAP(); osc != nil {
 		d := t.arch.distro.(*distribution)
 		supported := oscap.IsProfileAllowed(osc.ProfileID, d.DistroYAML.OscapProfilesAllowList)
 		if !supported {
-			return warnings, fmt.Errorf("%s: customizations.openscap.profile_id: unsupported profile %s", errPrefix, osc.ProfileID)
-		}
-		if osc.ProfileID == "" {
-			return warnings, fmt.Errorf("%s: customizations.openscap.profile_id: required when using customizations.openscap", errPrefix)
+			var allowed []string
+			for _, profile := range d.DistroYAML.OscapProfilesAllowList {
+				allowed = append(allowed, profile.String())
+			}
+			bpErrs = append(bpErrs, distro.BlueprintError{
+				Path:    "/customizations/openscap/profile_id",
+				Code:    distro.ValidationErrorUnsupported,
+				Message: fmt.Sprintf("customizations.openscap.profile_id: unsupported profile %s", osc.ProfileID),
+				Allowed: allowed,
+			})
+		} else if osc.ProfileID == "" {
+			addError("/customizations/openscap/profile_id", distro.ValidationErrorRequired, "customizations.openscap.profile_id: required when using customizations.openscap")
 		}
 	}
 
@@ -115,9 +185,8 @@ func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.Im
 	dc := customizations.GetDirectories()
 	fc := customizations.GetFiles()
 
-	err = blueprint.ValidateDirFileCustomizations(dc, fc)
-	if err != nil {
-		return warnings, err
+	if err := blueprint.ValidateDirFileCustomizations(dc, fc); err != nil {
+		addError("/customizations/files", distro.ValidationErrorConflict, err.Error())
 	}
 
 	dcp := policies.CustomDirectoriesPolicies
@@ -128,20 +197,25 @@ func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.Im
 		fcp = policies.OstreeCustomFilesPolicies
 	}
 
-	err = blueprint.CheckDirectoryCustomizationsPolicy(dc, dcp)
-	if err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+	for idx, dir := range dc {
+		if err := blueprint.CheckDirectoryCustomizationsPolicy([]blueprint.DirectoryCustomization{dir}, dcp); err != nil {
+			addError(fmt.Sprintf("/customizations/directories/%d/path", idx), distro.ValidationErrorPolicy, err.Error())
+		}
 	}
-
-	err = blueprint.CheckFileCustomizationsPolicy(fc, fcp)
-	if err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+	for idx, file := range fc {
+		if err := blueprint.CheckFileCustomizationsPolicy([]blueprint.FileCustomization{file}, fcp); err != nil {
+			addError(fmt.Sprintf("/customizations/files/%d/path", idx), distro.ValidationErrorPolicy, err.Error())
+		}
 	}
 
 	// check if repository customizations are valid
-	_, err = customizations.GetRepositories()
-	if err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+	if customizations != nil {
+		for idx, repo := range customizations.Repositories {
+			repoCustomizations := &blueprint.Customizations{Repositories: []blueprint.RepositoryCustomization{repo}}
+			if _, err := repoCustomizations.GetRepositories(); err != nil {
+				addError(fmt.Sprintf("/customizations/repositories/%d", idx), distro.ValidationErrorInvalid, err.Error())
+			}
+		}
 	}
 
 	if customizations.GetFIPS() && !common.IsBuildHostFIPSEnabled() {
@@ -149,49 +223,98 @@ func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.Im
 	}
 
 	// check if group customizations are valid
-	if _, err := customizations.GetGroups(); err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+	groups, err := customizations.GetGroups()
+	if err != nil {
+		addError("/customizations/group", distro.ValidationErrorInvalid, err.Error())
 	}
 
 	instCust, err := customizations.GetInstaller()
 	if err != nil {
-		return warnings, fmt.Errorf("%s: %w", errPrefix, err)
+		addError("/customizations/installer", distro.ValidationErrorInvalid, err.Error())
 	}
 	if instCust != nil && instCust.Kickstart != nil && len(instCust.Kickstart.Contents) > 0 {
-		groups, _ := customizations.GetGroups() // group customization errors are checked above
 		if customizations.GetUsers() != nil || groups != nil {
-			return warnings, fmt.Errorf("%s: customizations.installer.kickstart.contents cannot be used with customizations.user or customizations.group", errPrefix)
+			addError("/customizations/installer/kickstart/contents", distro.ValidationErrorConflict, "customizations.installer.kickstart.contents cannot be used with customizations.user or customizations.group")
 		}
 	}
-	return warnings, nil
+
+	return warnings, errs, bpErrs
+}
+
+// diskMountpoint is a mountpoint of a disk customization together with the
+// JSON pointer to its field
+type diskMountpoint struct {
+	path       string
+	mountpoint string
 }
 
-func checkOptionsRhel9(t *imageType, bp *blueprint.Blueprint) error {
+// diskMountpoints returns the mountpoints of the partitions, logical volumes
+// and subvolumes of the disk customization in order
+func diskMountpoints(partitioning *blueprint.DiskCustomization) []diskMountpoint {
+	if partitioning == nil {
+		return nil
+	}
+	var mountpoints []diskMountpoint
+	for idx, part := range partitioning.Partitions {
+		if part.Mountpoint != "" {
+			mountpoints = append(mountpoints, diskMountpoint{fmt.Sprintf("/customizations/disk/partitions/%d/mountpoint", idx), part.Mountpoint})
+		}
+		for lvIdx, lv := range part.LogicalVolumes {
+			if lv.Mountpoint != "" {
+				mountpoints = append(mountpoints, diskMountpoint{fmt.Sprintf("/customizations/disk/partitions/%d/logical_volumes/%d/mountpoint", idx, lvIdx), lv.Mountpoint})
+			}
+		}
+		for subvolIdx, subvol := range part.Subvolumes {
+			mountpoints = append(mountpoints, diskMountpoint{fmt.Sprintf("/customizations/disk/partitions/%d/subvolumes/%d/mountpoint", idx, subvolIdx), subvol.Mountpoint})
+		}
+	}
+	return mountpoints
+}
+
+// layoutConstraintViolation returns the index of the first partition of a
+// disk that violates the layout constraints of the disk customizations,
+// e.g. a second volume group, together with the violation
+func layoutConstraintViolation(partitions []blueprint.PartitionCustomization) (int, error) {
+	for idx := range partitions {
+		dc := &blueprint.DiskCustomization{Partitions: partitions[:idx+1]}
+		if err := dc.ValidateLayoutConstraints(); err != nil {
+			return idx, err
+		}
+	}
+	return -1, nil
+}
+
+func checkOptionsRhel9(t *imageType, bp *blueprint.Blueprint) distro.BlueprintErrors {
 	customizations := bp.Customizations
-	errPrefix := fmt.Sprintf("blueprint validation failed for image type %q", t.Name())
 
+	var bpErrs distro.BlueprintErrors
 	if osc := customizations.GetOpenSCAP(); osc != nil {
 		// TODO: remove this check when we add support for conditions in
 		// supported_blueprint_options.
 		if t.Arch().Distro().OsVersion() == "9.0" {
-			return fmt.Errorf("%s: customizations.openscap: not supported for distro version: %s", errPrefix, t.Arch().Distro().OsVersion())
+			bpErrs = append(bpErrs, distro.BlueprintError{
+				Path:    "/customizations/openscap",
+				Code:    distro.ValidationErrorUnsupported,
+				Message: fmt.Sprintf("customizations.openscap: not supported for distro version: %s", t.Arch().Distro().OsVersion()),
+			})
 		}
 	}
-	return nil
+	return bpErrs
 }
 
-func checkOptionsRhel8(t *imageType, bp *blueprint.Blueprint) error {
+func checkOptionsRhel8(t *imageType, bp *blueprint.Blueprint) distro.BlueprintErrors {
 	customizations := bp.Customizations
 
-	errPrefix := fmt.Sprintf("blueprint validation failed for image type %q", t.Name())
-
-	partitioning, err := customizations.GetPartitioning()
-	if err != nil {
-		return err
+	var bpErrs distro.BlueprintErrors
+	addError := func(path string, msg string) {
+		bpErrs = append(bpErrs, distro.BlueprintError{Path: path, Code: distro.ValidationErrorUnsupported, Message: msg})
 	}
 
+	// an invalid disk customization is reported by checkOptionsCommon()
+	partitioning, _ := customizations.GetPartitioning()
+
 	if partitioning != nil {
-		for _, partition := range partitioning.Partitions {
+		for idx, partition := range partitioning.Partitions {
 			if t.Arch().Name() == arch.ARCH_AARCH64.String() {
 				// Due to kernel page size differences, between RHEL 8 and
 				// newer distros, it is impossible to create a swap partition
@@ -200,11 +323,13 @@ func checkOptionsRhel8(t *imageType, bp *blueprint.Blueprint) error {
 				// running on RHEL 8, and the RHEL 9 aarch64 kernel uses a
 				// different page size.
 				if partition.FSType == "swap" {
-					return fmt.Errorf("%s: customizations.disk: swap partition creation is not supported on %s %s", errPrefix, t.Arch().Distro().Name(), t.Arch().Name())
+					addError(fmt.Sprintf("/customizations/disk/partitions/%d/fs_type", idx),
+						fmt.Sprintf("customizations.disk.partitions[%d].fs_type: swap partition creation is not supported on %s %s", idx, t.Arch().Distro().Name(), t.Arch().Name()))
 				}
-				for _, lv := range partition.LogicalVolumes {
+				for lvIdx, lv := range partition.LogicalVolumes {
 					if lv.FSType == "swap" {
-						return fmt.Errorf("%s: customizations.disk: swap logical volume creation is not supported on %s %s", errPrefix, t.Arch().Distro().Name(), t.Arch().Name())
+						addError(fmt.Sprintf("/customizations/disk/partitions/%d/logical_volumes/%d/fs_type", idx, lvIdx),
+							fmt.Sprintf("customizations.disk.partitions[%d].logical_volumes[%d].fs_type: swap logical volume creation is not supported on %s %s", idx, lvIdx, t.Arch().Distro().Name(), t.Arch().Name()))
 					}
 				}
 			}
@@ -212,9 +337,9 @@ func checkOptionsRhel8(t *imageType, bp *blueprint.Blueprint) error {
 	}
 	if osc := customizations.GetOpenSCAP(); osc != nil {
 		if osVersion := t.Arch().Distro().OsVersion(); common.VersionLessThan(osVersion, "8.7") {
-			return fmt.Errorf("%s: customizations.openscap: not supported for distro version: %s", errPrefix, osVersion)
+			addError("/customizations/openscap", fmt.Sprintf("customizations.openscap: not supported for distro version: %s", osVersion))
 		}
 	}
 
-	return nil
+	return bpErrs
 }
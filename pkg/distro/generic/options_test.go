@@ -1,12 +1,15 @@
 package generic_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/customizations/mok"
 	"github.com/osbuild/images/pkg/disk/partition"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distro/generic"
@@ -43,6 +46,98 @@ func TestCheckOptions(t *testing.T) {
 			},
 			expErr: "blueprint validation failed for image type \"generic-ami\": customizations.installer: not supported",
 		},
+		"f42/ami-mok-ok": {
+			distro: "fedora-42",
+			it:     "generic-ami",
+			options: distro.ImageOptions{
+				MOK: &mok.ImageOptions{
+					EnrollMOK:  true,
+					CertPath:   "/keys/db.der",
+					SBATPolicy: "latest",
+				},
+			},
+		},
+		"f42/ami-mok-invalid": {
+			distro: "fedora-42",
+			it:     "generic-ami",
+			options: distro.ImageOptions{
+				MOK: &mok.ImageOptions{
+					EnrollMOK: true,
+				},
+			},
+			expErr: "machine owner key enrollment requires a certificate path",
+		},
+		"f42/container-mok-error": {
+			distro: "fedora-42",
+			it:     "container",
+			options: distro.ImageOptions{
+				MOK: &mok.ImageOptions{
+					SBATPolicy: "latest",
+				},
+			},
+			expErr: "mok options are not supported for \"generic-container\"",
+		},
+		"f42/ami-additional-disks-ok": {
+			distro: "fedora-42",
+			it:     "generic-ami",
+			bp: blueprint.Blueprint{
+				Customizations: &blueprint.Customizations{
+					Disk: &blueprint.DiskCustomization{
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								MinSize: 1024 * 1024 * 1024,
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/var/lib/data",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			options: distro.ImageOptions{
+				AdditionalDisks: []distro.AdditionalDisk{{Name: "data", Partitions: []string{"/var/lib/data"}}},
+			},
+		},
+		"f42/ami-additional-disks-unknown-partition": {
+			distro: "fedora-42",
+			it:     "generic-ami",
+			options: distro.ImageOptions{
+				AdditionalDisks: []distro.AdditionalDisk{{Name: "data", Partitions: []string{"/var/lib/data"}}},
+			},
+			expErr: "partitions can only be moved to additional disks with a disk customization",
+		},
+		"f42/container-additional-disks-error": {
+			distro: "fedora-42",
+			it:     "container",
+			options: distro.ImageOptions{
+				AdditionalDisks: []distro.AdditionalDisk{{Name: "data"}},
+			},
+			expErr: "additional disks are not supported for \"generic-container\"",
+		},
+		"f42/ami-sector-size-ok": {
+			distro: "fedora-42",
+			it:     "generic-ami",
+			options: distro.ImageOptions{
+				SectorSize: 4096,
+			},
+		},
+		"f42/ami-sector-size-error": {
+			distro: "fedora-42",
+			it:     "generic-ami",
+			options: distro.ImageOptions{
+				SectorSize: 1024,
+			},
+			expErr: "unsupported sector size 1024, must be 512 or 4096",
+		},
+		"f42/container-sector-size-error": {
+			distro: "fedora-42",
+			it:     "container",
+			options: distro.ImageOptions{
+				SectorSize: 4096,
+			},
+			expErr: "sector size is not supported for \"generic-container\"",
+		},
 		"f42/ami-ostree-error": {
 			distro: "fedora-42",
 			it:     "generic-ami",
@@ -1033,7 +1128,8 @@ func TestCheckOptions(t *testing.T) {
 			options: distro.ImageOptions{
 				PartitioningMode: partition.BtrfsPartitioningMode,
 			},
-			expErr: "partitioning mode btrfs not supported for \"edge-raw-image\"",
+			// all problems of the options are reported at once
+			expErr: "partitioning mode btrfs not supported for \"edge-raw-image\"\noptions validation failed for image type \"edge-raw-image\": ostree.url: required, there is no default available",
 		},
 		"r8/aarch-swap-partition-not-supported": {
 			distro: "rhel-8.10",
@@ -1061,7 +1157,7 @@ func TestCheckOptions(t *testing.T) {
 					},
 				},
 			},
-			expErr: "blueprint validation failed for image type \"qcow2\": customizations.disk: swap partition creation is not supported on rhel-8.10 aarch64",
+			expErr: "blueprint validation failed for image type \"qcow2\": customizations.disk.partitions[1].fs_type: swap partition creation is not supported on rhel-8.10 aarch64",
 		},
 		"r8/aarch-swap-lv-not-supported": {
 			distro: "rhel-8.10",
@@ -1094,7 +1190,7 @@ func TestCheckOptions(t *testing.T) {
 					},
 				},
 			},
-			expErr: "blueprint validation failed for image type \"qcow2\": customizations.disk: swap logical volume creation is not supported on rhel-8.10 aarch64",
+			expErr: "blueprint validation failed for image type \"qcow2\": customizations.disk.partitions[0].logical_volumes[1].fs_type: swap logical volume creation is not supported on rhel-8.10 aarch64",
 		},
 		"r8/oscap-8.6-unsupported": {
 			distro: "rhel-8.6",
@@ -1773,7 +1869,7 @@ func TestCheckOptions(t *testing.T) {
 					},
 				},
 			},
-			expErr: "invalid partitioning customizations:\nunknown partition type: wrong",
+			expErr: "blueprint validation failed for image type \"qcow2\": invalid partitioning customizations:\nunknown partition type: wrong",
 		},
 		"r10/unsupported-oscap-policy": {
 			distro: "rhel-10.1",
@@ -1802,7 +1898,7 @@ func TestCheckOptions(t *testing.T) {
 					},
 				},
 			},
-			expErr: "duplicate files / directory customization paths: [/file1]",
+			expErr: "blueprint validation failed for image type \"qcow2\": duplicate files / directory customization paths: [/file1]",
 		},
 		"r10/bad-path-for-file-customization": {
 			distro: "rhel-10.1",
@@ -1930,3 +2026,133 @@ func TestCheckOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckOptionsCollectsAllErrors(t *testing.T) {
+	d := generic.DistroFactory("fedora-42")
+	arch, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err := arch.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	bp := blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Filesystem: []blueprint.FilesystemCustomization{
+				{Mountpoint: "/etc", MinSize: 1024 * 1024 * 1024},
+			},
+			Disk: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						MinSize: 1024 * 1024 * 1024,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/data",
+							FSType:     "xfs",
+						},
+					},
+				},
+			},
+			Files: []blueprint.FileCustomization{
+				{Path: "/boot/grub2/grub.cfg", Data: "evil"},
+			},
+		},
+	}
+	_, err = generic.ImageTypeCheckOptions(it.(*generic.ImageType), &bp, distro.ImageOptions{})
+	require.Error(t, err)
+
+	var bpErrs distro.BlueprintErrors
+	require.True(t, errors.As(err, &bpErrs))
+	var paths []string
+	var codes []distro.ValidationErrorCode
+	for _, bpErr := range bpErrs {
+		paths = append(paths, bpErr.Path)
+		codes = append(codes, bpErr.Code)
+	}
+	assert.Equal(t, []string{"/customizations/disk", "/customizations/filesystem/0/mountpoint", "/customizations/files/0/path"}, paths)
+	assert.Equal(t, []distro.ValidationErrorCode{distro.ValidationErrorConflict, distro.ValidationErrorPolicy, distro.ValidationErrorPolicy}, codes)
+}
+
+func TestCheckOptionsMergesAllErrors(t *testing.T) {
+	d := generic.DistroFactory("rhel-8.10")
+	arch, err := d.GetArch("aarch64")
+	require.NoError(t, err)
+	it, err := arch.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	bp := blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Installer: &blueprint.InstallerCustomization{
+				Unattended: true,
+			},
+			Disk: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						MinSize: 1024 * 1024 * 1024,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							FSType: "swap",
+						},
+					},
+					{
+						Type:    "lvm",
+						MinSize: 5 * 1024 * 1024 * 1024,
+						VGCustomization: blueprint.VGCustomization{
+							Name: "rootvg",
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									Name:    "rootlv",
+									MinSize: 2 * 1024 * 1024 * 1024,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/",
+										FSType:     "xfs",
+									},
+								},
+								{
+									Name:    "etclv",
+									MinSize: 1024 * 1024 * 1024,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/etc",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Directories: []blueprint.DirectoryCustomization{
+				{Path: "/etc/foo"},
+				{Path: "/boot/foo"},
+			},
+		},
+	}
+	warnings, violations, err := generic.ImageTypeCheckOptionsViolations(it.(*generic.ImageType), &bp, distro.ImageOptions{SourceDateEpoch: common.ToPtr(int64(-1))})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "source_date_epoch must not be negative, got -1")
+
+	// NOTE (validation-warnings): the unsupported options are not fatal,
+	// they are returned as warnings and as a typed list
+	assert.Contains(t, warnings, `blueprint validation failed for image type "qcow2": customizations.installer: not supported`)
+	require.Len(t, violations, 1)
+	assert.Equal(t, "/customizations/installer", violations[0].Path)
+	assert.Equal(t, distro.ValidationErrorUnsupported, violations[0].Code)
+	assert.Contains(t, violations[0].Allowed, "customizations.disk")
+
+	// the path policies and the distro specific checks end up in the same
+	// list
+	var bpErrs distro.BlueprintErrors
+	require.True(t, errors.As(err, &bpErrs))
+	var paths []string
+	var codes []distro.ValidationErrorCode
+	for _, bpErr := range bpErrs {
+		paths = append(paths, bpErr.Path)
+		codes = append(codes, bpErr.Code)
+	}
+	assert.Equal(t, []string{
+		"/customizations/disk/partitions/1/logical_volumes/1/mountpoint",
+		"/customizations/directories/1/path",
+		"/customizations/disk/partitions/0/fs_type",
+	}, paths)
+	assert.Equal(t, []distro.ValidationErrorCode{
+		distro.ValidationErrorPolicy,
+		distro.ValidationErrorPolicy,
+		distro.ValidationErrorUnsupported,
+	}, codes)
+}
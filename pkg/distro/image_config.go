@@ -153,6 +153,12 @@ type ImageConfig struct {
 	// /usr/lib/ostree-boot into bootupd-compatible update metadata.
 	// Only set this to true if the bootupd package is available in the image.
 	BootupdGenMetadata *bool `yaml:"bootupd_gen_metadata,omitempty"`
+
+	// RepartDefinitionsDir is the directory in the image, e.g.
+	// "/usr/lib/repart.d", that receives the systemd-repart definitions
+	// of the partition table of the image, so that the partitions can be
+	// grown or recreated on boot. Only GPT partition tables are supported.
+	RepartDefinitionsDir *string `yaml:"repart_definitions_dir,omitempty"`
 }
 
 // shallowMerge creates a new struct by merging a child and a parent.
@@ -17,19 +17,141 @@ type ImageTypeValidator interface {
 	SupportedBlueprintOptions() []string
 }
 
+// ValidationErrorCode identifies the kind of a blueprint validation error
+type ValidationErrorCode string
+
+const (
+	// The option is set but not supported by the image type
+	ValidationErrorUnsupported ValidationErrorCode = "unsupported"
+	// The option is required by the image type but not set
+	ValidationErrorRequired ValidationErrorCode = "required"
+	// The value of the option is not allowed by a path policy, e.g. a
+	// custom mountpoint or file under a protected directory
+	ValidationErrorPolicy ValidationErrorCode = "policy"
+	// The option cannot be used together with another option
+	ValidationErrorConflict ValidationErrorCode = "conflict"
+	// The value of the option is invalid
+	ValidationErrorInvalid ValidationErrorCode = "invalid"
+	// The list of supported or required options of the image type is broken
+	ValidationErrorInternal ValidationErrorCode = "internal"
+)
+
+// BlueprintError is a single violation found when validating a blueprint
+// for an image type.
+type BlueprintError struct {
+	// Path is a JSON pointer to the offending blueprint field, e.g.
+	// "/customizations/user/1/name"
+	Path string              `json:"path"`
+	Code ValidationErrorCode `json:"code"`
+	// Message is the human readable description of the violation
+	Message string `json:"message"`
+	// Allowed are the alternatives that can be used instead, e.g. the
+	// supported options next to an unsupported one or the allowed values of
+	// an option
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+func (e BlueprintError) Error() string {
+	return e.Message
+}
+
+// BlueprintErrors are all violations found when validating a blueprint,
+// use errors.As to get them from the error of a validation.
+type BlueprintErrors []BlueprintError
+
+func (e BlueprintErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ErrorOrNil returns nil if there are no errors, so that the list can be
+// returned as an error
+func (e BlueprintErrors) ErrorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
 type validationError struct {
-	// Reverse path to the customization that caused the error.
+	// Reverse path to the customization that caused the error. Slice
+	// indices are separate elements, e.g. "[1]".
 	revPath []string
+	code    ValidationErrorCode
 	message string
+	// allowed options relative to the parent of the last path element
+	allowed []string
 }
 
 func (e validationError) Error() string {
-	path := e.revPath
-	slices.Reverse(path)
-	return fmt.Sprintf("%s: %s", strings.Join(path, "."), e.message)
+	return fmt.Sprintf("%s: %s", e.dottedPath(), e.message)
 }
 
-func validateSupportedConfig(supported []string, conf reflect.Value) *validationError {
+// dottedPath returns the path in the format of the blueprint options, e.g.
+// "customizations.user[1].name"
+func (e validationError) dottedPath() string {
+	var b strings.Builder
+	for idx := len(e.revPath) - 1; idx >= 0; idx-- {
+		elem := e.revPath[idx]
+		if b.Len() > 0 && !strings.HasPrefix(elem, "[") {
+			b.WriteString(".")
+		}
+		b.WriteString(elem)
+	}
+	return b.String()
+}
+
+// jsonPointer returns the path as a JSON pointer (RFC 6901), e.g.
+// "/customizations/user/1/name"
+func (e validationError) jsonPointer() string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	var b strings.Builder
+	for idx := len(e.revPath) - 1; idx >= 0; idx-- {
+		elem := strings.TrimSuffix(strings.TrimPrefix(e.revPath[idx], "["), "]")
+		b.WriteString("/")
+		b.WriteString(escaper.Replace(elem))
+	}
+	return b.String()
+}
+
+// parent prepends the tag of the parent field to the path, index is the
+// index of the element in the parent slice or -1
+func (e *validationError) parent(tag string, index int) {
+	if index >= 0 {
+		e.revPath = append(e.revPath, fmt.Sprintf("[%d]", index))
+	}
+	e.revPath = append(e.revPath, tag)
+	for idx := range e.allowed {
+		e.allowed[idx] = tag + "." + e.allowed[idx]
+	}
+}
+
+type validationErrors []*validationError
+
+func (errs validationErrors) parent(tag string, index int) validationErrors {
+	for _, err := range errs {
+		err.parent(tag, index)
+	}
+	return errs
+}
+
+func (errs validationErrors) blueprintErrors() BlueprintErrors {
+	var bpErrs BlueprintErrors
+	for _, err := range errs {
+		bpErrs = append(bpErrs, BlueprintError{
+			Path:    err.jsonPointer(),
+			Code:    err.code,
+			Message: err.Error(),
+			Allowed: err.allowed,
+		})
+	}
+	return bpErrs
+}
+
+func validateSupportedConfig(supported []string, conf reflect.Value) validationErrors {
 
 	// Construct two maps:
 	//  - subMap represents the keys on the current level of the recursion that
@@ -65,14 +187,26 @@ func validateSupportedConfig(supported []string, conf reflect.Value) *validation
 		}
 	}
 
+	// the options on this level that can be used instead of an unsupported
+	// one
+	var allowed []string
+	for key := range supportedMap {
+		allowed = append(allowed, key)
+	}
+	for key := range subMap {
+		if !supportedMap[key] {
+			allowed = append(allowed, key)
+		}
+	}
+	slices.Sort(allowed)
+
+	var errs validationErrors
 	confT := conf.Type()
 	for fieldIdx := 0; fieldIdx < confT.NumField(); fieldIdx++ {
 		fieldT := confT.Field(fieldIdx)
 		if fieldT.Anonymous {
 			// embedded struct: flatten with the parent
-			if err := validateSupportedConfig(supported, conf.Field(fieldIdx)); err != nil {
-				return err
-			}
+			errs = append(errs, validateSupportedConfig(supported, conf.Field(fieldIdx))...)
 			continue
 		}
 
@@ -86,7 +220,7 @@ func validateSupportedConfig(supported []string, conf reflect.Value) *validation
 			// as empty
 			empty := field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0)
 			if !empty && !supportedMap[tag] {
-				return &validationError{message: "not supported", revPath: []string{tag}}
+				errs = append(errs, &validationError{code: ValidationErrorUnsupported, message: "not supported", revPath: []string{tag}, allowed: slices.Clone(allowed)})
 			}
 			continue
 		}
@@ -105,30 +239,24 @@ func validateSupportedConfig(supported []string, conf reflect.Value) *validation
 		case reflect.Slice:
 			// iterate over slice and validate each element as a substructure
 			for sliceIdx := 0; sliceIdx < subStruct.Len(); sliceIdx++ {
-				if err := validateSupportedConfig(subList, subStruct.Index(sliceIdx)); err != nil {
-					err.revPath = append(err.revPath, fmt.Sprintf("%s[%d]", tag, sliceIdx))
-					return err
-				}
+				errs = append(errs, validateSupportedConfig(subList, subStruct.Index(sliceIdx)).parent(tag, sliceIdx)...)
 			}
 		case reflect.Struct:
 			// single element
-			if err := validateSupportedConfig(subList, subStruct); err != nil {
-				err.revPath = append(err.revPath, tag)
-				return err
-			}
+			errs = append(errs, validateSupportedConfig(subList, subStruct).parent(tag, -1)...)
 		case reflect.Int, reflect.Bool, reflect.String:
 			// this can happen if the supported list contains an invalid
 			// string, where a non-container type field is followed by a
 			// period, for example, "a.b" where a is an integer
-			return &validationError{message: fmt.Sprintf("internal error: supported list specifies child element of non-container type %v: %v", subStruct.Kind(), subStruct), revPath: []string{tag}}
+			errs = append(errs, &validationError{code: ValidationErrorInternal, message: fmt.Sprintf("internal error: supported list specifies child element of non-container type %v: %v", subStruct.Kind(), subStruct), revPath: []string{tag}})
 		default:
 			// this can happen if the config uses a container type that's
 			// not a struct or an array (e.g. a map).
-			return &validationError{message: fmt.Sprintf("internal error: unexpected field type: %v (%v)", subStruct.Kind(), subStruct), revPath: []string{tag}}
+			errs = append(errs, &validationError{code: ValidationErrorInternal, message: fmt.Sprintf("internal error: unexpected field type: %v (%v)", subStruct.Kind(), subStruct), revPath: []string{tag}})
 		}
 	}
 
-	return nil
+	return errs
 }
 
 func jsonTagFor(f reflect.StructField) string {
@@ -136,6 +264,47 @@ func jsonTagFor(f reflect.StructField) string {
 	return strings.Split(tag, ",")[0]
 }
 
+// fieldTypeByTag returns the field of the given struct type with the given
+// JSON tag, fields of embedded structs are flattened with the parent.
+func fieldTypeByTag(t reflect.Type, tag string) (reflect.StructField, bool) {
+	for idx := 0; idx < t.NumField(); idx++ {
+		f := t.Field(idx)
+		if f.Anonymous {
+			if field, ok := fieldTypeByTag(f.Type, tag); ok {
+				return field, true
+			}
+			continue
+		}
+		if jsonTagFor(f) == tag {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// ValidateBlueprintOption checks that the given option, as used in the
+// lists of supported and required blueprint options of an image type,
+// refers to an existing blueprint field, e.g. "customizations.kernel.name".
+func ValidateBlueprintOption(option string) error {
+	t := reflect.TypeOf(blueprint.Blueprint{})
+	parts := strings.Split(option, ".")
+	for idx, part := range parts {
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("%s: not a blueprint section", strings.Join(parts[:idx], "."))
+		}
+		field, ok := fieldTypeByTag(t, part)
+		if !ok {
+			return fmt.Errorf("%s: no such blueprint option", strings.Join(parts[:idx+1], "."))
+		}
+		t = field.Type
+		// options of pointers and slices refer to their elements
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+	}
+	return nil
+}
+
 func fieldByTag(p reflect.Value, tag string) (reflect.Value, error) {
 	for idx := 0; idx < p.Type().NumField(); idx++ {
 		c := p.Type().Field(idx)
@@ -156,7 +325,7 @@ func fieldByTag(p reflect.Value, tag string) (reflect.Value, error) {
 	return reflect.Value{}, fmt.Errorf("%s does not have a field with JSON tag %q", p.Type().Name(), tag)
 }
 
-func validateRequiredConfig(required []string, conf reflect.Value) *validationError {
+func validateRequiredConfig(required []string, conf reflect.Value) validationErrors {
 	// create two maps from the required list:
 	//
 	// 1. requiredMap contains the keys that must exist at this level as
@@ -189,7 +358,16 @@ func validateRequiredConfig(required []string, conf reflect.Value) *validationEr
 		}
 	}
 
+	// iterate in a stable order, all errors are collected
+	requiredKeys := make([]string, 0, len(requiredMap))
 	for key := range requiredMap {
+		requiredKeys = append(requiredKeys, key)
+	}
+	slices.Sort(requiredKeys)
+
+	var errs validationErrors
+	missing := make(map[string]bool)
+	for _, key := range requiredKeys {
 		// requiredMap contains keys that are required at this level, whether
 		// they have subkeys or not.
 		// Their values should be non-zero but only for certain types:
@@ -198,7 +376,9 @@ func validateRequiredConfig(required []string, conf reflect.Value) *validationEr
 		// shouldn't assume that a zero value is the same as a missing one.
 		value, err := fieldByTag(conf, key)
 		if err != nil {
-			return &validationError{message: err.Error(), revPath: []string{key}}
+			errs = append(errs, &validationError{code: ValidationErrorInternal, message: err.Error(), revPath: []string{key}})
+			missing[key] = true
+			continue
 		}
 		switch value.Kind() {
 		case reflect.Ptr, reflect.Struct, reflect.String, reflect.Slice:
@@ -206,14 +386,26 @@ func validateRequiredConfig(required []string, conf reflect.Value) *validationEr
 			// For other types, the zero value can be valid and not indicate a
 			// missing value.
 			if value.IsZero() {
-				return &validationError{message: "required", revPath: []string{key}}
+				errs = append(errs, &validationError{code: ValidationErrorRequired, message: "required", revPath: []string{key}})
+				missing[key] = true
 			}
 		default:
-			return &validationError{message: fmt.Sprintf("field of type %v cannot be marked required", value.Kind()), revPath: []string{key}}
+			errs = append(errs, &validationError{code: ValidationErrorInternal, message: fmt.Sprintf("field of type %v cannot be marked required", value.Kind()), revPath: []string{key}})
+			missing[key] = true
 		}
 	}
 
+	subKeys := make([]string, 0, len(subMap))
 	for key := range subMap {
+		subKeys = append(subKeys, key)
+	}
+	slices.Sort(subKeys)
+
+	for _, key := range subKeys {
+		if missing[key] {
+			// the missing parent is already reported
+			continue
+		}
 		// subMap contains keys that should contain specific subkeys.
 		// If the key's value is Zero, that's an error, but that should be
 		// caught by the requiredMap checks above.
@@ -221,7 +413,8 @@ func validateRequiredConfig(required []string, conf reflect.Value) *validationEr
 		// If it's s Slice, descend into each element.
 		value, err := fieldByTag(conf, key)
 		if err != nil {
-			return &validationError{message: err.Error(), revPath: []string{key}}
+			errs = append(errs, &validationError{code: ValidationErrorInternal, message: err.Error(), revPath: []string{key}})
+			continue
 		}
 		if value.Kind() == reflect.Ptr {
 			// Dereference pointer before validating.
@@ -232,47 +425,33 @@ func validateRequiredConfig(required []string, conf reflect.Value) *validationEr
 		switch value.Kind() {
 		case reflect.Struct:
 			// Descend into map
-			if err := validateRequiredConfig(subMap[key], value); err != nil {
-				err.revPath = append(err.revPath, key)
-				return err
-			}
+			errs = append(errs, validateRequiredConfig(subMap[key], value).parent(key, -1)...)
 		case reflect.Slice:
 			// iterate over slice and validate each element
 			for idx := 0; idx < value.Len(); idx++ {
-				if err := validateRequiredConfig(subMap[key], value.Index(idx)); err != nil {
-					err.revPath = append(err.revPath, fmt.Sprintf("%s[%d]", key, idx))
-					return err
-				}
+				errs = append(errs, validateRequiredConfig(subMap[key], value.Index(idx)).parent(key, idx)...)
 			}
 		case reflect.String:
 			// this can happen if the required list contains an invalid
 			// string, where a non-container type field is followed by a
 			// period, for example, "a.b" where a is a string
-			return &validationError{message: fmt.Sprintf("internal error: required list specifies child element of non-container type %v: %v", value.Kind(), value), revPath: []string{key}}
+			errs = append(errs, &validationError{code: ValidationErrorInternal, message: fmt.Sprintf("internal error: required list specifies child element of non-container type %v: %v", value.Kind(), value), revPath: []string{key}})
 		default:
 			// this should never happen, because we check above that only
 			// struct, string, and slice types can be required (and ptr types
 			// are dereferenced before the switch)
-			return &validationError{message: fmt.Sprintf("internal error: unexpected field type: %v (%v)", value.Kind(), value), revPath: []string{key}}
+			errs = append(errs, &validationError{code: ValidationErrorInternal, message: fmt.Sprintf("internal error: unexpected field type: %v (%v)", value.Kind(), value), revPath: []string{key}})
 		}
 	}
-	return nil
+	return errs
 }
 
+// ValidateConfig checks the blueprint against the supported and required
+// options of the image type. All violations are collected, the returned
+// error is a BlueprintErrors list.
 func ValidateConfig(t ImageTypeValidator, bp blueprint.Blueprint) error {
 	bpv := reflect.ValueOf(bp)
-	if err := validateSupportedConfig(t.SupportedBlueprintOptions(), bpv); err != nil {
-		return err
-	}
-
-	// note that validateRequiredConfig() returns a *validationError not a
-	// normal "error", hence the special handling below
-	if err := validateRequiredConfig(t.RequiredBlueprintOptions(), bpv); err != nil {
-		return err
-	}
-
-	// explicitly return nil when there is no error, otherwise the error type
-	// will be validationError instead of nil
-	// https://go.dev/doc/faq#nil_error
-	return nil
+	errs := validateSupportedConfig(t.SupportedBlueprintOptions(), bpv)
+	errs = append(errs, validateRequiredConfig(t.RequiredBlueprintOptions(), bpv)...)
+	return errs.blueprintErrors().ErrorOrNil()
 }
@@ -1,6 +1,8 @@
 package distro_test
 
 import (
+	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -8,6 +10,7 @@ import (
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type TestImageType struct {
@@ -590,6 +593,73 @@ func TestValidateConfig(t *testing.T) {
 	}
 }
 
+func TestValidateConfigCollectsAllErrors(t *testing.T) {
+	testImage := &TestImageType{
+		name: "test",
+		supportedOptions: []string{
+			"packages",
+			"customizations.hostname",
+			"customizations.user.name",
+			"customizations.user.key",
+		},
+		requiredOptions: []string{"customizations.user.name", "customizations.hostname"},
+	}
+	bp := blueprint.Blueprint{
+		Containers: []blueprint.Container{{Source: "example.org/box"}},
+		Customizations: &blueprint.Customizations{
+			Kernel: &blueprint.KernelCustomization{Name: "kernel-rt"},
+			User: []blueprint.UserCustomization{
+				{Name: "mario", Key: common.ToPtr("ssh-key")},
+				{Key: common.ToPtr("ssh-key"), Home: common.ToPtr("/home/nobody")},
+			},
+		},
+	}
+
+	err := distro.ValidateConfig(testImage, bp)
+	var bpErrs distro.BlueprintErrors
+	require.True(t, errors.As(err, &bpErrs))
+	assert.Equal(t, distro.BlueprintErrors{
+		{
+			Path:    "/containers",
+			Code:    distro.ValidationErrorUnsupported,
+			Message: "containers: not supported",
+			Allowed: []string{"customizations", "packages"},
+		},
+		{
+			Path:    "/customizations/kernel",
+			Code:    distro.ValidationErrorUnsupported,
+			Message: "customizations.kernel: not supported",
+			Allowed: []string{"customizations.hostname", "customizations.user"},
+		},
+		{
+			Path:    "/customizations/user/1/home",
+			Code:    distro.ValidationErrorUnsupported,
+			Message: "customizations.user[1].home: not supported",
+			Allowed: []string{"customizations.user.key", "customizations.user.name"},
+		},
+		{
+			Path:    "/customizations/hostname",
+			Code:    distro.ValidationErrorRequired,
+			Message: "customizations.hostname: required",
+		},
+		{
+			Path:    "/customizations/user/1/name",
+			Code:    distro.ValidationErrorRequired,
+			Message: "customizations.user[1].name: required",
+		},
+	}, bpErrs)
+	assert.Equal(t, "containers: not supported\n"+
+		"customizations.kernel: not supported\n"+
+		"customizations.user[1].home: not supported\n"+
+		"customizations.hostname: required\n"+
+		"customizations.user[1].name: required", err.Error())
+
+	// the errors are meant to be passed on to frontends
+	js, err := json.Marshal(bpErrs[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"path": "/customizations/kernel", "code": "unsupported", "message": "customizations.kernel: not supported", "allowed": ["customizations.hostname", "customizations.user"]}`, string(js))
+}
+
 func TestValidateSupportedConfig(t *testing.T) {
 	type testCase struct {
 		supported []string
@@ -1233,3 +1303,28 @@ func TestValidateRequiredConfigTypeError(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateBlueprintOption(t *testing.T) {
+	testCases := map[string]string{
+		"distro":                              "",
+		"packages":                            "",
+		"customizations.kernel.name":          "",
+		"customizations.user":                 "",
+		"customizations.disk.partitions":      "",
+		"customizations.filesystem":           "",
+		"customizations.bogus":                "customizations.bogus: no such blueprint option",
+		"customizations.kernel.name.whatever": "customizations.kernel.name: not a blueprint section",
+		"nonsense":                            "nonsense: no such blueprint option",
+	}
+
+	for option, expectedErr := range testCases {
+		t.Run(option, func(t *testing.T) {
+			err := distro.ValidateBlueprintOption(option)
+			if expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, expectedErr)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"slices"
 
 	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/distro/defs"
 	"github.com/osbuild/images/pkg/distro/generic"
 	"github.com/osbuild/images/pkg/distro/test_distro"
 )
@@ -109,6 +110,16 @@ func NewDefault() *Factory {
 	)
 }
 
+// NewWithSearchPaths returns a Factory of distro.Distro factories for all
+// supported distros and the distros defined in the given distro
+// definitions search paths. Later search paths take precedence, see
+// defs.Loader for the details.
+func NewWithSearchPaths(searchPaths []string) *Factory {
+	return New(
+		generic.NewDistroFactory(defs.NewLoaderWithSearchPaths(searchPaths)),
+	)
+}
+
 // NewTestDefault returns a Factory of distro.Distro factory for the test_distro.
 func NewTestDefault() *Factory {
 	return New(
@@ -1,9 +1,12 @@
 package distrofactory
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetDistroDefaultList(t *testing.T) {
@@ -136,3 +139,33 @@ func TestGetDistroDefaultListWithAliases(t *testing.T) {
 	}
 
 }
+
+func TestGetDistroWithSearchPaths(t *testing.T) {
+	searchPath := t.TempDir()
+	distrosYAML := `
+distros:
+  - name: downstream-42
+    distro_like: fedora
+    os_version: 42
+    release_version: 42
+    module_platform_id: platform:f42
+    product: "Downstream"
+    default_fs_type: "ext4"
+    defs_path: fedora
+    runner:
+      name: org.osbuild.fedora42
+`
+	err := os.WriteFile(filepath.Join(searchPath, "downstream.yaml"), []byte(distrosYAML), 0644)
+	require.NoError(t, err)
+
+	df := NewWithSearchPaths([]string{searchPath})
+	// the image types of the built-in "fedora" defs_path are used
+	d := df.GetDistro("downstream-42")
+	require.NotNil(t, d)
+	assert.Equal(t, "downstream-42", d.Name())
+	assert.Contains(t, d.ListArches(), "x86_64")
+	// built-in distros are still available
+	assert.NotNil(t, df.GetDistro("fedora-42"))
+
+	assert.Nil(t, NewDefault().GetDistro("downstream-42"))
+}
@@ -1,9 +1,12 @@
 package image
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/osbuild/images/internal/environment"
@@ -19,7 +22,10 @@ import (
 type DiskImage struct {
 	Base
 
-	PartitionTable     *disk.PartitionTable
+	PartitionTable *disk.PartitionTable
+	// AdditionalDisks are exported as separate images next to the boot
+	// disk image, only raw and qcow2 images support them
+	AdditionalDisks    []disk.Disk
 	OSCustomizations   manifest.OSCustomizations
 	DiskCustomizations manifest.DiskCustomizations
 	Environment        environment.Environment
@@ -33,6 +39,9 @@ type DiskImage struct {
 	OSProduct string
 	OSVersion string
 	OSNick    string
+
+	// extraFormats are exported from the same raw disk image, see AddFormat
+	extraFormats []*DiskImage
 }
 
 func NewDiskImage(platform platform.Platform, filename string) *DiskImage {
@@ -42,16 +51,135 @@ func NewDiskImage(platform platform.Platform, filename string) *DiskImage {
 	}
 }
 
+var ErrIncompatibleDiskImages = errors.New("disk images cannot be built from the same OS tree")
+
+// AddFormat adds the image format, compression and filename of other to
+// img so that the manifest of img also exports other, see
+// InstantiateManifestMulti. Both images need to build the same OS tree
+// and raw disk image, they may only differ in the format of the exported
+// image.
+func (img *DiskImage) AddFormat(other *DiskImage) error {
+	switch {
+	case !samePlatformFamily(img.platform, other.platform):
+		return fmt.Errorf("%w: %q and %q have different platforms", ErrIncompatibleDiskImages, img.filename, other.filename)
+	case !reflect.DeepEqual(img.PartitionTable, other.PartitionTable):
+		return fmt.Errorf("%w: %q and %q have different partition tables", ErrIncompatibleDiskImages, img.filename, other.filename)
+	case !reflect.DeepEqual(img.AdditionalDisks, other.AdditionalDisks):
+		return fmt.Errorf("%w: %q and %q have different additional disks", ErrIncompatibleDiskImages, img.filename, other.filename)
+	case !reflect.DeepEqual(img.OSCustomizations, other.OSCustomizations):
+		return fmt.Errorf("%w: %q and %q have different OS customizations", ErrIncompatibleDiskImages, img.filename, other.filename)
+	case !reflect.DeepEqual(img.Environment, other.Environment):
+		return fmt.Errorf("%w: %q and %q have different environments", ErrIncompatibleDiskImages, img.filename, other.filename)
+	case !reflect.DeepEqual(img.BuildOptions, other.BuildOptions):
+		return fmt.Errorf("%w: %q and %q have different build options", ErrIncompatibleDiskImages, img.filename, other.filename)
+	case img.DiskCustomizations != other.DiskCustomizations || img.PartTool != other.PartTool:
+		return fmt.Errorf("%w: %q and %q have different disk customizations", ErrIncompatibleDiskImages, img.filename, other.filename)
+	case img.NoBLS != other.NoBLS || img.OSProduct != other.OSProduct || img.OSVersion != other.OSVersion || img.OSNick != other.OSNick:
+		return fmt.Errorf("%w: %q and %q have different OS releases", ErrIncompatibleDiskImages, img.filename, other.filename)
+	}
+
+	// every format pipeline needs a unique name in the manifest
+	pipelines := make(map[string]string)
+	for _, format := range append([]*DiskImage{img}, img.extraFormats...) {
+		for _, name := range format.formatPipelineNames() {
+			pipelines[name] = format.filename
+		}
+	}
+	for _, name := range other.formatPipelineNames() {
+		if filename, ok := pipelines[name]; ok {
+			return fmt.Errorf("cannot export %q together with %q: both need the %q pipeline", other.filename, filename, name)
+		}
+	}
+
+	img.extraFormats = append(img.extraFormats, other)
+	return nil
+}
+
+// samePlatformFamily returns true if both platforms only differ in the
+// image format
+func samePlatformFamily(a, b platform.Platform) bool {
+	return a.GetArch() == b.GetArch() &&
+		a.GetBIOSPlatform() == b.GetBIOSPlatform() &&
+		a.GetUEFIVendor() == b.GetUEFIVendor() &&
+		slices.Equal(a.GetExtraUEFIArchitectures(), b.GetExtraUEFIArchitectures()) &&
+		a.GetZiplSupport() == b.GetZiplSupport() &&
+		sameElements(a.GetPackages(), b.GetPackages()) &&
+		sameElements(a.GetBuildPackages(), b.GetBuildPackages()) &&
+		reflect.DeepEqual(a.GetBootFiles(), b.GetBootFiles()) &&
+		a.GetBootloader() == b.GetBootloader()
+}
+
+func sameElements(a, b []string) bool {
+	a = slices.Clone(a)
+	b = slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// formatPipelineNames returns the names of the pipelines that
+// formatPipeline and the compression add for img
+func (img *DiskImage) formatPipelineNames() []string {
+	var names []string
+	switch img.platform.GetImageFormat() {
+	case platform.FORMAT_RAW:
+		// the raw image pipeline is shared, it can only be exported
+		// once under its own filename
+		if img.Compression == "" {
+			names = append(names, "image")
+		}
+	case platform.FORMAT_QCOW2:
+		names = append(names, "qcow2")
+	case platform.FORMAT_VHD:
+		names = append(names, "vpc")
+	case platform.FORMAT_VHDX:
+		names = append(names, "vhdx")
+	case platform.FORMAT_VMDK:
+		names = append(names, "vmdk")
+	case platform.FORMAT_OVA:
+		names = append(names, "vmdk", "ovf", "archive")
+	case platform.FORMAT_VAGRANT_LIBVIRT:
+		names = append(names, "qcow2", "vagrant", "archive")
+	case platform.FORMAT_VAGRANT_VIRTUALBOX:
+		names = append(names, "vmdk", "vagrant", "archive")
+	case platform.FORMAT_GCE:
+		// the GCE tarball renames the shared raw image
+		names = append(names, "image", "archive")
+	}
+	if img.Compression != "" {
+		names = append(names, img.Compression)
+	}
+	return names
+}
+
 func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 	repos []rpmmd.RepoConfig,
 	runner runner.Runner,
 	rng *rand.Rand) (*artifact.Artifact, error) {
 
+	artifacts, err := img.InstantiateManifestMulti(m, repos, runner, rng)
+	if err != nil {
+		return nil, err
+	}
+	return artifacts[0], nil
+}
+
+// InstantiateManifestMulti works like InstantiateManifest but also exports
+// the formats that were added with AddFormat. The OS tree and the raw disk
+// image are only built once. The artifact of img is returned first,
+// followed by the artifacts of the added formats in order. The artifacts of
+// the additional disks of all formats come last, in the same order.
+func (img *DiskImage) InstantiateManifestMulti(m *manifest.Manifest,
+	repos []rpmmd.RepoConfig,
+	runner runner.Runner,
+	rng *rand.Rand) ([]*artifact.Artifact, error) {
+
 	buildPipeline := addBuildBootstrapPipelines(m, runner, repos, img.BuildOptions)
 	buildPipeline.Checkpoint()
 
 	osPipeline := manifest.NewOS(buildPipeline, img.platform, repos)
 	osPipeline.PartitionTable = img.PartitionTable
+	osPipeline.AdditionalDisks = img.AdditionalDisks
 	osPipeline.OSCustomizations = img.OSCustomizations
 	osPipeline.DiskCustomizations = img.DiskCustomizations
 	osPipeline.Environment = img.Environment
@@ -61,6 +189,31 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 
 	rawImagePipeline := manifest.NewRawImage(buildPipeline, osPipeline, img.DiskCustomizations)
 
+	var artifacts []*artifact.Artifact
+	var multiDiskPipelines []manifest.MultiDiskPipeline
+	for _, format := range append([]*DiskImage{img}, img.extraFormats...) {
+		imagePipeline := format.formatPipeline(buildPipeline, rawImagePipeline, rng)
+		compressionPipeline := GetCompressionPipeline(format.Compression, buildPipeline, imagePipeline)
+		compressionPipeline.SetFilename(format.filename)
+		artifacts = append(artifacts, compressionPipeline.Export())
+
+		if len(img.AdditionalDisks) > 0 {
+			multiDisk, ok := compressionPipeline.(manifest.MultiDiskPipeline)
+			if !ok {
+				return nil, fmt.Errorf("cannot export %q: additional disks are only supported for uncompressed raw and qcow2 images", format.filename)
+			}
+			multiDiskPipelines = append(multiDiskPipelines, multiDisk)
+		}
+	}
+	for _, multiDisk := range multiDiskPipelines {
+		artifacts = append(artifacts, multiDisk.ExportAdditionalDisks()...)
+	}
+	return artifacts, nil
+}
+
+// formatPipeline adds the pipeline that converts the raw disk image into
+// the image format of the platform of img
+func (img *DiskImage) formatPipeline(buildPipeline manifest.Build, rawImagePipeline *manifest.RawImage, rng *rand.Rand) manifest.FilePipeline {
 	var imagePipeline manifest.FilePipeline
 	switch img.platform.GetImageFormat() {
 	case platform.FORMAT_RAW:
@@ -96,6 +249,8 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 		imagePipeline = vpcPipeline
 	case platform.FORMAT_VMDK:
 		imagePipeline = manifest.NewVMDK(buildPipeline, rawImagePipeline)
+	case platform.FORMAT_VHDX:
+		imagePipeline = manifest.NewVHDX(buildPipeline, rawImagePipeline)
 	case platform.FORMAT_OVA:
 		vmdkPipeline := manifest.NewVMDK(buildPipeline, rawImagePipeline)
 		ovfPipeline := manifest.NewOVF(buildPipeline, vmdkPipeline)
@@ -120,8 +275,5 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 		panic("invalid image format for image kind")
 	}
 
-	compressionPipeline := GetCompressionPipeline(img.Compression, buildPipeline, imagePipeline)
-	compressionPipeline.SetFilename(img.filename)
-
-	return compressionPipeline.Export(), nil
+	return imagePipeline
 }
@@ -0,0 +1,168 @@
+package image_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/image"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func newTestDiskImage(format platform.ImageFormat, filename string) *image.DiskImage {
+	return newTestDiskImageForArch(arch.ARCH_X86_64, format, filename)
+}
+
+func newTestDiskImageForArch(a arch.Arch, format platform.ImageFormat, filename string) *image.DiskImage {
+	img := image.NewDiskImage(&platform.Data{
+		Arch:         a,
+		ImageFormat:  format,
+		BIOSPlatform: "i386-pc",
+		Packages: map[string][]string{
+			"bios": {"grub2-pc"},
+			"uefi": {"shim-x64", "grub2-efi-x64"},
+		},
+	}, filename)
+	img.PartitionTable = &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Size: 1 * 1024 * 1024 * 1024,
+				Payload: &disk.Filesystem{
+					Type:       "xfs",
+					Mountpoint: "/",
+				},
+			},
+		},
+	}
+	img.OSCustomizations.Hostname = "test"
+	return img
+}
+
+func TestDiskImageAddFormat(t *testing.T) {
+	img := newTestDiskImage(platform.FORMAT_QCOW2, "disk.qcow2")
+	for _, other := range []*image.DiskImage{
+		newTestDiskImage(platform.FORMAT_VHD, "disk.vhd"),
+		newTestDiskImage(platform.FORMAT_OVA, "image.ova"),
+		newTestDiskImage(platform.FORMAT_VHDX, "disk.vhdx"),
+	} {
+		require.NoError(t, img.AddFormat(other))
+	}
+	raw := newTestDiskImage(platform.FORMAT_RAW, "disk.raw.xz")
+	raw.Compression = "xz"
+	require.NoError(t, img.AddFormat(raw))
+
+	mf := manifest.New()
+	rng := rand.New(rand.NewSource(0)) // nolint:gosec
+	artifacts, err := img.InstantiateManifestMulti(&mf, nil, &runner.Fedora{Version: 43}, rng)
+	require.NoError(t, err)
+
+	var exports, filenames []string
+	for _, a := range artifacts {
+		exports = append(exports, a.Export())
+		filenames = append(filenames, a.Filename())
+	}
+	assert.Equal(t, []string{"qcow2", "vpc", "archive", "vhdx", "xz"}, exports)
+	assert.Equal(t, []string{"disk.qcow2", "disk.vhd", "image.ova", "disk.vhdx", "disk.raw.xz"}, filenames)
+	assert.Equal(t, exports, mf.GetExports())
+
+	// the OS tree and the raw image are only built once
+	pipelines := 0
+	for _, name := range mf.PayloadPipelines() {
+		if name == "os" || name == "image" {
+			pipelines++
+		}
+	}
+	assert.Equal(t, 2, pipelines)
+}
+
+func TestDiskImageAddFormatErrors(t *testing.T) {
+	otherPT := newTestDiskImage(platform.FORMAT_VHD, "disk.vhd")
+	otherPT.PartitionTable.Type = disk.PT_DOS
+
+	otherOS := newTestDiskImage(platform.FORMAT_VHD, "disk.vhd")
+	otherOS.OSCustomizations.Hostname = "other"
+
+	otherArch := newTestDiskImageForArch(arch.ARCH_AARCH64, platform.FORMAT_VHD, "disk.vhd")
+
+	for _, tc := range []struct {
+		other       *image.DiskImage
+		expectedErr string
+	}{
+		{otherPT, `disk images cannot be built from the same OS tree: "disk.qcow2" and "disk.vhd" have different partition tables`},
+		{otherOS, `disk images cannot be built from the same OS tree: "disk.qcow2" and "disk.vhd" have different OS customizations`},
+		{otherArch, `disk images cannot be built from the same OS tree: "disk.qcow2" and "disk.vhd" have different platforms`},
+		{newTestDiskImage(platform.FORMAT_QCOW2, "other.qcow2"), `cannot export "other.qcow2" together with "disk.qcow2": both need the "qcow2" pipeline`},
+		{newTestDiskImage(platform.FORMAT_VAGRANT_LIBVIRT, "vagrant.box"), `cannot export "vagrant.box" together with "disk.qcow2": both need the "qcow2" pipeline`},
+	} {
+		img := newTestDiskImage(platform.FORMAT_QCOW2, "disk.qcow2")
+		err := img.AddFormat(tc.other)
+		assert.EqualError(t, err, tc.expectedErr)
+	}
+}
+
+func withTestDataDisk(img *image.DiskImage) *image.DiskImage {
+	img.AdditionalDisks = []disk.Disk{
+		{
+			Name: "data",
+			PartitionTable: &disk.PartitionTable{
+				Type: disk.PT_GPT,
+				Partitions: []disk.Partition{
+					{
+						Size: 1 * 1024 * 1024 * 1024,
+						Payload: &disk.Filesystem{
+							Type:       "xfs",
+							Mountpoint: "/var/lib/data",
+						},
+					},
+				},
+			},
+		},
+	}
+	return img
+}
+
+func TestDiskImageAdditionalDisks(t *testing.T) {
+	img := withTestDataDisk(newTestDiskImage(platform.FORMAT_QCOW2, "disk.qcow2"))
+	require.NoError(t, img.AddFormat(withTestDataDisk(newTestDiskImage(platform.FORMAT_RAW, "disk.raw"))))
+
+	mf := manifest.New()
+	rng := rand.New(rand.NewSource(0)) // nolint:gosec
+	artifacts, err := img.InstantiateManifestMulti(&mf, nil, &runner.Fedora{Version: 43}, rng)
+	require.NoError(t, err)
+
+	var exports, filenames []string
+	for _, a := range artifacts {
+		exports = append(exports, a.Export())
+		filenames = append(filenames, a.Filename())
+	}
+	assert.Equal(t, []string{"qcow2", "image", "qcow2", "image"}, exports)
+	assert.Equal(t, []string{"disk.qcow2", "disk.raw", "disk-data.qcow2", "disk-data.raw"}, filenames)
+
+	// the additional disks need to be the same for all formats
+	err = img.AddFormat(newTestDiskImage(platform.FORMAT_VHD, "disk.vhd"))
+	assert.EqualError(t, err, `disk images cannot be built from the same OS tree: "disk.qcow2" and "disk.vhd" have different additional disks`)
+}
+
+func TestDiskImageAdditionalDisksUnsupportedFormat(t *testing.T) {
+	for _, img := range []*image.DiskImage{
+		newTestDiskImage(platform.FORMAT_VHD, "disk.vhd"),
+		func() *image.DiskImage {
+			img := newTestDiskImage(platform.FORMAT_RAW, "disk.raw.xz")
+			img.Compression = "xz"
+			return img
+		}(),
+	} {
+		withTestDataDisk(img)
+		mf := manifest.New()
+		rng := rand.New(rand.NewSource(0)) // nolint:gosec
+		_, err := img.InstantiateManifestMulti(&mf, nil, &runner.Fedora{Version: 43}, rng)
+		assert.ErrorContains(t, err, "additional disks are only supported for uncompressed raw and qcow2 images")
+	}
+}
@@ -0,0 +1,96 @@
+package image
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/osbuild/images/pkg/artifact"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+// An Extension is a systemd system or configuration extension image for a
+// base image, see systemd-sysext(8). It contains the packages that are not
+// part of the base image and extension-release metadata that matches the
+// os-release of the base image.
+type Extension struct {
+	Base
+
+	ExtensionType manifest.ExtensionType
+
+	// Filesystem and compression of the image
+	RootfsType        manifest.ISORootfsType
+	RootfsCompression string
+	ErofsOptions      *osbuild.ErofsStageOptions
+
+	// Verity creates a discoverable disk image with a dm-verity protected
+	// partition instead of a plain filesystem image
+	Verity bool
+
+	// ID and VERSION_ID of the os-release of the base image
+	OSReleaseID        string
+	OSReleaseVersionID string
+
+	// Packages of the base image and the extension
+	BasePackages    rpmmd.PackageSet
+	Packages        rpmmd.PackageSet
+	PayloadRepos    []rpmmd.RepoConfig
+	InstallWeakDeps bool
+}
+
+func NewExtension(platform platform.Platform, filename string) *Extension {
+	return &Extension{
+		Base:       NewBase("extension", platform, filename),
+		RootfsType: manifest.ErofsRootfs,
+	}
+}
+
+// extensionName returns the name of the extension, systemd requires it to
+// match the name of the image file without the .raw suffix.
+func (img *Extension) extensionName() string {
+	return strings.TrimSuffix(img.filename, ".raw")
+}
+
+func (img *Extension) InstantiateManifest(m *manifest.Manifest,
+	repos []rpmmd.RepoConfig,
+	runner runner.Runner,
+	rng *rand.Rand) (*artifact.Artifact, error) {
+	buildPipeline := addBuildBootstrapPipelines(m, runner, repos, img.BuildOptions)
+	buildPipeline.Checkpoint()
+
+	treePipeline := manifest.NewExtensionTree(buildPipeline, img.platform, repos)
+	treePipeline.Type = img.ExtensionType
+	treePipeline.ExtensionName = img.extensionName()
+	treePipeline.OSReleaseID = img.OSReleaseID
+	treePipeline.OSReleaseVersionID = img.OSReleaseVersionID
+	treePipeline.BasePackages = img.BasePackages.Include
+	treePipeline.ExcludeBasePackages = img.BasePackages.Exclude
+	treePipeline.Packages = img.Packages.Include
+	treePipeline.ExcludePackages = img.Packages.Exclude
+	treePipeline.PayloadRepos = img.PayloadRepos
+	treePipeline.InstallWeakDeps = img.InstallWeakDeps
+
+	imgPipeline := manifest.NewExtensionImage(buildPipeline, treePipeline)
+	imgPipeline.RootfsType = img.RootfsType
+	imgPipeline.RootfsCompression = img.RootfsCompression
+	imgPipeline.ErofsOptions = img.ErofsOptions
+
+	if !img.Verity {
+		imgPipeline.SetFilename(img.filename)
+		return imgPipeline.Export(), nil
+	}
+
+	imgPipeline.SetFilename(img.extensionName() + ".img")
+	pt, err := disk.NewVerityImagePartitionTable(imgPipeline.Filename(), img.platform.GetArch(), rng)
+	if err != nil {
+		return nil, err
+	}
+	verityPipeline := manifest.NewExtensionVerityImage(buildPipeline, imgPipeline, pt)
+	verityPipeline.SetFilename(img.filename)
+
+	return verityPipeline.Export(), nil
+}
@@ -74,6 +74,10 @@ func GetInline(p Pipeline) []string {
 	return p.getInline()
 }
 
+func FileRefs(p Pipeline) ([]string, error) {
+	return p.fileRefs()
+}
+
 func (p *OS) Serialize() (osbuild.Pipeline, error) {
 	repo := rpmmd.RepoConfig{Id: "dummy-repo-id"}
 	transaction := depsolvednf.TransactionList{
@@ -105,3 +109,11 @@ func (p *OS) Serialize() (osbuild.Pipeline, error) {
 	}
 	return p.serialize()
 }
+
+func (p *ExtensionTree) GetPackageSetChain(d Distro) ([]rpmmd.PackageSet, error) {
+	return p.getPackageSetChain(d)
+}
+
+func (p *ExtensionTree) GetPackageSpecs() rpmmd.PackageList {
+	return p.getPackageSpecs()
+}
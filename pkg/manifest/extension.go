@@ -0,0 +1,218 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/artifact"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// sysextExcludePaths are the paths of the tree that are not part of system
+// extensions, which can only extend /usr and /opt
+var sysextExcludePaths = []string{
+	"boot/.*",
+	"etc/.*",
+	"run/.*",
+	"tmp/.*",
+	"var/.*",
+	"usr/lib/sysimage/.*",
+}
+
+// confextExcludePaths are the paths of the tree that are not part of
+// configuration extensions, which can only extend /etc
+var confextExcludePaths = []string{
+	"boot/.*",
+	"opt/.*",
+	"run/.*",
+	"tmp/.*",
+	"usr/.*",
+	"var/.*",
+}
+
+// An ExtensionImage is the read-only filesystem image of a systemd extension,
+// which systemd-sysext and systemd-confext can merge as is.
+type ExtensionImage struct {
+	Base
+	filename string
+
+	// Filesystem of the image, either SquashfsRootfs or ErofsRootfs
+	RootfsType ISORootfsType
+	// Compression method of the filesystem, defaults to "zstd" for erofs
+	// and "xz" for squashfs
+	RootfsCompression string
+	// Options for the erofs filesystem, the filename, the excluded paths
+	// and the compression method are set by the pipeline
+	ErofsOptions *osbuild.ErofsStageOptions
+
+	treePipeline *ExtensionTree
+}
+
+func (p ExtensionImage) Filename() string {
+	return p.filename
+}
+
+func (p *ExtensionImage) SetFilename(filename string) {
+	p.filename = filename
+}
+
+// NewExtensionImage creates a pipeline that builds an erofs or squashfs image from the
+// extension tree.
+func NewExtensionImage(buildPipeline Build, treePipeline *ExtensionTree) *ExtensionImage {
+	p := &ExtensionImage{
+		Base:         NewBase("extension", buildPipeline),
+		filename:     "extension.raw",
+		RootfsType:   ErofsRootfs,
+		treePipeline: treePipeline,
+	}
+	buildPipeline.addDependent(p)
+	return p
+}
+
+func (p *ExtensionImage) getBuildPackages(Distro) ([]string, error) {
+	switch p.RootfsType {
+	case ErofsRootfs:
+		return []string{"erofs-utils"}, nil
+	default:
+		return []string{"squashfs-tools"}, nil
+	}
+}
+
+func (p *ExtensionImage) excludePaths() []string {
+	switch p.treePipeline.Type {
+	case ConfextExtension:
+		return confextExcludePaths
+	default:
+		return sysextExcludePaths
+	}
+}
+
+func (p *ExtensionImage) serialize() (osbuild.Pipeline, error) {
+	pipeline, err := p.Base.serialize()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+
+	switch p.RootfsType {
+	case ErofsRootfs:
+		var erofsOptions osbuild.ErofsStageOptions
+		if p.ErofsOptions != nil {
+			erofsOptions = *p.ErofsOptions
+		}
+		erofsOptions.Filename = p.Filename()
+		if p.RootfsCompression != "" {
+			erofsOptions.Compression = &osbuild.ErofsCompression{Method: p.RootfsCompression}
+		} else if erofsOptions.Compression == nil {
+			// default to zstd if not specified
+			erofsOptions.Compression = &osbuild.ErofsCompression{Method: "zstd"}
+		}
+		erofsOptions.ExcludePaths = p.excludePaths()
+		pipeline.AddStage(osbuild.NewErofsStage(erofsOptions, p.treePipeline.Name()))
+	case SquashfsRootfs:
+		squashfsOptions := osbuild.SquashfsStageOptions{
+			Filename:     p.Filename(),
+			ExcludePaths: p.excludePaths(),
+		}
+		if p.RootfsCompression != "" {
+			squashfsOptions.Compression.Method = p.RootfsCompression
+		} else {
+			// default to xz if not specified
+			squashfsOptions.Compression.Method = "xz"
+		}
+		if squashfsOptions.Compression.Method == "xz" {
+			squashfsOptions.Compression.Options = &osbuild.FSCompressionOptions{
+				BCJ: osbuild.BCJOption(p.treePipeline.platform.GetArch().String()),
+			}
+		}
+		pipeline.AddStage(osbuild.NewSquashfsStage(&squashfsOptions, p.treePipeline.Name()))
+	default:
+		return osbuild.Pipeline{}, fmt.Errorf("unsupported filesystem for extension images: %v", p.RootfsType)
+	}
+
+	return pipeline, nil
+}
+
+func (p *ExtensionImage) Export() *artifact.Artifact {
+	p.Base.export = true
+	mimeType := "application/octet-stream"
+	return artifact.New(p.Name(), p.Filename(), &mimeType)
+}
+
+// extensionDataMargin is added to the installed size of the extension
+// packages when sizing the data partition of a verity protected extension
+// image to account for the filesystem metadata.
+const extensionDataMargin = 16 * datasizes.MiB
+
+// An ExtensionVerityImage is a discoverable disk image that contains the
+// filesystem image of an extension together with its dm-verity hash tree.
+// The root hash is written next to the image with a .roothash suffix, where
+// systemd-sysext and systemd-confext look for it.
+type ExtensionVerityImage struct {
+	Base
+	filename string
+
+	// PartitionTable of the image, created with
+	// disk.NewVerityImagePartitionTable. The partitions are sized during
+	// serialization from the installed size of the extension packages.
+	PartitionTable *disk.PartitionTable
+
+	imgPipeline *ExtensionImage
+}
+
+func (p ExtensionVerityImage) Filename() string {
+	return p.filename
+}
+
+func (p *ExtensionVerityImage) SetFilename(filename string) {
+	p.filename = filename
+}
+
+// NewExtensionVerityImage creates a pipeline that writes the filesystem image
+// of imgPipeline into the data partition of pt and computes the hash tree.
+func NewExtensionVerityImage(buildPipeline Build, imgPipeline *ExtensionImage, pt *disk.PartitionTable) *ExtensionVerityImage {
+	p := &ExtensionVerityImage{
+		Base:           NewBase("extension-verity", buildPipeline),
+		filename:       "extension.raw",
+		PartitionTable: pt,
+		imgPipeline:    imgPipeline,
+	}
+	buildPipeline.addDependent(p)
+	return p
+}
+
+func (p *ExtensionVerityImage) getBuildPackages(Distro) ([]string, error) {
+	return p.PartitionTable.GetBuildPackages(), nil
+}
+
+func (p *ExtensionVerityImage) serialize() (osbuild.Pipeline, error) {
+	pipeline, err := p.Base.serialize()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	if p.PartitionTable == nil {
+		return osbuild.Pipeline{}, fmt.Errorf("ExtensionVerityImage: partition table is required")
+	}
+
+	// the filesystem image is compressed, the installed size of the
+	// packages is an upper bound for its size
+	pt := p.PartitionTable.Clone().(*disk.PartitionTable)
+	if err := pt.SetVerityImageDataSize(p.imgPipeline.treePipeline.installSize() + extensionDataMargin); err != nil {
+		return osbuild.Pipeline{}, err
+	}
+
+	pipeline.AddStages(osbuild.GenImagePrepareStages(pt, p.Filename(), osbuild.PTSfdisk, p.imgPipeline.Name())...)
+	verityStage, err := osbuild.GenVerityImageStage(pt, p.Filename())
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStage(verityStage)
+
+	return pipeline, nil
+}
+
+func (p *ExtensionVerityImage) Export() *artifact.Artifact {
+	p.Base.export = true
+	mimeType := "application/octet-stream"
+	return artifact.New(p.Name(), p.Filename(), &mimeType)
+}
@@ -0,0 +1,172 @@
+package manifest_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/rpmmd"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func newTestExtensionTree(extType manifest.ExtensionType) *manifest.ExtensionTree {
+	mani := manifest.New()
+	build := manifest.NewBuild(&mani, &runner.Fedora{Version: 42}, nil, nil)
+	tree := manifest.NewExtensionTree(build, &platform.Data{Arch: arch.ARCH_X86_64}, nil)
+	tree.Type = extType
+	tree.ExtensionName = "tools"
+	tree.OSReleaseID = "fedora"
+	tree.OSReleaseVersionID = "42"
+	tree.BasePackages = []string{"@core"}
+	tree.Packages = []string{"strace"}
+	return tree
+}
+
+func testExtensionInputs() manifest.Inputs {
+	repo := rpmmd.RepoConfig{Id: "dummy-repo-id"}
+	return manifest.Inputs{
+		Depsolved: depsolvednf.DepsolveResult{
+			Transactions: depsolvednf.TransactionList{
+				{
+					{
+						Name:        "glibc",
+						Checksum:    rpmmd.Checksum{Type: "sha256", Value: "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"},
+						RepoID:      repo.Id,
+						Repo:        &repo,
+						InstallSize: 6 * datasizes.MiB,
+					},
+				},
+				{
+					{
+						Name:        "strace",
+						Checksum:    rpmmd.Checksum{Type: "sha256", Value: "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+						RepoID:      repo.Id,
+						Repo:        &repo,
+						InstallSize: 3 * datasizes.MiB,
+					},
+				},
+			},
+			Repos: []rpmmd.RepoConfig{repo},
+		},
+	}
+}
+
+func TestExtensionTreePackageSetChain(t *testing.T) {
+	tree := newTestExtensionTree(manifest.SysextExtension)
+	tree.ExcludePackages = []string{"strace-doc"}
+
+	chain, err := tree.GetPackageSetChain(manifest.DISTRO_FEDORA)
+	require.NoError(t, err)
+	require.Len(t, chain, 2)
+	assert.Equal(t, []string{"@core"}, chain[0].Include)
+	assert.Equal(t, []string{"strace"}, chain[1].Include)
+	assert.Equal(t, []string{"strace-doc"}, chain[1].Exclude)
+
+	tree.BasePackages = nil
+	_, err = tree.GetPackageSetChain(manifest.DISTRO_FEDORA)
+	assert.EqualError(t, err, `extension "tools" requires the packages of the base image`)
+}
+
+func TestExtensionTreeSerialize(t *testing.T) {
+	for _, tc := range []struct {
+		extType      manifest.ExtensionType
+		expectedPath string
+	}{
+		{manifest.SysextExtension, "tree:///usr/lib/extension-release.d/extension-release.tools"},
+		{manifest.ConfextExtension, "tree:///etc/extension-release.d/extension-release.tools"},
+	} {
+		t.Run(tc.extType.String(), func(t *testing.T) {
+			tree := newTestExtensionTree(tc.extType)
+
+			pipeline, err := manifest.SerializeWith(tree, testExtensionInputs())
+			require.NoError(t, err)
+
+			// only the packages that are not part of the base image are
+			// installed
+			rpmStages := findStages("org.osbuild.rpm", pipeline.Stages)
+			require.Len(t, rpmStages, 1)
+			assert.True(t, rpmStages[0].Options.(*osbuild.RPMStageOptions).DisableDracut)
+			specs := tree.GetPackageSpecs()
+			require.Len(t, specs, 1)
+			assert.Equal(t, "strace", specs[0].Name)
+
+			copyStage := findStage("org.osbuild.copy", pipeline.Stages)
+			require.NotNil(t, copyStage)
+			paths := copyStage.Options.(*osbuild.CopyStageOptions).Paths
+			require.Len(t, paths, 1)
+			assert.Equal(t, tc.expectedPath, paths[0].To)
+			assert.Equal(t, []string{"ID=fedora\nVERSION_ID=42\nARCHITECTURE=x86-64\n"}, manifest.GetInline(tree))
+		})
+	}
+}
+
+func TestExtensionImageSerialize(t *testing.T) {
+	tree := newTestExtensionTree(manifest.ConfextExtension)
+	img := manifest.NewExtensionImage(tree.BuildPipeline(), tree)
+	img.SetFilename("tools.raw")
+
+	pipeline, err := manifest.Serialize(img)
+	require.NoError(t, err)
+	require.Len(t, pipeline.Stages, 1)
+	assert.Equal(t, "org.osbuild.erofs", pipeline.Stages[0].Type)
+	erofsOptions := pipeline.Stages[0].Options.(*osbuild.ErofsStageOptions)
+	assert.Equal(t, "tools.raw", erofsOptions.Filename)
+	assert.Equal(t, "zstd", erofsOptions.Compression.Method)
+	assert.Contains(t, erofsOptions.ExcludePaths, "usr/.*")
+
+	img.RootfsType = manifest.SquashfsRootfs
+	pipeline, err = manifest.Serialize(img)
+	require.NoError(t, err)
+	require.Len(t, pipeline.Stages, 1)
+	assert.Equal(t, "org.osbuild.squashfs", pipeline.Stages[0].Type)
+	squashfsOptions := pipeline.Stages[0].Options.(*osbuild.SquashfsStageOptions)
+	assert.Equal(t, "tools.raw", squashfsOptions.Filename)
+	assert.Equal(t, osbuild.FSCompression{Method: "xz", Options: &osbuild.FSCompressionOptions{BCJ: "x86"}}, squashfsOptions.Compression)
+
+	img.RootfsType = manifest.SquashfsExt4Rootfs
+	_, err = manifest.Serialize(img)
+	assert.EqualError(t, err, "unsupported filesystem for extension images: 0")
+}
+
+func TestExtensionVerityImageSerialize(t *testing.T) {
+	tree := newTestExtensionTree(manifest.SysextExtension)
+	img := manifest.NewExtensionImage(tree.BuildPipeline(), tree)
+	img.SetFilename("tools.erofs")
+
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+	pt, err := disk.NewVerityImagePartitionTable(img.Filename(), arch.ARCH_X86_64, rng)
+	require.NoError(t, err)
+	ddi := manifest.NewExtensionVerityImage(tree.BuildPipeline(), img, pt)
+	ddi.SetFilename("tools.raw")
+
+	// the partitions are sized from the packages of the extension tree
+	_, err = manifest.SerializeWith(tree, testExtensionInputs())
+	require.NoError(t, err)
+	pipeline, err := manifest.Serialize(ddi)
+	require.NoError(t, err)
+
+	truncateStage := findStage("org.osbuild.truncate", pipeline.Stages)
+	require.NotNil(t, truncateStage)
+	// 1 MiB header, 3 MiB of packages + 16 MiB margin, 1 MiB hash tree
+	assert.Equal(t, "22020096", truncateStage.Options.(*osbuild.TruncateStageOptions).Size)
+
+	writeStage := findStage("org.osbuild.write-device", pipeline.Stages)
+	require.NotNil(t, writeStage)
+	assert.Equal(t, "input://tree/tools.erofs", writeStage.Options.(*osbuild.WriteDeviceStageOptions).From)
+
+	verityStage := findStage("org.osbuild.dmverity", pipeline.Stages)
+	require.NotNil(t, verityStage)
+	assert.Equal(t, "/tools.raw.roothash", verityStage.Options.(*osbuild.DMVerityStageOptions).RootHash)
+	// the partition table of the pipeline is not modified
+	assert.Equal(t, datasizes.Size(0), ddi.PartitionTable.Size)
+}
@@ -0,0 +1,276 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+type ExtensionType uint64
+
+// These constants select the kind of systemd extension image, see
+// systemd-sysext(8)
+const ( // Extension type enum
+	SysextExtension  ExtensionType = iota // Extends /usr and /opt
+	ConfextExtension                      // Extends /etc
+)
+
+func (t ExtensionType) String() string {
+	switch t {
+	case SysextExtension:
+		return "sysext"
+	case ConfextExtension:
+		return "confext"
+	default:
+		panic(fmt.Sprintf("unknown ExtensionType: %d", t))
+	}
+}
+
+func (t *ExtensionType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	switch s {
+	case "sysext", "":
+		*t = SysextExtension
+	case "confext":
+		*t = ConfextExtension
+	default:
+		return fmt.Errorf("unknown ExtensionType: %q", s)
+	}
+
+	return nil
+}
+
+func (t *ExtensionType) UnmarshalYAML(unmarshal func(any) error) error {
+	return common.UnmarshalYAMLviaJSON(t, unmarshal)
+}
+
+// systemdArchNames are the architecture identifiers used by systemd, e.g. in
+// the ARCHITECTURE= field of the extension-release file
+var systemdArchNames = map[arch.Arch]string{
+	arch.ARCH_X86_64:  "x86-64",
+	arch.ARCH_AARCH64: "arm64",
+	arch.ARCH_PPC64LE: "ppc64-le",
+	arch.ARCH_S390X:   "s390x",
+	arch.ARCH_RISCV64: "riscv64",
+	arch.ARCH_ARM:     "arm",
+}
+
+// An ExtensionTree is the file system tree of a systemd system or
+// configuration extension. The extension packages are depsolved on top of
+// the packages of the base image the extension is meant for and only the
+// packages that are not part of the base image are installed.
+//
+// The packages are installed into an otherwise empty tree, so their
+// scriptlets run without the base image. Packages that rely on scriptlets to
+// set themselves up are not suitable for extensions.
+type ExtensionTree struct {
+	Base
+
+	Type ExtensionType
+
+	// Name of the extension, used for the name of the extension-release
+	// file. systemd requires it to match the name of the image file
+	// without the .raw suffix.
+	ExtensionName string
+
+	// ID and VERSION_ID of the os-release of the base image. The extension
+	// can only be merged on systems that match them.
+	OSReleaseID        string
+	OSReleaseVersionID string
+
+	// Packages of the base image. They are only used for depsolving and
+	// are not part of the extension.
+	BasePackages        []string
+	ExcludeBasePackages []string
+
+	// Packages of the extension
+	Packages        []string
+	ExcludePackages []string
+
+	// Repositories that only apply to the extension packages
+	PayloadRepos []rpmmd.RepoConfig
+
+	InstallWeakDeps bool
+	RPMKeysBinary   string
+
+	platform platform.Platform
+	// depsolveRepos holds the repository configuration used by
+	// getPackageSetChain() for depsolving. After depsolving, use
+	// depsolveResult.Repos which contains only repos that provided packages.
+	depsolveRepos  []rpmmd.RepoConfig
+	depsolveResult *depsolvednf.DepsolveResult
+	inlineData     []string
+}
+
+// NewExtensionTree creates a new extension tree pipeline. The base and the
+// extension packages are depsolved from repos.
+func NewExtensionTree(buildPipeline Build, platform platform.Platform, repos []rpmmd.RepoConfig) *ExtensionTree {
+	name := "extension-tree"
+	p := &ExtensionTree{
+		Base:          NewBase(name, buildPipeline),
+		platform:      platform,
+		depsolveRepos: filterRepos(repos, name),
+	}
+	buildPipeline.addDependent(p)
+	return p
+}
+
+func (p *ExtensionTree) getPackageSetChain(Distro) ([]rpmmd.PackageSet, error) {
+	if len(p.BasePackages) == 0 {
+		return nil, fmt.Errorf("extension %q requires the packages of the base image", p.ExtensionName)
+	}
+	return []rpmmd.PackageSet{
+		{
+			Include:         p.BasePackages,
+			Exclude:         p.ExcludeBasePackages,
+			Repositories:    p.depsolveRepos,
+			InstallWeakDeps: p.InstallWeakDeps,
+		},
+		{
+			Include:         p.Packages,
+			Exclude:         p.ExcludePackages,
+			Repositories:    slices.Concat(p.depsolveRepos, p.PayloadRepos),
+			InstallWeakDeps: p.InstallWeakDeps,
+		},
+	}, nil
+}
+
+func (p *ExtensionTree) getBuildPackages(Distro) ([]string, error) {
+	return []string{"rpm"}, nil
+}
+
+// extensionTransactions returns the transaction of the extension packages,
+// i.e. the last element of the depsolved chain.
+func (p *ExtensionTree) extensionTransactions() depsolvednf.TransactionList {
+	if p.depsolveResult == nil || len(p.depsolveResult.Transactions) == 0 {
+		return nil
+	}
+	transactions := p.depsolveResult.Transactions
+	return transactions[len(transactions)-1:]
+}
+
+func (p *ExtensionTree) getPackageSpecs() rpmmd.PackageList {
+	return p.extensionTransactions().AllPackages()
+}
+
+// installSize returns the sum of the installed sizes of the extension
+// packages.
+func (p *ExtensionTree) installSize() datasizes.Size {
+	var size uint64
+	for _, pkg := range p.getPackageSpecs() {
+		size += pkg.InstallSize
+	}
+	return datasizes.Size(size)
+}
+
+func (p *ExtensionTree) getInline() []string {
+	return p.inlineData
+}
+
+func (p *ExtensionTree) serializeStart(inputs Inputs) error {
+	if p.depsolveResult != nil {
+		return errors.New("ExtensionTree: double call to serializeStart()")
+	}
+	p.depsolveResult = &inputs.Depsolved
+	return nil
+}
+
+func (p *ExtensionTree) serializeEnd() {
+	if p.depsolveResult == nil {
+		panic("serializeEnd() call when serialization not in progress")
+	}
+	p.depsolveResult = nil
+}
+
+// extensionReleasePath returns the path of the extension-release file in the
+// tree, see os-release(5)
+func (p *ExtensionTree) extensionReleasePath() string {
+	switch p.Type {
+	case ConfextExtension:
+		return filepath.Join("/etc/extension-release.d", "extension-release."+p.ExtensionName)
+	default:
+		return filepath.Join("/usr/lib/extension-release.d", "extension-release."+p.ExtensionName)
+	}
+}
+
+func (p *ExtensionTree) extensionRelease() ([]byte, error) {
+	if p.OSReleaseID == "" {
+		return nil, fmt.Errorf("extension %q requires the os-release ID of the base image", p.ExtensionName)
+	}
+	lines := []string{
+		"ID=" + p.OSReleaseID,
+	}
+	if p.OSReleaseVersionID != "" {
+		lines = append(lines, "VERSION_ID="+p.OSReleaseVersionID)
+	}
+	if archName, ok := systemdArchNames[p.platform.GetArch()]; ok {
+		lines = append(lines, "ARCHITECTURE="+archName)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+func (p *ExtensionTree) serialize() (osbuild.Pipeline, error) {
+	if p.depsolveResult == nil {
+		return osbuild.Pipeline{}, fmt.Errorf("ExtensionTree: serialization not started")
+	}
+	if p.ExtensionName == "" {
+		return osbuild.Pipeline{}, fmt.Errorf("ExtensionTree: extension name is required")
+	}
+	pipeline, err := p.Base.serialize()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+
+	baseOptions := osbuild.RPMStageOptions{
+		DisableDracut: true,
+	}
+	if p.RPMKeysBinary != "" {
+		baseOptions.RPMKeys = &osbuild.RPMKeys{
+			BinPath: p.RPMKeysBinary,
+		}
+	}
+	rpmStages, err := osbuild.GenRPMStagesFromTransactions(p.extensionTransactions(), &baseOptions)
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStages(rpmStages...)
+
+	releasePath := p.extensionReleasePath()
+	releaseDir, err := fsnode.NewDirectory(filepath.Dir(releasePath), nil, nil, nil, true)
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStages(osbuild.GenDirectoryNodesStages([]*fsnode.Directory{releaseDir})...)
+
+	data, err := p.extensionRelease()
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	releaseFile, err := fsnode.NewFile(releasePath, nil, nil, nil, data)
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStages(osbuild.GenFileNodesStages([]*fsnode.File{releaseFile})...)
+	p.inlineData = []string{string(releaseFile.Data())}
+
+	return pipeline, nil
+}
+
+func (p *ExtensionTree) Platform() platform.Platform {
+	return p.platform
+}
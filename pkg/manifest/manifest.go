@@ -19,6 +19,7 @@ import (
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/ostree"
 	"github.com/osbuild/images/pkg/rpmmd"
@@ -182,6 +183,55 @@ func (m Manifest) GetOSTreeSourceSpecs() map[string][]ostree.SourceSpec {
 	return ostreeSpecs
 }
 
+// TreePartitionTable is the partition table that the tree of a pipeline is
+// installed on
+type TreePartitionTable struct {
+	Pipeline       string
+	PartitionTable *disk.PartitionTable
+	// AdditionalDisks hold the filesystems of the tree that are not on
+	// PartitionTable, see OS.AdditionalDisks
+	AdditionalDisks []disk.Disk
+	// ContainersStorage is the custom location of the containers-storage
+	// in the tree, empty for the default location
+	ContainersStorage string
+}
+
+// GetTreePartitionTables returns the partition tables of the OS trees of the
+// manifest together with the partition tables of their additional disks.
+// The partition tables are shared with the pipelines that create the disk
+// images, changes to them are part of the serialized manifest.
+func (m Manifest) GetTreePartitionTables() []TreePartitionTable {
+	var pts []TreePartitionTable
+	for _, pipeline := range m.pipelines {
+		osPipeline, ok := pipeline.(*OS)
+		if !ok || osPipeline.PartitionTable == nil {
+			continue
+		}
+		tpt := TreePartitionTable{
+			Pipeline:        osPipeline.Name(),
+			PartitionTable:  osPipeline.PartitionTable,
+			AdditionalDisks: osPipeline.AdditionalDisks,
+		}
+		if osPipeline.OSCustomizations.ContainersStorage != nil {
+			tpt.ContainersStorage = *osPipeline.OSCustomizations.ContainersStorage
+		}
+		pts = append(pts, tpt)
+	}
+	return pts
+}
+
+// sourceEpoch returns the SOURCE_DATE_EPOCH of the OS trees of the manifest,
+// see OSCustomizations.SourceDateEpoch. It applies to all pipelines, the
+// artifacts created from a tree need the same timestamps as the tree.
+func (m Manifest) sourceEpoch() *int64 {
+	for _, pipeline := range m.pipelines {
+		if osPipeline, ok := pipeline.(*OS); ok && osPipeline.OSCustomizations.SourceDateEpoch != nil {
+			return osPipeline.OSCustomizations.SourceDateEpoch
+		}
+	}
+	return nil
+}
+
 type SerializeOptions struct {
 	RpmDownloader osbuild.RpmDownloader
 }
@@ -202,6 +252,7 @@ func (m Manifest) Serialize(depsolvedSets map[string]depsolvednf.DepsolveResult,
 		}
 	}
 
+	sourceEpoch := m.sourceEpoch()
 	var osbuildPipelines []osbuild.Pipeline
 	var mergedInputs osbuild.SourceInputs
 	for _, pipeline := range m.pipelines {
@@ -209,6 +260,7 @@ func (m Manifest) Serialize(depsolvedSets map[string]depsolvednf.DepsolveResult,
 		if err != nil {
 			return nil, fmt.Errorf("cannot serialize pipeline %q: %w", pipeline.Name(), err)
 		}
+		osbuildPipeline.SourceEpoch = sourceEpoch
 		osbuildPipelines = append(osbuildPipelines, osbuildPipeline)
 		mergedInputs.Commits = append(mergedInputs.Commits, pipeline.getOSTreeCommits()...)
 		mergedInputs.Depsolved.Transactions = append(mergedInputs.Depsolved.Transactions, depsolvedSets[pipeline.Name()].Transactions...)
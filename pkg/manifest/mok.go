@@ -0,0 +1,80 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/customizations/mok"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/shutil"
+)
+
+const (
+	mokFirstBootService = "osbuild-mok-first-boot.service"
+
+	// mokFirstBootFlag is removed by the first-boot service after it
+	// ran so that the requests are only made once
+	mokFirstBootFlag = "/etc/osbuild-mok-first-boot"
+)
+
+// mokFiles returns the files the first-boot service needs: its flag
+// file and the certificate that is enrolled as a machine owner key. The
+// certificate is copied from the host that runs osbuild through a "file:"
+// source, like blueprint files with an URI, so it does not end up in the
+// manifest.
+func mokFiles(options *mok.ImageOptions) ([]*fsnode.File, error) {
+	flag, err := fsnode.NewFile(mokFirstBootFlag, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	files := []*fsnode.File{flag}
+	if options.EnrollMOK {
+		cert, err := fsnode.NewFileForURI(mok.CertificatePath, common.ToPtr(os.FileMode(0644)), nil, nil, "file://"+options.CertPath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, cert)
+	}
+	return files, nil
+}
+
+// mokFirstBootServiceStage creates a first-boot service that requests
+// the enrollment of the certificate as a machine owner key and sets the SBAT
+// policy of shim. Both requests are applied by shim on the next boot, the
+// enrollment is confirmed in shim's MokManager with the root password.
+func mokFirstBootServiceStage(options *mok.ImageOptions) *osbuild.Stage {
+	var execStart []string
+	if options.EnrollMOK {
+		certPath := shutil.Quote(mok.CertificatePath)
+		execStart = append(execStart,
+			fmt.Sprintf("/usr/bin/mokutil --import %s --root-pw", certPath),
+			fmt.Sprintf("/usr/bin/rm %s", certPath),
+		)
+	}
+	if options.SBATPolicy != "" {
+		execStart = append(execStart, fmt.Sprintf("/usr/bin/mokutil --set-sbat-policy %s", options.SBATPolicy))
+	}
+	execStart = append(execStart, fmt.Sprintf("/usr/bin/rm %s", shutil.Quote(mokFirstBootFlag)))
+
+	stageOptions := &osbuild.SystemdUnitCreateStageOptions{
+		Filename: mokFirstBootService,
+		UnitType: "system",
+		UnitPath: osbuild.EtcUnitPath,
+		Config: osbuild.SystemdUnit{
+			Unit: &osbuild.UnitSection{
+				Description:         "First-boot service for requesting the machine owner key enrollment and SBAT policy of shim",
+				ConditionPathExists: []string{mokFirstBootFlag},
+			},
+			Service: &osbuild.ServiceSection{
+				Type:      osbuild.OneshotServiceType,
+				ExecStart: execStart,
+			},
+			Install: &osbuild.InstallSection{
+				WantedBy: []string{"default.target"},
+			},
+		},
+	}
+	return osbuild.NewSystemdUnitCreateStage(stageOptions)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/osbuild/images/pkg/customizations/bootc"
 	"github.com/osbuild/images/pkg/customizations/fsnode"
 	"github.com/osbuild/images/pkg/customizations/ignition"
+	"github.com/osbuild/images/pkg/customizations/mok"
 	"github.com/osbuild/images/pkg/customizations/oscap"
 	"github.com/osbuild/images/pkg/customizations/shell"
 	"github.com/osbuild/images/pkg/customizations/subscription"
@@ -163,6 +164,10 @@ type OSCustomizations struct {
 	RHSMConfig *subscription.RHSMConfig
 	RHSMFacts  *facts.ImageOptions
 
+	// Machine owner key enrollment and SBAT policy of shim that are
+	// requested on the first boot
+	MOK *mok.ImageOptions
+
 	// Custom directories to create in the image. The stages for the
 	// directories defined here are always added at the end of the pipeline.
 	Directories []*fsnode.Directory
@@ -188,6 +193,11 @@ type OSCustomizations struct {
 	// "ConditionFirstBoot" to work in systemd
 	MachineIdUninitialized bool
 
+	// SourceDateEpoch makes the build reproducible when set: osbuild clamps
+	// the timestamps of the tree and of all artifacts created from it to
+	// this UNIX timestamp and no machine-id is generated during the build.
+	SourceDateEpoch *int64
+
 	// VersionlockPackges uses dnf versionlock to lock a package to the version
 	// that is installed during image build, preventing it from being updated.
 	// This is only supported for distributions that use dnf4, because osbuild
@@ -199,6 +209,10 @@ type OSCustomizations struct {
 
 	// Use this RPMKeysBinary from the tree instead of the default one
 	RPMKeysBinary string
+
+	// Directory that receives the systemd-repart definitions of the
+	// partition table of the image
+	RepartDefinitionsDir string
 }
 
 // OS represents the filesystem tree of the target image. This roughly
@@ -230,6 +244,9 @@ type OS struct {
 
 	// Partition table, if nil the tree cannot be put on a partitioned disk
 	PartitionTable *disk.PartitionTable
+	// AdditionalDisks hold the filesystems that are not on the boot disk
+	// described by PartitionTable, e.g. /var/lib/data on a second disk
+	AdditionalDisks []disk.Disk
 
 	// content-related fields
 
@@ -277,6 +294,9 @@ func (p *OS) getPackageSetChain(Distro) ([]rpmmd.PackageSet, error) {
 	if p.PartitionTable != nil {
 		partitionTablePackages = p.PartitionTable.GetBuildPackages()
 	}
+	for _, d := range p.AdditionalDisks {
+		partitionTablePackages = append(partitionTablePackages, d.PartitionTable.GetBuildPackages()...)
+	}
 
 	if p.OSCustomizations.KernelName != "" {
 		// kernel is considered part of the platform package set
@@ -329,6 +349,10 @@ func (p *OS) getPackageSetChain(Distro) ([]rpmmd.PackageSet, error) {
 		customizationPackages = append(customizationPackages, "dnf", "python3-dnf-plugin-versionlock")
 	}
 
+	if p.OSCustomizations.MOK != nil {
+		customizationPackages = append(customizationPackages, "mokutil")
+	}
+
 	osRepos := slices.Concat(p.depsolveRepos, p.OSCustomizations.ExtraBaseRepos)
 
 	// merge all package lists for the pipeline
@@ -408,6 +432,9 @@ func (p *OS) getBuildPackages(distro Distro) ([]string, error) {
 	if p.PartitionTable != nil {
 		packages = append(packages, p.PartitionTable.GetBuildPackages()...)
 	}
+	for _, d := range p.AdditionalDisks {
+		packages = append(packages, d.PartitionTable.GetBuildPackages()...)
+	}
 	packages = append(packages, "rpm")
 	if p.OSTreeRef != "" {
 		packages = append(packages, "rpm-ostree")
@@ -798,12 +825,23 @@ func (p *OS) serialize() (osbuild.Pipeline, error) {
 			}))
 		}
 
-		fsCfgStages, err := filesystemConfigStages(pt, p.DiskCustomizations.MountConfiguration)
+		pts := []*disk.PartitionTable{pt}
+		for _, d := range p.AdditionalDisks {
+			pts = append(pts, d.PartitionTable)
+		}
+		fsCfgStages, err := filesystemConfigStages(p.DiskCustomizations.MountConfiguration, pts...)
 		if err != nil {
 			return osbuild.Pipeline{}, err
 		}
 		pipeline.AddStages(fsCfgStages...)
 
+		// the LUKS containers of the boot disk are unlocked with the
+		// luks.uuid kernel options, the ones of additional disks need
+		// crypttab entries
+		if opts := osbuild.NewCrypttabStageOptions(pts[1:]...); opts != nil {
+			pipeline.AddStage(osbuild.NewCrypttabStage(opts))
+		}
+
 		switch p.platform.GetBootloader() {
 		case platform.BOOTLOADER_GRUB2:
 			pipeline.AddStage(grubStage(p, pt, kernelOptions))
@@ -905,10 +943,46 @@ func (p *OS) serialize() (osbuild.Pipeline, error) {
 		p.addStagesForAllFilesAndInlineData(&pipeline, p.OSCustomizations.Files)
 	}
 
+	if p.OSCustomizations.RepartDefinitionsDir != "" && p.PartitionTable != nil {
+		repartDir, repartFiles, err := repartDefinitionNodes(p.PartitionTable, p.OSCustomizations.RepartDefinitionsDir)
+		if err != nil {
+			return osbuild.Pipeline{}, err
+		}
+		pipeline.AddStages(osbuild.GenDirectoryNodesStages([]*fsnode.Directory{repartDir})...)
+		p.addStagesForAllFilesAndInlineData(&pipeline, repartFiles)
+	}
+
 	enabledServices := []string{}
 	disabledServices := []string{}
 	maskedServices := []string{}
 	enabledServices = append(enabledServices, p.OSCustomizations.EnabledServices...)
+
+	if mokOptions := p.OSCustomizations.MOK; mokOptions != nil {
+		if mokOptions.EnrollMOK {
+			certDir, err := fsnode.NewDirectory(filepath.Dir(mok.CertificatePath), nil, nil, nil, true)
+			if err != nil {
+				return osbuild.Pipeline{}, err
+			}
+			pipeline.AddStages(osbuild.GenDirectoryNodesStages([]*fsnode.Directory{certDir})...)
+		}
+		files, err := mokFiles(mokOptions)
+		if err != nil {
+			return osbuild.Pipeline{}, err
+		}
+		p.addStagesForAllFilesAndInlineData(&pipeline, files)
+		pipeline.AddStage(mokFirstBootServiceStage(mokOptions))
+		enabledServices = append(enabledServices, mokFirstBootService)
+	}
+
+	if disks := extendedVolumeGroups(p.AdditionalDisks); len(disks) > 0 {
+		vgFiles, err := extendVolumeGroupsFiles()
+		if err != nil {
+			return osbuild.Pipeline{}, err
+		}
+		p.addStagesForAllFilesAndInlineData(&pipeline, vgFiles)
+		pipeline.AddStage(extendVolumeGroupsServiceStage(disks))
+		enabledServices = append(enabledServices, extendVolumeGroupsService)
+	}
 	disabledServices = append(disabledServices, p.OSCustomizations.DisabledServices...)
 	maskedServices = append(maskedServices, p.OSCustomizations.MaskedServices...)
 	if p.Environment != nil {
@@ -996,6 +1070,12 @@ func (p *OS) serialize() (osbuild.Pipeline, error) {
 		pipeline.AddStage(osbuild.NewMachineIdStage(&osbuild.MachineIdStageOptions{
 			FirstBoot: osbuild.MachineIdFirstBootYes,
 		}))
+	} else if p.OSCustomizations.SourceDateEpoch != nil {
+		// a machine-id generated during the build would differ between
+		// otherwise identical builds, leave it empty instead
+		pipeline.AddStage(osbuild.NewMachineIdStage(&osbuild.MachineIdStageOptions{
+			FirstBoot: osbuild.MachineIdFirstBootNo,
+		}))
 	}
 
 	if p.OSCustomizations.SELinux != "" {
@@ -1149,14 +1229,19 @@ func ukiBootCSVfile(espMountpoint string, architecture arch.Arch, kernelVer, ven
 		return nil, fmt.Errorf("ukiBootCSVfile: UKIs are only supported for x86_64 and aarch64")
 	}
 
-	kernelFilename := fmt.Sprintf("ffffffffffffffffffffffffffffffff-%s.efi", kernelVer)
-	data := fmt.Sprintf("shim%s.efi,%s,\\EFI\\Linux\\%s ,UKI bootentry\n", shortArch, vendor, kernelFilename)
+	data := fmt.Sprintf("shim%s.efi,%s,\\EFI\\Linux\\%s ,UKI bootentry\n", shortArch, vendor, ukiFilename(kernelVer))
 
 	csvPath := filepath.Join(espMountpoint, "EFI", vendor, fmt.Sprintf("BOOT%s.CSV", strings.ToUpper(shortArch)))
 
 	return fsnode.NewFile(csvPath, nil, nil, nil, common.EncodeUTF16le(data))
 }
 
+// ukiFilename returns the filename of the UKI for the given kernel version in
+// the ESP.
+func ukiFilename(kernelVer string) string {
+	return fmt.Sprintf("ffffffffffffffffffffffffffffffff-%s.efi", kernelVer)
+}
+
 func findESPMountpoint(pt *disk.PartitionTable) (string, error) {
 	// the ESP in our images is always at /boot/efi, but let's make this more
 	// flexible and future proof by finding the ESP mountpoint from the
@@ -1210,8 +1295,7 @@ func maybeAddHMACandDirStage(packages rpmmd.PackageList, espMountpoint, kernelVe
 
 	if common.VersionLessThan(ukiDirect.Version, "25.3") {
 		// generate hmac file using stage
-		kernelFilename := fmt.Sprintf("ffffffffffffffffffffffffffffffff-%s.efi", kernelVer)
-		kernelPath := filepath.Join(espMountpoint, "EFI", "Linux", kernelFilename)
+		kernelPath := filepath.Join(espMountpoint, "EFI", "Linux", ukiFilename(kernelVer))
 		hmacStage := osbuild.NewHMACStage(&osbuild.HMACStageOptions{
 			Paths:     []string{kernelPath},
 			Algorithm: "sha512",
@@ -1255,6 +1339,28 @@ func (p *OS) addStagesForAllFilesAndInlineData(pipeline *osbuild.Pipeline, files
 	}
 }
 
+// repartDefinitionNodes returns the directory and files of the systemd-repart
+// definitions of the partition table
+func repartDefinitionNodes(pt *disk.PartitionTable, dir string) (*fsnode.Directory, []*fsnode.File, error) {
+	defs, err := pt.RepartDefinitions()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot embed repart definitions: %w", err)
+	}
+	repartDir, err := fsnode.NewDirectory(dir, nil, nil, nil, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make([]*fsnode.File, 0, len(defs))
+	for _, def := range defs {
+		file, err := fsnode.NewFile(filepath.Join(dir, def.Filename), nil, nil, nil, []byte(def.String()))
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, file)
+	}
+	return repartDir, files, nil
+}
+
 // fileRefs ensures that any files from customizations that require fetching data
 // (e.g. via the "uri" key in customizations) are added to the manifests "sources"
 //
@@ -1278,5 +1384,9 @@ func (p *OS) fileRefs() ([]string, error) {
 		}
 	}
 
+	if mokOptions := p.OSCustomizations.MOK; mokOptions != nil && mokOptions.EnrollMOK {
+		fileRefs = append(fileRefs, mokOptions.CertPath)
+	}
+
 	return fileRefs, nil
 }
@@ -2,6 +2,7 @@ package manifest_test
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -14,8 +15,10 @@ import (
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/customizations/bootc"
 	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/customizations/mok"
 	"github.com/osbuild/images/pkg/customizations/subscription"
 	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/manifest"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/platform"
@@ -254,6 +257,28 @@ func TestMachineIdUninitializedDoesNotIncludeMachineIdStage(t *testing.T) {
 	require.Nil(t, st)
 }
 
+func TestSourceDateEpochMachineId(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.OSCustomizations.SourceDateEpoch = common.ToPtr(int64(1700000000))
+
+	pipeline, err := os.Serialize()
+	assert.NoError(t, err)
+
+	st := findStage("org.osbuild.machine-id", pipeline.Stages)
+	require.NotNil(t, st)
+	assert.Equal(t, osbuild.MachineIdFirstBootNo, st.Options.(*osbuild.MachineIdStageOptions).FirstBoot)
+
+	// an explicitly uninitialized machine-id is kept
+	os = manifest.NewTestOS()
+	os.OSCustomizations.SourceDateEpoch = common.ToPtr(int64(1700000000))
+	os.OSCustomizations.MachineIdUninitialized = true
+	pipeline, err = os.Serialize()
+	assert.NoError(t, err)
+	st = findStage("org.osbuild.machine-id", pipeline.Stages)
+	require.NotNil(t, st)
+	assert.Equal(t, osbuild.MachineIdFirstBootYes, st.Options.(*osbuild.MachineIdStageOptions).FirstBoot)
+}
+
 func TestModularityIncludesConfigStage(t *testing.T) {
 	os := manifest.NewTestOS()
 
@@ -877,3 +902,210 @@ func TestOSPackageSetChainStructure(t *testing.T) {
 		})
 	}
 }
+
+func TestMOKFirstBoot(t *testing.T) {
+	certPath := filepath.Join(t.TempDir(), "db.der")
+	require.NoError(t, os.WriteFile(certPath, []byte("certificate"), 0600))
+
+	testCases := map[string]struct {
+		options           mok.ImageOptions
+		expectedExecStart []string
+		expectedCopies    []string
+		expectedFileRefs  []string
+	}{
+		"mok": {
+			options: mok.ImageOptions{EnrollMOK: true, CertPath: certPath},
+			expectedExecStart: []string{
+				"/usr/bin/mokutil --import '/etc/pki/secureboot/mok.der' --root-pw",
+				"/usr/bin/rm '/etc/pki/secureboot/mok.der'",
+				"/usr/bin/rm '/etc/osbuild-mok-first-boot'",
+			},
+			expectedCopies:   []string{"tree:///etc/osbuild-mok-first-boot", "tree:///etc/pki/secureboot/mok.der"},
+			expectedFileRefs: []string{certPath},
+		},
+		"sbat": {
+			options: mok.ImageOptions{SBATPolicy: "latest"},
+			expectedExecStart: []string{
+				"/usr/bin/mokutil --set-sbat-policy latest",
+				"/usr/bin/rm '/etc/osbuild-mok-first-boot'",
+			},
+			expectedCopies: []string{"tree:///etc/osbuild-mok-first-boot"},
+		},
+		"mok-sbat": {
+			options: mok.ImageOptions{EnrollMOK: true, CertPath: certPath, SBATPolicy: "delete"},
+			expectedExecStart: []string{
+				"/usr/bin/mokutil --import '/etc/pki/secureboot/mok.der' --root-pw",
+				"/usr/bin/rm '/etc/pki/secureboot/mok.der'",
+				"/usr/bin/mokutil --set-sbat-policy delete",
+				"/usr/bin/rm '/etc/osbuild-mok-first-boot'",
+			},
+			expectedCopies:   []string{"tree:///etc/osbuild-mok-first-boot", "tree:///etc/pki/secureboot/mok.der"},
+			expectedFileRefs: []string{certPath},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			os := manifest.NewTestOS()
+			os.OSCustomizations.MOK = &tc.options
+
+			pipeline, err := os.Serialize()
+			require.NoError(t, err)
+
+			var unit *osbuild.SystemdUnitCreateStageOptions
+			for _, stage := range findStages("org.osbuild.systemd.unit.create", pipeline.Stages) {
+				if options := stage.Options.(*osbuild.SystemdUnitCreateStageOptions); options.Filename == "osbuild-mok-first-boot.service" {
+					unit = options
+				}
+			}
+			require.NotNil(t, unit)
+			assert.Equal(t, tc.expectedExecStart, unit.Config.Service.ExecStart)
+			assert.Equal(t, []string{"/etc/osbuild-mok-first-boot"}, unit.Config.Unit.ConditionPathExists)
+			assert.Equal(t, tc.expectedCopies, collectCopyDestinationPaths(pipeline.Stages))
+
+			systemdStage := findStage("org.osbuild.systemd", pipeline.Stages)
+			require.NotNil(t, systemdStage)
+			assert.Contains(t, systemdStage.Options.(*osbuild.SystemdStageOptions).EnabledServices, "osbuild-mok-first-boot.service")
+
+			// the certificate comes from a file source and is not inlined
+			fileRefs, err := manifest.FileRefs(os)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedFileRefs, fileRefs)
+		})
+	}
+}
+
+func TestOSPipelineRepartDefinitions(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/boot/efi", "/")
+	os.OSCustomizations.RepartDefinitionsDir = "/usr/lib/repart.d"
+
+	pipeline, err := os.Serialize()
+	require.NoError(t, err)
+
+	mkdir := findStage("org.osbuild.mkdir", pipeline.Stages)
+	require.NotNil(t, mkdir)
+	assert.Equal(t, "/usr/lib/repart.d", mkdir.Options.(*osbuild.MkdirStageOptions).Paths[0].Path)
+	assert.Equal(t, []string{
+		"tree:///usr/lib/repart.d/01-boot-efi.conf",
+		"tree:///usr/lib/repart.d/02-root.conf",
+	}, collectCopyDestinationPaths(pipeline.Stages))
+	assert.Contains(t, manifest.GetInline(os), "[Partition]\nType=linux-generic\nFormat=ext4\nSizeMinBytes=827326464\n")
+
+	// systemd-repart only supports gpt
+	os = manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/")
+	os.PartitionTable.Type = disk.PT_DOS
+	os.OSCustomizations.RepartDefinitionsDir = "/usr/lib/repart.d"
+	_, err = os.Serialize()
+	assert.EqualError(t, err, `cannot embed repart definitions: systemd-repart only supports gpt partition tables, got "dos"`)
+}
+
+func TestOSPipelineAdditionalDisks(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot")
+	os.AdditionalDisks = []disk.Disk{
+		{
+			Name: "data",
+			PartitionTable: &disk.PartitionTable{
+				Type: disk.PT_GPT,
+				Partitions: []disk.Partition{
+					{
+						Payload: &disk.LUKSContainer{
+							UUID: "fb180daf-48a7-4ee0-b10d-394651850fd4",
+							Payload: &disk.Filesystem{
+								Type:       "xfs",
+								UUID:       disk.DataPartitionUUID,
+								Mountpoint: "/var/lib/data",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	buildPackages, err := os.GetBuildPackages(manifest.DISTRO_FEDORA)
+	require.NoError(t, err)
+	assert.Contains(t, buildPackages, "cryptsetup")
+
+	pipeline, err := os.Serialize()
+	require.NoError(t, err)
+
+	// the fstab covers the filesystems of all disks
+	fstab := findStage("org.osbuild.fstab", pipeline.Stages)
+	require.NotNil(t, fstab)
+	var paths []string
+	for _, fs := range fstab.Options.(*osbuild.FSTabStageOptions).FileSystems {
+		paths = append(paths, fs.Path)
+	}
+	assert.ElementsMatch(t, []string{"/", "/boot", "/var/lib/data"}, paths)
+
+	// only the LUKS container of the additional disk is in the crypttab
+	crypttab := findStage("org.osbuild.crypttab", pipeline.Stages)
+	require.NotNil(t, crypttab)
+	assert.Equal(t, &osbuild.CrypttabStageOptions{
+		Volumes: []osbuild.CrypttabEntry{
+			{
+				Volume:  "luks-fb180daf-48a7-4ee0-b10d-394651850fd4",
+				UUID:    "fb180daf-48a7-4ee0-b10d-394651850fd4",
+				Keyfile: "none",
+			},
+		},
+	}, crypttab.Options)
+}
+
+func TestOSPipelineExtendVolumeGroups(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot")
+	os.AdditionalDisks = []disk.Disk{
+		{
+			Name:        "data",
+			VolumeGroup: "rootvg",
+			PartitionTable: &disk.PartitionTable{
+				Type: disk.PT_GPT,
+				Partitions: []disk.Partition{
+					{
+						Type: disk.LVMPartitionGUID,
+						UUID: "7A3F1E4D-2B6C-4F8A-9D1E-5C3B2A1F0E9D",
+					},
+				},
+			},
+		},
+	}
+
+	pipeline, err := os.Serialize()
+	require.NoError(t, err)
+
+	var unit *osbuild.SystemdUnitCreateStageOptions
+	for _, stage := range findStages("org.osbuild.systemd.unit.create", pipeline.Stages) {
+		if options := stage.Options.(*osbuild.SystemdUnitCreateStageOptions); options.Filename == "osbuild-extend-volume-groups.service" {
+			unit = options
+		}
+	}
+	require.NotNil(t, unit)
+	assert.Equal(t, []string{
+		"/usr/bin/udevadm settle",
+		`/bin/sh -c "/usr/sbin/pvs '/dev/disk/by-partuuid/7a3f1e4d-2b6c-4f8a-9d1e-5c3b2a1f0e9d' >/dev/null 2>&1 || /usr/sbin/pvcreate '/dev/disk/by-partuuid/7a3f1e4d-2b6c-4f8a-9d1e-5c3b2a1f0e9d'"`,
+		`/bin/sh -c "/usr/sbin/pvs --noheadings -o vg_name '/dev/disk/by-partuuid/7a3f1e4d-2b6c-4f8a-9d1e-5c3b2a1f0e9d' | /usr/bin/tr -d ' ' | /usr/bin/grep -qxF 'rootvg' || /usr/sbin/vgextend 'rootvg' '/dev/disk/by-partuuid/7a3f1e4d-2b6c-4f8a-9d1e-5c3b2a1f0e9d'"`,
+		"/usr/bin/rm '/etc/osbuild-extend-volume-groups'",
+	}, unit.Config.Service.ExecStart)
+	assert.Equal(t, []string{"/etc/osbuild-extend-volume-groups"}, unit.Config.Unit.ConditionPathExists)
+	assert.Contains(t, collectCopyDestinationPaths(pipeline.Stages), "tree:///etc/osbuild-extend-volume-groups")
+
+	systemdStage := findStage("org.osbuild.systemd", pipeline.Stages)
+	require.NotNil(t, systemdStage)
+	assert.Contains(t, systemdStage.Options.(*osbuild.SystemdStageOptions).EnabledServices, "osbuild-extend-volume-groups.service")
+
+	// without a volume group to extend there is no first-boot service
+	disks := os.AdditionalDisks
+	disks[0].VolumeGroup = ""
+	os = manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot")
+	os.AdditionalDisks = disks
+	pipeline, err = os.Serialize()
+	require.NoError(t, err)
+	for _, stage := range findStages("org.osbuild.systemd.unit.create", pipeline.Stages) {
+		assert.NotEqual(t, "osbuild-extend-volume-groups.service", stage.Options.(*osbuild.SystemdUnitCreateStageOptions).Filename)
+	}
+}
@@ -211,3 +211,12 @@ type FilePipeline interface {
 	Filename() string
 	SetFilename(fname string)
 }
+
+// MultiDiskPipeline is a FilePipeline of a disk image that also produces
+// the images of the additional disks of the OS tree. The file of each
+// additional disk is named with AdditionalDiskFilename.
+type MultiDiskPipeline interface {
+	FilePipeline
+	AdditionalDisks() []string
+	ExportAdditionalDisks() []*artifact.Artifact
+}
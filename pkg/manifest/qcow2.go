@@ -55,9 +55,30 @@ func (p *QCOW2) serialize() (osbuild.Pipeline, error) {
 		osbuild.NewQemuStagePipelineFilesInputs(p.imgPipeline.Name(), p.imgPipeline.Filename()),
 	))
 
+	// convert the images of the additional disks too
+	for _, name := range p.AdditionalDisks() {
+		pipeline.AddStage(osbuild.NewQEMUStage(
+			osbuild.NewQEMUStageOptions(AdditionalDiskFilename(p.Filename(), name),
+				osbuild.QEMUFormatQCOW2,
+				osbuild.QCOW2Options{
+					Compat: p.Compat,
+				}),
+			osbuild.NewQemuStagePipelineFilesInputs(p.imgPipeline.Name(), AdditionalDiskFilename(p.imgPipeline.Filename(), name)),
+		))
+	}
+
 	return pipeline, nil
 }
 
+// AdditionalDisks returns the names of the additional disks of the raw
+// image, see RawImage.AdditionalDisks
+func (p *QCOW2) AdditionalDisks() []string {
+	if img, ok := p.imgPipeline.(MultiDiskPipeline); ok {
+		return img.AdditionalDisks()
+	}
+	return nil
+}
+
 func (p *QCOW2) getBuildPackages(Distro) ([]string, error) {
 	return []string{"qemu-img"}, nil
 }
@@ -67,3 +88,15 @@ func (p *QCOW2) Export() *artifact.Artifact {
 	mimeType := "application/x-qemu-disk"
 	return artifact.New(p.Name(), p.Filename(), &mimeType)
 }
+
+// ExportAdditionalDisks exports the qcow2 images of the additional disks,
+// one artifact per disk in the order of AdditionalDisks
+func (p *QCOW2) ExportAdditionalDisks() []*artifact.Artifact {
+	p.Base.export = true
+	mimeType := "application/x-qemu-disk"
+	var artifacts []*artifact.Artifact
+	for _, name := range p.AdditionalDisks() {
+		artifacts = append(artifacts, artifact.New(p.Name(), AdditionalDiskFilename(p.Filename(), name), &mimeType))
+	}
+	return artifacts
+}
@@ -2,6 +2,8 @@ package manifest
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/artifact"
@@ -25,6 +27,37 @@ func (p *RawImage) SetFilename(filename string) {
 	p.filename = filename
 }
 
+// AdditionalDiskFilename returns the filename of the image of an additional
+// disk, derived from the filename of the boot disk image, e.g.
+// "disk-data.qcow2" for "disk.qcow2" and the disk "data".
+func AdditionalDiskFilename(filename, diskName string) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(filename, ext), diskName, ext)
+}
+
+// AdditionalDisks returns the names of the additional disks of the image,
+// the pipeline creates one file for each of them next to the boot disk
+// image, see AdditionalDiskFilename.
+func (p *RawImage) AdditionalDisks() []string {
+	names := make([]string, 0, len(p.treePipeline.AdditionalDisks))
+	for _, d := range p.treePipeline.AdditionalDisks {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// diskFiles returns the image files of all disks, the boot disk first
+func (p *RawImage) diskFiles() []osbuild.DiskFile {
+	disks := []osbuild.DiskFile{{Filename: p.Filename(), PartitionTable: p.treePipeline.PartitionTable}}
+	for _, d := range p.treePipeline.AdditionalDisks {
+		disks = append(disks, osbuild.DiskFile{
+			Filename:       AdditionalDiskFilename(p.Filename(), d.Name),
+			PartitionTable: d.PartitionTable,
+		})
+	}
+	return disks
+}
+
 func NewRawImage(buildPipeline Build, treePipeline *OS, diskCustomizations DiskCustomizations) *RawImage {
 	p := &RawImage{
 		Base:               NewBase("image", buildPipeline),
@@ -58,12 +91,15 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 		return osbuild.Pipeline{}, fmt.Errorf("no partition table in live image")
 	}
 
-	for _, stage := range osbuild.GenImagePrepareStages(pt, p.Filename(), p.DiskCustomizations.PartitioningTool, p.treePipeline.Name()) {
-		pipeline.AddStage(stage)
+	disks := p.diskFiles()
+	for _, d := range disks {
+		for _, stage := range osbuild.GenImagePrepareStages(d.PartitionTable, d.Filename, p.DiskCustomizations.PartitioningTool, p.treePipeline.Name()) {
+			pipeline.AddStage(stage)
+		}
 	}
 
 	inputName := "root-tree"
-	copyOptions, copyDevices, copyMounts := osbuild.GenCopyFSTreeOptions(inputName, p.treePipeline.Name(), p.Filename(), pt)
+	copyOptions, copyDevices, copyMounts := osbuild.GenCopyFSTreeOptionsForDisks(inputName, p.treePipeline.Name(), disks)
 	copyInputs := osbuild.NewPipelineTreeInputs(inputName, p.treePipeline.Name())
 	pipeline.AddStage(osbuild.NewCopyStage(copyOptions, copyInputs, copyDevices, copyMounts))
 
@@ -71,7 +107,7 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 	if len(bootFiles) > 0 {
 		// we ignore the bootcopyoptions as they contain a full tree copy instead we make our own, we *do* still want all the other
 		// information such as mountpoints and devices
-		_, bootCopyDevices, bootCopyMounts := osbuild.GenCopyFSTreeOptions(inputName, p.treePipeline.Name(), p.Filename(), pt)
+		_, bootCopyDevices, bootCopyMounts := osbuild.GenCopyFSTreeOptionsForDisks(inputName, p.treePipeline.Name(), disks)
 		bootCopyOptions := &osbuild.CopyStageOptions{}
 		bootCopyInputs := osbuild.NewPipelineTreeInputs(inputName, p.treePipeline.Name())
 
@@ -99,13 +135,15 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 		pipeline.AddStage(osbuild.NewCopyStage(bootCopyOptions, bootCopyInputs, bootCopyDevices, bootCopyMounts))
 	}
 
-	for _, stage := range osbuild.GenImageFinishStages(pt, p.Filename()) {
-		pipeline.AddStage(stage)
+	for _, d := range disks {
+		for _, stage := range osbuild.GenImageFinishStages(d.PartitionTable, d.Filename) {
+			pipeline.AddStage(stage)
+		}
 	}
 
 	switch p.treePipeline.platform.GetArch() {
 	case arch.ARCH_S390X:
-		loopback := osbuild.NewLoopbackDevice(&osbuild.LoopbackDeviceOptions{Filename: p.Filename()})
+		loopback := osbuild.NewLoopbackDevice(&osbuild.LoopbackDeviceOptions{Filename: p.Filename(), SectorSize: osbuild.LoopbackSectorSize(pt)})
 		pipeline.AddStage(osbuild.NewZiplInstStage(osbuild.NewZiplInstStageOptions(p.treePipeline.kernelVer, pt), loopback, copyDevices, copyMounts))
 	default:
 		if grubLegacy := p.treePipeline.platform.GetBIOSPlatform(); grubLegacy != "" {
@@ -113,6 +151,14 @@ func (p *RawImage) serialize() (osbuild.Pipeline, error) {
 		}
 	}
 
+	// the verity hash trees must be computed last, any later change of the
+	// protected filesystems would invalidate them
+	verityStages, err := osbuild.GenImageVerityStages(pt, p.Filename())
+	if err != nil {
+		return osbuild.Pipeline{}, err
+	}
+	pipeline.AddStages(verityStages...)
+
 	return pipeline, nil
 }
 
@@ -120,3 +166,14 @@ func (p *RawImage) Export() *artifact.Artifact {
 	p.Base.export = true
 	return artifact.New(p.Name(), p.Filename(), nil)
 }
+
+// ExportAdditionalDisks exports the images of the additional disks, one
+// artifact per disk in the order of AdditionalDisks
+func (p *RawImage) ExportAdditionalDisks() []*artifact.Artifact {
+	p.Base.export = true
+	artifacts := make([]*artifact.Artifact, 0, len(p.treePipeline.AdditionalDisks))
+	for _, name := range p.AdditionalDisks() {
+		artifacts = append(artifacts, artifact.New(p.Name(), AdditionalDiskFilename(p.Filename(), name), nil))
+	}
+	return artifacts
+}
@@ -177,7 +177,7 @@ func (p *RawBootcImage) serialize() (osbuild.Pipeline, error) {
 
 	postStages := []*osbuild.Stage{}
 
-	fsCfgStages, err := filesystemConfigStages(pt, p.DiskCustomizations.MountConfiguration)
+	fsCfgStages, err := filesystemConfigStages(p.DiskCustomizations.MountConfiguration, pt)
 	if err != nil {
 		return osbuild.Pipeline{}, err
 	}
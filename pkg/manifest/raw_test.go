@@ -0,0 +1,83 @@
+package manifest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+func TestAdditionalDiskFilename(t *testing.T) {
+	assert.Equal(t, "disk-data.img", manifest.AdditionalDiskFilename("disk.img", "data"))
+	assert.Equal(t, "disk-data.qcow2", manifest.AdditionalDiskFilename("disk.qcow2", "data"))
+	assert.Equal(t, "image-data", manifest.AdditionalDiskFilename("image", "data"))
+}
+
+func TestRawImageAdditionalDisks(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot")
+	// the test OS boots with BIOS, grub2 needs a partition for its core
+	os.PartitionTable.Partitions = append(os.PartitionTable.Partitions, disk.Partition{
+		Size: 1024 * 1024,
+		Type: disk.BIOSBootPartitionGUID,
+	})
+	os.AdditionalDisks = []disk.Disk{
+		{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/var/lib/data")},
+	}
+	build := os.BuildPipeline()
+	rawImage := manifest.NewRawImage(build, os, manifest.DiskCustomizations{PartitioningTool: osbuild.PTSfdisk})
+	assert.Equal(t, []string{"data"}, rawImage.AdditionalDisks())
+
+	pipeline, err := manifest.Serialize(rawImage)
+	require.NoError(t, err)
+
+	// both disk images are created, partitioned and filled by the same copy
+	var truncated []string
+	for _, stage := range findStages("org.osbuild.truncate", pipeline.Stages) {
+		truncated = append(truncated, stage.Options.(*osbuild.TruncateStageOptions).Filename)
+	}
+	assert.Equal(t, []string{"disk.img", "disk-data.img"}, truncated)
+	assert.Len(t, findStages("org.osbuild.sfdisk", pipeline.Stages), 2)
+
+	copyStages := findStages("org.osbuild.copy", pipeline.Stages)
+	require.Len(t, copyStages, 1)
+	var targets []string
+	for _, mount := range copyStages[0].Mounts {
+		targets = append(targets, mount.Target)
+	}
+	assert.Equal(t, []string{"/", "/boot", "/var/lib/data"}, targets)
+	assert.Equal(t, "disk-data.img", copyStages[0].Devices["var-lib-data"].Options.(*osbuild.LoopbackDeviceOptions).Filename)
+
+	artifacts := rawImage.ExportAdditionalDisks()
+	require.Len(t, artifacts, 1)
+	assert.Equal(t, "image", artifacts[0].Export())
+	assert.Equal(t, "disk-data.img", artifacts[0].Filename())
+}
+
+func TestQCOW2AdditionalDisks(t *testing.T) {
+	os := manifest.NewTestOS()
+	os.PartitionTable = testdisk.MakeFakePartitionTable("/")
+	os.AdditionalDisks = []disk.Disk{
+		{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/var/lib/data")},
+	}
+	build := os.BuildPipeline()
+	rawImage := manifest.NewRawImage(build, os, manifest.DiskCustomizations{})
+	qcow2 := manifest.NewQCOW2(build, rawImage)
+	qcow2.SetFilename("disk.qcow2")
+
+	pipeline, err := manifest.Serialize(qcow2)
+	require.NoError(t, err)
+	require.Len(t, pipeline.Stages, 2)
+	assert.Equal(t, "disk.qcow2", pipeline.Stages[0].Options.(*osbuild.QEMUStageOptions).Filename)
+	assert.Equal(t, "disk-data.qcow2", pipeline.Stages[1].Options.(*osbuild.QEMUStageOptions).Filename)
+
+	artifacts := qcow2.ExportAdditionalDisks()
+	require.Len(t, artifacts, 1)
+	assert.Equal(t, "disk-data.qcow2", artifacts[0].Filename())
+	assert.Equal(t, "application/x-qemu-disk", artifacts[0].MIMEType())
+}
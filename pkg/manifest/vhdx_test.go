@@ -0,0 +1,38 @@
+package manifest_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func TestVHDXSerialize(t *testing.T) {
+	mani := manifest.New()
+	runner := &runner.Linux{}
+	build := manifest.NewBuild(&mani, runner, nil, nil)
+
+	rawImage := manifest.NewRawImage(build, nil, manifest.DiskCustomizations{})
+	vhdxPipeline := manifest.NewVHDX(build, rawImage)
+	vhdxPipeline.SetFilename("disk.vhdx")
+
+	osbuildPipeline, err := manifest.Serialize(vhdxPipeline)
+	require.NoError(t, err)
+
+	assert.Equal(t, "vhdx", osbuildPipeline.Name)
+	require.Equal(t, 1, len(osbuildPipeline.Stages))
+	qemuStage := osbuildPipeline.Stages[0]
+	assert.Equal(t, "org.osbuild.qemu", qemuStage.Type)
+	assert.Equal(t, &osbuild.QEMUStageOptions{
+		Filename: "disk.vhdx",
+		Format:   osbuild.VHDXOptions{Type: osbuild.QEMUFormatVHDX},
+	}, qemuStage.Options)
+
+	art := vhdxPipeline.Export()
+	assert.Equal(t, "disk.vhdx", art.Filename())
+	assert.Equal(t, "application/x-vhdx", art.MIMEType())
+}
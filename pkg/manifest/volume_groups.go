@@ -0,0 +1,91 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/shutil"
+)
+
+const (
+	extendVolumeGroupsService = "osbuild-extend-volume-groups.service"
+
+	// extendVolumeGroupsFlag is removed by the first-boot service after it
+	// ran so that the volume groups are only extended once
+	extendVolumeGroupsFlag = "/etc/osbuild-extend-volume-groups"
+)
+
+// extendedVolumeGroups returns the additional disks that extend a volume
+// group of another disk
+func extendedVolumeGroups(disks []disk.Disk) []disk.Disk {
+	var res []disk.Disk
+	for _, d := range disks {
+		if d.PhysicalVolume() != nil {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// extendVolumeGroupsFiles returns the flag file of the first-boot service
+// that extends the volume groups
+func extendVolumeGroupsFiles() ([]*fsnode.File, error) {
+	flag, err := fsnode.NewFile(extendVolumeGroupsFlag, nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []*fsnode.File{flag}, nil
+}
+
+// extendVolumeGroupsServiceStage creates a first-boot service that extends
+// volume groups onto the physical volumes of other disks. osbuild creates
+// every volume group on a single device, so a volume group that spans disks
+// is completed on the first boot. The physical volumes are found by their
+// partition UUIDs.
+//
+// The flag file is only removed after all volume groups were extended, a
+// failed run is repeated on the next boot. Each step checks if it is
+// already done, i.e. if the partition is a physical volume and if it is
+// part of the volume group, so repeating the service is safe.
+//
+// Extending a volume group only adds free extents to it. The logical
+// volumes are created at build time when the volume group has no other
+// physical volumes yet, so they are all on the disk of the volume group.
+// The free extents on the other disks can be used to grow the logical
+// volumes or to create new ones.
+func extendVolumeGroupsServiceStage(disks []disk.Disk) *osbuild.Stage {
+	execStart := []string{"/usr/bin/udevadm settle"}
+	for _, d := range disks {
+		dev := shutil.Quote("/dev/disk/by-partuuid/" + strings.ToLower(d.PhysicalVolume().UUID))
+		vg := shutil.Quote(d.VolumeGroup)
+		execStart = append(execStart,
+			fmt.Sprintf(`/bin/sh -c "/usr/sbin/pvs %s >/dev/null 2>&1 || /usr/sbin/pvcreate %s"`, dev, dev),
+			fmt.Sprintf(`/bin/sh -c "/usr/sbin/pvs --noheadings -o vg_name %s | /usr/bin/tr -d ' ' | /usr/bin/grep -qxF %s || /usr/sbin/vgextend %s %s"`, dev, vg, vg, dev),
+		)
+	}
+	execStart = append(execStart, fmt.Sprintf("/usr/bin/rm %s", shutil.Quote(extendVolumeGroupsFlag)))
+
+	stageOptions := &osbuild.SystemdUnitCreateStageOptions{
+		Filename: extendVolumeGroupsService,
+		UnitType: "system",
+		UnitPath: osbuild.EtcUnitPath,
+		Config: osbuild.SystemdUnit{
+			Unit: &osbuild.UnitSection{
+				Description:         "First-boot service for extending volume groups onto additional disks",
+				ConditionPathExists: []string{extendVolumeGroupsFlag},
+				After:               []string{"local-fs.target"},
+			},
+			Service: &osbuild.ServiceSection{
+				Type:      osbuild.OneshotServiceType,
+				ExecStart: execStart,
+			},
+			Install: &osbuild.InstallSection{
+				WantedBy: []string{"default.target"},
+			},
+		},
+	}
+	return osbuild.NewSystemdUnitCreateStage(stageOptions)
+}
@@ -0,0 +1,721 @@
+// Package manifestdiff computes semantic differences between two osbuild
+// manifests.
+//
+// A plain textual diff of two generated manifests is dominated by noise:
+// package checksums, reshuffled source items and deeply nested stage options.
+// This package instead matches pipelines by name and stages by type and
+// position and reports what actually changed: added or removed pipelines and
+// stages, changed stage options, reordered stages, added, removed or updated
+// packages and changed sources.
+package manifestdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// Load parses an osbuild manifest. Both plain manifests and the files written
+// by cmd/gen-manifests, which wrap the manifest in a "manifest" key next to
+// build metadata, are accepted.
+func Load(data []byte) (*osbuild.Manifest, error) {
+	var wrapped struct {
+		Manifest json.RawMessage `json:"manifest"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	if len(wrapped.Manifest) > 0 {
+		data = wrapped.Manifest
+	}
+
+	mf, err := osbuild.NewManifestFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	if mf.Version != "2" {
+		return nil, fmt.Errorf("unsupported manifest version %q, only version 2 is supported", mf.Version)
+	}
+	return mf, nil
+}
+
+// ChangeKind describes how an item differs between two manifests.
+type ChangeKind string
+
+const (
+	Added     ChangeKind = "added"
+	Removed   ChangeKind = "removed"
+	Changed   ChangeKind = "changed"
+	Reordered ChangeKind = "reordered"
+)
+
+// Diff is the semantic difference between two manifests.
+type Diff struct {
+	Pipelines []PipelineDiff `json:"pipelines,omitempty"`
+	Sources   []SourceDiff   `json:"sources,omitempty"`
+}
+
+// PipelineDiff describes the difference of a single pipeline, identified by
+// its name.
+type PipelineDiff struct {
+	Name string     `json:"name"`
+	Kind ChangeKind `json:"kind"`
+
+	// Fields of the pipeline itself that changed (build, runner)
+	Fields []FieldDiff `json:"fields,omitempty"`
+
+	Stages []StageDiff `json:"stages,omitempty"`
+	// StageOrder is set when the stages that exist in both manifests
+	// appear in a different order. It contains the old and new order of
+	// those stages.
+	StageOrder *StageOrder `json:"stage_order,omitempty"`
+
+	Packages []PackageDiff `json:"packages,omitempty"`
+}
+
+// StageOrder lists the stages common to both pipelines in their old and new
+// order.
+type StageOrder struct {
+	Old []string `json:"old"`
+	New []string `json:"new"`
+}
+
+// StageDiff describes the difference of a single stage. Stages are
+// identified by their type and the n-th occurrence of that type in the
+// pipeline.
+type StageDiff struct {
+	Type       string      `json:"type"`
+	Occurrence int         `json:"occurrence"`
+	Kind       ChangeKind  `json:"kind"`
+	Fields     []FieldDiff `json:"fields,omitempty"`
+}
+
+// FieldDiff describes a single changed value, addressed with a JSON-pointer
+// style path (e.g. "options/kernel_opts").
+type FieldDiff struct {
+	Path string          `json:"path"`
+	Kind ChangeKind      `json:"kind"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// PackageDiff describes a package that was added, removed or changed its
+// version. Packages are identified by their name and architecture, so that
+// the packages of a multilib pair are compared separately.
+type PackageDiff struct {
+	Name string     `json:"name"`
+	Arch string     `json:"arch,omitempty"`
+	Kind ChangeKind `json:"kind"`
+	// Old and New are the "[epoch:]version-release" of the package
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// NameArch returns the "name.arch" of the package, or just the name if the
+// architecture is unknown.
+func (pd PackageDiff) NameArch() string {
+	if pd.Arch == "" {
+		return pd.Name
+	}
+	return pd.Name + "." + pd.Arch
+}
+
+// SourceDiff describes the difference of one source type.
+type SourceDiff struct {
+	Name    string     `json:"name"`
+	Kind    ChangeKind `json:"kind"`
+	Added   []string   `json:"added,omitempty"`
+	Removed []string   `json:"removed,omitempty"`
+	Changed []string   `json:"changed,omitempty"`
+	// OptionsChanged is set when the non-item parts of a source (e.g. the
+	// librepo mirror definitions) differ.
+	OptionsChanged bool `json:"options_changed,omitempty"`
+}
+
+// Empty returns true if the two compared manifests are semantically
+// identical.
+func (d *Diff) Empty() bool {
+	return len(d.Pipelines) == 0 && len(d.Sources) == 0
+}
+
+// Compare computes the semantic difference between two manifests.
+func Compare(a, b *osbuild.Manifest) (*Diff, error) {
+	aPkgs, err := packageNames(a)
+	if err != nil {
+		return nil, err
+	}
+	bPkgs, err := packageNames(b)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{}
+	for _, name := range mergedOrder(pipelineNames(a), pipelineNames(b)) {
+		pa := findPipeline(a, name)
+		pb := findPipeline(b, name)
+		switch {
+		case pa == nil:
+			diff.Pipelines = append(diff.Pipelines, PipelineDiff{Name: name, Kind: Added, Packages: comparePackages(nil, pkgsInPipeline(pb, bPkgs))})
+		case pb == nil:
+			diff.Pipelines = append(diff.Pipelines, PipelineDiff{Name: name, Kind: Removed, Packages: comparePackages(pkgsInPipeline(pa, aPkgs), nil)})
+		default:
+			pd, err := comparePipelines(pa, pb, aPkgs, bPkgs)
+			if err != nil {
+				return nil, fmt.Errorf("cannot compare pipeline %q: %w", name, err)
+			}
+			if pd != nil {
+				diff.Pipelines = append(diff.Pipelines, *pd)
+			}
+		}
+	}
+
+	aSources, err := rawSources(a.Sources)
+	if err != nil {
+		return nil, err
+	}
+	bSources, err := rawSources(b.Sources)
+	if err != nil {
+		return nil, err
+	}
+	diff.Sources, err = compareSources(aSources, bSources)
+	if err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// CompareBytes is a convenience wrapper that loads and compares two
+// serialized manifests.
+func CompareBytes(a, b []byte) (*Diff, error) {
+	ma, err := Load(a)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := Load(b)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(ma, mb)
+}
+
+func findPipeline(m *osbuild.Manifest, name string) *osbuild.Pipeline {
+	for idx := range m.Pipelines {
+		if m.Pipelines[idx].Name == name {
+			return &m.Pipelines[idx]
+		}
+	}
+	return nil
+}
+
+func pipelineNames(m *osbuild.Manifest) []string {
+	names := make([]string, 0, len(m.Pipelines))
+	for _, p := range m.Pipelines {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// mergedOrder returns all elements of a in their order followed by all
+// elements of b that are not in a.
+func mergedOrder(a, b []string) []string {
+	res := slices.Clone(a)
+	for _, s := range b {
+		if !slices.Contains(a, s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// stageKey identifies a stage by its type and the occurrence of this type in
+// the pipeline.
+type stageKey struct {
+	typ        string
+	occurrence int
+}
+
+func (k stageKey) String() string {
+	if k.occurrence == 0 {
+		return k.typ
+	}
+	return fmt.Sprintf("%s#%d", k.typ, k.occurrence)
+}
+
+func stageKeys(stages []*osbuild.Stage) []stageKey {
+	seen := map[string]int{}
+	keys := make([]stageKey, len(stages))
+	for idx, stage := range stages {
+		keys[idx] = stageKey{stage.Type, seen[stage.Type]}
+		seen[stage.Type]++
+	}
+	return keys
+}
+
+func comparePipelines(a, b *osbuild.Pipeline, aPkgs, bPkgs map[string]pkgInfo) (*PipelineDiff, error) {
+	pd := &PipelineDiff{Name: a.Name, Kind: Changed}
+
+	if a.Build != b.Build {
+		pd.Fields = append(pd.Fields, FieldDiff{Path: "build", Kind: Changed, Old: jsonString(a.Build), New: jsonString(b.Build)})
+	}
+	if a.Runner != b.Runner {
+		pd.Fields = append(pd.Fields, FieldDiff{Path: "runner", Kind: Changed, Old: jsonString(a.Runner), New: jsonString(b.Runner)})
+	}
+
+	aKeys := stageKeys(a.Stages)
+	bKeys := stageKeys(b.Stages)
+	bIdx := make(map[stageKey]int, len(bKeys))
+	for idx, key := range bKeys {
+		bIdx[key] = idx
+	}
+	aIdx := make(map[stageKey]int, len(aKeys))
+	for idx, key := range aKeys {
+		aIdx[key] = idx
+	}
+
+	var commonOld, commonNew []string
+	for idx, key := range aKeys {
+		j, ok := bIdx[key]
+		if !ok {
+			pd.Stages = append(pd.Stages, StageDiff{Type: key.typ, Occurrence: key.occurrence, Kind: Removed})
+			continue
+		}
+		commonOld = append(commonOld, key.String())
+		fields, err := compareStages(a.Stages[idx], b.Stages[j])
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: %w", key, err)
+		}
+		if len(fields) > 0 {
+			pd.Stages = append(pd.Stages, StageDiff{Type: key.typ, Occurrence: key.occurrence, Kind: Changed, Fields: fields})
+		}
+	}
+	for _, key := range bKeys {
+		if _, ok := aIdx[key]; !ok {
+			pd.Stages = append(pd.Stages, StageDiff{Type: key.typ, Occurrence: key.occurrence, Kind: Added})
+			continue
+		}
+		commonNew = append(commonNew, key.String())
+	}
+	if !slices.Equal(commonOld, commonNew) {
+		pd.StageOrder = &StageOrder{Old: commonOld, New: commonNew}
+	}
+
+	pd.Packages = comparePackages(pkgsInPipeline(a, aPkgs), pkgsInPipeline(b, bPkgs))
+
+	if len(pd.Fields) == 0 && len(pd.Stages) == 0 && pd.StageOrder == nil && len(pd.Packages) == 0 {
+		return nil, nil
+	}
+	return pd, nil
+}
+
+func compareStages(a, b *osbuild.Stage) ([]FieldDiff, error) {
+	var fields []FieldDiff
+	for _, f := range []struct {
+		name string
+		a, b any
+	}{
+		{"inputs", a.Inputs, b.Inputs},
+		{"options", a.Options, b.Options},
+		{"devices", a.Devices, b.Devices},
+		{"mounts", a.Mounts, b.Mounts},
+	} {
+		fd, err := compareJSON(f.name, f.a, f.b)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, fd...)
+	}
+	return fields, nil
+}
+
+// compareJSON compares the JSON representation of two values and returns
+// the differences. JSON objects are descended into so that a change is
+// reported at the deepest path possible, everything else (including arrays)
+// is compared as a whole.
+func compareJSON(p string, a, b any) ([]FieldDiff, error) {
+	va, err := toJSONValue(a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := toJSONValue(b)
+	if err != nil {
+		return nil, err
+	}
+	return compareValues(p, va, vb), nil
+}
+
+// toJSONValue converts v into the generic representation of its JSON
+// encoding. Empty objects and arrays are treated like missing values.
+func toJSONValue(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	switch val := res.(type) {
+	case map[string]any:
+		if len(val) == 0 {
+			return nil, nil
+		}
+	case []any:
+		if len(val) == 0 {
+			return nil, nil
+		}
+	}
+	return res, nil
+}
+
+func compareValues(p string, a, b any) []FieldDiff {
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	switch {
+	case a == nil:
+		return []FieldDiff{{Path: p, Kind: Added, New: mustMarshal(b)}}
+	case b == nil:
+		return []FieldDiff{{Path: p, Kind: Removed, Old: mustMarshal(a)}}
+	}
+
+	ma, aIsMap := a.(map[string]any)
+	mb, bIsMap := b.(map[string]any)
+	if !aIsMap || !bIsMap {
+		return []FieldDiff{{Path: p, Kind: Changed, Old: mustMarshal(a), New: mustMarshal(b)}}
+	}
+
+	keys := make([]string, 0, len(ma)+len(mb))
+	for k := range ma {
+		keys = append(keys, k)
+	}
+	for k := range mb {
+		if _, ok := ma[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var res []FieldDiff
+	for _, k := range keys {
+		res = append(res, compareValues(path.Join(p, escapePointer(k)), ma[k], mb[k])...)
+	}
+	return res
+}
+
+// escapePointer escapes a key for use in a JSON pointer (RFC 6901)
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		// values come from json.Unmarshal so this can never happen
+		panic(fmt.Sprintf("cannot marshal %v: %v", v, err))
+	}
+	return data
+}
+
+func jsonString(s string) json.RawMessage {
+	return mustMarshal(s)
+}
+
+// pkgInfo is the name, version and architecture of a package as derived
+// from its rpm filename.
+type pkgInfo struct {
+	name string
+	evr  string
+	arch string
+}
+
+// nameArch returns the key of a package in a pipeline, see
+// pkgsInPipeline()
+func (pi pkgInfo) nameArch() string {
+	if pi.arch == "" {
+		return pi.name
+	}
+	return pi.name + "." + pi.arch
+}
+
+// packageNames maps all package checksums found in the sources of the
+// manifest to their name and version.
+func packageNames(m *osbuild.Manifest) (map[string]pkgInfo, error) {
+	res := map[string]pkgInfo{}
+
+	if src, ok := m.Sources[osbuild.SourceNameCurl]; ok {
+		curl, ok := src.(*osbuild.CurlSource)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type for %s source: %T", osbuild.SourceNameCurl, src)
+		}
+		for checksum, item := range curl.Items {
+			var url string
+			switch item := item.(type) {
+			case osbuild.URL:
+				url = string(item)
+			case osbuild.CurlSourceOptions:
+				url = item.URL
+			}
+			if info, ok := parseRPMFilename(path.Base(url)); ok {
+				res[checksum] = info
+			}
+		}
+	}
+
+	if src, ok := m.Sources[osbuild.SourceNameLibrepo]; ok {
+		librepo, ok := src.(*osbuild.LibrepoSource)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type for %s source: %T", osbuild.SourceNameLibrepo, src)
+		}
+		for checksum, item := range librepo.Items {
+			if item == nil {
+				continue
+			}
+			if info, ok := parseRPMFilename(path.Base(item.Path)); ok {
+				res[checksum] = info
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// parseRPMFilename splits a "name-version-release.arch.rpm" filename into
+// the package name, the "version-release" and the architecture.
+func parseRPMFilename(filename string) (pkgInfo, bool) {
+	nvra, ok := strings.CutSuffix(filename, ".rpm")
+	if !ok {
+		return pkgInfo{}, false
+	}
+	archIdx := strings.LastIndex(nvra, ".")
+	if archIdx <= 0 {
+		return pkgInfo{}, false
+	}
+	nvr, arch := nvra[:archIdx], nvra[archIdx+1:]
+	relIdx := strings.LastIndex(nvr, "-")
+	if relIdx <= 0 {
+		return pkgInfo{}, false
+	}
+	verIdx := strings.LastIndex(nvr[:relIdx], "-")
+	if verIdx <= 0 {
+		return pkgInfo{}, false
+	}
+	return pkgInfo{name: nvr[:verIdx], evr: nvr[verIdx+1:], arch: arch}, true
+}
+
+// pkgsInPipeline returns the packages installed by all org.osbuild.rpm
+// stages of the pipeline, keyed by "name.arch".
+func pkgsInPipeline(p *osbuild.Pipeline, known map[string]pkgInfo) map[string]pkgInfo {
+	res := map[string]pkgInfo{}
+	for _, stage := range p.Stages {
+		if stage.Type != "org.osbuild.rpm" || stage.Inputs == nil {
+			continue
+		}
+		data, err := json.Marshal(stage.Inputs)
+		if err != nil {
+			continue
+		}
+		var inputs struct {
+			Packages struct {
+				References json.RawMessage `json:"references"`
+			} `json:"packages"`
+		}
+		if err := json.Unmarshal(data, &inputs); err != nil {
+			continue
+		}
+		for _, checksum := range referenceIDs(inputs.Packages.References) {
+			info, ok := known[checksum]
+			if !ok {
+				info = pkgInfo{name: checksum}
+			}
+			res[info.nameArch()] = info
+		}
+	}
+	return res
+}
+
+// referenceIDs returns the ids of all references of a files input, which can
+// be either a plain list of ids, a list of objects with an "id" or a map
+// keyed by id.
+func referenceIDs(refs json.RawMessage) []string {
+	var plain []string
+	if err := json.Unmarshal(refs, &plain); err == nil {
+		return plain
+	}
+	var array []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(refs, &array); err == nil {
+		ids := make([]string, 0, len(array))
+		for _, ref := range array {
+			ids = append(ids, ref.ID)
+		}
+		return ids
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(refs, &object); err == nil {
+		ids := make([]string, 0, len(object))
+		for id := range object {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	return nil
+}
+
+func comparePackages(a, b map[string]pkgInfo) []PackageDiff {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var res []PackageDiff
+	for _, key := range keys {
+		pa, inA := a[key]
+		pb, inB := b[key]
+		switch {
+		case !inA:
+			res = append(res, PackageDiff{Name: pb.name, Arch: pb.arch, Kind: Added, New: pb.evr})
+		case !inB:
+			res = append(res, PackageDiff{Name: pa.name, Arch: pa.arch, Kind: Removed, Old: pa.evr})
+		case pa.evr != pb.evr:
+			res = append(res, PackageDiff{Name: pa.name, Arch: pa.arch, Kind: Changed, Old: pa.evr, New: pb.evr})
+		}
+	}
+	return res
+}
+
+// rawSources returns the JSON representation of all sources of a manifest
+func rawSources(sources osbuild.Sources) (map[string]json.RawMessage, error) {
+	res := make(map[string]json.RawMessage, len(sources))
+	for name, src := range sources {
+		data, err := json.Marshal(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal source %q: %w", name, err)
+		}
+		res[name] = data
+	}
+	return res, nil
+}
+
+func compareSources(a, b map[string]json.RawMessage) ([]SourceDiff, error) {
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var res []SourceDiff
+	for _, name := range names {
+		sa, err := splitSource(a[name])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse source %q: %w", name, err)
+		}
+		sb, err := splitSource(b[name])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse source %q: %w", name, err)
+		}
+
+		sd := SourceDiff{Name: name, Kind: Changed}
+		switch {
+		case a[name] == nil:
+			sd.Kind = Added
+		case b[name] == nil:
+			sd.Kind = Removed
+		}
+		for id, item := range sa.items {
+			other, ok := sb.items[id]
+			switch {
+			case !ok:
+				sd.Removed = append(sd.Removed, id)
+			case !jsonEqual(item, other):
+				sd.Changed = append(sd.Changed, id)
+			}
+		}
+		for id := range sb.items {
+			if _, ok := sa.items[id]; !ok {
+				sd.Added = append(sd.Added, id)
+			}
+		}
+		sd.OptionsChanged = sd.Kind == Changed && !jsonEqual(sa.rest, sb.rest)
+		slices.Sort(sd.Added)
+		slices.Sort(sd.Removed)
+		slices.Sort(sd.Changed)
+
+		if sd.Kind == Changed && len(sd.Added) == 0 && len(sd.Removed) == 0 && len(sd.Changed) == 0 && !sd.OptionsChanged {
+			continue
+		}
+		res = append(res, sd)
+	}
+	return res, nil
+}
+
+type splitSrc struct {
+	items map[string]json.RawMessage
+	rest  map[string]json.RawMessage
+}
+
+// splitSource separates the "items" of a source from the rest of its
+// definition.
+func splitSource(raw json.RawMessage) (*splitSrc, error) {
+	res := &splitSrc{}
+	if raw == nil {
+		return res, nil
+	}
+	if err := json.Unmarshal(raw, &res.rest); err != nil {
+		return nil, err
+	}
+	if items, ok := res.rest["items"]; ok {
+		if err := json.Unmarshal(items, &res.items); err != nil {
+			return nil, err
+		}
+		delete(res.rest, "items")
+	}
+	return res, nil
+}
+
+func jsonEqual(a, b any) bool {
+	da, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	var va, vb any
+	if err := json.Unmarshal(da, &va); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(db, &vb); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// compactJSON returns a compact single line representation of the given
+// JSON, falling back to the input if it is not valid.
+func compactJSON(data json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
@@ -0,0 +1,371 @@
+package manifestdiff_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/manifestdiff"
+)
+
+var oldManifest = []byte(`{
+  "version": "2",
+  "pipelines": [
+    {
+      "name": "build",
+      "runner": "org.osbuild.fedora42",
+      "stages": [
+        {
+          "type": "org.osbuild.rpm",
+          "inputs": {
+            "packages": {
+              "type": "org.osbuild.files",
+              "origin": "org.osbuild.source",
+              "references": [
+                {"id": "sha256:aaa"},
+                {"id": "sha256:bbb"}
+              ]
+            }
+          }
+        },
+        {"type": "org.osbuild.selinux", "options": {"file_contexts": "etc/selinux/targeted/contexts/files/file_contexts"}}
+      ]
+    },
+    {
+      "name": "os",
+      "build": "name:build",
+      "stages": [
+        {"type": "org.osbuild.kernel-cmdline", "options": {"root_fs_uuid": "1234", "kernel_opts": "ro"}},
+        {"type": "org.osbuild.hostname", "options": {"hostname": "old"}},
+        {"type": "org.osbuild.mkdir", "options": {"paths": [{"path": "/a"}]}},
+        {"type": "org.osbuild.mkdir", "options": {"paths": [{"path": "/b"}]}}
+      ]
+    },
+    {
+      "name": "vmdk",
+      "stages": [{"type": "org.osbuild.qemu"}]
+    }
+  ],
+  "sources": {
+    "org.osbuild.curl": {
+      "items": {
+        "sha256:aaa": "https://example.com/bash-5.2.26-3.fc42.x86_64.rpm",
+        "sha256:bbb": {"url": "https://example.com/tar-1.35-4.fc42.x86_64.rpm"}
+      }
+    }
+  }
+}`)
+
+var newManifest = []byte(`{
+  "manifest": {
+    "version": "2",
+    "pipelines": [
+      {
+        "name": "build",
+        "runner": "org.osbuild.fedora42",
+        "stages": [
+          {
+            "type": "org.osbuild.rpm",
+            "inputs": {
+              "packages": {
+                "type": "org.osbuild.files",
+                "origin": "org.osbuild.source",
+                "references": [
+                  {"id": "sha256:ccc"},
+                  {"id": "sha256:ddd"}
+                ]
+              }
+            }
+          },
+          {"type": "org.osbuild.selinux", "options": {"file_contexts": "etc/selinux/targeted/contexts/files/file_contexts"}}
+        ]
+      },
+      {
+        "name": "os",
+        "build": "name:build",
+        "stages": [
+          {"type": "org.osbuild.hostname", "options": {"hostname": "new"}},
+          {"type": "org.osbuild.kernel-cmdline", "options": {"root_fs_uuid": "1234", "kernel_opts": "ro quiet"}},
+          {"type": "org.osbuild.mkdir", "options": {"paths": [{"path": "/a"}]}},
+          {"type": "org.osbuild.locale", "options": {"language": "C.UTF-8"}}
+        ]
+      },
+      {
+        "name": "qcow2",
+        "stages": [{"type": "org.osbuild.qemu"}]
+      }
+    ],
+    "sources": {
+      "org.osbuild.curl": {
+        "items": {
+          "sha256:ccc": "https://example.com/bash-5.2.37-1.fc42.x86_64.rpm",
+          "sha256:ddd": "https://example.com/dnf5-5.2.13.1-1.fc42.x86_64.rpm"
+        }
+      }
+    }
+  },
+  "rpmmd": {}
+}`)
+
+func TestCompareIdentical(t *testing.T) {
+	diff, err := manifestdiff.CompareBytes(oldManifest, oldManifest)
+	require.NoError(t, err)
+	assert.True(t, diff.Empty())
+
+	var buf bytes.Buffer
+	require.NoError(t, diff.WriteText(&buf))
+	assert.Equal(t, "manifests are identical\n", buf.String())
+}
+
+func TestCompare(t *testing.T) {
+	diff, err := manifestdiff.CompareBytes(oldManifest, newManifest)
+	require.NoError(t, err)
+	assert.False(t, diff.Empty())
+
+	expected := &manifestdiff.Diff{
+		Pipelines: []manifestdiff.PipelineDiff{
+			{
+				Name: "build",
+				Kind: manifestdiff.Changed,
+				Stages: []manifestdiff.StageDiff{
+					{
+						Type: "org.osbuild.rpm",
+						Kind: manifestdiff.Changed,
+						Fields: []manifestdiff.FieldDiff{
+							{
+								Path: "inputs/packages/references",
+								Kind: manifestdiff.Changed,
+								Old:  json.RawMessage(`[{"id":"sha256:aaa"},{"id":"sha256:bbb"}]`),
+								New:  json.RawMessage(`[{"id":"sha256:ccc"},{"id":"sha256:ddd"}]`),
+							},
+						},
+					},
+				},
+				Packages: []manifestdiff.PackageDiff{
+					{Name: "bash", Arch: "x86_64", Kind: manifestdiff.Changed, Old: "5.2.26-3.fc42", New: "5.2.37-1.fc42"},
+					{Name: "dnf5", Arch: "x86_64", Kind: manifestdiff.Added, New: "5.2.13.1-1.fc42"},
+					{Name: "tar", Arch: "x86_64", Kind: manifestdiff.Removed, Old: "1.35-4.fc42"},
+				},
+			},
+			{
+				Name: "os",
+				Kind: manifestdiff.Changed,
+				Stages: []manifestdiff.StageDiff{
+					{
+						Type: "org.osbuild.kernel-cmdline",
+						Kind: manifestdiff.Changed,
+						Fields: []manifestdiff.FieldDiff{
+							{
+								Path: "options/kernel_opts",
+								Kind: manifestdiff.Changed,
+								Old:  json.RawMessage(`"ro"`),
+								New:  json.RawMessage(`"ro quiet"`),
+							},
+						},
+					},
+					{
+						Type: "org.osbuild.hostname",
+						Kind: manifestdiff.Changed,
+						Fields: []manifestdiff.FieldDiff{
+							{
+								Path: "options/hostname",
+								Kind: manifestdiff.Changed,
+								Old:  json.RawMessage(`"old"`),
+								New:  json.RawMessage(`"new"`),
+							},
+						},
+					},
+					{
+						Type:       "org.osbuild.mkdir",
+						Occurrence: 1,
+						Kind:       manifestdiff.Removed,
+					},
+					{
+						Type: "org.osbuild.locale",
+						Kind: manifestdiff.Added,
+					},
+				},
+				StageOrder: &manifestdiff.StageOrder{
+					Old: []string{"org.osbuild.kernel-cmdline", "org.osbuild.hostname", "org.osbuild.mkdir"},
+					New: []string{"org.osbuild.hostname", "org.osbuild.kernel-cmdline", "org.osbuild.mkdir"},
+				},
+			},
+			{
+				Name: "vmdk",
+				Kind: manifestdiff.Removed,
+			},
+			{
+				Name: "qcow2",
+				Kind: manifestdiff.Added,
+			},
+		},
+		Sources: []manifestdiff.SourceDiff{
+			{
+				Name:    "org.osbuild.curl",
+				Kind:    manifestdiff.Changed,
+				Added:   []string{"sha256:ccc", "sha256:ddd"},
+				Removed: []string{"sha256:aaa", "sha256:bbb"},
+			},
+		},
+	}
+	assert.Equal(t, expected, diff)
+}
+
+func TestWriteText(t *testing.T) {
+	diff, err := manifestdiff.CompareBytes(oldManifest, newManifest)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, diff.WriteText(&buf))
+	assert.Equal(t, `pipeline "build":
+  stage org.osbuild.rpm: changed
+    ~ inputs/packages/references: [{"id":"sha256:aaa"},{"id":"sha256:bbb"}] -> [{"id":"sha256:ccc"},{"id":"sha256:ddd"}]
+  packages: 1 added, 1 removed, 1 changed
+    ~ bash.x86_64: 5.2.26-3.fc42 -> 5.2.37-1.fc42
+    + dnf5-5.2.13.1-1.fc42.x86_64
+    - tar-1.35-4.fc42.x86_64
+pipeline "os":
+  stages reordered:
+    - org.osbuild.kernel-cmdline, org.osbuild.hostname, org.osbuild.mkdir
+    + org.osbuild.hostname, org.osbuild.kernel-cmdline, org.osbuild.mkdir
+  stage org.osbuild.kernel-cmdline: changed
+    ~ options/kernel_opts: "ro" -> "ro quiet"
+  stage org.osbuild.hostname: changed
+    ~ options/hostname: "old" -> "new"
+  stage org.osbuild.mkdir#1: removed
+  stage org.osbuild.locale: added
+pipeline "vmdk": removed
+pipeline "qcow2": added
+source "org.osbuild.curl":
+  items: 2 added, 2 removed, 0 changed
+`, buf.String())
+}
+
+func TestWriteJSONRoundtrip(t *testing.T) {
+	diff, err := manifestdiff.CompareBytes(oldManifest, newManifest)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, diff.WriteJSON(&buf))
+
+	var decoded manifestdiff.Diff
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+
+	// raw json values get re-indented, so compare the rendered text
+	var expected, actual bytes.Buffer
+	require.NoError(t, diff.WriteText(&expected))
+	require.NoError(t, decoded.WriteText(&actual))
+	assert.Equal(t, expected.String(), actual.String())
+}
+
+func multilibManifest(glibcI686 string) []byte {
+	return []byte(`{
+  "version": "2",
+  "pipelines": [
+    {
+      "name": "os",
+      "stages": [
+        {
+          "type": "org.osbuild.rpm",
+          "inputs": {
+            "packages": {
+              "type": "org.osbuild.files",
+              "origin": "org.osbuild.source",
+              "references": {"sha256:aaa": {}, "sha256:bbb": {}}
+            }
+          }
+        }
+      ]
+    }
+  ],
+  "sources": {
+    "org.osbuild.curl": {
+      "items": {
+        "sha256:aaa": "https://example.com/glibc-2.41-5.fc42.x86_64.rpm",
+        "sha256:bbb": "https://example.com/` + glibcI686 + `"
+      }
+    }
+  }
+}`)
+}
+
+func TestCompareMultilib(t *testing.T) {
+	diff, err := manifestdiff.CompareBytes(
+		multilibManifest("glibc-2.41-5.fc42.i686.rpm"),
+		multilibManifest("glibc-2.41-6.fc42.i686.rpm"),
+	)
+	require.NoError(t, err)
+	require.Len(t, diff.Pipelines, 1)
+	// the x86_64 package did not change and is not shadowed by the i686 one
+	assert.Equal(t, []manifestdiff.PackageDiff{
+		{Name: "glibc", Arch: "i686", Kind: manifestdiff.Changed, Old: "2.41-5.fc42", New: "2.41-6.fc42"},
+	}, diff.Pipelines[0].Packages)
+}
+
+func TestCompareContainerSourcesAndDevices(t *testing.T) {
+	manifest := func(size string) []byte {
+		return []byte(`{
+  "version": "2",
+  "pipelines": [
+    {
+      "name": "image",
+      "stages": [
+        {
+          "type": "org.osbuild.mkfs.ext4",
+          "options": {"uuid": "1234"},
+          "devices": {"device": {"type": "org.osbuild.loopback", "options": {"filename": "disk.raw", "size": ` + size + `}}}
+        },
+        {
+          "type": "org.osbuild.copy",
+          "mounts": [{"name": "root", "type": "org.osbuild.ext4", "source": "device", "target": "/", "options": {"ro": true}}]
+        }
+      ]
+    }
+  ],
+  "sources": {
+    "org.osbuild.skopeo": {
+      "items": {
+        "sha256:1111111111111111111111111111111111111111111111111111111111111111": {
+          "image": {"name": "registry.example.com/base", "digest": "sha256:2222222222222222222222222222222222222222222222222222222222222222"}
+        }
+      }
+    },
+    "org.osbuild.containers-storage": {"items": {}}
+  }
+}`)
+	}
+	diff, err := manifestdiff.CompareBytes(manifest("2048"), manifest("4096"))
+	require.NoError(t, err)
+	assert.Equal(t, []manifestdiff.PipelineDiff{
+		{
+			Name: "image",
+			Kind: manifestdiff.Changed,
+			Stages: []manifestdiff.StageDiff{
+				{
+					Type: "org.osbuild.mkfs.ext4",
+					Kind: manifestdiff.Changed,
+					Fields: []manifestdiff.FieldDiff{
+						{
+							Path: "devices/device/options/size",
+							Kind: manifestdiff.Changed,
+							Old:  json.RawMessage(`2048`),
+							New:  json.RawMessage(`4096`),
+						},
+					},
+				},
+			},
+		},
+	}, diff.Pipelines)
+	assert.Empty(t, diff.Sources)
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := manifestdiff.Load([]byte(`{"version": "1"}`))
+	assert.EqualError(t, err, `unsupported manifest version "1", only version 2 is supported`)
+
+	_, err = manifestdiff.Load([]byte(`not json`))
+	assert.ErrorContains(t, err, "cannot parse manifest")
+}
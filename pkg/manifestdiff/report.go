@@ -0,0 +1,128 @@
+package manifestdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxValueLen is the maximum length of a changed value in the text output,
+// longer values are truncated.
+const maxValueLen = 120
+
+// WriteJSON writes the diff as indented JSON.
+func (d *Diff) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// WriteText writes a human readable summary of the diff.
+func (d *Diff) WriteText(w io.Writer) error {
+	var sb strings.Builder
+
+	if d.Empty() {
+		sb.WriteString("manifests are identical\n")
+	}
+
+	for _, pd := range d.Pipelines {
+		switch pd.Kind {
+		case Added, Removed:
+			fmt.Fprintf(&sb, "pipeline %q: %s\n", pd.Name, pd.Kind)
+		default:
+			fmt.Fprintf(&sb, "pipeline %q:\n", pd.Name)
+		}
+		for _, fd := range pd.Fields {
+			writeField(&sb, "  ", fd)
+		}
+		if pd.StageOrder != nil {
+			sb.WriteString("  stages reordered:\n")
+			fmt.Fprintf(&sb, "    - %s\n", strings.Join(pd.StageOrder.Old, ", "))
+			fmt.Fprintf(&sb, "    + %s\n", strings.Join(pd.StageOrder.New, ", "))
+		}
+		for _, sd := range pd.Stages {
+			key := stageKey{sd.Type, sd.Occurrence}
+			fmt.Fprintf(&sb, "  stage %s: %s\n", key, sd.Kind)
+			for _, fd := range sd.Fields {
+				writeField(&sb, "    ", fd)
+			}
+		}
+		if len(pd.Packages) > 0 {
+			fmt.Fprintf(&sb, "  packages: %s\n", packageSummary(pd.Packages))
+			for _, pkg := range pd.Packages {
+				switch pkg.Kind {
+				case Added:
+					fmt.Fprintf(&sb, "    + %s\n", packageNEVRA(pkg.Name, pkg.New, pkg.Arch))
+				case Removed:
+					fmt.Fprintf(&sb, "    - %s\n", packageNEVRA(pkg.Name, pkg.Old, pkg.Arch))
+				case Changed:
+					fmt.Fprintf(&sb, "    ~ %s: %s -> %s\n", pkg.NameArch(), pkg.Old, pkg.New)
+				}
+			}
+		}
+	}
+
+	for _, sd := range d.Sources {
+		switch sd.Kind {
+		case Added, Removed:
+			fmt.Fprintf(&sb, "source %q: %s\n", sd.Name, sd.Kind)
+		default:
+			fmt.Fprintf(&sb, "source %q:\n", sd.Name)
+		}
+		if len(sd.Added)+len(sd.Removed)+len(sd.Changed) > 0 {
+			fmt.Fprintf(&sb, "  items: %d added, %d removed, %d changed\n", len(sd.Added), len(sd.Removed), len(sd.Changed))
+		}
+		if sd.OptionsChanged {
+			sb.WriteString("  options changed\n")
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeField(sb *strings.Builder, indent string, fd FieldDiff) {
+	switch fd.Kind {
+	case Added:
+		fmt.Fprintf(sb, "%s+ %s: %s\n", indent, fd.Path, truncate(compactJSON(fd.New)))
+	case Removed:
+		fmt.Fprintf(sb, "%s- %s: %s\n", indent, fd.Path, truncate(compactJSON(fd.Old)))
+	default:
+		fmt.Fprintf(sb, "%s~ %s: %s -> %s\n", indent, fd.Path, truncate(compactJSON(fd.Old)), truncate(compactJSON(fd.New)))
+	}
+}
+
+// packageNEVRA returns the "name-version-release.arch" of a package
+func packageNEVRA(name, evr, arch string) string {
+	res := name
+	if evr != "" {
+		res += "-" + evr
+	}
+	if arch != "" {
+		res += "." + arch
+	}
+	return res
+}
+
+func packageSummary(pkgs []PackageDiff) string {
+	var added, removed, changed int
+	for _, pkg := range pkgs {
+		switch pkg.Kind {
+		case Added:
+			added++
+		case Removed:
+			removed++
+		case Changed:
+			changed++
+		}
+	}
+	return fmt.Sprintf("%d added, %d removed, %d changed", added, removed, changed)
+}
+
+func truncate(s string) string {
+	if len(s) <= maxValueLen {
+		return s
+	}
+	return s[:maxValueLen-3] + "..."
+}
@@ -0,0 +1,385 @@
+// Package bundle exports all content that an osbuild manifest fetches
+// into a self-contained directory so that the manifest can be built on
+// a machine without network access.
+//
+// A bundle contains the manifest, the rpms in the local rpm repository
+// "rpms/", other files like container manifest lists or host files in
+// "files/", the containers in the OCI layout "containers/" and the ostree
+// commits in the archive repo "ostree/". The index "bundle.json" lists
+// every item with its checksum.
+//
+// Import verifies the checksums of all items and returns the manifest
+// with its sources rewritten to the bundle: rpms and files are fetched
+// from file:// URLs, commits from the local ostree repo and containers
+// are loaded into the local containers-storage.
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// IndexVersion is the version of the bundle index written by Export,
+// bundles with other versions are rejected by Import.
+const IndexVersion = 1
+
+const (
+	indexFilename    = "bundle.json"
+	manifestFilename = "manifest.json"
+
+	rpmsDir       = "rpms"
+	repodataDir   = "repodata"
+	filesDir      = "files"
+	containersDir = "containers"
+	ostreeDir     = "ostree"
+)
+
+// Kind of a bundle item
+type Kind string
+
+const (
+	KindRPM       Kind = "rpm"
+	KindFile      Kind = "file"
+	KindContainer Kind = "container"
+	KindCommit    Kind = "commit"
+	// KindRepodata is a file of the repodata of the rpm repository
+	KindRepodata Kind = "repodata"
+)
+
+// Item is a single piece of content of a bundle
+type Item struct {
+	Kind Kind `json:"kind"`
+	// Checksum identifies the content, it is the "<type>:<value>"
+	// checksum of rpms, repodata and files, the image ID of containers
+	// and the checksum of ostree commits. It is also the key of the item in
+	// the sources of the manifest.
+	Checksum string `json:"checksum"`
+	// Path relative to the bundle directory
+	Path string `json:"path"`
+	// Ref of a container in the OCI layout
+	Ref string `json:"ref,omitempty"`
+	// Name of a container
+	Name string `json:"name,omitempty"`
+}
+
+// Index lists the items of a bundle
+type Index struct {
+	Version int    `json:"version"`
+	Items   []Item `json:"items"`
+}
+
+func (idx *Index) item(checksum string) (Item, error) {
+	for _, item := range idx.Items {
+		if item.Checksum == checksum {
+			return item, nil
+		}
+	}
+	return Item{}, fmt.Errorf("item %q is not in the bundle", checksum)
+}
+
+// rawManifest keeps the parts of a manifest that do not need to be
+// understood as they are
+type rawManifest struct {
+	top     map[string]json.RawMessage
+	sources map[string]json.RawMessage
+}
+
+func parseManifest(manifest []byte) (*rawManifest, error) {
+	var raw rawManifest
+	if err := json.Unmarshal(manifest, &raw.top); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	raw.sources = make(map[string]json.RawMessage)
+	if sources, ok := raw.top["sources"]; ok {
+		if err := json.Unmarshal(sources, &raw.sources); err != nil {
+			return nil, fmt.Errorf("cannot parse manifest sources: %w", err)
+		}
+	}
+	return &raw, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+type exporter struct {
+	dir     string
+	fetcher Fetcher
+	index   Index
+}
+
+// Export fetches all content of the sources of the manifest into the
+// bundle directory dir, which must be empty or not exist. The fetcher
+// may be nil, the DefaultFetcher is used then.
+//
+// Content that needs secrets, e.g. rpms from RHSM repositories, cannot
+// be exported. Images from the local containers-storage of the host are
+// expected to be in the local containers-storage of the build host as
+// well and are not exported.
+func Export(ctx context.Context, manifest []byte, dir string, fetcher Fetcher) error {
+	if fetcher == nil {
+		fetcher = DefaultFetcher{}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("bundle directory %q is not empty", dir)
+	}
+	raw, err := parseManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	e := &exporter{
+		dir:     dir,
+		fetcher: fetcher,
+		index:   Index{Version: IndexVersion, Items: []Item{}},
+	}
+	for _, name := range sortedKeys(raw.sources) {
+		if err := e.exportSource(ctx, name, raw.sources[name]); err != nil {
+			return fmt.Errorf("cannot export source %s: %w", name, err)
+		}
+	}
+	if err := e.createRepo(ctx); err != nil {
+		return fmt.Errorf("cannot create the rpm repository: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, manifestFilename), manifest, 0644); err != nil {
+		return err
+	}
+	index, err := json.MarshalIndent(e.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, indexFilename), index, 0644)
+}
+
+func (e *exporter) exportSource(ctx context.Context, name string, rawSource json.RawMessage) error {
+	switch name {
+	case osbuild.SourceNameCurl:
+		var source osbuild.CurlSource
+		if err := json.Unmarshal(rawSource, &source); err != nil {
+			return err
+		}
+		for _, checksum := range sortedKeys(source.Items) {
+			var opts osbuild.CurlSourceOptions
+			switch item := source.Items[checksum].(type) {
+			case osbuild.URL:
+				opts.URL = string(item)
+			case osbuild.CurlSourceOptions:
+				opts = item
+			}
+			if opts.Secrets != nil {
+				return fmt.Errorf("cannot export %s, it needs the %s secrets", opts.URL, opts.Secrets.Name)
+			}
+			u, err := url.Parse(opts.URL)
+			if err != nil {
+				return err
+			}
+			kind := KindFile
+			if strings.HasSuffix(u.Path, ".rpm") {
+				kind = KindRPM
+			}
+			if err := e.exportURL(ctx, kind, checksum, opts.URL, opts.Insecure); err != nil {
+				return err
+			}
+		}
+	case osbuild.SourceNameLibrepo:
+		var source osbuild.LibrepoSource
+		if err := json.Unmarshal(rawSource, &source); err != nil {
+			return err
+		}
+		for _, checksum := range sortedKeys(source.Items) {
+			item := source.Items[checksum]
+			mirror := source.Options.Mirrors[item.MirrorID]
+			if mirror == nil {
+				return fmt.Errorf("unknown mirror %q of %s", item.MirrorID, item.Path)
+			}
+			// metalinks and mirrorlists would need to be
+			// resolved like librepo does it
+			if mirror.Type != "baseurl" {
+				return fmt.Errorf("cannot export %s from a %s, only baseurls are supported", item.Path, mirror.Type)
+			}
+			if mirror.Secrets != nil {
+				return fmt.Errorf("cannot export %s, it needs the %s secrets", item.Path, mirror.Secrets.Name)
+			}
+			rpmURL := strings.TrimSuffix(mirror.URL, "/") + "/" + item.Path
+			if err := e.exportURL(ctx, KindRPM, checksum, rpmURL, mirror.Insecure); err != nil {
+				return err
+			}
+		}
+	case osbuild.SourceNameSkopeo:
+		var source osbuild.SkopeoSource
+		if err := json.Unmarshal(rawSource, &source); err != nil {
+			return err
+		}
+		layoutDir := filepath.Join(e.dir, containersDir)
+		for _, imageID := range sortedKeys(source.Items) {
+			image := source.Items[imageID].Image
+			ref := strings.TrimPrefix(imageID, "sha256:")
+			if err := e.fetcher.FetchContainer(ctx, image.Name, image.Digest, image.TLSVerify, layoutDir, ref); err != nil {
+				return fmt.Errorf("cannot fetch %s@%s: %w", image.Name, image.Digest, err)
+			}
+			if err := verifyOCIImage(layoutDir, ref, imageID); err != nil {
+				return err
+			}
+			e.index.Items = append(e.index.Items, Item{
+				Kind:     KindContainer,
+				Checksum: imageID,
+				Path:     containersDir,
+				Ref:      ref,
+				Name:     image.Name,
+			})
+		}
+	case osbuild.SourceNameSkopeoIndex:
+		var source osbuild.SkopeoIndexSource
+		if err := json.Unmarshal(rawSource, &source); err != nil {
+			return err
+		}
+		for _, listDigest := range sortedKeys(source.Items) {
+			image := source.Items[listDigest].Image
+			err := e.exportFile(KindFile, listDigest, "", func(f *os.File) error {
+				return e.fetcher.FetchManifestList(ctx, image.Name, listDigest, image.TLSVerify, f)
+			})
+			if err != nil {
+				return fmt.Errorf("cannot fetch manifest list %s@%s: %w", image.Name, listDigest, err)
+			}
+		}
+	case osbuild.SourceNameOstree:
+		var source osbuild.OSTreeSource
+		if err := json.Unmarshal(rawSource, &source); err != nil {
+			return err
+		}
+		repoDir := filepath.Join(e.dir, ostreeDir)
+		for _, checksum := range sortedKeys(source.Items) {
+			remote := source.Items[checksum].Remote
+			if remote.Secrets != nil {
+				return fmt.Errorf("cannot export commit %s, it needs the %s secrets", checksum, remote.Secrets.Name)
+			}
+			if err := e.fetcher.FetchCommit(ctx, remote.URL, remote.ContentURL, checksum, repoDir); err != nil {
+				return fmt.Errorf("cannot fetch commit %s from %s: %w", checksum, remote.URL, err)
+			}
+			if err := verifyCommit(repoDir, checksum); err != nil {
+				return err
+			}
+			e.index.Items = append(e.index.Items, Item{
+				Kind:     KindCommit,
+				Checksum: checksum,
+				Path:     ostreeDir,
+			})
+		}
+	case osbuild.SourceNameInline, osbuild.SourceNameContainersStorage:
+		// already part of the manifest or the host
+	default:
+		return fmt.Errorf("unsupported source")
+	}
+	return nil
+}
+
+// createRepo writes the repodata of the exported rpms so that "rpms/" can
+// be used as a local rpm repository and adds the repodata to the index
+func (e *exporter) createRepo(ctx context.Context) error {
+	if !slices.ContainsFunc(e.index.Items, func(item Item) bool { return item.Kind == KindRPM }) {
+		return nil
+	}
+	if err := e.fetcher.CreateRepo(ctx, filepath.Join(e.dir, rpmsDir)); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(filepath.Join(e.dir, rpmsDir, repodataDir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		relPath := path.Join(rpmsDir, repodataDir, entry.Name())
+		checksum, err := sha256File(filepath.Join(e.dir, relPath))
+		if err != nil {
+			return err
+		}
+		e.index.Items = append(e.index.Items, Item{
+			Kind:     KindRepodata,
+			Checksum: checksum,
+			Path:     relPath,
+		})
+	}
+	return nil
+}
+
+func (e *exporter) exportURL(ctx context.Context, kind Kind, checksum, rawURL string, insecure bool) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	err = e.exportFile(kind, checksum, path.Base(u.Path), func(f *os.File) error {
+		return e.fetcher.FetchURL(ctx, rawURL, insecure, f)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot fetch %s: %w", rawURL, err)
+	}
+	return nil
+}
+
+// exportFile writes a file with fetch and verifies its checksum. Rpms
+// keep their filename so that "rpms/" is a plain directory of packages,
+// other files are named after their checksum.
+func (e *exporter) exportFile(kind Kind, checksum, filename string, fetch func(*os.File) error) error {
+	if _, err := e.index.item(checksum); err == nil {
+		return nil
+	}
+
+	_, value, _ := strings.Cut(checksum, ":")
+	relPath := path.Join(filesDir, value)
+	if kind == KindRPM {
+		relPath = path.Join(rpmsDir, filename)
+		for _, item := range e.index.Items {
+			if item.Path == relPath {
+				return fmt.Errorf("packages %s and %s are both named %s", item.Checksum, checksum, filename)
+			}
+		}
+	}
+
+	dst := filepath.Join(e.dir, relPath)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := fetch(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := verifyFile(dst, checksum); err != nil {
+		return err
+	}
+
+	e.index.Items = append(e.index.Items, Item{
+		Kind:     kind,
+		Checksum: checksum,
+		Path:     relPath,
+	})
+	return nil
+}
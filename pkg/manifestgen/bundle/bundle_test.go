@@ -0,0 +1,309 @@
+package bundle_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/manifestgen/bundle"
+)
+
+func sha256For(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+const (
+	rpmContent          = "rpm-content"
+	librepoContent      = "librepo-rpm-content"
+	manifestListContent = `{"manifests":[]}`
+	commitContent       = "commit-object"
+	configContent       = `{"architecture":"amd64"}`
+	layerContent        = "layer"
+)
+
+var (
+	imageID    = digest.FromString(configContent).String()
+	listDigest = digest.FromString(manifestListContent).String()
+	commit     = sha256For(commitContent)
+)
+
+type fakeFetcher struct {
+	// content of the urls
+	urls map[string]string
+}
+
+func (ff *fakeFetcher) FetchURL(ctx context.Context, url string, insecure bool, dst io.Writer) error {
+	content, ok := ff.urls[url]
+	if !ok {
+		return fmt.Errorf("unexpected url %s", url)
+	}
+	_, err := io.WriteString(dst, content)
+	return err
+}
+
+func writeBlob(layoutDir, content string) (imgspecv1.Descriptor, error) {
+	d := digest.FromString(content)
+	blobDir := filepath.Join(layoutDir, "blobs", "sha256")
+	if err := os.MkdirAll(blobDir, 0755); err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	desc := imgspecv1.Descriptor{Digest: d, Size: int64(len(content))}
+	return desc, os.WriteFile(filepath.Join(blobDir, d.Encoded()), []byte(content), 0644)
+}
+
+func (ff *fakeFetcher) FetchContainer(ctx context.Context, name, imageDigest string, tlsVerify *bool, layoutDir, ref string) error {
+	if name != "registry.example.com/image" {
+		return fmt.Errorf("unexpected container %s", name)
+	}
+	config, err := writeBlob(layoutDir, configContent)
+	if err != nil {
+		return err
+	}
+	layer, err := writeBlob(layoutDir, layerContent)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(imgspecv1.Manifest{Config: config, Layers: []imgspecv1.Descriptor{layer}})
+	if err != nil {
+		return err
+	}
+	desc, err := writeBlob(layoutDir, string(data))
+	if err != nil {
+		return err
+	}
+	desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: ref}
+	index, err := json.Marshal(imgspecv1.Index{Manifests: []imgspecv1.Descriptor{desc}})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(layoutDir, "index.json"), index, 0644)
+}
+
+func (ff *fakeFetcher) FetchManifestList(ctx context.Context, name, listDigest string, tlsVerify *bool, dst io.Writer) error {
+	_, err := io.WriteString(dst, manifestListContent)
+	return err
+}
+
+func (ff *fakeFetcher) FetchCommit(ctx context.Context, url, contentURL, checksum string, repoDir string) error {
+	objDir := filepath.Join(repoDir, "objects", checksum[:2])
+	if err := os.MkdirAll(objDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(objDir, checksum[2:]+".commit"), []byte(commitContent), 0644)
+}
+
+func (ff *fakeFetcher) CreateRepo(ctx context.Context, repoDir string) error {
+	entries, err := os.ReadDir(repoDir)
+	if err != nil {
+		return err
+	}
+	var repomd string
+	for _, entry := range entries {
+		repomd += entry.Name() + "\n"
+	}
+	if err := os.MkdirAll(filepath.Join(repoDir, "repodata"), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(repoDir, "repodata", "repomd.xml"), []byte(repomd), 0644)
+}
+
+func testManifest(hostFile string) []byte {
+	manifest := fmt.Sprintf(`{
+  "version": "2",
+  "pipelines": [
+    {
+      "name": "os",
+      "stages": [
+        {
+          "type": "org.osbuild.skopeo",
+          "inputs": {
+            "images": {
+              "type": "org.osbuild.containers",
+              "origin": "org.osbuild.source",
+              "references": {"%[1]s": {"name": "registry.example.com/image:latest"}}
+            }
+          }
+        }
+      ]
+    }
+  ],
+  "sources": {
+    "org.osbuild.curl": {
+      "items": {
+        "sha256:%[2]s": {"url": "https://example.com/repo/Packages/bash-5.2-1.x86_64.rpm"},
+        "sha256:%[3]s": {"url": "file:%[4]s"}
+      }
+    },
+    "org.osbuild.librepo": {
+      "items": {
+        "sha256:%[5]s": {"path": "Packages/dnf-4.0-1.noarch.rpm", "mirror": "repo-id"}
+      },
+      "options": {
+        "mirrors": {"repo-id": {"url": "https://example.com/other/", "type": "baseurl"}}
+      }
+    },
+    "org.osbuild.skopeo": {
+      "items": {
+        "%[1]s": {"image": {"name": "registry.example.com/image", "digest": "sha256:%[6]s"}}
+      }
+    },
+    "org.osbuild.skopeo-index": {
+      "items": {
+        "%[7]s": {"image": {"name": "registry.example.com/image"}}
+      }
+    },
+    "org.osbuild.ostree": {
+      "items": {
+        "%[8]s": {"remote": {"url": "https://example.com/ostree", "gpgkeys": ["key"]}}
+      }
+    },
+    "org.osbuild.inline": {
+      "items": {
+        "sha256:%[9]s": {"encoding": "base64", "data": "aW5saW5l"}
+      }
+    }
+  }
+}`, imageID, sha256For(rpmContent), sha256For("host-file"), hostFile, sha256For(librepoContent), sha256For("manifest"), listDigest, commit, sha256For("inline"))
+	return []byte(manifest)
+}
+
+func exportTestBundle(t *testing.T) string {
+	hostFile := filepath.Join(t.TempDir(), "host-file")
+	require.NoError(t, os.WriteFile(hostFile, []byte("host-file"), 0644))
+
+	fetcher := &fakeFetcher{
+		urls: map[string]string{
+			"https://example.com/repo/Packages/bash-5.2-1.x86_64.rpm": rpmContent,
+			"file:" + hostFile: "host-file",
+			"https://example.com/other/Packages/dnf-4.0-1.noarch.rpm": librepoContent,
+		},
+	}
+	dir := filepath.Join(t.TempDir(), "bundle")
+	require.NoError(t, bundle.Export(context.Background(), testManifest(hostFile), dir, fetcher))
+	return dir
+}
+
+func TestExportImport(t *testing.T) {
+	dir := exportTestBundle(t)
+	// the repodata of the rpm repository lists the exported rpms
+	repomd := "bash-5.2-1.x86_64.rpm\ndnf-4.0-1.noarch.rpm\n"
+
+	idx, err := bundle.ReadIndex(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []bundle.Item{
+		{Kind: bundle.KindFile, Checksum: "sha256:" + sha256For("host-file"), Path: "files/" + sha256For("host-file")},
+		{Kind: bundle.KindRPM, Checksum: "sha256:" + sha256For(rpmContent), Path: "rpms/bash-5.2-1.x86_64.rpm"},
+		{Kind: bundle.KindRPM, Checksum: "sha256:" + sha256For(librepoContent), Path: "rpms/dnf-4.0-1.noarch.rpm"},
+		{Kind: bundle.KindCommit, Checksum: commit, Path: "ostree"},
+		{Kind: bundle.KindContainer, Checksum: imageID, Path: "containers", Ref: imageID[len("sha256:"):], Name: "registry.example.com/image"},
+		{Kind: bundle.KindFile, Checksum: listDigest, Path: "files/" + listDigest[len("sha256:"):]},
+		{Kind: bundle.KindRepodata, Checksum: "sha256:" + sha256For(repomd), Path: "rpms/repodata/repomd.xml"},
+	}, idx.Items)
+
+	var loaded []string
+	loader := func(ctx context.Context, layoutDir, ref, name string) error {
+		loaded = append(loaded, fmt.Sprintf("%s:%s %s", layoutDir, ref, name))
+		return nil
+	}
+	manifest, err := bundle.Import(context.Background(), dir, loader)
+	require.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("%s/containers:%s registry.example.com/image", dir, imageID[len("sha256:"):])}, loaded)
+
+	var result struct {
+		Pipelines []struct {
+			Stages []struct {
+				Inputs map[string]struct {
+					Type string `json:"type"`
+				} `json:"inputs"`
+			} `json:"stages"`
+		} `json:"pipelines"`
+		Sources map[string]json.RawMessage `json:"sources"`
+	}
+	require.NoError(t, json.Unmarshal(manifest, &result))
+	assert.Equal(t, "org.osbuild.containers-storage", result.Pipelines[0].Stages[0].Inputs["images"].Type)
+	assert.ElementsMatch(t, []string{"org.osbuild.curl", "org.osbuild.containers-storage", "org.osbuild.ostree", "org.osbuild.inline"}, keys(result.Sources))
+	assert.JSONEq(t, fmt.Sprintf(`{"items": {
+	  "sha256:%s": "file://%s/rpms/bash-5.2-1.x86_64.rpm",
+	  "sha256:%s": "file://%s/files/%s",
+	  "sha256:%s": "file://%s/rpms/dnf-4.0-1.noarch.rpm",
+	  "%s": "file://%s/files/%s"
+	}}`, sha256For(rpmContent), dir,
+		sha256For("host-file"), dir, sha256For("host-file"),
+		sha256For(librepoContent), dir,
+		listDigest, dir, listDigest[len("sha256:"):]), string(result.Sources["org.osbuild.curl"]))
+	assert.JSONEq(t, fmt.Sprintf(`{"items": {"%s": {}}}`, imageID), string(result.Sources["org.osbuild.containers-storage"]))
+	assert.JSONEq(t, fmt.Sprintf(`{"items": {"%s": {"remote": {"url": "file://%s/ostree", "gpgkeys": ["key"]}}}}`, commit, dir), string(result.Sources["org.osbuild.ostree"]))
+	assert.JSONEq(t, fmt.Sprintf(`{"items": {"sha256:%s": {"encoding": "base64", "data": "aW5saW5l"}}}`, sha256For("inline")), string(result.Sources["org.osbuild.inline"]))
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestImportVerifies(t *testing.T) {
+	dir := exportTestBundle(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rpms", "bash-5.2-1.x86_64.rpm"), []byte("tampered"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rpms", "repodata", "repomd.xml"), []byte("tampered"), 0644))
+	layer := digest.FromString(layerContent)
+	require.NoError(t, os.Remove(filepath.Join(dir, "containers", "blobs", "sha256", layer.Encoded())))
+
+	loader := func(ctx context.Context, layoutDir, ref, name string) error {
+		panic("containers must not be loaded from a broken bundle")
+	}
+	_, err := bundle.Import(context.Background(), dir, loader)
+	assert.ErrorContains(t, err, fmt.Sprintf("rpm sha256:%s: checksum mismatch", sha256For(rpmContent)))
+	assert.ErrorContains(t, err, "rpms/repodata/repomd.xml: expected")
+	assert.ErrorContains(t, err, fmt.Sprintf("container %s: open ", imageID))
+}
+
+func TestExportErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sources  string
+		expected string
+	}{
+		{
+			name:     "secrets",
+			sources:  `{"org.osbuild.curl": {"items": {"sha256:abc": {"url": "https://cdn.example.com/a.rpm", "secrets": {"name": "org.osbuild.rhsm"}}}}}`,
+			expected: "cannot export source org.osbuild.curl: cannot export https://cdn.example.com/a.rpm, it needs the org.osbuild.rhsm secrets",
+		},
+		{
+			name:     "metalink",
+			sources:  `{"org.osbuild.librepo": {"items": {"sha256:abc": {"path": "a.rpm", "mirror": "m"}}, "options": {"mirrors": {"m": {"url": "https://example.com/metalink", "type": "metalink"}}}}}`,
+			expected: "cannot export source org.osbuild.librepo: cannot export a.rpm from a metalink, only baseurls are supported",
+		},
+		{
+			name:     "checksum mismatch",
+			sources:  `{"org.osbuild.curl": {"items": {"sha256:abc": "https://example.com/a.rpm"}}}`,
+			expected: "cannot export source org.osbuild.curl: cannot fetch https://example.com/a.rpm: checksum mismatch",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fetcher := &fakeFetcher{urls: map[string]string{"https://example.com/a.rpm": "a"}}
+			manifest := fmt.Sprintf(`{"version": "2", "pipelines": [], "sources": %s}`, tc.sources)
+			err := bundle.Export(context.Background(), []byte(manifest), t.TempDir(), fetcher)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
+
+func TestExportNotEmpty(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+	err := bundle.Export(context.Background(), []byte(`{}`), dir, &fakeFetcher{})
+	assert.EqualError(t, err, fmt.Sprintf("bundle directory %q is not empty", dir))
+}
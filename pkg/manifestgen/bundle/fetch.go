@@ -0,0 +1,170 @@
+package bundle
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/osbuild/images/pkg/container"
+)
+
+// Fetcher downloads the content of the sources of a manifest into a
+// bundle and creates the rpm repository of the bundle
+type Fetcher interface {
+	// FetchURL writes the content of the given URL to dst
+	FetchURL(ctx context.Context, url string, insecure bool, dst io.Writer) error
+
+	// FetchContainer copies the image with the given manifest digest
+	// into the OCI layout at layoutDir under the given ref
+	FetchContainer(ctx context.Context, name, digest string, tlsVerify *bool, layoutDir, ref string) error
+
+	// FetchManifestList writes the manifest list with the given digest
+	// to dst
+	FetchManifestList(ctx context.Context, name, listDigest string, tlsVerify *bool, dst io.Writer) error
+
+	// FetchCommit pulls the commit with the given checksum into the
+	// archive ostree repo at repoDir, the repo is created if it does
+	// not exist
+	FetchCommit(ctx context.Context, url, contentURL, checksum string, repoDir string) error
+
+	// CreateRepo writes the repodata of the rpms in repoDir into
+	// "repodata/" of repoDir
+	CreateRepo(ctx context.Context, repoDir string) error
+}
+
+// ContainerLoader loads the image with the given ref from the OCI layout
+// at layoutDir into the local containers-storage under the given name
+type ContainerLoader func(ctx context.Context, layoutDir, ref, name string) error
+
+// DefaultFetcher downloads files with net/http, containers with
+// containers/image and ostree commits with the ostree command, it creates
+// the rpm repository with the createrepo_c command
+type DefaultFetcher struct{}
+
+var _ = Fetcher(DefaultFetcher{})
+
+func (DefaultFetcher) FetchURL(ctx context.Context, rawURL string, insecure bool, dst io.Writer) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	// GenSources adds local files as "file:" URLs
+	if u.Scheme == "file" {
+		f, err := os.Open(u.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(dst, f)
+		return err
+	}
+
+	client := http.DefaultClient
+	if insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		/* #nosec G402 */
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		client = &http.Client{Transport: transport}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot fetch %s: %s", rawURL, resp.Status)
+	}
+	_, err = io.Copy(dst, resp.Body)
+	return err
+}
+
+func newContainerClient(name string, tlsVerify *bool) (*container.Client, error) {
+	client, err := container.NewClient(name)
+	if err != nil {
+		return nil, err
+	}
+	client.SetTLSVerify(tlsVerify)
+	client.ReportWriter = io.Discard
+	return client, nil
+}
+
+func (DefaultFetcher) FetchContainer(ctx context.Context, name, imageDigest string, tlsVerify *bool, layoutDir, ref string) error {
+	client, err := newContainerClient(name, tlsVerify)
+	if err != nil {
+		return err
+	}
+	from := fmt.Sprintf("docker://%s@%s", client.Target.Name(), imageDigest)
+	_, err = client.CopyImage(ctx, from, fmt.Sprintf("oci:%s:%s", layoutDir, ref))
+	return err
+}
+
+func (DefaultFetcher) FetchManifestList(ctx context.Context, name, listDigest string, tlsVerify *bool, dst io.Writer) error {
+	client, err := newContainerClient(name, tlsVerify)
+	if err != nil {
+		return err
+	}
+	rm, err := client.GetManifest(ctx, digest.Digest(listDigest), false)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(rm.Data)
+	return err
+}
+
+func (DefaultFetcher) FetchCommit(ctx context.Context, url, contentURL, checksum string, repoDir string) error {
+	if _, err := os.Stat(filepath.Join(repoDir, "config")); errors.Is(err, os.ErrNotExist) {
+		if err := runOSTree(ctx, "init", "--repo="+repoDir, "--mode=archive"); err != nil {
+			return err
+		}
+	}
+	// a remote per commit, commits can come from different repositories
+	remote := "bundle-" + checksum
+	args := []string{"remote", "add", "--repo=" + repoDir, "--no-gpg-verify", "--if-not-exists"}
+	if contentURL != "" {
+		args = append(args, "--set=contenturl="+contentURL)
+	}
+	args = append(args, remote, url)
+	if err := runOSTree(ctx, args...); err != nil {
+		return err
+	}
+	return runOSTree(ctx, "pull", "--repo="+repoDir, "--mirror", remote, checksum)
+}
+
+func (DefaultFetcher) CreateRepo(ctx context.Context, repoDir string) error {
+	output, err := exec.CommandContext(ctx, "createrepo_c", repoDir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("createrepo_c failed: %w\n%s", err, output)
+	}
+	return nil
+}
+
+// DefaultContainerLoader loads images with containers/image
+func DefaultContainerLoader(ctx context.Context, layoutDir, ref, name string) error {
+	client, err := newContainerClient(name, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.CopyImage(ctx, fmt.Sprintf("oci:%s:%s", layoutDir, ref), "containers-storage:"+client.Target.String())
+	return err
+}
+
+func runOSTree(ctx context.Context, args ...string) error {
+	output, err := exec.CommandContext(ctx, "ostree", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ostree %s failed: %w\n%s", args[0], err, output)
+	}
+	return nil
+}
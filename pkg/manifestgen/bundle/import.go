@@ -0,0 +1,255 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// ReadIndex reads the index of the bundle in dir
+func ReadIndex(dir string) (*Index, error) {
+	data, err := os.ReadFile(filepath.Join(dir, indexFilename))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read bundle index: %w", err)
+	}
+	var idx Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("cannot parse bundle index: %w", err)
+	}
+	if idx.Version != IndexVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, expected %d", idx.Version, IndexVersion)
+	}
+	return &idx, nil
+}
+
+// Verify checks the checksums of all items of the bundle in dir, the
+// returned error lists all items that failed to verify
+func Verify(dir string) error {
+	idx, err := ReadIndex(dir)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, item := range idx.Items {
+		var err error
+		switch item.Kind {
+		case KindRPM, KindRepodata, KindFile:
+			err = verifyFile(filepath.Join(dir, item.Path), item.Checksum)
+		case KindContainer:
+			err = verifyOCIImage(filepath.Join(dir, item.Path), item.Ref, item.Checksum)
+		case KindCommit:
+			err = verifyCommit(filepath.Join(dir, item.Path), item.Checksum)
+		default:
+			err = fmt.Errorf("unknown kind %q", item.Kind)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", item.Kind, item.Checksum, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("bundle %q failed to verify: %w", dir, errors.Join(errs...))
+	}
+	return nil
+}
+
+// Import verifies the bundle in dir, loads its containers into the local
+// containers-storage with the loader and returns the manifest of the
+// bundle with its sources rewritten to the content of the bundle. The
+// loader may be nil, the DefaultContainerLoader is used then.
+//
+// The bundle must stay at dir until the manifest is built.
+func Import(ctx context.Context, dir string, loader ContainerLoader) ([]byte, error) {
+	if loader == nil {
+		loader = DefaultContainerLoader
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(dir); err != nil {
+		return nil, err
+	}
+	idx, err := ReadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range idx.Items {
+		if item.Kind != KindContainer {
+			continue
+		}
+		if err := loader(ctx, filepath.Join(dir, item.Path), item.Ref, item.Name); err != nil {
+			return nil, fmt.Errorf("cannot load container %s: %w", item.Name, err)
+		}
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+	if err != nil {
+		return nil, err
+	}
+	return rewriteManifest(manifest, dir, idx)
+}
+
+func fileURL(dir, relPath string) string {
+	u := url.URL{Scheme: "file", Path: filepath.Join(dir, relPath)}
+	return u.String()
+}
+
+// rewriteManifest rewrites the sources of the manifest to the content of
+// the bundle at dir
+func rewriteManifest(manifest []byte, dir string, idx *Index) ([]byte, error) {
+	raw, err := parseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	curl := osbuild.NewCurlSource()
+	addFile := func(checksum string) error {
+		item, err := idx.item(checksum)
+		if err != nil {
+			return err
+		}
+		curl.Items[checksum] = osbuild.URL(fileURL(dir, item.Path))
+		return nil
+	}
+	localContainers := osbuild.NewContainersStorageSource()
+	var ostreeSource *osbuild.OSTreeSource
+
+	sources := make(map[string]any, len(raw.sources))
+	for _, name := range sortedKeys(raw.sources) {
+		rawSource := raw.sources[name]
+		switch name {
+		case osbuild.SourceNameCurl:
+			var source osbuild.CurlSource
+			if err := json.Unmarshal(rawSource, &source); err != nil {
+				return nil, err
+			}
+			for checksum := range source.Items {
+				if err := addFile(checksum); err != nil {
+					return nil, err
+				}
+			}
+		case osbuild.SourceNameLibrepo:
+			var source osbuild.LibrepoSource
+			if err := json.Unmarshal(rawSource, &source); err != nil {
+				return nil, err
+			}
+			for checksum := range source.Items {
+				if err := addFile(checksum); err != nil {
+					return nil, err
+				}
+			}
+		case osbuild.SourceNameSkopeoIndex:
+			var source osbuild.SkopeoIndexSource
+			if err := json.Unmarshal(rawSource, &source); err != nil {
+				return nil, err
+			}
+			// the manifest lists are plain files for the stages
+			for listDigest := range source.Items {
+				if err := addFile(listDigest); err != nil {
+					return nil, err
+				}
+			}
+		case osbuild.SourceNameSkopeo:
+			var source osbuild.SkopeoSource
+			if err := json.Unmarshal(rawSource, &source); err != nil {
+				return nil, err
+			}
+			for imageID := range source.Items {
+				if _, err := idx.item(imageID); err != nil {
+					return nil, err
+				}
+				localContainers.AddItem(imageID)
+			}
+		case osbuild.SourceNameContainersStorage:
+			var source osbuild.ContainersStorageSource
+			if err := json.Unmarshal(rawSource, &source); err != nil {
+				return nil, err
+			}
+			for imageID := range source.Items {
+				localContainers.AddItem(imageID)
+			}
+		case osbuild.SourceNameOstree:
+			var source osbuild.OSTreeSource
+			if err := json.Unmarshal(rawSource, &source); err != nil {
+				return nil, err
+			}
+			ostreeSource = osbuild.NewOSTreeSource()
+			for checksum, item := range source.Items {
+				bundleItem, err := idx.item(checksum)
+				if err != nil {
+					return nil, err
+				}
+				ostreeSource.Items[checksum] = osbuild.OSTreeSourceItem{
+					Remote: osbuild.OSTreeSourceRemote{
+						URL:     fileURL(dir, bundleItem.Path),
+						GPGKeys: item.Remote.GPGKeys,
+					},
+				}
+			}
+		default:
+			sources[name] = rawSource
+		}
+	}
+	if len(curl.Items) > 0 {
+		sources[osbuild.SourceNameCurl] = curl
+	}
+	if len(localContainers.Items) > 0 {
+		sources[osbuild.SourceNameContainersStorage] = localContainers
+	}
+	if ostreeSource != nil {
+		sources[osbuild.SourceNameOstree] = ostreeSource
+	}
+	rawSources, err := json.Marshal(sources)
+	if err != nil {
+		return nil, err
+	}
+	raw.top["sources"] = rawSources
+
+	if _, ok := raw.sources[osbuild.SourceNameSkopeo]; ok {
+		pipelines, err := useLocalContainers(raw.top["pipelines"])
+		if err != nil {
+			return nil, err
+		}
+		raw.top["pipelines"] = pipelines
+	}
+
+	return json.Marshal(raw.top)
+}
+
+// useLocalContainers switches the container inputs of all stages from
+// the registry to the local containers-storage, both are keyed by the
+// image ID
+func useLocalContainers(rawPipelines json.RawMessage) (json.RawMessage, error) {
+	var pipelines any
+	dec := json.NewDecoder(bytes.NewReader(rawPipelines))
+	dec.UseNumber()
+	if err := dec.Decode(&pipelines); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest pipelines: %w", err)
+	}
+
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if v["type"] == "org.osbuild.containers" && v["origin"] == osbuild.InputOriginSource {
+				v["type"] = osbuild.SourceNameContainersStorage
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(pipelines)
+	return json.Marshal(pipelines)
+}
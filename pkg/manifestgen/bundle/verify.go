@@ -0,0 +1,136 @@
+package bundle
+
+import (
+	"crypto/md5"  // #nosec G501
+	"crypto/sha1" // #nosec G505
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// verifyFile checks that the file at path has the given "<type>:<value>"
+// checksum, the types of the curl source are supported
+func verifyFile(path, checksum string) error {
+	var h hash.Hash
+	checksumType, value, _ := strings.Cut(checksum, ":")
+	switch checksumType {
+	case "md5":
+		h = md5.New() // #nosec G401
+	case "sha1":
+		h = sha1.New() // #nosec G401
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported checksum %q", checksum)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != value {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s:%s", path, checksum, checksumType, actual)
+	}
+	return nil
+}
+
+// sha256File returns the "sha256:<value>" checksum of the file at path
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func verifyBlob(layoutDir string, d digest.Digest) ([]byte, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(layoutDir, "blobs", d.Algorithm().String(), d.Encoded()))
+	if err != nil {
+		return nil, err
+	}
+	if actual := d.Algorithm().FromBytes(data); actual != d {
+		return nil, fmt.Errorf("blob %s has the digest %s", d, actual)
+	}
+	return data, nil
+}
+
+// verifyOCIImage checks that the image with the given ref in the OCI
+// layout has the imageID and that all of its blobs are intact
+func verifyOCIImage(layoutDir, ref, imageID string) error {
+	data, err := os.ReadFile(filepath.Join(layoutDir, "index.json"))
+	if err != nil {
+		return err
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("cannot parse OCI index: %w", err)
+	}
+
+	var manifestDesc *imgspecv1.Descriptor
+	for i, desc := range index.Manifests {
+		if desc.Annotations[imgspecv1.AnnotationRefName] == ref {
+			manifestDesc = &index.Manifests[i]
+			break
+		}
+	}
+	if manifestDesc == nil {
+		return fmt.Errorf("image %s is not in the OCI layout", ref)
+	}
+
+	data, err = verifyBlob(layoutDir, manifestDesc.Digest)
+	if err != nil {
+		return err
+	}
+	var manifest imgspecv1.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("cannot parse image manifest: %w", err)
+	}
+	// the image ID is the digest of the config
+	if manifest.Config.Digest.String() != imageID {
+		return fmt.Errorf("image %s has the ID %s, expected %s", ref, manifest.Config.Digest, imageID)
+	}
+	for _, desc := range append([]imgspecv1.Descriptor{manifest.Config}, manifest.Layers...) {
+		if _, err := verifyBlob(layoutDir, desc.Digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyCommit checks that the commit object in the ostree repo has the
+// given checksum. The checksum of an ostree metadata object is the
+// sha256 of its content. The objects the commit refers to are verified
+// by ostree when osbuild pulls the commit.
+func verifyCommit(repoDir, checksum string) error {
+	if len(checksum) != sha256.Size*2 {
+		return fmt.Errorf("invalid commit checksum %q", checksum)
+	}
+	commitPath := filepath.Join(repoDir, "objects", checksum[:2], checksum[2:]+".commit")
+	return verifyFile(commitPath, "sha256:"+checksum)
+}
@@ -2,6 +2,7 @@ package manifestgen
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,12 +15,17 @@ import (
 	"github.com/osbuild/blueprint/pkg/blueprint"
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/artifact"
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/diskestimate"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/manifestgen/bundle"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/ostree"
+	"github.com/osbuild/images/pkg/packagepolicy"
 	"github.com/osbuild/images/pkg/reporegistry"
 	"github.com/osbuild/images/pkg/rpmmd"
 	"github.com/osbuild/images/pkg/sbom"
@@ -27,7 +33,6 @@ import (
 
 const (
 	defaultDepsolverSBOMType = sbom.StandardTypeSpdx
-	defaultSBOMExt           = "spdx.json"
 
 	defaultDepsolveCacheDir = "osbuild-depsolve-dnf"
 )
@@ -36,6 +41,37 @@ var (
 	ErrContainerArchMismatch = errors.New("requested container architecture does not match resolved container")
 )
 
+// DiskSpaceCheckMode selects what happens if the estimated usage of a
+// mountpoint exceeds its size, see Options.DiskSpaceCheck
+type DiskSpaceCheckMode string
+
+const (
+	// DiskSpaceCheckNone does not estimate the disk space
+	DiskSpaceCheckNone DiskSpaceCheckMode = ""
+	// DiskSpaceCheckWarn reports the mountpoints as warnings
+	DiskSpaceCheckWarn DiskSpaceCheckMode = "warn"
+	// DiskSpaceCheckError returns a *DiskSpaceError
+	DiskSpaceCheckError DiskSpaceCheckMode = "error"
+	// DiskSpaceCheckGrow grows the partitions, logical volumes and
+	// the image to fit the estimated usage
+	DiskSpaceCheckGrow DiskSpaceCheckMode = "grow"
+)
+
+// DiskSpaceError is returned if the estimated usage of mountpoints of an
+// image exceeds their size
+type DiskSpaceError struct {
+	Pipeline string
+	Exceeded []disk.SpaceUsage
+}
+
+func (e *DiskSpaceError) Error() string {
+	lines := make([]string, 0, len(e.Exceeded))
+	for _, u := range e.Exceeded {
+		lines = append(lines, u.String())
+	}
+	return fmt.Sprintf("estimated disk usage of pipeline %q exceeds the partition table:\n%s", e.Pipeline, strings.Join(lines, "\n"))
+}
+
 // Options contains the optional settings for the manifest generation.
 // For unset values defaults will be used.
 type Options struct {
@@ -53,6 +89,10 @@ type Options struct {
 	// content can be read
 	SBOMWriter SBOMWriterFunc
 
+	// SBOMType selects the standard of the SBOM documents passed
+	// to the SBOMWriter. If unset SPDX is used.
+	SBOMType sbom.StandardType
+
 	// WarningsOutput will receive any warnings that are part of
 	// the manifest generation. If it is unset any warnings will
 	// generate an error.
@@ -80,6 +120,37 @@ type Options struct {
 	// Use the a bootstrap container to buildroot (useful for e.g.
 	// cross-arch or cross-distro builds)
 	UseBootstrapContainer bool
+
+	// Lockfile regenerates the manifest from the locked packages
+	// instead of depsolving the package sets. If the lockfile no
+	// longer satisfies the package sets of the image type a
+	// *depsolvednf.LockfileDriftError is returned. SBOMs cannot be
+	// generated from a lockfile.
+	Lockfile *depsolvednf.Lockfile
+
+	// LockfileOutput will receive the lockfile of the depsolved
+	// package sets, it can be passed as Lockfile to regenerate
+	// the same manifest later.
+	LockfileOutput io.Writer
+
+	// BundleFetcher downloads the content of the bundles of
+	// GenerateBundle, if unset bundle.DefaultFetcher is used.
+	BundleFetcher bundle.Fetcher
+
+	// PackagePolicies are checked against the depsolved packages
+	// of the image types they apply to. Violations of enforced
+	// policies return a *packagepolicy.ViolationError, the others
+	// are reported as warnings.
+	PackagePolicies []packagepolicy.Policy
+
+	// DiskSpaceCheck estimates the space the packages, kernels
+	// and containers of the image need on each mountpoint of its
+	// partition table before osbuild runs, see the diskestimate
+	// package. It is disabled by default.
+	DiskSpaceCheck DiskSpaceCheckMode
+	// DiskSpaceEstimate tunes the estimate, if unset the
+	// defaults of the diskestimate package are used.
+	DiskSpaceEstimate *diskestimate.Options
 }
 
 // Generator can generate an osbuild manifest from a given repository
@@ -91,6 +162,7 @@ type Generator struct {
 	containerResolver      ContainerResolverFunc
 	commitResolver         CommitResolverFunc
 	sbomWriter             SBOMWriterFunc
+	sbomType               sbom.StandardType
 	warningsOutput         io.Writer
 	depsolveWarningsOutput io.Writer
 
@@ -102,6 +174,16 @@ type Generator struct {
 	overrideRepos []rpmmd.RepoConfig
 
 	useBootstrapContainer bool
+
+	lockfile       *depsolvednf.Lockfile
+	lockfileOutput io.Writer
+
+	bundleFetcher bundle.Fetcher
+
+	packagePolicies []packagepolicy.Policy
+
+	diskSpaceCheck    DiskSpaceCheckMode
+	diskSpaceEstimate *diskestimate.Options
 }
 
 // New will create a new manifest generator
@@ -109,6 +191,19 @@ func New(reporegistry *reporegistry.RepoRegistry, opts *Options) (*Generator, er
 	if opts == nil {
 		opts = &Options{}
 	}
+	if opts.Lockfile != nil && opts.SBOMWriter != nil {
+		return nil, fmt.Errorf("cannot generate SBOMs from a lockfile")
+	}
+	switch opts.DiskSpaceCheck {
+	case DiskSpaceCheckNone, DiskSpaceCheckWarn, DiskSpaceCheckError, DiskSpaceCheckGrow:
+	default:
+		return nil, fmt.Errorf("invalid disk space check mode %q", opts.DiskSpaceCheck)
+	}
+	for _, policy := range opts.PackagePolicies {
+		if err := policy.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	mg := &Generator{
 		reporegistry: reporegistry,
 
@@ -118,15 +213,25 @@ func New(reporegistry *reporegistry.RepoRegistry, opts *Options) (*Generator, er
 		commitResolver:         opts.CommitResolver,
 		rpmDownloader:          opts.RpmDownloader,
 		sbomWriter:             opts.SBOMWriter,
+		sbomType:               opts.SBOMType,
 		warningsOutput:         opts.WarningsOutput,
 		depsolveWarningsOutput: opts.DepsolveWarningsOutput,
 		customSeed:             opts.CustomSeed,
 		overrideRepos:          opts.OverrideRepos,
 		useBootstrapContainer:  opts.UseBootstrapContainer,
+		lockfile:               opts.Lockfile,
+		lockfileOutput:         opts.LockfileOutput,
+		bundleFetcher:          opts.BundleFetcher,
+		packagePolicies:        opts.PackagePolicies,
+		diskSpaceCheck:         opts.DiskSpaceCheck,
+		diskSpaceEstimate:      opts.DiskSpaceEstimate,
 	}
 	if mg.depsolve == nil {
 		mg.depsolve = DefaultDepsolve
 	}
+	if mg.sbomType == sbom.StandardTypeNone {
+		mg.sbomType = defaultDepsolverSBOMType
+	}
 	if mg.containerResolver == nil {
 		mg.containerResolver = func(containerSources map[string][]container.SourceSpec, archName string) (map[string][]container.Spec, error) {
 			return container.NewBlockingResolver(archName).ResolveAll(containerSources)
@@ -153,18 +258,10 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 		imgOpts = &distro.ImageOptions{}
 	}
 	imgOpts.UseBootstrapContainer = mg.useBootstrapContainer
-	a := imgType.Arch()
-	dist := a.Distro()
 
-	var repos []rpmmd.RepoConfig
-	if mg.overrideRepos != nil {
-		repos = mg.overrideRepos
-	} else {
-		var err error
-		repos, err = mg.reporegistry.ReposByImageTypeName(dist.Name(), a.Name(), imgType.Name())
-		if err != nil {
-			return nil, err
-		}
+	repos, err := mg.repos(imgType)
+	if err != nil {
+		return nil, err
 	}
 	// To support "user" a.k.a. "3rd party" repositories, these
 	// will have to be added to the repos with
@@ -174,6 +271,76 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 	if err != nil {
 		return nil, err
 	}
+	return mg.serialize(preManifest, warnings, imgType)
+}
+
+// GenerateBundle will generate a new manifest like Generate and export
+// all content the manifest fetches into the bundle directory dir, see the
+// bundle package. The manifest can then be built without network access
+// from the manifest returned by bundle.Import(). Cancelling ctx stops the
+// export.
+func (mg *Generator) GenerateBundle(ctx context.Context, dir string, bp *blueprint.Blueprint, imgType distro.ImageType, imgOpts *distro.ImageOptions) ([]byte, error) {
+	mf, err := mg.Generate(bp, imgType, imgOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := bundle.Export(ctx, mf, dir, mg.bundleFetcher); err != nil {
+		return nil, fmt.Errorf("cannot export bundle: %w", err)
+	}
+	return mf, nil
+}
+
+// GenerateMulti will generate a single manifest that builds all the given
+// image types from one shared OS tree and disk image. The image types
+// need to be of the same distro and arch and may only differ in the
+// format of the exported image, see distro.MultiManifestImageType.
+//
+// The artifacts of the image types are returned in the same order as the
+// image types, followed by the artifacts of the additional disks of the
+// image options. Their exports can be passed to osbuild to build all images
+// in a single run.
+func (mg *Generator) GenerateMulti(bp *blueprint.Blueprint, imgTypes []distro.ImageType, imgOpts *distro.ImageOptions) ([]byte, []*artifact.Artifact, error) {
+	if len(imgTypes) == 0 {
+		return nil, nil, fmt.Errorf("no image types to generate a manifest for")
+	}
+	imgType, ok := imgTypes[0].(distro.MultiManifestImageType)
+	if !ok {
+		return nil, nil, fmt.Errorf("image type %q cannot be combined with other image types", imgTypes[0].Name())
+	}
+	if imgOpts == nil {
+		imgOpts = &distro.ImageOptions{}
+	}
+	imgOpts.UseBootstrapContainer = mg.useBootstrapContainer
+
+	repos, err := mg.repos(imgType)
+	if err != nil {
+		return nil, nil, err
+	}
+	preManifest, artifacts, warnings, err := imgType.MultiManifest(bp, *imgOpts, repos, mg.customSeed, imgTypes[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	mf, err := mg.serialize(preManifest, warnings, imgType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mf, artifacts, nil
+}
+
+func (mg *Generator) repos(imgType distro.ImageType) ([]rpmmd.RepoConfig, error) {
+	if mg.overrideRepos != nil {
+		return mg.overrideRepos, nil
+	}
+	a := imgType.Arch()
+	return mg.reporegistry.ReposByImageTypeName(a.Distro().Name(), a.Name(), imgType.Name())
+}
+
+// serialize depsolves and resolves the content of the given manifest of
+// the image type and returns the serialized osbuild manifest
+func (mg *Generator) serialize(preManifest *manifest.Manifest, warnings []string, imgType distro.ImageType) ([]byte, error) {
+	a := imgType.Arch()
+	dist := a.Distro()
+
 	if len(warnings) > 0 {
 		warn := strings.Join(warnings, "\n")
 		if mg.warningsOutput != nil {
@@ -186,28 +353,18 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 	if err != nil {
 		return nil, err
 	}
-	solver := depsolvednf.NewSolver(dist.ModulePlatformID(), dist.Releasever(), a.Name(), dist.Name(), mg.cacheDir)
-	if dd, ok := dist.(distro.CustomDepsolverDistro); ok {
-		// XXX: it would be nice to have access to arch.Arch
-		// from distro.Arch but we dont so we have to do without.
-		archi := common.Must(arch.FromString(a.Name()))
-		customSolver, cleanupFunc, err := dd.Depsolver(mg.cacheDir, archi)
-		if err != nil {
-			return nil, err
-		}
-		if customSolver != nil {
-			solver = customSolver
-		}
-		defer func() {
-			if err := cleanupFunc(); err != nil {
-				fmt.Fprintf(mg.warningsOutput, "WARNING: cleanup failed: %v\n", err)
-			}
-		}()
-	}
-	depsolved, err := mg.depsolve(solver, mg.cacheDir, mg.depsolveWarningsOutput, pkgSetChains, dist, a.Name())
+	depsolved, err := mg.depsolvePackageSets(pkgSetChains, dist, a)
 	if err != nil {
 		return nil, err
 	}
+	if err := mg.checkPackagePolicies(depsolved, preManifest.PayloadPipelines(), imgType); err != nil {
+		return nil, err
+	}
+	if mg.lockfileOutput != nil {
+		if err := depsolvednf.NewLockfile(depsolved).Write(mg.lockfileOutput); err != nil {
+			return nil, fmt.Errorf("cannot write lockfile: %w", err)
+		}
+	}
 	containerSpecs, err := mg.containerResolver(preManifest.GetContainerSourceSpecs(), a.Name())
 	if err != nil {
 		return nil, err
@@ -224,6 +381,9 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 	if err != nil {
 		return nil, err
 	}
+	if err := mg.checkDiskSpace(preManifest, depsolved, containerSpecs); err != nil {
+		return nil, err
+	}
 	opts := &manifest.SerializeOptions{
 		RpmDownloader: mg.rpmDownloader,
 	}
@@ -246,14 +406,20 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 			}
 			// XXX: sync with image-builder-cli:build.go name generation - can we have a shared helper?
 			imageName := fmt.Sprintf("%s-%s-%s", dist.Name(), imgType.Name(), a.Name())
-			sbomDocOutputFilename := fmt.Sprintf("%s.%s-%s.%s", imageName, pipelinePurpose, plName, defaultSBOMExt)
+			sbomDocOutputFilename := fmt.Sprintf("%s.%s-%s.%s", imageName, pipelinePurpose, plName, mg.sbomType.FileExtension())
+
+			// the depsolver generates SPDX, convert if needed
+			sbomDoc, err := depsolvedPipeline.SBOM.Convert(mg.sbomType)
+			if err != nil {
+				return nil, err
+			}
 
 			var buf bytes.Buffer
 			enc := json.NewEncoder(&buf)
-			if err := enc.Encode(depsolvedPipeline.SBOM.Document); err != nil {
+			if err := enc.Encode(sbomDoc.Document); err != nil {
 				return nil, err
 			}
-			if err := mg.sbomWriter(sbomDocOutputFilename, &buf, depsolvedPipeline.SBOM.DocType); err != nil {
+			if err := mg.sbomWriter(sbomDocOutputFilename, &buf, sbomDoc.DocType); err != nil {
 				return nil, err
 			}
 		}
@@ -262,6 +428,142 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, imgType distro.ImageType,
 	return mf, nil
 }
 
+// checkPackagePolicies checks the depsolved packages against the package
+// policies that apply to the image type
+func (mg *Generator) checkPackagePolicies(depsolved map[string]depsolvednf.DepsolveResult, payloadPipelines []string, imgType distro.ImageType) error {
+	pipelines := make([]string, 0, len(depsolved))
+	for name := range depsolved {
+		pipelines = append(pipelines, name)
+	}
+	slices.Sort(pipelines)
+
+	var violations, warnings []packagepolicy.Violation
+	for _, policy := range mg.packagePolicies {
+		if !policy.AppliesTo(imgType.Name()) {
+			continue
+		}
+		for _, name := range pipelines {
+			if !policy.ChecksPipeline(name, slices.Contains(payloadPipelines, name)) {
+				continue
+			}
+			pipelineViolations, err := policy.Check(name, depsolved[name].Transactions.AllPackages())
+			if err != nil {
+				return err
+			}
+			if policy.Warn() {
+				warnings = append(warnings, pipelineViolations...)
+			} else {
+				violations = append(violations, pipelineViolations...)
+			}
+		}
+	}
+
+	for _, v := range warnings {
+		// like the warnings of the manifest creation, warnings
+		// are errors without a warnings output
+		if mg.warningsOutput == nil {
+			violations = append(violations, v)
+			continue
+		}
+		fmt.Fprintf(mg.warningsOutput, "WARNING: %s\n", v)
+	}
+	if len(violations) > 0 {
+		return &packagepolicy.ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// checkDiskSpace estimates the usage of the mountpoints of the partition
+// tables of the manifest and grows them if requested
+func (mg *Generator) checkDiskSpace(preManifest *manifest.Manifest, depsolved map[string]depsolvednf.DepsolveResult, containerSpecs map[string][]container.Spec) error {
+	if mg.diskSpaceCheck == DiskSpaceCheckNone {
+		return nil
+	}
+	for _, tpt := range preManifest.GetTreePartitionTables() {
+		pkgs := depsolved[tpt.Pipeline].Transactions.AllPackages()
+		if mg.lockfile != nil {
+			// lockfiles only record the GPG key files
+			// of the packages, the estimate would account the
+			// whole packages to the GPG key directory
+			for i := range pkgs {
+				pkgs[i].Files = nil
+			}
+		}
+		dirUsage := diskestimate.Estimate(diskestimate.Content{
+			Packages:          pkgs,
+			Containers:        containerSpecs[tpt.Pipeline],
+			ContainersStorage: tpt.ContainersStorage,
+		}, mg.diskSpaceEstimate)
+
+		// the directories on additional disks are accounted to their
+		// partition tables, mountpoints are unique across all disks
+		pts := []*disk.PartitionTable{tpt.PartitionTable}
+		for _, d := range tpt.AdditionalDisks {
+			pts = append(pts, d.PartitionTable)
+		}
+		var exceeded []disk.SpaceUsage
+		for i, ptUsage := range disk.SplitDirectoryUsage(pts, dirUsage) {
+			if mg.diskSpaceCheck == DiskSpaceCheckGrow {
+				pts[i].GrowDirectorySizes(ptUsage)
+				continue
+			}
+			usages, err := pts[i].SpaceUsage(ptUsage)
+			if err != nil {
+				return fmt.Errorf("cannot estimate the disk usage of pipeline %q: %w", tpt.Pipeline, err)
+			}
+			for _, u := range usages {
+				if u.Exceeded() {
+					exceeded = append(exceeded, u)
+				}
+			}
+		}
+		if len(exceeded) == 0 {
+			continue
+		}
+		// like the warnings of the manifest creation, warnings
+		// are errors without a warnings output
+		if mg.diskSpaceCheck == DiskSpaceCheckWarn && mg.warningsOutput != nil {
+			for _, u := range exceeded {
+				fmt.Fprintf(mg.warningsOutput, "WARNING: estimated disk usage of pipeline %q exceeds the partition table: %s\n", tpt.Pipeline, u)
+			}
+			continue
+		}
+		return &DiskSpaceError{Pipeline: tpt.Pipeline, Exceeded: exceeded}
+	}
+	return nil
+}
+
+// depsolvePackageSets returns the packages of the given package set
+// chains, they are taken from the lockfile if the generator has one
+func (mg *Generator) depsolvePackageSets(pkgSetChains map[string][]rpmmd.PackageSet, dist distro.Distro, a distro.Arch) (map[string]depsolvednf.DepsolveResult, error) {
+	if mg.lockfile != nil {
+		if err := mg.lockfile.Check(pkgSetChains); err != nil {
+			return nil, err
+		}
+		return mg.lockfile.DepsolveResults()
+	}
+
+	solver := depsolvednf.NewSolver(dist.ModulePlatformID(), dist.Releasever(), a.Name(), dist.Name(), mg.cacheDir)
+	if dd, ok := dist.(distro.CustomDepsolverDistro); ok {
+		// XXX: it would be nice to have access to arch.Arch
+		// from distro.Arch but we dont so we have to do without.
+		archi := common.Must(arch.FromString(a.Name()))
+		customSolver, cleanupFunc, err := dd.Depsolver(mg.cacheDir, archi)
+		if err != nil {
+			return nil, err
+		}
+		if customSolver != nil {
+			solver = customSolver
+		}
+		defer func() {
+			if err := cleanupFunc(); err != nil {
+				fmt.Fprintf(mg.warningsOutput, "WARNING: cleanup failed: %v\n", err)
+			}
+		}()
+	}
+	return mg.depsolve(solver, mg.cacheDir, mg.depsolveWarningsOutput, pkgSetChains, dist, a.Name())
+}
+
 func xdgCacheHome() (string, error) {
 	xdgCacheHome := os.Getenv("XDG_CACHE_HOME")
 	if xdgCacheHome != "" {
@@ -287,12 +589,11 @@ func DefaultDepsolve(solver *depsolvednf.Solver, cacheDir string, depsolveWarnin
 		solver.Stderr = depsolveWarningsOutput
 	}
 
-	// Always generate Spdx SBOMs for now, this makes the
-	// default depsolve slightly slower but it means we
-	// need no extra argument here to select the SBOM
-	// type. Once we have more types than Spdx of course
-	// we need to add a option to select the type.
-	solver.SetSBOMType(sbom.StandardTypeSpdx)
+	// Always generate Spdx SBOMs, this makes the default
+	// depsolve slightly slower but it means we need no extra
+	// argument here to select the SBOM type. Other types
+	// are converted from the Spdx document by the Generator.
+	solver.SetSBOMType(defaultDepsolverSBOMType)
 	return solver.DepsolveAll(packageSets)
 }
 
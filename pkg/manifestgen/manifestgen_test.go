@@ -2,10 +2,13 @@ package manifestgen_test
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"maps"
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 
@@ -16,15 +19,19 @@ import (
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/container"
+	"github.com/osbuild/images/pkg/datasizes"
 	"github.com/osbuild/images/pkg/depsolvednf"
+	"github.com/osbuild/images/pkg/diskestimate"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distrofactory"
 	"github.com/osbuild/images/pkg/imagefilter"
 	"github.com/osbuild/images/pkg/manifestgen"
+	"github.com/osbuild/images/pkg/manifestgen/bundle"
 	"github.com/osbuild/images/pkg/manifestgen/manifestmock"
 	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/osbuild/manifesttest"
 	"github.com/osbuild/images/pkg/ostree"
+	"github.com/osbuild/images/pkg/packagepolicy"
 	"github.com/osbuild/images/pkg/rpmmd"
 	"github.com/osbuild/images/pkg/sbom"
 	testrepos "github.com/osbuild/images/test/data/repositories"
@@ -267,6 +274,49 @@ func TestManifestGeneratorDepsolveWithSbomWriter(t *testing.T) {
 	assert.Equal(t, expected, generatedSboms)
 }
 
+func TestManifestGeneratorDepsolveWithCycloneDXSbomWriter(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+	fac := distrofactory.NewDefault()
+
+	filter, err := imagefilter.New(fac, repos)
+	assert.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+
+	generatedSboms := map[string]string{}
+	opts := &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+
+		SBOMType: sbom.StandardTypeCycloneDX,
+		SBOMWriter: func(filename string, content io.Reader, docType sbom.StandardType) error {
+			assert.Equal(t, sbom.StandardTypeCycloneDX, docType)
+
+			b, err := io.ReadAll(content)
+			assert.NoError(t, err)
+			generatedSboms[filename] = strings.TrimSpace(string(b))
+			return nil
+		},
+	}
+	mg, err := manifestgen.New(repos, opts)
+	assert.NoError(t, err)
+	assert.NotNil(t, mg)
+	var bp blueprint.Blueprint
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	require.NoError(t, err)
+
+	// the fake depsolver generates (empty) SPDX documents that get
+	// converted
+	expected := map[string]string{
+		"centos-9-qcow2-x86_64.buildroot-build.cdx.json": `{"bomFormat":"CycloneDX","specVersion":"1.5","version":1,"components":[]}`,
+		"centos-9-qcow2-x86_64.image-os.cdx.json":        `{"bomFormat":"CycloneDX","specVersion":"1.5","version":1,"components":[]}`,
+	}
+	assert.Equal(t, expected, generatedSboms)
+}
+
 func TestManifestGeneratorSeed(t *testing.T) {
 	repos, err := testrepos.New()
 	assert.NoError(t, err)
@@ -411,3 +461,295 @@ func TestManifestGeneratorUseBootstrapContainer(t *testing.T) {
 		})
 	}
 }
+
+func TestManifestGeneratorMulti(t *testing.T) {
+	repos, err := testrepos.New()
+	require.NoError(t, err)
+	fac := distrofactory.NewDefault()
+	filter, err := imagefilter.New(fac, repos)
+	require.NoError(t, err)
+
+	var imgTypes []distro.ImageType
+	for _, name := range []string{"minimal-raw-xz", "minimal-raw-zst"} {
+		res, err := filter.Filter("distro:fedora-43", "type:"+name, "arch:x86_64")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(res))
+		imgTypes = append(imgTypes, res[0].ImgType)
+	}
+
+	opts := &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+	}
+	mg, err := manifestgen.New(repos, opts)
+	require.NoError(t, err)
+	var bp blueprint.Blueprint
+	osbuildManifest, artifacts, err := mg.GenerateMulti(&bp, imgTypes, nil)
+	require.NoError(t, err)
+
+	pipelineNames, err := manifesttest.PipelineNamesFrom(osbuildManifest)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"build", "os", "image", "xz", "zstd"}, pipelineNames)
+
+	require.Equal(t, 2, len(artifacts))
+	assert.Equal(t, "xz", artifacts[0].Export())
+	assert.Equal(t, imgTypes[0].Filename(), artifacts[0].Filename())
+	assert.Equal(t, "zstd", artifacts[1].Export())
+	assert.Equal(t, imgTypes[1].Filename(), artifacts[1].Filename())
+}
+
+func TestManifestGeneratorMultiIncompatible(t *testing.T) {
+	repos, err := testrepos.New()
+	require.NoError(t, err)
+	fac := distrofactory.NewDefault()
+	filter, err := imagefilter.New(fac, repos)
+	require.NoError(t, err)
+
+	var imgTypes []distro.ImageType
+	for _, name := range []string{"generic-qcow2", "generic-vhd"} {
+		res, err := filter.Filter("distro:fedora-43", "type:"+name, "arch:x86_64")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(res))
+		imgTypes = append(imgTypes, res[0].ImgType)
+	}
+
+	opts := &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+	}
+	mg, err := manifestgen.New(repos, opts)
+	require.NoError(t, err)
+	var bp blueprint.Blueprint
+	_, _, err = mg.GenerateMulti(&bp, imgTypes, nil)
+	assert.ErrorContains(t, err, `image type "generic-vhd" cannot be combined with "generic-qcow2": disk images cannot be built from the same OS tree`)
+}
+
+func panicDepsolve(solver *depsolvednf.Solver, cacheDir string, depsolveWarningsOutput io.Writer, packageSets map[string][]rpmmd.PackageSet, d distro.Distro, arch string) (map[string]depsolvednf.DepsolveResult, error) {
+	panic("panicDepsolve")
+}
+
+func TestManifestGeneratorLockfile(t *testing.T) {
+	repos, err := testrepos.New()
+	require.NoError(t, err)
+	fac := distrofactory.NewDefault()
+	filter, err := imagefilter.New(fac, repos)
+	require.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+
+	customSeed := int64(123)
+	var lockfileBuf bytes.Buffer
+	mg, err := manifestgen.New(repos, &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+		CustomSeed:        &customSeed,
+		LockfileOutput:    &lockfileBuf,
+	})
+	require.NoError(t, err)
+	var bp blueprint.Blueprint
+	expected, err := mg.Generate(&bp, res[0].ImgType, nil)
+	require.NoError(t, err)
+
+	lf, err := depsolvednf.ReadLockfile(&lockfileBuf)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"build", "os"}, slices.Collect(maps.Keys(lf.Pipelines)))
+
+	// regenerating from the lockfile does not depsolve
+	mg, err = manifestgen.New(repos, &manifestgen.Options{
+		Depsolve:          panicDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+		CustomSeed:        &customSeed,
+		Lockfile:          lf,
+	})
+	require.NoError(t, err)
+	osbuildManifest, err := mg.Generate(&bp, res[0].ImgType, nil)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(osbuildManifest))
+
+	// a package added to the blueprint is not in the lockfile
+	bp.Packages = []blueprint.Package{{Name: "not-locked"}}
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	var driftErr *depsolvednf.LockfileDriftError
+	require.ErrorAs(t, err, &driftErr)
+	assert.Equal(t, []string{"os"}, driftErr.Pipelines())
+	assert.ErrorContains(t, err, `pipeline "os": packages not locked: not-locked`)
+}
+
+func TestManifestGeneratorLockfileWithSbomWriter(t *testing.T) {
+	repos, err := testrepos.New()
+	require.NoError(t, err)
+	_, err = manifestgen.New(repos, &manifestgen.Options{
+		Lockfile: &depsolvednf.Lockfile{Version: depsolvednf.LockfileVersion},
+		SBOMWriter: func(filename string, content io.Reader, docType sbom.StandardType) error {
+			return nil
+		},
+	})
+	assert.EqualError(t, err, "cannot generate SBOMs from a lockfile")
+}
+
+type fakeBundleFetcher struct {
+	bundle.DefaultFetcher
+	urls []string
+}
+
+func (ff *fakeBundleFetcher) FetchURL(ctx context.Context, url string, insecure bool, dst io.Writer) error {
+	ff.urls = append(ff.urls, url)
+	_, err := io.WriteString(dst, "fake-rpm")
+	return err
+}
+
+func TestManifestGeneratorBundle(t *testing.T) {
+	repos, err := testrepos.New()
+	require.NoError(t, err)
+	fac := distrofactory.NewDefault()
+	filter, err := imagefilter.New(fac, repos)
+	require.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+
+	fetcher := &fakeBundleFetcher{}
+	mg, err := manifestgen.New(repos, &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+		BundleFetcher:     fetcher,
+	})
+	require.NoError(t, err)
+	var bp blueprint.Blueprint
+	_, err = mg.GenerateBundle(context.Background(), t.TempDir(), &bp, res[0].ImgType, nil)
+	// the fake depsolver does not checksum real content
+	assert.ErrorContains(t, err, "cannot export bundle: cannot export source org.osbuild.curl: cannot fetch https://rpmrepo.osbuild.org/")
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.Len(t, fetcher.urls, 1)
+}
+
+func TestManifestGeneratorPackagePolicies(t *testing.T) {
+	repos, err := testrepos.New()
+	require.NoError(t, err)
+	fac := distrofactory.NewDefault()
+	filter, err := imagefilter.New(fac, repos)
+	require.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+
+	bp := blueprint.Blueprint{
+		Packages: []blueprint.Package{{Name: "telnet-server"}},
+	}
+	policies := []packagepolicy.Policy{
+		{
+			Name: "no-telnet",
+			Deny: []packagepolicy.Rule{{Names: []string{"telnet*"}}},
+		},
+		{
+			Name:       "other image type",
+			ImageTypes: []string{"ami"},
+			Deny:       []packagepolicy.Rule{{Names: []string{"*"}}},
+		},
+	}
+
+	mg, err := manifestgen.New(repos, &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+		PackagePolicies:   policies,
+	})
+	require.NoError(t, err)
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	var violationErr *packagepolicy.ViolationError
+	require.ErrorAs(t, err, &violationErr)
+	// the build pipeline is not checked by default
+	require.Len(t, violationErr.Violations, 1)
+	assert.Equal(t, "no-telnet", violationErr.Violations[0].Policy)
+	assert.Equal(t, "os", violationErr.Violations[0].Pipeline)
+	assert.True(t, strings.HasPrefix(violationErr.Violations[0].Package, "telnet-server-0:"))
+	assert.Equal(t, "denied by rule names=telnet*", violationErr.Violations[0].Reason)
+
+	// violations of warn policies are reported as warnings
+	policies[0].Mode = packagepolicy.ModeWarn
+	var warnings bytes.Buffer
+	mg, err = manifestgen.New(repos, &manifestgen.Options{
+		Depsolve:          fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+		WarningsOutput:    &warnings,
+		PackagePolicies:   policies,
+	})
+	require.NoError(t, err)
+	_, err = mg.Generate(&bp, res[0].ImgType, nil)
+	require.NoError(t, err)
+	assert.Contains(t, warnings.String(), `WARNING: package telnet-server-0:`)
+	assert.Contains(t, warnings.String(), `in pipeline "os" violates policy "no-telnet": denied by rule names=telnet*`)
+}
+
+func TestManifestGeneratorInvalidPackagePolicy(t *testing.T) {
+	_, err := manifestgen.New(nil, &manifestgen.Options{
+		PackagePolicies: []packagepolicy.Policy{{Name: "invalid", Mode: "sometimes"}},
+	})
+	assert.EqualError(t, err, `package policy "invalid" has the invalid mode "sometimes"`)
+}
+
+func TestManifestGeneratorDiskSpaceCheck(t *testing.T) {
+	repos, err := testrepos.New()
+	require.NoError(t, err)
+	fac := distrofactory.NewDefault()
+	filter, err := imagefilter.New(fac, repos)
+	require.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(res))
+
+	var bp blueprint.Blueprint
+	// the kernel of the image does not fit into any partition
+	estimate := &diskestimate.Options{KernelBootSize: 100 * datasizes.GiB}
+	generate := func(mode manifestgen.DiskSpaceCheckMode, warnings io.Writer) ([]byte, error) {
+		mg, err := manifestgen.New(repos, &manifestgen.Options{
+			Depsolve:          fakeDepsolve,
+			CommitResolver:    panicCommitResolver,
+			ContainerResolver: panicContainerResolver,
+			WarningsOutput:    warnings,
+			DiskSpaceCheck:    mode,
+			DiskSpaceEstimate: estimate,
+			CustomSeed:        common.ToPtr(int64(0)),
+		})
+		require.NoError(t, err)
+		return mg.Generate(&bp, res[0].ImgType, nil)
+	}
+
+	unchecked, err := generate(manifestgen.DiskSpaceCheckNone, nil)
+	require.NoError(t, err)
+
+	_, err = generate(manifestgen.DiskSpaceCheckError, &bytes.Buffer{})
+	var diskErr *manifestgen.DiskSpaceError
+	require.ErrorAs(t, err, &diskErr)
+	assert.Equal(t, "os", diskErr.Pipeline)
+	require.Len(t, diskErr.Exceeded, 1)
+	assert.True(t, diskErr.Exceeded[0].Exceeded())
+
+	var warnings bytes.Buffer
+	warned, err := generate(manifestgen.DiskSpaceCheckWarn, &warnings)
+	require.NoError(t, err)
+	assert.Contains(t, warnings.String(), `WARNING: estimated disk usage of pipeline "os" exceeds the partition table: `)
+	assert.Equal(t, unchecked, warned)
+
+	// without a warnings output warnings are errors
+	_, err = generate(manifestgen.DiskSpaceCheckWarn, nil)
+	require.ErrorAs(t, err, &diskErr)
+
+	grown, err := generate(manifestgen.DiskSpaceCheckGrow, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, unchecked, grown)
+}
+
+func TestManifestGeneratorInvalidDiskSpaceCheck(t *testing.T) {
+	_, err := manifestgen.New(nil, &manifestgen.Options{
+		DiskSpaceCheck: "sometimes",
+	})
+	assert.EqualError(t, err, `invalid disk space check mode "sometimes"`)
+}
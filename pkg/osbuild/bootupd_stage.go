@@ -125,7 +125,7 @@ func genMountsForBootupd(source string, pt *disk.PartitionTable) ([]Mount, error
 					return nil, fmt.Errorf("expected LV payload %+[1]v to be mountable or swap, got %[1]T", lv.Payload)
 				}
 			}
-		case *disk.Swap, *disk.Raw:
+		case *disk.Swap, *disk.Raw, *disk.VerityHash:
 			// nothing to do
 		default:
 			return nil, fmt.Errorf("type %T not supported by bootupd handling yet", part.Payload)
@@ -144,8 +144,9 @@ func genDevicesForBootupd(filename, devName string, pt *disk.PartitionTable) (ma
 		devName: Device{
 			Type: "org.osbuild.loopback",
 			Options: &LoopbackDeviceOptions{
-				Filename: filename,
-				Partscan: true,
+				Filename:   filename,
+				SectorSize: LoopbackSectorSize(pt),
+				Partscan:   true,
 			},
 		},
 	}
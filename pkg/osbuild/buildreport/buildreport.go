@@ -0,0 +1,265 @@
+// Package buildreport aggregates the status updates of an osbuild run
+// into the wall times of its pipelines and stages.
+//
+// A report can be written as JSON, as a human readable table or in the
+// Chrome trace-event format that can be loaded into trace viewers like
+// chrome://tracing or https://ui.perfetto.dev.
+package buildreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// Stage is the wall time of a single stage of a pipeline
+type Stage struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Pipeline is the wall time of a pipeline and its stages in the order
+// they ran
+type Pipeline struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+	Stages   []Stage       `json:"stages,omitempty"`
+}
+
+// Report is the wall time of a build and its pipelines in the order they
+// ran
+type Report struct {
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration_ns"`
+	Pipelines []Pipeline    `json:"pipelines"`
+}
+
+type span struct {
+	name       string
+	start, end time.Time
+	// duration as measured by osbuild, only sent by newer versions
+	duration time.Duration
+}
+
+func (s *span) extend(ts time.Time) {
+	if ts.IsZero() {
+		return
+	}
+	if s.start.IsZero() || ts.Before(s.start) {
+		s.start = ts
+	}
+	if ts.After(s.end) {
+		s.end = ts
+	}
+}
+
+func (s *span) wallTime() time.Duration {
+	if s.duration > 0 {
+		return s.duration
+	}
+	return s.end.Sub(s.start)
+}
+
+type pipelineSpan struct {
+	span
+	stages []*span
+	// the current stage is finished, the next status of a stage with
+	// the same name belongs to a new instance of it
+	stageFinished bool
+}
+
+// Collector aggregates osbuild status updates into a Report. Its Add
+// method can be used as the osbuild.StatusFunc of
+// osbuild.RunOSBuildContext.
+type Collector struct {
+	build     span
+	pipelines []*pipelineSpan
+	byName    map[string]*pipelineSpan
+}
+
+// NewCollector returns a new, empty collector
+func NewCollector() *Collector {
+	return &Collector{
+		byName: make(map[string]*pipelineSpan),
+	}
+}
+
+// Add records a single status update
+func (c *Collector) Add(st *osbuild.Status) {
+	c.build.extend(st.Timestamp)
+	if st.Pipeline == "" {
+		return
+	}
+
+	p := c.byName[st.Pipeline]
+	if p == nil {
+		p = &pipelineSpan{span: span{name: st.Pipeline}}
+		c.byName[st.Pipeline] = p
+		c.pipelines = append(c.pipelines, p)
+	}
+	p.extend(st.Timestamp)
+
+	if st.Stage == "" {
+		// a result of the whole pipeline
+		if st.Duration > 0 {
+			p.duration = st.Duration
+		}
+		return
+	}
+
+	// stages of a pipeline run one after another. Without the
+	// duration osbuild sends with the result of a stage two
+	// consecutive stages with the same name cannot be told apart and
+	// are reported as one.
+	var stage *span
+	if n := len(p.stages); n > 0 && p.stages[n-1].name == st.Stage && !p.stageFinished {
+		stage = p.stages[n-1]
+	} else {
+		stage = &span{name: st.Stage}
+		p.stages = append(p.stages, stage)
+		p.stageFinished = false
+	}
+	stage.extend(st.Timestamp)
+	if st.Duration > 0 {
+		stage.duration = st.Duration
+		p.stageFinished = true
+	}
+}
+
+// Report returns the report of all status updates added so far
+func (c *Collector) Report() *Report {
+	report := &Report{
+		Start:     c.build.start,
+		Duration:  c.build.wallTime(),
+		Pipelines: []Pipeline{},
+	}
+	for _, p := range c.pipelines {
+		pipeline := Pipeline{
+			Name:     p.name,
+			Start:    p.start,
+			Duration: p.wallTime(),
+		}
+		for _, s := range p.stages {
+			pipeline.Stages = append(pipeline.Stages, Stage{
+				Name:     s.name,
+				Start:    s.start,
+				Duration: s.wallTime(),
+			})
+		}
+		report.Pipelines = append(report.Pipelines, pipeline)
+	}
+	return report
+}
+
+// FromScanner reads all status updates from the scanner and returns
+// their report
+func FromScanner(scanner *osbuild.StatusScanner) (*Report, error) {
+	c := NewCollector()
+	for {
+		st, err := scanner.Status()
+		if err != nil {
+			return nil, err
+		}
+		if st == nil {
+			break
+		}
+		c.Add(st)
+	}
+	return c.Report(), nil
+}
+
+// WriteJSON writes the report as indented JSON, durations are in
+// nanoseconds
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteTable writes the report as a human readable table, the share is
+// the part of the whole build a pipeline or stage took
+func (r *Report) WriteTable(w io.Writer) error {
+	type row struct {
+		name, duration, share string
+	}
+	newRow := func(name string, d time.Duration) row {
+		share := "-"
+		if r.Duration > 0 {
+			share = fmt.Sprintf("%.1f%%", 100*float64(d)/float64(r.Duration))
+		}
+		return row{name, d.Round(time.Millisecond).String(), share}
+	}
+
+	rows := []row{{"PIPELINE/STAGE", "DURATION", "SHARE"}}
+	for _, p := range r.Pipelines {
+		rows = append(rows, newRow(p.Name, p.Duration))
+		for _, s := range p.Stages {
+			rows = append(rows, newRow("  "+s.Name, s.Duration))
+		}
+	}
+	rows = append(rows, newRow("TOTAL", r.Duration))
+
+	var nameWidth, durationWidth, shareWidth int
+	for _, row := range rows {
+		nameWidth = max(nameWidth, len(row.name))
+		durationWidth = max(durationWidth, len(row.duration))
+		shareWidth = max(shareWidth, len(row.share))
+	}
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(w, "%-*s  %*s  %*s\n", nameWidth, row.name, durationWidth, row.duration, shareWidth, row.share); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// traceEvent is a complete event of the Chrome trace-event format, see
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type traceEvent struct {
+	Name     string `json:"name"`
+	Category string `json:"cat"`
+	Phase    string `json:"ph"`
+	// Timestamp and Duration are in microseconds
+	Timestamp int64 `json:"ts"`
+	Duration  int64 `json:"dur"`
+	PID       int   `json:"pid"`
+	TID       int   `json:"tid"`
+}
+
+type traceFile struct {
+	TraceEvents     []traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// WriteTrace writes the report in the Chrome trace-event format. Stages
+// are nested into their pipelines, timestamps are relative to the start
+// of the build.
+func (r *Report) WriteTrace(w io.Writer) error {
+	trace := traceFile{
+		TraceEvents:     []traceEvent{},
+		DisplayTimeUnit: "ms",
+	}
+	event := func(name, category string, start time.Time, d time.Duration) traceEvent {
+		return traceEvent{
+			Name:      name,
+			Category:  category,
+			Phase:     "X",
+			Timestamp: start.Sub(r.Start).Microseconds(),
+			Duration:  d.Microseconds(),
+			PID:       1,
+			TID:       1,
+		}
+	}
+	for _, p := range r.Pipelines {
+		trace.TraceEvents = append(trace.TraceEvents, event(p.Name, "pipeline", p.Start, p.Duration))
+		for _, s := range p.Stages {
+			trace.TraceEvents = append(trace.TraceEvents, event(s.Name, "stage", s.Start, s.Duration))
+		}
+	}
+	return json.NewEncoder(w).Encode(trace)
+}
@@ -0,0 +1,140 @@
+package buildreport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/osbuild/buildreport"
+)
+
+var t0 = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func at(sec float64) time.Time {
+	return t0.Add(time.Duration(sec * float64(time.Second)))
+}
+
+func testStatuses() []*osbuild.Status {
+	return []*osbuild.Status{
+		{Message: "starting", Timestamp: at(0)},
+		{Pipeline: "build", Message: "Starting pipeline build", Timestamp: at(1)},
+		{Pipeline: "build", Stage: "org.osbuild.rpm", Message: "Starting module org.osbuild.rpm", Timestamp: at(1)},
+		{Pipeline: "build", Stage: "org.osbuild.rpm", Trace: "installing", Timestamp: at(5)},
+		{Pipeline: "build", Stage: "org.osbuild.rpm", Trace: "Finished module org.osbuild.rpm", Timestamp: at(9), Duration: 8 * time.Second},
+		{Pipeline: "build", Stage: "org.osbuild.mkdir", Message: "Starting module org.osbuild.mkdir", Timestamp: at(9)},
+		{Pipeline: "build", Stage: "org.osbuild.mkdir", Trace: "Finished module org.osbuild.mkdir", Timestamp: at(10), Duration: 1 * time.Second},
+		// the same stage twice in a row
+		{Pipeline: "build", Stage: "org.osbuild.mkdir", Message: "Starting module org.osbuild.mkdir", Timestamp: at(10)},
+		{Pipeline: "build", Stage: "org.osbuild.mkdir", Trace: "Finished module org.osbuild.mkdir", Timestamp: at(10.5), Duration: 500 * time.Millisecond},
+		{Pipeline: "os", Message: "Starting pipeline os", Timestamp: at(11)},
+		// no duration from older osbuild versions
+		{Pipeline: "os", Stage: "org.osbuild.selinux", Message: "Starting module org.osbuild.selinux", Timestamp: at(11)},
+		{Pipeline: "os", Stage: "org.osbuild.selinux", Trace: "Finished module org.osbuild.selinux", Timestamp: at(14)},
+		{Pipeline: "os", Message: "Finished pipeline os", Timestamp: at(15)},
+		{Message: "done", Timestamp: at(16)},
+	}
+}
+
+func testReport() *buildreport.Report {
+	c := buildreport.NewCollector()
+	for _, st := range testStatuses() {
+		c.Add(st)
+	}
+	return c.Report()
+}
+
+func TestCollectorReport(t *testing.T) {
+	assert.Equal(t, &buildreport.Report{
+		Start:    at(0),
+		Duration: 16 * time.Second,
+		Pipelines: []buildreport.Pipeline{
+			{
+				Name:     "build",
+				Start:    at(1),
+				Duration: 9500 * time.Millisecond,
+				Stages: []buildreport.Stage{
+					{Name: "org.osbuild.rpm", Start: at(1), Duration: 8 * time.Second},
+					{Name: "org.osbuild.mkdir", Start: at(9), Duration: 1 * time.Second},
+					{Name: "org.osbuild.mkdir", Start: at(10), Duration: 500 * time.Millisecond},
+				},
+			},
+			{
+				Name:     "os",
+				Start:    at(11),
+				Duration: 4 * time.Second,
+				Stages: []buildreport.Stage{
+					{Name: "org.osbuild.selinux", Start: at(11), Duration: 3 * time.Second},
+				},
+			},
+		},
+	}, testReport())
+}
+
+func TestReportWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testReport().WriteTable(&buf))
+	assert.Equal(t, `PIPELINE/STAGE         DURATION   SHARE
+build                      9.5s   59.4%
+  org.osbuild.rpm            8s   50.0%
+  org.osbuild.mkdir          1s    6.2%
+  org.osbuild.mkdir       500ms    3.1%
+os                           4s   25.0%
+  org.osbuild.selinux        3s   18.8%
+TOTAL                       16s  100.0%
+`, buf.String())
+}
+
+func TestReportWriteTrace(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testReport().WriteTrace(&buf))
+
+	var trace struct {
+		TraceEvents []map[string]any `json:"traceEvents"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &trace))
+	require.Len(t, trace.TraceEvents, 6)
+	assert.Equal(t, map[string]any{
+		"name": "build",
+		"cat":  "pipeline",
+		"ph":   "X",
+		"ts":   float64(1_000_000),
+		"dur":  float64(9_500_000),
+		"pid":  float64(1),
+		"tid":  float64(1),
+	}, trace.TraceEvents[0])
+	assert.Equal(t, "org.osbuild.rpm", trace.TraceEvents[1]["name"])
+	assert.Equal(t, "stage", trace.TraceEvents[1]["cat"])
+}
+
+func TestReportWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testReport().WriteJSON(&buf))
+
+	var report buildreport.Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, testReport(), &report)
+}
+
+func TestFromScanner(t *testing.T) {
+	f, err := os.Open("../../../test/data/osbuild-monitor-output.json")
+	require.NoError(t, err)
+	defer f.Close()
+
+	report, err := buildreport.FromScanner(osbuild.NewStatusScanner(f))
+	require.NoError(t, err)
+	require.NotEmpty(t, report.Pipelines)
+	for _, p := range report.Pipelines {
+		assert.NotEmpty(t, p.Name)
+		assert.GreaterOrEqual(t, report.Duration, p.Duration)
+		for _, s := range p.Stages {
+			assert.NotEmpty(t, s.Name)
+			assert.False(t, s.Start.Before(p.Start))
+		}
+	}
+}
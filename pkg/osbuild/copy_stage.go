@@ -60,8 +60,18 @@ func GenCopyFSTreeOptions(inputName, inputPipeline, filename string, pt *disk.Pa
 	map[string]Device,
 	[]Mount,
 ) {
+	return GenCopyFSTreeOptionsForDisks(inputName, inputPipeline, []DiskFile{{Filename: filename, PartitionTable: pt}})
+}
+
+// GenCopyFSTreeOptionsForDisks is GenCopyFSTreeOptions for images with
+// multiple disks, the tree is copied to the filesystems of all disks.
+func GenCopyFSTreeOptionsForDisks(inputName, inputPipeline string, disks []DiskFile) (
+	*CopyStageOptions,
+	map[string]Device,
+	[]Mount,
+) {
 
-	fsRootMntName, mounts, devices, err := GenMountsDevicesFromPT(filename, pt)
+	fsRootMntName, mounts, devices, err := GenMountsDevicesFromDisks(disks)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,62 @@
+package osbuild
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// CrypttabStageOptions describe the content of the /etc/crypttab file
+type CrypttabStageOptions struct {
+	Volumes []CrypttabEntry `json:"volumes"`
+}
+
+func (CrypttabStageOptions) isStageOptions() {}
+
+// A CrypttabEntry is one line in /etc/crypttab, the encrypted device is
+// identified by its UUID
+type CrypttabEntry struct {
+	Volume  string `json:"volume"`
+	UUID    string `json:"uuid,omitempty"`
+	Keyfile string `json:"keyfile,omitempty"`
+	Options string `json:"options,omitempty"`
+}
+
+func NewCrypttabStage(options *CrypttabStageOptions) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.crypttab",
+		Options: options,
+	}
+}
+
+// NewCrypttabStageOptions creates the crypttab entries for the LUKS
+// containers of the partition tables. No key file is set: the passphrase is
+// asked for on boot unless the container is bound with clevis. Returns nil
+// if there are no LUKS containers.
+func NewCrypttabStageOptions(pts ...*disk.PartitionTable) *CrypttabStageOptions {
+	var volumes []CrypttabEntry
+	for _, pt := range pts {
+		_ = pt.ForEachEntity(func(e disk.Entity, path []disk.Entity) error {
+			luks, ok := e.(*disk.LUKSContainer)
+			if !ok {
+				return nil
+			}
+			entry := CrypttabEntry{
+				Volume:  fmt.Sprintf("luks-%s", luks.UUID),
+				UUID:    luks.UUID,
+				Keyfile: "none",
+			}
+			// volumes bound to a tang server can only be unlocked once
+			// the network is up
+			if luks.Clevis != nil && luks.Clevis.Pin == "tang" {
+				entry.Options = "_netdev"
+			}
+			volumes = append(volumes, entry)
+			return nil
+		})
+	}
+	if len(volumes) == 0 {
+		return nil
+	}
+	return &CrypttabStageOptions{Volumes: volumes}
+}
@@ -0,0 +1,61 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func TestNewCrypttabStage(t *testing.T) {
+	expectedStage := &Stage{
+		Type:    "org.osbuild.crypttab",
+		Options: &CrypttabStageOptions{},
+	}
+	actualStage := NewCrypttabStage(&CrypttabStageOptions{})
+	assert.Equal(t, expectedStage, actualStage)
+}
+
+func TestNewCrypttabStageOptions(t *testing.T) {
+	luksPT := func(uuid string, clevis *disk.ClevisBind) *disk.PartitionTable {
+		return &disk.PartitionTable{
+			Type: disk.PT_GPT,
+			Partitions: []disk.Partition{
+				{
+					Payload: &disk.LUKSContainer{
+						UUID:   uuid,
+						Clevis: clevis,
+						Payload: &disk.Filesystem{
+							Type:       "xfs",
+							Mountpoint: "/data-" + uuid[:4],
+						},
+					},
+				},
+			},
+		}
+	}
+
+	assert.Nil(t, NewCrypttabStageOptions())
+	assert.Nil(t, NewCrypttabStageOptions(&disk.PartitionTable{}))
+
+	opts := NewCrypttabStageOptions(
+		luksPT("11111111-2222-3333-4444-555555555555", nil),
+		luksPT("66666666-2222-3333-4444-555555555555", &disk.ClevisBind{Pin: "tang"}),
+	)
+	assert.Equal(t, &CrypttabStageOptions{
+		Volumes: []CrypttabEntry{
+			{
+				Volume:  "luks-11111111-2222-3333-4444-555555555555",
+				UUID:    "11111111-2222-3333-4444-555555555555",
+				Keyfile: "none",
+			},
+			{
+				Volume:  "luks-66666666-2222-3333-4444-555555555555",
+				UUID:    "66666666-2222-3333-4444-555555555555",
+				Keyfile: "none",
+				Options: "_netdev",
+			},
+		},
+	}, opts)
+}
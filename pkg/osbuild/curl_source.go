@@ -82,34 +82,32 @@ type URLSecrets struct {
 }
 
 // Unmarshal method for CurlSource for handling the CurlSourceItem interface:
-// Tries each of the implementations until it finds the one that works.
-func (cs *CurlSource) UnmarshalJSON(data []byte) (err error) {
-	cs.Items = make(map[string]CurlSourceItem)
-	type csSimple struct {
-		Items map[string]URL `json:"items"`
+// Tries each of the implementations for every item until it finds the one
+// that works.
+func (cs *CurlSource) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Items map[string]json.RawMessage `json:"items"`
 	}
-	simple := new(csSimple)
-	b := bytes.NewReader(data)
-	dec := json.NewDecoder(b)
+	dec := json.NewDecoder(bytes.NewReader(data))
 	dec.DisallowUnknownFields()
-	if err = dec.Decode(simple); err == nil {
-		for k, v := range simple.Items {
-			cs.Items[k] = v
-		}
-		return
+	if err := dec.Decode(&raw); err != nil {
+		return err
 	}
 
-	type csWithSecrets struct {
-		Items map[string]CurlSourceOptions `json:"items"`
-	}
-	withSecrets := new(csWithSecrets)
-	b.Reset(data)
-	if err = dec.Decode(withSecrets); err == nil {
-		for k, v := range withSecrets.Items {
-			cs.Items[k] = v
+	cs.Items = make(map[string]CurlSourceItem, len(raw.Items))
+	for k, v := range raw.Items {
+		var url URL
+		if err := json.Unmarshal(v, &url); err == nil {
+			cs.Items[k] = url
+			continue
 		}
-		return
+		var options CurlSourceOptions
+		dec := json.NewDecoder(bytes.NewReader(v))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&options); err != nil {
+			return fmt.Errorf("cannot unmarshal curl source item %q: %w", k, err)
+		}
+		cs.Items[k] = options
 	}
-
-	return
+	return nil
 }
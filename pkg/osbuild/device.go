@@ -2,6 +2,7 @@ package osbuild
 
 import (
 	"cmp"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"slices"
@@ -20,6 +21,37 @@ type DeviceOptions interface {
 	isDeviceOptions()
 }
 
+// RawDeviceOptions are the options of a device that was unmarshaled from
+// JSON.
+type RawDeviceOptions json.RawMessage
+
+func (RawDeviceOptions) isDeviceOptions() {}
+
+func (o RawDeviceOptions) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(o).MarshalJSON()
+}
+
+// UnmarshalJSON unmarshals a device, the options are kept as
+// RawDeviceOptions.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type    string          `json:"type"`
+		Parent  string          `json:"parent"`
+		Options json.RawMessage `json:"options"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = Device{
+		Type:   raw.Type,
+		Parent: raw.Parent,
+	}
+	if isRawSet(raw.Options) {
+		d.Options = RawDeviceOptions(raw.Options)
+	}
+	return nil
+}
+
 func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage {
 	stages := make([]*Stage, 0)
 
@@ -167,6 +199,8 @@ func deviceName(p disk.Entity) string {
 		return "swap-" + payload.UUID[:4]
 	case *disk.Raw:
 		return "raw-" + pathEscape(payload.SourcePath)
+	case *disk.VerityHash:
+		return "verity-" + pathEscape(payload.Target)
 	}
 	panic(fmt.Sprintf("unsupported device type in deviceName: '%T'", p))
 }
@@ -200,7 +234,7 @@ func getDevices(path []disk.Entity, filename string, lockLoopback bool) (map[str
 				Filename:   filename,
 				Start:      pt.BytesToSectors(e.Start),
 				Size:       pt.BytesToSectors(e.Size.Uint64()),
-				SectorSize: nil,
+				SectorSize: LoopbackSectorSize(pt),
 				Lock:       lockLoopback,
 			}
 			name := deviceName(e.Payload)
@@ -271,6 +305,13 @@ func genOsbuildMount(source string, mnt disk.Mountable) (*Mount, error) {
 	}
 }
 
+// DiskFile is an image file with its partition table, images with
+// multiple disks have one file per disk.
+type DiskFile struct {
+	Filename       string
+	PartitionTable *disk.PartitionTable
+}
+
 // GenMountsDevicesFromPT generates osbuild mounts and devices from a disk.PartitionTable
 // filename is the name of the underlying image file (which will get loop-mounted).
 //
@@ -280,39 +321,48 @@ func genOsbuildMount(source string, mnt disk.Mountable) (*Mount, error) {
 // 3) generated devices
 // 4) error if any
 func GenMountsDevicesFromPT(filename string, pt *disk.PartitionTable) (string, []Mount, map[string]Device, error) {
-	devices := make(map[string]Device, len(pt.Partitions))
-	mounts := make([]Mount, 0, len(pt.Partitions))
+	return GenMountsDevicesFromDisks([]DiskFile{{Filename: filename, PartitionTable: pt}})
+}
+
+// GenMountsDevicesFromDisks generates osbuild mounts and devices for the
+// filesystems of all disks of an image, see GenMountsDevicesFromPT. The
+// filesystem root needs to be on one of the disks.
+func GenMountsDevicesFromDisks(disks []DiskFile) (string, []Mount, map[string]Device, error) {
+	devices := make(map[string]Device)
+	mounts := make([]Mount, 0)
 	var fsRootMntName string
-	genMounts := func(mnt disk.Mountable, path []disk.Entity) error {
-		stageDevices, leafDeviceName := getDevices(path, filename, false)
-		mount, err := genOsbuildMount(leafDeviceName, mnt)
-		if err != nil {
-			return err
-		}
+	for _, d := range disks {
+		genMounts := func(mnt disk.Mountable, path []disk.Entity) error {
+			stageDevices, leafDeviceName := getDevices(path, d.Filename, false)
+			mount, err := genOsbuildMount(leafDeviceName, mnt)
+			if err != nil {
+				return err
+			}
 
-		mountpoint := mnt.GetMountpoint()
-		if mountpoint == "/" {
-			fsRootMntName = mount.Name
-		}
+			mountpoint := mnt.GetMountpoint()
+			if mountpoint == "/" {
+				fsRootMntName = mount.Name
+			}
 
-		mounts = append(mounts, *mount)
+			mounts = append(mounts, *mount)
 
-		// update devices map with new elements from stageDevices
-		for devName := range stageDevices {
-			if existingDevice, exists := devices[devName]; exists {
-				// It is usual that the a device is generated twice for the same Entity e.g. LVM VG, which is OK.
-				// Therefore fail only if a device with the same name is generated for two different Entities.
-				if !reflect.DeepEqual(existingDevice, stageDevices[devName]) {
-					return fmt.Errorf("the device name %q has been generated for two different devices", devName)
+			// update devices map with new elements from stageDevices
+			for devName := range stageDevices {
+				if existingDevice, exists := devices[devName]; exists {
+					// It is usual that the a device is generated twice for the same Entity e.g. LVM VG, which is OK.
+					// Therefore fail only if a device with the same name is generated for two different Entities.
+					if !reflect.DeepEqual(existingDevice, stageDevices[devName]) {
+						return fmt.Errorf("the device name %q has been generated for two different devices", devName)
+					}
 				}
+				devices[devName] = stageDevices[devName]
 			}
-			devices[devName] = stageDevices[devName]
+			return nil
 		}
-		return nil
-	}
 
-	if err := pt.ForEachMountable(genMounts); err != nil {
-		return "", nil, nil, err
+		if err := d.PartitionTable.ForEachMountable(genMounts); err != nil {
+			return "", nil, nil, err
+		}
 	}
 
 	// sort the mounts, using < should just work because:
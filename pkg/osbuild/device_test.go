@@ -225,6 +225,28 @@ func TestMountsDeviceFromPtHappy(t *testing.T) {
 	})
 }
 
+func TestMountsDeviceFromDisks(t *testing.T) {
+	disks := []DiskFile{
+		{Filename: "disk.img", PartitionTable: testdisk.MakeFakePartitionTable("/", "/boot")},
+		{Filename: "disk-data.img", PartitionTable: testdisk.MakeFakePartitionTable("/var/lib/data")},
+	}
+	fsRootMntName, mounts, devices, err := GenMountsDevicesFromDisks(disks)
+	require.NoError(t, err)
+	assert.Equal(t, "-", fsRootMntName)
+	assert.Equal(t, []Mount{
+		{Name: "-", Type: "org.osbuild.ext4", Source: "-", Target: "/"},
+		{Name: "boot", Type: "org.osbuild.ext4", Source: "boot", Target: "/boot"},
+		{Name: "var-lib-data", Type: "org.osbuild.ext4", Source: "var-lib-data", Target: "/var/lib/data"},
+	}, mounts)
+	require.Len(t, devices, 3)
+	assert.Equal(t, "disk.img", devices["boot"].Options.(*LoopbackDeviceOptions).Filename)
+	assert.Equal(t, "disk-data.img", devices["var-lib-data"].Options.(*LoopbackDeviceOptions).Filename)
+
+	// the root filesystem needs to be on one of the disks
+	_, _, _, err = GenMountsDevicesFromDisks(disks[1:])
+	assert.EqualError(t, err, "no mount found for the filesystem root")
+}
+
 func TestMountsDeviceFromBrfs(t *testing.T) {
 	filename := "fake-disk.img"
 	fakePt := testdisk.MakeFakeBtrfsPartitionTable("/", "/boot")
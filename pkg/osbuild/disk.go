@@ -134,11 +134,13 @@ func GenImagePrepareStages(pt *disk.PartitionTable, filename string, partTool Pa
 
 	stages = append(stages, stage)
 
-	// create the partition layout in the empty file
+	// create the partition layout in the empty file, the start and size of
+	// the partitions are in sectors of the loop device
 	loopback := NewLoopbackDevice(
 		&LoopbackDeviceOptions{
-			Filename: filename,
-			Lock:     true,
+			Filename:   filename,
+			SectorSize: LoopbackSectorSize(pt),
+			Lock:       true,
 		},
 	)
 
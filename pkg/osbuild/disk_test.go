@@ -198,6 +198,61 @@ func addMountOptions(pt *disk.PartitionTable, fsopts map[string]string) {
 	_ = pt.ForEachMountable(addOptions)
 }
 
+func TestGenImagePrepareStages4K(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type:       disk.PT_GPT,
+		Size:       10 * datasizes.GiB,
+		SectorSize: disk.NativeSectorSize4K,
+		Partitions: []disk.Partition{
+			{
+				Start: 1 * datasizes.MiB,
+				Size:  disk.MinESPSize4K,
+				Type:  disk.EFISystemPartitionGUID,
+				Payload: &disk.Filesystem{
+					Type:       "vfat",
+					UUID:       disk.EFIFilesystemUUID,
+					Mountpoint: "/boot/efi",
+				},
+			},
+			{
+				Start: (1*datasizes.MiB + disk.MinESPSize4K).Uint64(),
+				Size:  9 * datasizes.GiB,
+				Payload: &disk.Filesystem{
+					Type:       "xfs",
+					Mountpoint: "/",
+				},
+			},
+		},
+	}
+	filename := "image.raw"
+	stages := GenImagePrepareStages(pt, filename, PTSfdisk, "build")
+	sectorSize := uint64(disk.NativeSectorSize4K)
+
+	// partitions are created in 4096 byte sectors of the loop device
+	sfdisk := stages[1]
+	assert.Equal(t, "org.osbuild.sfdisk", sfdisk.Type)
+	assert.Equal(t, &sectorSize, sfdisk.Devices["device"].Options.(*LoopbackDeviceOptions).SectorSize)
+	sfOptions := sfdisk.Options.(*SfdiskStageOptions)
+	assert.Equal(t, uint64(1*datasizes.MiB/4096), sfOptions.Partitions[0].Start)
+	assert.Equal(t, uint64(disk.MinESPSize4K/4096), sfOptions.Partitions[0].Size)
+
+	// the ESP is formatted as FAT32 on a loop device with the same sector size
+	mkfsFAT := stages[2]
+	assert.Equal(t, "org.osbuild.mkfs.fat", mkfsFAT.Type)
+	assert.Equal(t, &LoopbackDeviceOptions{
+		Filename:   filename,
+		Start:      1 * datasizes.MiB / 4096,
+		Size:       uint64(disk.MinESPSize4K / 4096),
+		SectorSize: &sectorSize,
+		Lock:       true,
+	}, mkfsFAT.Devices["device"].Options)
+	assert.Equal(t, 32, *mkfsFAT.Options.(*MkfsFATStageOptions).FATSize)
+
+	mkfsXFS := stages[3]
+	assert.Equal(t, "org.osbuild.mkfs.xfs", mkfsXFS.Type)
+	assert.Equal(t, &sectorSize, mkfsXFS.Devices["device"].Options.(*LoopbackDeviceOptions).SectorSize)
+}
+
 func TestGenImageKernelOptionsMountUnitsPlain(t *testing.T) {
 	assert := assert.New(t)
 
@@ -0,0 +1,123 @@
+package osbuild
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// Format a dm-verity hash device for a data device and store the resulting
+// root hash in the tree. The hash device is formatted with the defaults of
+// veritysetup(8).
+
+type DMVerityStageOptions struct {
+	// Path in the tree where the root hash (as a hex string) is written to
+	RootHash string `json:"root_hash"`
+}
+
+func (DMVerityStageOptions) isStageOptions() {}
+
+func (o DMVerityStageOptions) validate() error {
+	if o.RootHash == "" {
+		return fmt.Errorf("root hash path for org.osbuild.dmverity stage is required")
+	}
+	return nil
+}
+
+// NewDMVerityStage creates a new org.osbuild.dmverity stage. The devices must
+// contain the "data_device" and the "hash_device".
+func NewDMVerityStage(options *DMVerityStageOptions, devices map[string]Device) *Stage {
+	if err := options.validate(); err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"data_device", "hash_device"} {
+		if _, ok := devices[name]; !ok {
+			panic(fmt.Sprintf("org.osbuild.dmverity stage requires a %q device", name))
+		}
+	}
+	return &Stage{
+		Type:    "org.osbuild.dmverity",
+		Options: options,
+		Devices: devices,
+	}
+}
+
+// VerityRootHashFilename returns the name of the file that the root hash of
+// the dm-verity protected filesystem mounted at target is written to by the
+// stages generated with GenImageVerityStages for the given image filename.
+func VerityRootHashFilename(filename, target string) string {
+	switch target {
+	case "/":
+		return filename + ".roothash"
+	case "/usr":
+		return filename + ".usrhash"
+	default:
+		return fmt.Sprintf("%s.%s.verityhash", filename, pathEscape(target))
+	}
+}
+
+// GenImageVerityStages generates the org.osbuild.dmverity stages that compute
+// the hash trees for all dm-verity protected filesystems of the partition
+// table. They need to run after all other stages that modify the image
+// because any later change to the protected filesystems invalidates the
+// hash tree. The root hashes are written next to the image file, see
+// VerityRootHashFilename.
+func GenImageVerityStages(pt *disk.PartitionTable, filename string) ([]*Stage, error) {
+	verityParts, err := pt.VerityPartitions()
+	if err != nil {
+		return nil, err
+	}
+
+	stages := make([]*Stage, 0, len(verityParts))
+	for _, vp := range verityParts {
+		stages = append(stages, newImageVerityStage(pt, filename, vp.Data, vp.Hash))
+	}
+	return stages, nil
+}
+
+// GenVerityImageStage generates the org.osbuild.dmverity stage that computes
+// the hash tree of a discoverable disk image with a partition table created
+// by disk.NewVerityImagePartitionTable. The root hash is written next to the
+// image file.
+func GenVerityImageStage(pt *disk.PartitionTable, filename string) (*Stage, error) {
+	if len(pt.Partitions) != 2 {
+		return nil, fmt.Errorf("verity image partition table must have 2 partitions, got %d", len(pt.Partitions))
+	}
+	if _, ok := pt.Partitions[0].Payload.(*disk.Raw); !ok {
+		return nil, fmt.Errorf("unexpected payload of verity image data partition: %T", pt.Partitions[0].Payload)
+	}
+	if _, ok := pt.Partitions[1].Payload.(*disk.VerityHash); !ok {
+		return nil, fmt.Errorf("unexpected payload of verity image hash partition: %T", pt.Partitions[1].Payload)
+	}
+	return newImageVerityStage(pt, filename, 0, 1), nil
+}
+
+// newImageVerityStage returns the org.osbuild.dmverity stage for the data
+// partition and the hash partition at the given indexes of the partition
+// table.
+func newImageVerityStage(pt *disk.PartitionTable, filename string, dataIdx, hashIdx int) *Stage {
+	data := pt.Partitions[dataIdx]
+	hashPart := pt.Partitions[hashIdx]
+	hash := hashPart.Payload.(*disk.VerityHash)
+
+	devices := map[string]Device{
+		"data_device": *NewLoopbackDevice(&LoopbackDeviceOptions{
+			Filename:   filename,
+			Start:      pt.BytesToSectors(data.Start),
+			Size:       pt.BytesToSectors(data.Size.Uint64()),
+			SectorSize: LoopbackSectorSize(pt),
+			Lock:       true,
+		}),
+		"hash_device": *NewLoopbackDevice(&LoopbackDeviceOptions{
+			Filename:   filename,
+			Start:      pt.BytesToSectors(hashPart.Start),
+			Size:       pt.BytesToSectors(hashPart.Size.Uint64()),
+			SectorSize: LoopbackSectorSize(pt),
+			Lock:       true,
+		}),
+	}
+	options := &DMVerityStageOptions{
+		RootHash: "/" + VerityRootHashFilename(filename, hash.Target),
+	}
+	return NewDMVerityStage(options, devices)
+}
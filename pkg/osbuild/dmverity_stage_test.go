@@ -0,0 +1,117 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func TestNewDMVerityStage(t *testing.T) {
+	devices := map[string]Device{
+		"data_device": *NewLoopbackDevice(&LoopbackDeviceOptions{Filename: "disk.img"}),
+		"hash_device": *NewLoopbackDevice(&LoopbackDeviceOptions{Filename: "disk.img"}),
+	}
+	options := &DMVerityStageOptions{RootHash: "/disk.img.roothash"}
+
+	expectedStage := &Stage{
+		Type:    "org.osbuild.dmverity",
+		Options: options,
+		Devices: devices,
+	}
+	assert.Equal(t, expectedStage, NewDMVerityStage(options, devices))
+
+	assert.PanicsWithError(t, "root hash path for org.osbuild.dmverity stage is required", func() {
+		NewDMVerityStage(&DMVerityStageOptions{}, devices)
+	})
+	assert.PanicsWithValue(t, `org.osbuild.dmverity stage requires a "hash_device" device`, func() {
+		NewDMVerityStage(options, map[string]Device{"data_device": devices["data_device"]})
+	})
+}
+
+func TestVerityRootHashFilename(t *testing.T) {
+	assert.Equal(t, "disk.img.roothash", VerityRootHashFilename("disk.img", "/"))
+	assert.Equal(t, "disk.img.usrhash", VerityRootHashFilename("disk.img", "/usr"))
+	assert.Equal(t, "disk.img.opt-data.verityhash", VerityRootHashFilename("disk.img", "/opt/data"))
+}
+
+func TestGenImageVerityStages(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type:       disk.PT_GPT,
+		SectorSize: 512,
+		Partitions: []disk.Partition{
+			{
+				Start:   1 * datasizes.MiB,
+				Size:    1 * datasizes.GiB,
+				Payload: &disk.Filesystem{Type: "ext4", Mountpoint: "/", FSTabOptions: "ro"},
+			},
+			{
+				Start:   1*datasizes.GiB + 1*datasizes.MiB,
+				Size:    64 * datasizes.MiB,
+				Payload: &disk.VerityHash{Target: "/"},
+			},
+		},
+	}
+
+	stages, err := GenImageVerityStages(pt, "disk.img")
+	require.NoError(t, err)
+	require.Len(t, stages, 1)
+
+	stage := stages[0]
+	assert.Equal(t, "org.osbuild.dmverity", stage.Type)
+	assert.Equal(t, &DMVerityStageOptions{
+		RootHash: "/disk.img.roothash",
+	}, stage.Options)
+
+	dataOpts := stage.Devices["data_device"].Options.(*LoopbackDeviceOptions)
+	assert.Equal(t, uint64(2048), dataOpts.Start)
+	assert.Equal(t, uint64(2097152), dataOpts.Size)
+	hashOpts := stage.Devices["hash_device"].Options.(*LoopbackDeviceOptions)
+	assert.Equal(t, uint64(2099200), hashOpts.Start)
+	assert.Equal(t, uint64(131072), hashOpts.Size)
+
+	// no verity, no stages
+	pt.Partitions = pt.Partitions[:1]
+	stages, err = GenImageVerityStages(pt, "disk.img")
+	require.NoError(t, err)
+	assert.Empty(t, stages)
+}
+
+func TestGenVerityImageStage(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Start:   1 * datasizes.MiB,
+				Size:    16 * datasizes.MiB,
+				Payload: &disk.Raw{SourcePath: "extension.img"},
+			},
+			{
+				Start:   17 * datasizes.MiB,
+				Size:    1 * datasizes.MiB,
+				Payload: &disk.VerityHash{Target: "/"},
+			},
+		},
+	}
+
+	stage, err := GenVerityImageStage(pt, "extension.raw")
+	require.NoError(t, err)
+	assert.Equal(t, "/extension.raw.roothash", stage.Options.(*DMVerityStageOptions).RootHash)
+	dataOpts := stage.Devices["data_device"].Options.(*LoopbackDeviceOptions)
+	assert.Equal(t, uint64(2048), dataOpts.Start)
+	assert.Equal(t, uint64(32768), dataOpts.Size)
+	hashOpts := stage.Devices["hash_device"].Options.(*LoopbackDeviceOptions)
+	assert.Equal(t, uint64(34816), hashOpts.Start)
+	assert.Equal(t, uint64(2048), hashOpts.Size)
+
+	pt.Partitions[0].Payload = &disk.Filesystem{Type: "ext4", Mountpoint: "/"}
+	_, err = GenVerityImageStage(pt, "extension.raw")
+	assert.EqualError(t, err, "unexpected payload of verity image data partition: *disk.Filesystem")
+
+	pt.Partitions = pt.Partitions[:1]
+	_, err = GenVerityImageStage(pt, "extension.raw")
+	assert.EqualError(t, err, "verity image partition table must have 2 partitions, got 1")
+}
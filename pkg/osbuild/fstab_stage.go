@@ -57,7 +57,10 @@ func (options *FSTabStageOptions) AddFilesystem(id string, vfsType string, path
 	})
 }
 
-func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
+// NewFSTabStageOptions creates the options for the fstab of the filesystems
+// of the partition tables, images with multiple disks pass the partition
+// tables of all disks.
+func NewFSTabStageOptions(pts ...*disk.PartitionTable) (*FSTabStageOptions, error) {
 	var options FSTabStageOptions
 	genOption := func(mnt disk.FSTabEntity, path []disk.Entity) error {
 		fsSpec := mnt.GetFSSpec()
@@ -73,9 +76,10 @@ func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
 		return fmt.Sprintf("%d%s", fs.PassNo, fs.Path)
 	}
 
-	err := pt.ForEachFSTabEntity(genOption)
-	if err != nil {
-		return nil, err
+	for _, pt := range pts {
+		if err := pt.ForEachFSTabEntity(genOption); err != nil {
+			return nil, err
+		}
 	}
 
 	// sort the entries by PassNo to maintain backward compatibility
@@ -172,11 +172,12 @@ func NewGrub2InstStageOption(filename string, pt *disk.PartitionTable, platform
 	}
 
 	return &Grub2InstStageOptions{
-		Filename: filename,
-		Platform: platform,
-		Location: common.ToPtr(coreLocation),
-		Core:     core,
-		Prefix:   prefix,
+		Filename:   filename,
+		Platform:   platform,
+		Location:   common.ToPtr(coreLocation),
+		SectorSize: LoopbackSectorSize(pt),
+		Core:       core,
+		Prefix:     prefix,
 	}
 }
 
@@ -1,5 +1,9 @@
 package osbuild
 
+import (
+	"github.com/osbuild/images/pkg/disk"
+)
+
 // Expose a file (or part of it) as a device node
 
 type LoopbackDeviceOptions struct {
@@ -30,3 +34,15 @@ func NewLoopbackDevice(options *LoopbackDeviceOptions) *Device {
 		Options: options,
 	}
 }
+
+// LoopbackSectorSize returns the sector size option for loopback devices of
+// disk images with the given partition table. It is only set if the partition
+// table has an explicit sector size, otherwise the loop device uses its
+// default of 512 bytes.
+func LoopbackSectorSize(pt *disk.PartitionTable) *uint64 {
+	if pt == nil || pt.SectorSize == 0 {
+		return nil
+	}
+	sectorSize := pt.SectorSize
+	return &sectorSize
+}
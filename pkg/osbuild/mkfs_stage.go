@@ -58,6 +58,11 @@ func GenFsStages(pt *disk.PartitionTable, filename string, soucePipeline string)
 					}
 					mkfsOptions.Geometry = nil // Handled
 				}
+				if pt.GetSectorSize() == disk.NativeSectorSize4K {
+					// UEFI requires FAT32 for the ESP, mkfs.fat picks
+					// FAT16 for small filesystems with 4096 byte sectors
+					options.FATSize = common.ToPtr(32)
+				}
 
 				stages = append(stages, NewMkfsFATStage(options, stageDevices))
 			case "ext4":
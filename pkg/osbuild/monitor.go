@@ -39,6 +39,10 @@ type Status struct {
 	// Pipeline name
 	Pipeline string
 
+	// Stage name, e.g. "org.osbuild.rpm", empty for messages that
+	// are not about a single stage
+	Stage string
+
 	// Duration as measured by osbuild
 	Duration time.Duration
 }
@@ -143,6 +147,7 @@ func (sr *StatusScanner) Status() (*Status, error) {
 			Total: status.Progress.Total,
 		},
 		Pipeline: pipelineName,
+		Stage:    context.Pipeline.Stage.Name,
 		Duration: time.Duration(status.Duration * float64(time.Second)),
 	}
 
@@ -101,6 +101,7 @@ func TestScannerSubprogress(t *testing.T) {
 			},
 		},
 		Pipeline:  "build",
+		Stage:     "org.osbuild.rpm",
 		Timestamp: time.UnixMilli(int64(ts1)),
 	}, st)
 }
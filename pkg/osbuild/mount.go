@@ -1,5 +1,9 @@
 package osbuild
 
+import (
+	"encoding/json"
+)
+
 type Mount struct {
 	Name      string       `json:"name"`
 	Type      string       `json:"type"`
@@ -12,3 +16,40 @@ type Mount struct {
 type MountOptions interface {
 	isMountOptions()
 }
+
+// RawMountOptions are the options of a mount that was unmarshaled from
+// JSON.
+type RawMountOptions json.RawMessage
+
+func (RawMountOptions) isMountOptions() {}
+
+func (o RawMountOptions) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(o).MarshalJSON()
+}
+
+// UnmarshalJSON unmarshals a mount, the options are kept as
+// RawMountOptions.
+func (m *Mount) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name      string          `json:"name"`
+		Type      string          `json:"type"`
+		Source    string          `json:"source"`
+		Target    string          `json:"target"`
+		Options   json.RawMessage `json:"options"`
+		Partition *int            `json:"partition"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Mount{
+		Name:      raw.Name,
+		Type:      raw.Type,
+		Source:    raw.Source,
+		Target:    raw.Target,
+		Partition: raw.Partition,
+	}
+	if isRawSet(raw.Options) {
+		m.Options = RawMountOptions(raw.Options)
+	}
+	return nil
+}
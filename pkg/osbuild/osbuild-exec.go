@@ -2,6 +2,7 @@ package osbuild
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-version"
 
@@ -52,9 +54,29 @@ type OSBuildOptions struct {
 	JSONOutput bool
 
 	CacheMaxSize int64
+
+	// TerminateTimeout is the time osbuild is given to exit after
+	// SIGTERM when the context of the command is done, see
+	// NewOSBuildCmdContext. Defaults to DefaultTerminateTimeout.
+	TerminateTimeout time.Duration
 }
 
 func NewOSBuildCmd(manifest []byte, optsPtr *OSBuildOptions) *exec.Cmd {
+	// nolint: gosec
+	return newOSBuildCmd(exec.Command(osbuildCmd), manifest, optsPtr)
+}
+
+// NewOSBuildCmdContext works like NewOSBuildCmd but osbuild is stopped
+// when ctx is done: it receives SIGTERM first and is killed if it does
+// not exit within opts.TerminateTimeout.
+func NewOSBuildCmdContext(ctx context.Context, manifest []byte, optsPtr *OSBuildOptions) *exec.Cmd {
+	// nolint: gosec
+	cmd := newOSBuildCmd(exec.CommandContext(ctx, osbuildCmd), manifest, optsPtr)
+	setupCancel(cmd, common.ValueOrEmpty(optsPtr).TerminateTimeout)
+	return cmd
+}
+
+func newOSBuildCmd(cmd *exec.Cmd, manifest []byte, optsPtr *OSBuildOptions) *exec.Cmd {
 	opts := common.ValueOrEmpty(optsPtr)
 
 	cacheMaxSize := int64(20 * datasizes.GiB)
@@ -62,9 +84,7 @@ func NewOSBuildCmd(manifest []byte, optsPtr *OSBuildOptions) *exec.Cmd {
 		cacheMaxSize = opts.CacheMaxSize
 	}
 
-	// nolint: gosec
-	cmd := exec.Command(
-		osbuildCmd,
+	cmd.Args = append(cmd.Args,
 		"--store", opts.StoreDir,
 		"--output-directory", opts.OutputDir,
 		fmt.Sprintf("--cache-max-size=%v", cacheMaxSize),
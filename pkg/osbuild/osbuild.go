@@ -28,6 +28,10 @@ type Pipeline struct {
 
 	Runner string `json:"runner,omitempty"`
 
+	// UNIX timestamp that osbuild passes to the stages of the pipeline as
+	// SOURCE_DATE_EPOCH and clamps the modification times of the tree to
+	SourceEpoch *int64 `json:"source-epoch,omitempty"`
+
 	// Sequence of stages that produce the filesystem tree, which is the
 	// payload of the produced image.
 	Stages []*Stage `json:"stages,omitempty"`
@@ -3,9 +3,11 @@
 package osbuild
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPipeline_AddStage(t *testing.T) {
@@ -58,3 +60,55 @@ func TestManifestFromBytes(t *testing.T) {
 
 	assert.Equal(t, pID, "5678")
 }
+
+func TestManifestFromBytesRoundtrip(t *testing.T) {
+	storage := NewContainersStorageSource()
+	storage.AddItem("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+	curl := NewCurlSource()
+	curl.Items["sha256:aaa"] = URL("https://example.com/a.rpm")
+	curl.Items["sha256:bbb"] = CurlSourceOptions{URL: "https://example.com/b.rpm", Secrets: &URLSecrets{Name: "org.osbuild.rhsm"}}
+
+	devices := map[string]Device{
+		"device": *NewLoopbackDevice(&LoopbackDeviceOptions{Filename: "disk.raw", Size: 2048}),
+	}
+	manifest := Manifest{
+		Version: "2",
+		Pipelines: []Pipeline{
+			{
+				Name:  "image",
+				Build: "name:build",
+				Stages: []*Stage{
+					NewMkdirStage(&MkdirStageOptions{Paths: []MkdirStagePath{{Path: "/boot", Parents: true}}}),
+					NewMkfsExt4Stage(&MkfsExt4StageOptions{UUID: "1234"}, devices),
+					NewCopyStage(
+						&CopyStageOptions{Paths: []CopyStagePath{{From: "input://root-tree/", To: "mount://root/"}}},
+						NewPipelineTreeInputs("root-tree", "os"),
+						devices,
+						[]Mount{*NewExt4Mount("root", "device", "/")},
+					),
+				},
+			},
+		},
+		Sources: Sources{
+			SourceNameContainersStorage: storage,
+			SourceNameCurl:              curl,
+		},
+	}
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	// all stages and sources can be unmarshaled, stage options, inputs,
+	// device and mount options are kept as raw JSON
+	loaded, err := NewManifestFromBytes(data)
+	require.NoError(t, err)
+	require.Len(t, loaded.Pipelines[0].Stages, 3)
+	assert.IsType(t, RawStageOptions{}, loaded.Pipelines[0].Stages[0].Options)
+	assert.IsType(t, RawInputs{}, loaded.Pipelines[0].Stages[2].Inputs)
+	assert.IsType(t, RawDeviceOptions{}, loaded.Pipelines[0].Stages[2].Devices["device"].Options)
+	assert.Nil(t, loaded.Pipelines[0].Stages[2].Mounts[0].Options)
+	assert.Equal(t, curl, loaded.Sources[SourceNameCurl])
+
+	roundtrip, err := json.Marshal(loaded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(roundtrip))
+}
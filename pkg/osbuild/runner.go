@@ -0,0 +1,175 @@
+package osbuild
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/osbuild/images/internal/common"
+)
+
+// DefaultTerminateTimeout is the time osbuild is given to exit after it
+// received SIGTERM on cancellation before it is killed.
+const DefaultTerminateTimeout = 30 * time.Second
+
+// StatusFunc is called for every status update of a running osbuild
+type StatusFunc func(*Status)
+
+// BuildError is returned by RunOSBuildContext when osbuild ran but the
+// build failed. It identifies the failing pipeline and stage.
+type BuildError struct {
+	// Pipeline is the name of the pipeline that failed, it is empty if
+	// the manifest failed to validate
+	Pipeline string
+	// Stage is the type of the stage that failed, e.g. org.osbuild.rpm
+	Stage string
+	// Output of the failing stage or the validation errors
+	Output string
+
+	Result *Result
+}
+
+func (e *BuildError) Error() string {
+	if e.Pipeline == "" && e.Stage == "" {
+		return fmt.Sprintf("osbuild failed: %s", e.Output)
+	}
+	return fmt.Sprintf("osbuild failed in pipeline %q at stage %q", e.Pipeline, e.Stage)
+}
+
+// newBuildError returns the error for a failed result or nil if the
+// result does not contain a failure.
+func newBuildError(res *Result) *BuildError {
+	if res.Type == "https://osbuild.org/validation-error" {
+		var output []string
+		for _, e := range res.Errors {
+			output = append(output, fmt.Sprintf("%s: %s", strings.Join(e.Path, "."), e.Message))
+		}
+		return &BuildError{
+			Output: fmt.Sprintf("%s\n%s", res.Title, strings.Join(output, "\n")),
+			Result: res,
+		}
+	}
+
+	// the pipeline results don't have a stable order, osbuild stops
+	// at the first failure so there is at most one failed stage
+	pipelineNames := make([]string, 0, len(res.Log))
+	for name := range res.Log {
+		pipelineNames = append(pipelineNames, name)
+	}
+	slices.Sort(pipelineNames)
+	for _, pipelineName := range pipelineNames {
+		for _, stage := range res.Log[pipelineName] {
+			if !stage.Success {
+				return &BuildError{
+					Pipeline: pipelineName,
+					Stage:    stage.Type,
+					Output:   stage.Output,
+					Result:   res,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RunOSBuildContext runs osbuild like RunOSBuild but it can be cancelled
+// through ctx and reports the progress of the build.
+//
+// On cancellation osbuild receives SIGTERM and gets
+// opts.TerminateTimeout to clean up before it is killed with SIGKILL.
+//
+// The runner owns the osbuild monitor, opts.Monitor and
+// opts.MonitorFile must not be set. Every status update of the build is
+// passed to onStatus, which may be nil. The callback is called from the
+// goroutine that runs the build, it should not block for long.
+//
+// The result is built from the monitor output, opts.JSONOutput is
+// ignored. If the build fails the result is returned together with a
+// *BuildError.
+func RunOSBuildContext(ctx context.Context, manifest []byte, optsPtr *OSBuildOptions, onStatus StatusFunc) (*Result, error) {
+	opts := common.ValueOrEmpty(optsPtr)
+	if opts.Monitor != "" || opts.MonitorFile != nil {
+		return nil, fmt.Errorf("cannot run osbuild with a custom monitor, the runner owns the monitor")
+	}
+
+	if err := CheckMinimumOSBuildVersion(); err != nil {
+		return nil, err
+	}
+
+	rp, wp, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create monitor pipe: %w", err)
+	}
+	defer rp.Close()
+
+	opts.Monitor = MonitorJSONSeq
+	opts.MonitorFile = wp
+	opts.JSONOutput = false
+	cmd := NewOSBuildCmdContext(ctx, manifest, &opts)
+
+	if err := cmd.Start(); err != nil {
+		wp.Close()
+		return nil, fmt.Errorf("error starting osbuild: %w", err)
+	}
+	// osbuild has its own copy now, closing ours ensures that reading
+	// the monitor ends when osbuild exits
+	wp.Close()
+
+	scanner := NewStatusScanner(rp)
+	var scanErr error
+	for {
+		st, err := scanner.Status()
+		if err != nil {
+			scanErr = err
+			break
+		}
+		if st == nil {
+			break
+		}
+		if onStatus != nil {
+			onStatus(st)
+		}
+	}
+	if scanErr != nil {
+		// keep draining the monitor so that osbuild does not block
+		_, _ = io.Copy(io.Discard, rp)
+	}
+	waitErr := cmd.Wait()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, fmt.Errorf("osbuild was cancelled: %w", ctxErr)
+	}
+	if scanErr != nil {
+		return nil, fmt.Errorf("cannot read osbuild status: %w", scanErr)
+	}
+
+	res, err := scanner.Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get osbuild result: %w", err)
+	}
+	if buildErr := newBuildError(res); buildErr != nil {
+		return res, buildErr
+	}
+	if waitErr != nil {
+		return res, fmt.Errorf("running osbuild failed: %w", waitErr)
+	}
+	return res, nil
+}
+
+// setupCancel makes osbuild exit gracefully when the context of cmd is
+// done: it receives SIGTERM first and SIGKILL after timeout.
+func setupCancel(cmd *exec.Cmd, timeout time.Duration) {
+	if timeout == 0 {
+		timeout = DefaultTerminateTimeout
+	}
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = timeout
+}
@@ -0,0 +1,136 @@
+package osbuild_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+const fakeOSBuildVersion = `
+if [ "$1" = "--version" ]; then
+    echo '90000.0'
+    exit 0
+fi
+`
+
+func TestRunOSBuildContextStatus(t *testing.T) {
+	fakeOSBuildBinary := makeFakeOSBuild(t, fakeOSBuildVersion+`
+printf '\036{"message": "Starting pipeline os", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1", "stage": {}}, "id": "c1"}, "progress": {"name": "pipelines", "total": 2, "done": 1}, "timestamp": 1731589407.0}\n' >&3
+printf '\036{"message": "stage output", "context": {"origin": "org.osbuild", "pipeline": {"name": "os", "id": "p1", "stage": {"name": "org.osbuild.rpm", "id": "s1"}}, "id": "c2"}, "progress": {"name": "pipelines", "total": 2, "done": 1}, "timestamp": 1731589408.0}\n' >&3
+printf '\036{"message": "Finished stage", "result": {"name": "org.osbuild.rpm", "id": "s1", "success": true, "output": "stage output"}, "context": {"id": "c2"}, "progress": {"name": "pipelines", "total": 2, "done": 2}, "timestamp": 1731589409.0}\n' >&3
+`)
+	restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+	defer restore()
+
+	var statuses []*osbuild.Status
+	res, err := osbuild.RunOSBuildContext(context.Background(), []byte(`{"fake":"manifest"}`), nil, func(st *osbuild.Status) {
+		statuses = append(statuses, st)
+	})
+	require.NoError(t, err)
+	assert.True(t, res.Success)
+	assert.Equal(t, "org.osbuild.rpm", res.Log["os"][0].Type)
+
+	require.Len(t, statuses, 3)
+	assert.Equal(t, "Starting pipeline os", statuses[0].Message)
+	assert.Equal(t, "os", statuses[0].Pipeline)
+	assert.Equal(t, "stage output", statuses[1].Trace)
+	assert.Equal(t, 2, statuses[2].Progress.Done)
+}
+
+func TestRunOSBuildContextStageFailure(t *testing.T) {
+	fakeOSBuildBinary := makeFakeOSBuild(t, fakeOSBuildVersion+`
+printf '\036{"message": "Finished stage", "result": {"name": "org.osbuild.rpm", "id": "s1", "success": false, "output": "no space left"}, "context": {"origin": "org.osbuild", "pipeline": {"name": "os", "id": "p1", "stage": {"name": "org.osbuild.rpm", "id": "s1"}}, "id": "c1"}, "progress": {"name": "pipelines", "total": 2, "done": 1}, "timestamp": 1731589409.0}\n' >&3
+exit 1
+`)
+	restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+	defer restore()
+
+	res, err := osbuild.RunOSBuildContext(context.Background(), nil, nil, nil)
+	assert.EqualError(t, err, `osbuild failed in pipeline "os" at stage "org.osbuild.rpm"`)
+	var buildErr *osbuild.BuildError
+	require.True(t, errors.As(err, &buildErr))
+	assert.Equal(t, "os", buildErr.Pipeline)
+	assert.Equal(t, "org.osbuild.rpm", buildErr.Stage)
+	assert.Equal(t, "no space left", buildErr.Output)
+	assert.Equal(t, res, buildErr.Result)
+	assert.False(t, res.Success)
+}
+
+func TestRunOSBuildContextValidationFailure(t *testing.T) {
+	fakeOSBuildBinary := makeFakeOSBuild(t, fakeOSBuildVersion+`
+printf '\036{"type": "https://osbuild.org/validation-error", "title": "JSON Schema validation failed", "success": false, "errors": [{"message": "bad", "path": ["pipelines", 0]}]}\n' >&3
+exit 2
+`)
+	restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+	defer restore()
+
+	_, err := osbuild.RunOSBuildContext(context.Background(), nil, nil, nil)
+	assert.EqualError(t, err, "osbuild failed: JSON Schema validation failed\npipelines.[0]: bad")
+}
+
+func TestRunOSBuildContextExitFailure(t *testing.T) {
+	fakeOSBuildBinary := makeFakeOSBuild(t, fakeOSBuildVersion+`
+exit 3
+`)
+	restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+	defer restore()
+
+	_, err := osbuild.RunOSBuildContext(context.Background(), nil, nil, nil)
+	assert.EqualError(t, err, "running osbuild failed: exit status 3")
+}
+
+func TestRunOSBuildContextCancel(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+	}{
+		// osbuild exits on SIGTERM
+		{"terminate", `
+trap 'echo terminated > "$MARKER"; exit 1' TERM
+printf '\036{"message": "started", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1", "stage": {}}, "id": "c1"}, "progress": {"name": "pipelines", "total": 1, "done": 0}}\n' >&3
+while true; do sleep 0.1; done
+`},
+		// osbuild ignores SIGTERM and needs to be killed
+		{"kill", `
+trap '' TERM
+printf '\036{"message": "started", "context": {"origin": "osbuild.monitor", "pipeline": {"name": "os", "id": "p1", "stage": {}}, "id": "c1"}, "progress": {"name": "pipelines", "total": 1, "done": 0}}\n' >&3
+while true; do sleep 0.1; done
+`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			marker := t.TempDir() + "/marker"
+			fakeOSBuildBinary := makeFakeOSBuild(t, fakeOSBuildVersion+tc.script)
+			restore := osbuild.MockOSBuildCmd(fakeOSBuildBinary)
+			defer restore()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			opts := &osbuild.OSBuildOptions{
+				ExtraEnv:         []string{"MARKER=" + marker},
+				TerminateTimeout: 200 * time.Millisecond,
+			}
+			start := time.Now()
+			_, err := osbuild.RunOSBuildContext(ctx, nil, opts, func(st *osbuild.Status) {
+				// cancel once the build is running
+				cancel()
+			})
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Less(t, time.Since(start), 10*time.Second)
+
+			_, statErr := os.Stat(marker)
+			assert.Equal(t, tc.name == "terminate", statErr == nil)
+		})
+	}
+}
+
+func TestRunOSBuildContextCustomMonitor(t *testing.T) {
+	_, err := osbuild.RunOSBuildContext(context.Background(), nil, &osbuild.OSBuildOptions{Monitor: osbuild.MonitorLog}, nil)
+	assert.EqualError(t, err, "cannot run osbuild with a custom monitor, the runner owns the monitor")
+}
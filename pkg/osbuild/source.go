@@ -69,6 +69,12 @@ func (sources *Sources) UnmarshalJSON(data []byte) error {
 			source = new(InlineSource)
 		case SourceNameOstree:
 			source = new(OSTreeSource)
+		case SourceNameSkopeo:
+			source = new(SkopeoSource)
+		case SourceNameSkopeoIndex:
+			source = new(SkopeoIndexSource)
+		case SourceNameContainersStorage:
+			source = new(ContainersStorageSource)
 		default:
 			return errors.New("unexpected source name: " + name)
 		}
@@ -1,5 +1,9 @@
 package osbuild
 
+import (
+	"encoding/json"
+)
+
 // Single stage of a pipeline executing one step
 type Stage struct {
 	// Well-known name in reverse domain-name notation, uniquely identifying
@@ -21,6 +25,59 @@ type StageOptions interface {
 	isStageOptions()
 }
 
+// RawStageOptions are the options of a stage that was unmarshaled from
+// JSON. Stage options have no type information, so they are kept as is.
+type RawStageOptions json.RawMessage
+
+func (RawStageOptions) isStageOptions() {}
+
+func (o RawStageOptions) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(o).MarshalJSON()
+}
+
+// RawInputs are the inputs of a stage that was unmarshaled from JSON.
+type RawInputs json.RawMessage
+
+func (RawInputs) isStageInputs() {}
+
+func (i RawInputs) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(i).MarshalJSON()
+}
+
+// UnmarshalJSON unmarshals a stage. The inputs and options are kept as
+// RawInputs and RawStageOptions, so that any stage can be unmarshaled.
+func (s *Stage) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Type    string            `json:"type"`
+		ID      string            `json:"id"`
+		Inputs  json.RawMessage   `json:"inputs"`
+		Options json.RawMessage   `json:"options"`
+		Devices map[string]Device `json:"devices"`
+		Mounts  []Mount           `json:"mounts"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Stage{
+		Type:    raw.Type,
+		ID:      raw.ID,
+		Devices: raw.Devices,
+		Mounts:  raw.Mounts,
+	}
+	if isRawSet(raw.Inputs) {
+		s.Inputs = RawInputs(raw.Inputs)
+	}
+	if isRawSet(raw.Options) {
+		s.Options = RawStageOptions(raw.Options)
+	}
+	return nil
+}
+
+// isRawSet returns true if the raw message is neither missing nor null
+func isRawSet(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
+
 // MountOSTree adds an ostree mount to a stage which makes it run in a deployed
 // ostree stateroot.
 func (s *Stage) MountOSTree(osName, ref string, serial int) {
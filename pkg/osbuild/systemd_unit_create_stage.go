@@ -246,8 +246,8 @@ func NewSystemdUnitCreateStage(options *SystemdUnitCreateStageOptions) *Stage {
 
 // GenSystemdMountStages generates a collection of
 // org.osbuild.systemd.unit.create stages with options to create systemd mount
-// units, one for each mountpoint in the partition table.
-func GenSystemdMountStages(pt *disk.PartitionTable) ([]*Stage, error) {
+// units, one for each mountpoint in the partition tables.
+func GenSystemdMountStages(pts ...*disk.PartitionTable) ([]*Stage, error) {
 	mountStages := make([]*Stage, 0)
 	unitNames := make([]string, 0)
 
@@ -306,9 +306,10 @@ func GenSystemdMountStages(pt *disk.PartitionTable) ([]*Stage, error) {
 		return nil
 	}
 
-	err := pt.ForEachFSTabEntity(genOption)
-	if err != nil {
-		return nil, err
+	for _, pt := range pts {
+		if err := pt.ForEachFSTabEntity(genOption); err != nil {
+			return nil, err
+		}
 	}
 
 	// sort the entries by filename for stable ordering
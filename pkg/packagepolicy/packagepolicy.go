@@ -0,0 +1,331 @@
+// Package packagepolicy checks the depsolved packages of an image against
+// allow and deny rules on package names, licenses, vendors and repositories.
+//
+// Licenses are taken from the rpm headers of the packages, which is the same
+// data the SPDX SBOM of a depsolve declares for each package. License
+// expressions like "MIT AND (GPL-3.0-only OR BSD-3-Clause)" are split into
+// their license identifiers: a deny rule matches if any identifier matches,
+// an allow rule only matches if all identifiers match.
+package packagepolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gobwas/glob"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+// Mode selects how the violations of a policy are reported
+type Mode string
+
+const (
+	// ModeEnforce reports violations as a *ViolationError, it is the
+	// default
+	ModeEnforce Mode = "enforce"
+	// ModeWarn reports violations as warnings
+	ModeWarn Mode = "warn"
+)
+
+// Rule matches packages. Each field is a list of globs of which one needs
+// to match, all fields that are set need to match for the rule to match.
+type Rule struct {
+	Names    []string `json:"names,omitempty"`
+	Licenses []string `json:"licenses,omitempty"`
+	Vendors  []string `json:"vendors,omitempty"`
+	// Repos match the id or the name of the repository of a package
+	Repos []string `json:"repos,omitempty"`
+}
+
+// Policy is a set of rules for the packages of an image
+type Policy struct {
+	Name string `json:"name"`
+
+	// ImageTypes the policy applies to as globs, the policy applies
+	// to all image types if empty
+	ImageTypes []string `json:"image_types,omitempty"`
+
+	// Pipelines whose packages are checked as globs. If empty the
+	// payload pipelines are checked, the packages of the build root
+	// are not part of the image.
+	Pipelines []string `json:"pipelines,omitempty"`
+
+	// Allow rules, if set every package must match at least one
+	Allow []Rule `json:"allow,omitempty"`
+	// Deny rules, a package that matches any of them is a violation
+	// even if it matches an allow rule
+	Deny []Rule `json:"deny,omitempty"`
+
+	Mode Mode `json:"mode,omitempty"`
+}
+
+// Violation is a package that violates a policy
+type Violation struct {
+	Policy   string `json:"policy"`
+	Pipeline string `json:"pipeline"`
+	// Package is the full NEVRA of the package
+	Package string `json:"package"`
+	Reason  string `json:"reason"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("package %s in pipeline %q violates policy %q: %s", v.Package, v.Pipeline, v.Policy, v.Reason)
+}
+
+// ViolationError is returned for the violations of enforced policies
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	lines := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		lines = append(lines, v.String())
+	}
+	return fmt.Sprintf("package policy violations:\n%s", strings.Join(lines, "\n"))
+}
+
+// Load reads a JSON list of policies and validates them
+func Load(r io.Reader) ([]Policy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var policies []Policy
+	if err := dec.Decode(&policies); err != nil {
+		return nil, fmt.Errorf("cannot parse package policies: %w", err)
+	}
+	for _, p := range policies {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+// compiledRule is a Rule with compiled globs, nil fields match everything
+type compiledRule struct {
+	names    []glob.Glob
+	licenses []glob.Glob
+	vendors  []glob.Glob
+	repos    []glob.Glob
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	globs := make([]glob.Glob, 0, len(patterns))
+	for _, pattern := range patterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule.Names) == 0 && len(rule.Licenses) == 0 && len(rule.Vendors) == 0 && len(rule.Repos) == 0 {
+			return nil, fmt.Errorf("rule matches all packages, at least one of names, licenses, vendors or repos is required")
+		}
+		var cr compiledRule
+		var err error
+		if cr.names, err = compileGlobs(rule.Names); err != nil {
+			return nil, err
+		}
+		if cr.licenses, err = compileGlobs(rule.Licenses); err != nil {
+			return nil, err
+		}
+		if cr.vendors, err = compileGlobs(rule.Vendors); err != nil {
+			return nil, err
+		}
+		if cr.repos, err = compileGlobs(rule.Repos); err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, cr)
+	}
+	return compiled, nil
+}
+
+func matchAny(globs []glob.Glob, values ...string) bool {
+	for _, g := range globs {
+		for _, v := range values {
+			if g.Match(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// licenseIDs splits a license expression into its license identifiers,
+// the exceptions of "<license> WITH <exception>" are dropped
+func licenseIDs(expression string) []string {
+	var ids []string
+	exception := false
+	for _, field := range strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expression)) {
+		switch {
+		case exception:
+			exception = false
+		case strings.EqualFold(field, "WITH"):
+			exception = true
+		case strings.EqualFold(field, "AND"), strings.EqualFold(field, "OR"):
+		default:
+			ids = append(ids, field)
+		}
+	}
+	return ids
+}
+
+// match checks if the rule matches the package, allRequired selects if
+// all license identifiers need to match the license globs
+func (cr *compiledRule) match(pkg rpmmd.Package, allRequired bool) bool {
+	if cr.names != nil && !matchAny(cr.names, pkg.Name) {
+		return false
+	}
+	if cr.licenses != nil {
+		ids := licenseIDs(pkg.License)
+		if len(ids) == 0 {
+			return false
+		}
+		matched := 0
+		for _, id := range ids {
+			if matchAny(cr.licenses, id) {
+				matched++
+			}
+		}
+		if matched == 0 || (allRequired && matched != len(ids)) {
+			return false
+		}
+	}
+	if cr.vendors != nil && !matchAny(cr.vendors, pkg.Vendor) {
+		return false
+	}
+	if cr.repos != nil {
+		repos := []string{pkg.RepoID}
+		if pkg.Repo != nil {
+			repos = append(repos, pkg.Repo.Id, pkg.Repo.Name)
+		}
+		if !matchAny(cr.repos, repos...) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that the mode and globs of the policy are valid
+func (p *Policy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("package policy needs a name")
+	}
+	switch p.Mode {
+	case "", ModeEnforce, ModeWarn:
+	default:
+		return fmt.Errorf("package policy %q has the invalid mode %q", p.Name, p.Mode)
+	}
+	for _, patterns := range [][]string{p.ImageTypes, p.Pipelines} {
+		if _, err := compileGlobs(patterns); err != nil {
+			return fmt.Errorf("package policy %q: %w", p.Name, err)
+		}
+	}
+	for _, rules := range [][]Rule{p.Allow, p.Deny} {
+		if _, err := compileRules(rules); err != nil {
+			return fmt.Errorf("package policy %q: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Warn returns true if violations of the policy are warnings
+func (p *Policy) Warn() bool {
+	return p.Mode == ModeWarn
+}
+
+// AppliesTo returns true if the policy applies to the image type with the
+// given name
+func (p *Policy) AppliesTo(imageType string) bool {
+	if len(p.ImageTypes) == 0 {
+		return true
+	}
+	globs, err := compileGlobs(p.ImageTypes)
+	return err == nil && matchAny(globs, imageType)
+}
+
+// ChecksPipeline returns true if the policy checks the packages of the
+// pipeline with the given name, payload selects if it is a payload
+// pipeline of the image
+func (p *Policy) ChecksPipeline(pipeline string, payload bool) bool {
+	if len(p.Pipelines) == 0 {
+		return payload
+	}
+	globs, err := compileGlobs(p.Pipelines)
+	return err == nil && matchAny(globs, pipeline)
+}
+
+// Check returns the violations of the policy by the packages of the given
+// pipeline
+func (p *Policy) Check(pipeline string, pkgs rpmmd.PackageList) ([]Violation, error) {
+	allow, err := compileRules(p.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("package policy %q: %w", p.Name, err)
+	}
+	deny, err := compileRules(p.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("package policy %q: %w", p.Name, err)
+	}
+
+	var violations []Violation
+	for _, pkg := range pkgs {
+		reason := ""
+		for i := range deny {
+			if deny[i].match(pkg, false) {
+				reason = fmt.Sprintf("denied by rule %s", formatRule(p.Deny[i]))
+				break
+			}
+		}
+		if reason == "" && len(allow) > 0 {
+			allowed := false
+			for i := range allow {
+				if allow[i].match(pkg, true) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				reason = "not allowed by any rule"
+			}
+		}
+		if reason != "" {
+			violations = append(violations, Violation{
+				Policy:   p.Name,
+				Pipeline: pipeline,
+				Package:  pkg.FullNEVRA(),
+				Reason:   reason,
+			})
+		}
+	}
+	return violations, nil
+}
+
+func formatRule(rule Rule) string {
+	var fields []string
+	for _, f := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"names", rule.Names},
+		{"licenses", rule.Licenses},
+		{"vendors", rule.Vendors},
+		{"repos", rule.Repos},
+	} {
+		if len(f.patterns) > 0 {
+			fields = append(fields, fmt.Sprintf("%s=%s", f.name, strings.Join(f.patterns, ",")))
+		}
+	}
+	return strings.Join(fields, " ")
+}
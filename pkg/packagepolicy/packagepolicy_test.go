@@ -0,0 +1,155 @@
+package packagepolicy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+var testPackages = rpmmd.PackageList{
+	{Name: "bash", Version: "5.2", Release: "1", Arch: "x86_64", License: "GPL-3.0-or-later", Vendor: "Fedora Project", RepoID: "abc", Repo: &rpmmd.RepoConfig{Id: "abc", Name: "fedora"}},
+	{Name: "telnet-server", Version: "0.17", Release: "1", Arch: "x86_64", License: "BSD-4-Clause-UC", Vendor: "Fedora Project", RepoID: "abc", Repo: &rpmmd.RepoConfig{Id: "abc", Name: "fedora"}},
+	{Name: "gcc-libs", Version: "14", Release: "1", Arch: "x86_64", License: "GPL-3.0-or-later WITH GCC-exception-3.1 AND (MIT OR GPL-3.0-only)", Vendor: "Fedora Project", RepoID: "abc", Repo: &rpmmd.RepoConfig{Id: "abc", Name: "fedora"}},
+	{Name: "tool", Version: "1", Release: "1", Arch: "noarch", License: "MIT", Vendor: "ACME", RepoID: "def", Repo: &rpmmd.RepoConfig{Id: "def", Name: "acme-tools"}},
+}
+
+func TestLicenseIDs(t *testing.T) {
+	assert.Equal(t, []string{"MIT"}, licenseIDs("MIT"))
+	assert.Equal(t, []string{"GPL-3.0-or-later", "MIT", "GPL-3.0-only"}, licenseIDs("GPL-3.0-or-later WITH GCC-exception-3.1 AND (MIT OR GPL-3.0-only)"))
+	assert.Equal(t, []string{"GPLv2+", "LGPLv2+"}, licenseIDs("GPLv2+ and LGPLv2+"))
+	assert.Empty(t, licenseIDs(""))
+}
+
+func violatingPackages(violations []Violation) []string {
+	var names []string
+	for _, v := range violations {
+		names = append(names, v.Package)
+	}
+	return names
+}
+
+func TestPolicyCheck(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policy   Policy
+		expected []string
+	}{
+		{
+			name:     "deny name",
+			policy:   Policy{Name: "test", Deny: []Rule{{Names: []string{"telnet-server"}}}},
+			expected: []string{"telnet-server-0:0.17-1.x86_64"},
+		},
+		{
+			name:     "deny license, any identifier",
+			policy:   Policy{Name: "test", Deny: []Rule{{Licenses: []string{"GPL-3.0-only"}}}},
+			expected: []string{"gcc-libs-0:14-1.x86_64"},
+		},
+		{
+			name:     "deny vendor and repo",
+			policy:   Policy{Name: "test", Deny: []Rule{{Vendors: []string{"ACME*"}, Repos: []string{"acme-*"}}}},
+			expected: []string{"tool-0:1-1.noarch"},
+		},
+		{
+			name:     "deny needs all fields",
+			policy:   Policy{Name: "test", Deny: []Rule{{Names: []string{"bash"}, Repos: []string{"acme-*"}}}},
+			expected: nil,
+		},
+		{
+			name:     "allow license, all identifiers",
+			policy:   Policy{Name: "test", Allow: []Rule{{Licenses: []string{"GPL-3.0-or-later", "MIT"}}}},
+			expected: []string{"telnet-server-0:0.17-1.x86_64", "gcc-libs-0:14-1.x86_64"},
+		},
+		{
+			name: "deny wins over allow",
+			policy: Policy{
+				Name:  "test",
+				Allow: []Rule{{Repos: []string{"abc"}}, {Names: []string{"tool"}}},
+				Deny:  []Rule{{Names: []string{"bash"}}},
+			},
+			expected: []string{"bash-0:5.2-1.x86_64"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.policy.Validate())
+			violations, err := tc.policy.Check("os", testPackages)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, violatingPackages(violations))
+		})
+	}
+}
+
+func TestPolicyCheckViolation(t *testing.T) {
+	policy := Policy{
+		Name: "test",
+		Deny: []Rule{{Names: []string{"telnet*"}, Licenses: []string{"BSD-*"}}},
+	}
+	violations, err := policy.Check("os", testPackages)
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	assert.Equal(t, Violation{
+		Policy:   "test",
+		Pipeline: "os",
+		Package:  "telnet-server-0:0.17-1.x86_64",
+		Reason:   "denied by rule names=telnet* licenses=BSD-*",
+	}, violations[0])
+
+	err = &ViolationError{Violations: violations}
+	assert.EqualError(t, err, "package policy violations:\n"+
+		`package telnet-server-0:0.17-1.x86_64 in pipeline "os" violates policy "test": denied by rule names=telnet* licenses=BSD-*`)
+}
+
+func TestPolicyAppliesTo(t *testing.T) {
+	global := Policy{Name: "global"}
+	assert.True(t, global.AppliesTo("qcow2"))
+	assert.True(t, global.ChecksPipeline("os", true))
+	assert.False(t, global.ChecksPipeline("build", false))
+
+	p := Policy{Name: "cloud", ImageTypes: []string{"ami", "*-azure"}, Pipelines: []string{"build"}}
+	assert.True(t, p.AppliesTo("ami"))
+	assert.True(t, p.AppliesTo("vhd-azure"))
+	assert.False(t, p.AppliesTo("qcow2"))
+	assert.True(t, p.ChecksPipeline("build", false))
+	assert.False(t, p.ChecksPipeline("os", true))
+}
+
+func TestLoad(t *testing.T) {
+	policies, err := Load(strings.NewReader(`[
+		{"name": "no-gpl3", "image_types": ["ami"], "deny": [{"licenses": ["GPL-3.0-only"]}], "mode": "warn"}
+	]`))
+	require.NoError(t, err)
+	assert.Equal(t, []Policy{
+		{
+			Name:       "no-gpl3",
+			ImageTypes: []string{"ami"},
+			Deny:       []Rule{{Licenses: []string{"GPL-3.0-only"}}},
+			Mode:       ModeWarn,
+		},
+	}, policies)
+	assert.True(t, policies[0].Warn())
+}
+
+func TestLoadErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"unknown field", `[{"name": "p", "denny": []}]`, `cannot parse package policies: json: unknown field "denny"`},
+		{"no name", `[{"deny": [{"names": ["a"]}]}]`, "package policy needs a name"},
+		{"empty rule", `[{"name": "p", "allow": [{}]}]`, `package policy "p": rule matches all packages, at least one of names, licenses, vendors or repos is required`},
+		{"invalid glob", `[{"name": "p", "deny": [{"names": ["[a"]}]}]`, `package policy "p": invalid glob "[a": `},
+		{"invalid mode", `[{"name": "p", "mode": "log"}]`, `package policy "p" has the invalid mode "log"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(strings.NewReader(tc.input))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
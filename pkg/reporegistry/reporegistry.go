@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"path/filepath"
+	"slices"
 
 	"github.com/osbuild/images/pkg/distroidparser"
 	"github.com/osbuild/images/pkg/rpmmd"
@@ -35,6 +37,19 @@ func New(repoConfigPaths []string, repoConfigFS []fs.FS) (*RepoRegistry, error)
 	return &RepoRegistry{repositories}, nil
 }
 
+// NewWithSearchPaths returns a new RepoRegistry instance with the data
+// loaded from the "repositories" directories of the given distro
+// definitions search paths and then from the given repoConfigFS
+// instances. This matches distrofactory.NewWithSearchPaths, later
+// search paths take precedence over earlier ones.
+func NewWithSearchPaths(searchPaths []string, repoConfigFS []fs.FS) (*RepoRegistry, error) {
+	var repoConfigPaths []string
+	for _, searchPath := range slices.Backward(searchPaths) {
+		repoConfigPaths = append(repoConfigPaths, filepath.Join(searchPath, "repositories"))
+	}
+	return New(repoConfigPaths, repoConfigFS)
+}
+
 func NewFromDistrosRepoConfigs(distrosRepoConfigs rpmmd.DistrosRepoConfigs) *RepoRegistry {
 	return &RepoRegistry{distrosRepoConfigs}
 }
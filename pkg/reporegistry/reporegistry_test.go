@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/distro/test_distro"
@@ -353,3 +354,23 @@ func TestInvalidReposByArchName(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWithSearchPaths(t *testing.T) {
+	searchPaths := []string{
+		"./test/confpaths/priority2",
+		"./test/confpaths/priority1",
+		"./test/confpaths/missing",
+	}
+	rr, err := NewWithSearchPaths(searchPaths, nil)
+	require.NoError(t, err)
+
+	// later search paths take precedence
+	repos, err := rr.ReposByArchName("fedora-33", "test_arch", false)
+	require.NoError(t, err)
+	require.NotEmpty(t, repos)
+	assert.Equal(t, "fedora-33-p1", repos[0].Name)
+
+	// repositories from all search paths are available
+	assert.Contains(t, rr.ListDistros(), "fedora-34")
+	assert.Contains(t, rr.ListDistros(), "rhel-8.7")
+}
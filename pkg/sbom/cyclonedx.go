@@ -0,0 +1,266 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// CycloneDXSpecVersion is the version of the CycloneDX specification that
+// generated documents conform to.
+const CycloneDXSpecVersion = "1.5"
+
+// spdxDocument is the subset of an SPDX 2.x JSON document that is needed to
+// convert it to CycloneDX.
+type spdxDocument struct {
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	SPDXID           string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo"`
+	Supplier         string            `json:"supplier"`
+	DownloadLocation string            `json:"downloadLocation"`
+	Homepage         string            `json:"homepage"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	Summary          string            `json:"summary"`
+	Description      string            `json:"description"`
+	Checksums        []spdxChecksum    `json:"checksums"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SpdxElementID      string `json:"spdxElementId"`
+	RelatedSpdxElement string `json:"relatedSpdxElement"`
+	RelationshipType   string `json:"relationshipType"`
+}
+
+// cdxDocument is a CycloneDX JSON document.
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber,omitempty"`
+	Version      int             `json:"version"`
+	Metadata     *cdxMetadata    `json:"metadata,omitempty"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string     `json:"timestamp,omitempty"`
+	Tools     *cdxTools  `json:"tools,omitempty"`
+	Authors   []cdxActor `json:"authors,omitempty"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxActor struct {
+	Name string `json:"name"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Supplier           *cdxActor        `json:"supplier,omitempty"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	Description        string           `json:"description,omitempty"`
+	Hashes             []cdxHash        `json:"hashes,omitempty"`
+	Licenses           []cdxLicense     `json:"licenses,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// spdxToCdxHashAlg maps SPDX checksum algorithms to CycloneDX hash
+// algorithms. Algorithms without a CycloneDX equivalent are dropped.
+var spdxToCdxHashAlg = map[string]string{
+	"MD5":      "MD5",
+	"SHA1":     "SHA-1",
+	"SHA256":   "SHA-256",
+	"SHA384":   "SHA-384",
+	"SHA512":   "SHA-512",
+	"SHA3-256": "SHA3-256",
+	"SHA3-384": "SHA3-384",
+	"SHA3-512": "SHA3-512",
+}
+
+// spdxNoValue returns true if the given SPDX field value does not carry any
+// information.
+func spdxNoValue(s string) bool {
+	return s == "" || s == "NOASSERTION" || s == "NONE"
+}
+
+// SpdxToCycloneDX converts an SPDX 2.x JSON document, as generated by the
+// depsolver, into a CycloneDX JSON document. Packages become components and
+// dependency relationships are kept. Information that has no CycloneDX
+// equivalent is dropped.
+func SpdxToCycloneDX(spdxDoc json.RawMessage) (json.RawMessage, error) {
+	var spdx spdxDocument
+	if err := json.Unmarshal(spdxDoc, &spdx); err != nil {
+		return nil, fmt.Errorf("cannot parse SPDX document: %w", err)
+	}
+
+	cdx := cdxDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: CycloneDXSpecVersion,
+		Version:     1,
+		Components:  []cdxComponent{},
+	}
+	if spdx.DocumentNamespace != "" {
+		// derive the serial number from the namespace so that the same
+		// SPDX document always yields the same CycloneDX document
+		cdx.SerialNumber = "urn:uuid:" + uuid.NewSHA1(uuid.NameSpaceURL, []byte(spdx.DocumentNamespace)).String()
+	}
+
+	metadata := &cdxMetadata{Timestamp: spdx.CreationInfo.Created}
+	for _, creator := range spdx.CreationInfo.Creators {
+		kind, name, ok := strings.Cut(creator, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		switch kind {
+		case "Tool":
+			if metadata.Tools == nil {
+				metadata.Tools = &cdxTools{}
+			}
+			metadata.Tools.Components = append(metadata.Tools.Components, cdxComponent{Type: "application", Name: name})
+		case "Organization", "Person":
+			metadata.Authors = append(metadata.Authors, cdxActor{Name: name})
+		}
+	}
+	if metadata.Timestamp != "" || metadata.Tools != nil || len(metadata.Authors) > 0 {
+		cdx.Metadata = metadata
+	}
+
+	known := make(map[string]bool, len(spdx.Packages))
+	for _, pkg := range spdx.Packages {
+		known[pkg.SPDXID] = true
+		cdx.Components = append(cdx.Components, spdxPackageToComponent(pkg))
+	}
+
+	deps := make(map[string][]string, len(spdx.Packages))
+	addDep := func(from, to string) {
+		if !known[from] || !known[to] {
+			return
+		}
+		for _, existing := range deps[from] {
+			if existing == to {
+				return
+			}
+		}
+		deps[from] = append(deps[from], to)
+	}
+	for _, rel := range spdx.Relationships {
+		switch rel.RelationshipType {
+		case "DEPENDS_ON":
+			addDep(rel.SpdxElementID, rel.RelatedSpdxElement)
+		case "DEPENDENCY_OF", "OPTIONAL_DEPENDENCY_OF":
+			addDep(rel.RelatedSpdxElement, rel.SpdxElementID)
+		}
+	}
+	for _, pkg := range spdx.Packages {
+		cdx.Dependencies = append(cdx.Dependencies, cdxDependency{
+			Ref:       pkg.SPDXID,
+			DependsOn: deps[pkg.SPDXID],
+		})
+	}
+
+	return json.Marshal(cdx)
+}
+
+func spdxPackageToComponent(pkg spdxPackage) cdxComponent {
+	comp := cdxComponent{
+		Type:    "library",
+		BOMRef:  pkg.SPDXID,
+		Name:    pkg.Name,
+		Version: pkg.VersionInfo,
+	}
+
+	if !spdxNoValue(pkg.Supplier) {
+		_, name, ok := strings.Cut(pkg.Supplier, ":")
+		if !ok {
+			name = pkg.Supplier
+		}
+		comp.Supplier = &cdxActor{Name: strings.TrimSpace(name)}
+	}
+
+	comp.Description = pkg.Summary
+	if comp.Description == "" {
+		comp.Description = pkg.Description
+	}
+
+	for _, checksum := range pkg.Checksums {
+		if alg, ok := spdxToCdxHashAlg[checksum.Algorithm]; ok {
+			comp.Hashes = append(comp.Hashes, cdxHash{Alg: alg, Content: checksum.ChecksumValue})
+		}
+	}
+
+	license := pkg.LicenseDeclared
+	if spdxNoValue(license) {
+		license = pkg.LicenseConcluded
+	}
+	if !spdxNoValue(license) {
+		comp.Licenses = []cdxLicense{{Expression: license}}
+	}
+
+	for _, ref := range pkg.ExternalRefs {
+		if ref.ReferenceType == "purl" && comp.PURL == "" {
+			comp.PURL = ref.ReferenceLocator
+		}
+	}
+
+	if !spdxNoValue(pkg.DownloadLocation) {
+		comp.ExternalReferences = append(comp.ExternalReferences, cdxExternalRef{Type: "distribution", URL: pkg.DownloadLocation})
+	}
+	if !spdxNoValue(pkg.Homepage) {
+		comp.ExternalReferences = append(comp.ExternalReferences, cdxExternalRef{Type: "website", URL: pkg.Homepage})
+	}
+
+	return comp
+}
@@ -0,0 +1,139 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSpdxDoc = json.RawMessage(`{
+  "spdxVersion": "SPDX-2.3",
+  "dataLicense": "CC0-1.0",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "sbom-by-osbuild-depsolve-dnf",
+  "documentNamespace": "https://osbuild.org/spdxdocs/sbom-by-osbuild-depsolve-dnf-1234",
+  "creationInfo": {
+    "created": "2025-01-01T00:00:00Z",
+    "creators": ["Tool: osbuild-depsolve-dnf", "Organization: Red Hat"]
+  },
+  "packages": [
+    {
+      "SPDXID": "SPDXRef-bash",
+      "name": "bash",
+      "versionInfo": "5.2.26-3.fc42",
+      "supplier": "Organization: Fedora Project",
+      "downloadLocation": "https://example.com/bash-5.2.26-3.fc42.x86_64.rpm",
+      "homepage": "https://www.gnu.org/software/bash",
+      "licenseDeclared": "GPL-3.0-or-later",
+      "licenseConcluded": "NOASSERTION",
+      "summary": "The GNU Bourne Again shell",
+      "checksums": [
+        {"algorithm": "SHA256", "checksumValue": "abcd"},
+        {"algorithm": "BLAKE2b-256", "checksumValue": "ef01"}
+      ],
+      "externalRefs": [
+        {
+          "referenceCategory": "PACKAGE-MANAGER",
+          "referenceType": "purl",
+          "referenceLocator": "pkg:rpm/fedora/bash@5.2.26-3.fc42?arch=x86_64"
+        }
+      ]
+    },
+    {
+      "SPDXID": "SPDXRef-glibc",
+      "name": "glibc",
+      "versionInfo": "2.41-1.fc42",
+      "supplier": "NOASSERTION",
+      "downloadLocation": "NOASSERTION",
+      "licenseDeclared": "NOASSERTION",
+      "licenseConcluded": "LGPL-2.1-or-later"
+    }
+  ],
+  "relationships": [
+    {"spdxElementId": "SPDXRef-DOCUMENT", "relatedSpdxElement": "SPDXRef-bash", "relationshipType": "DESCRIBES"},
+    {"spdxElementId": "SPDXRef-bash", "relatedSpdxElement": "SPDXRef-glibc", "relationshipType": "DEPENDS_ON"},
+    {"spdxElementId": "SPDXRef-glibc", "relatedSpdxElement": "SPDXRef-bash", "relationshipType": "OPTIONAL_DEPENDENCY_OF"}
+  ]
+}`)
+
+func TestSpdxToCycloneDX(t *testing.T) {
+	cdx, err := SpdxToCycloneDX(testSpdxDoc)
+	require.NoError(t, err)
+
+	expected := `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "serialNumber": "urn:uuid:8627f676-a9e1-599e-bb69-27849a016a0f",
+  "version": 1,
+  "metadata": {
+    "timestamp": "2025-01-01T00:00:00Z",
+    "tools": {"components": [{"type": "application", "name": "osbuild-depsolve-dnf"}]},
+    "authors": [{"name": "Red Hat"}]
+  },
+  "components": [
+    {
+      "type": "library",
+      "bom-ref": "SPDXRef-bash",
+      "supplier": {"name": "Fedora Project"},
+      "name": "bash",
+      "version": "5.2.26-3.fc42",
+      "description": "The GNU Bourne Again shell",
+      "hashes": [{"alg": "SHA-256", "content": "abcd"}],
+      "licenses": [{"expression": "GPL-3.0-or-later"}],
+      "purl": "pkg:rpm/fedora/bash@5.2.26-3.fc42?arch=x86_64",
+      "externalReferences": [
+        {"type": "distribution", "url": "https://example.com/bash-5.2.26-3.fc42.x86_64.rpm"},
+        {"type": "website", "url": "https://www.gnu.org/software/bash"}
+      ]
+    },
+    {
+      "type": "library",
+      "bom-ref": "SPDXRef-glibc",
+      "name": "glibc",
+      "version": "2.41-1.fc42",
+      "licenses": [{"expression": "LGPL-2.1-or-later"}]
+    }
+  ],
+  "dependencies": [
+    {"ref": "SPDXRef-bash", "dependsOn": ["SPDXRef-glibc"]},
+    {"ref": "SPDXRef-glibc"}
+  ]
+}`
+
+	assert.JSONEq(t, expected, string(cdx))
+
+	// conversion is deterministic
+	cdx2, err := SpdxToCycloneDX(testSpdxDoc)
+	require.NoError(t, err)
+	assert.Equal(t, cdx, cdx2)
+}
+
+func TestSpdxToCycloneDXInvalid(t *testing.T) {
+	_, err := SpdxToCycloneDX(json.RawMessage(`[]`))
+	assert.ErrorContains(t, err, "cannot parse SPDX document")
+}
+
+func TestDocumentConvert(t *testing.T) {
+	doc, err := NewDocument(StandardTypeSpdx, testSpdxDoc)
+	require.NoError(t, err)
+
+	same, err := doc.Convert(StandardTypeSpdx)
+	require.NoError(t, err)
+	assert.Equal(t, doc, same)
+
+	cdx, err := doc.Convert(StandardTypeCycloneDX)
+	require.NoError(t, err)
+	assert.Equal(t, StandardTypeCycloneDX, cdx.DocType)
+	assert.Contains(t, string(cdx.Document), `"bomFormat":"CycloneDX"`)
+
+	_, err = cdx.Convert(StandardTypeSpdx)
+	assert.EqualError(t, err, "unsupported SBOM document conversion: cyclonedx to spdx")
+}
+
+func TestStandardTypeFileExtension(t *testing.T) {
+	assert.Equal(t, "spdx.json", StandardTypeSpdx.FileExtension())
+	assert.Equal(t, "cdx.json", StandardTypeCycloneDX.FileExtension())
+	assert.Panics(t, func() { _ = StandardTypeNone.FileExtension() })
+}
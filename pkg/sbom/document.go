@@ -10,6 +10,7 @@ type StandardType uint64
 const (
 	StandardTypeNone StandardType = iota
 	StandardTypeSpdx
+	StandardTypeCycloneDX
 )
 
 func (t StandardType) String() string {
@@ -18,6 +19,21 @@ func (t StandardType) String() string {
 		return "none"
 	case StandardTypeSpdx:
 		return "spdx"
+	case StandardTypeCycloneDX:
+		return "cyclonedx"
+	default:
+		panic("invalid standard type")
+	}
+}
+
+// FileExtension returns the conventional file extension (without the
+// leading dot) for documents of the given standard type.
+func (t StandardType) FileExtension() string {
+	switch t {
+	case StandardTypeSpdx:
+		return "spdx.json"
+	case StandardTypeCycloneDX:
+		return "cdx.json"
 	default:
 		panic("invalid standard type")
 	}
@@ -41,6 +57,8 @@ func (t *StandardType) UnmarshalJSON(data []byte) error {
 		*t = StandardTypeNone
 	case `"spdx"`:
 		*t = StandardTypeSpdx
+	case `"cyclonedx"`:
+		*t = StandardTypeCycloneDX
 	default:
 		return fmt.Errorf("invalid SBOM standard type: %s", data)
 	}
@@ -57,8 +75,7 @@ type Document struct {
 
 func NewDocument(docType StandardType, doc json.RawMessage) (*Document, error) {
 	switch docType {
-	case StandardTypeSpdx:
-		docType = StandardTypeSpdx
+	case StandardTypeSpdx, StandardTypeCycloneDX:
 	default:
 		return nil, fmt.Errorf("unsupported SBOM document type: %s", docType)
 	}
@@ -68,3 +85,19 @@ func NewDocument(docType StandardType, doc json.RawMessage) (*Document, error) {
 		Document: doc,
 	}, nil
 }
+
+// Convert returns a new document of the given standard type with the same
+// content. Only conversions from SPDX to CycloneDX are supported.
+func (d *Document) Convert(docType StandardType) (*Document, error) {
+	if d.DocType == docType {
+		return d, nil
+	}
+	if d.DocType != StandardTypeSpdx || docType != StandardTypeCycloneDX {
+		return nil, fmt.Errorf("unsupported SBOM document conversion: %s to %s", d.DocType, docType)
+	}
+	doc, err := SpdxToCycloneDX(d.Document)
+	if err != nil {
+		return nil, err
+	}
+	return NewDocument(docType, doc)
+}